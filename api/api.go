@@ -0,0 +1,10 @@
+// Package api embeds the OpenAPI description of the http routes and the page rendering it.
+package api
+
+import _ "embed"
+
+//go:embed openapi.yaml
+var Spec []byte
+
+//go:embed docs.html
+var Docs []byte
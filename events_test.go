@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+)
+
+// decodeEvents reads the messages back as the consumers do
+func decodeEvents(t *testing.T, msgs []producer.Message) []*events.MovieEvent {
+	decoded := make([]*events.MovieEvent, len(msgs))
+	for i, msg := range msgs {
+		decoded[i] = &events.MovieEvent{}
+		require.NoError(t, encoder.Decode(msg.Value, msg.Headers, decoded[i]))
+	}
+	return decoded
+}
+
+func assertEvents(t *testing.T, want []*events.MovieEvent, got []*events.MovieEvent) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.True(t, proto.Equal(want[i], got[i]), "event %d\nwant %v\ngot  %v", i, want[i], got[i])
+	}
+}
+
+func TestEventsOfTheRequests(t *testing.T) {
+	formats := []struct {
+		format      string
+		contentType string
+	}{
+		{format: "protobuf", contentType: encoder.ProtobufContentType},
+		{format: "json", contentType: encoder.JSONContentType},
+		{format: "cloudevents-structured", contentType: encoder.CloudEventsContentType},
+		{format: "cloudevents-binary", contentType: encoder.JSONContentType},
+	}
+
+	for _, tc := range formats {
+		t.Run(tc.format, func(t *testing.T) {
+			s := newTestServer(t, tc.format)
+			kafka := s.kafka
+			router := s.router()
+
+			requests := []struct {
+				method string
+				path   string
+				body   string
+				status int
+			}{
+				{method: "POST", path: "/movies", status: http.StatusOK,
+					body: `{"isbn": "9788401490040", "title": "Jaws", "director": "Steven Spielberg", "external_ids": {"imdb": "tt0073195"}, "translations": [{"language": "pt-br", "title": "Tubarão"}]}`},
+				{method: "POST", path: "/movies", body: `{"isbn": "9780000000002", "title": "Alien", "director": "Ridley Scott"}`, status: http.StatusOK},
+				{method: "PUT", path: "/movies/2", body: `{"isbn": "9780000000002", "title": "Aliens", "director": "James Cameron"}`, status: http.StatusOK},
+				{method: "PUT", path: "/movies/isbn/9780000000019", body: `{"title": "Heat", "director": "Michael Mann"}`, status: http.StatusCreated},
+				{method: "PUT", path: "/movies/isbn/9780000000019", body: `{"title": "Heat", "director": "Michael Mann (1995)"}`, status: http.StatusOK},
+				{method: "POST", path: "/movies:batch", status: http.StatusOK,
+					body: `{"operations": [{"op": "create", "movie": {"isbn": "9780000000026", "title": "Ran"}}, {"op": "delete", "id": 2}, {"op": "create", "movie": {"isbn": "9780000000033", "title": "Seven"}}]}`},
+				{method: "DELETE", path: "/movies/1", status: http.StatusOK},
+			}
+			for _, req := range requests {
+				rec := apitest.Send(t, router, req.method, req.path, req.body, nil)
+				require.Equal(t, req.status, rec.Code, "%s %s %s", req.method, req.path, rec.Body.String())
+			}
+
+			// every change is sent in the order of the requests, the operations of a batch in their order
+			msgs := kafka.Messages()
+			sent := decodeEvents(t, msgs)
+			assertEvents(t, []*events.MovieEvent{
+				{Id: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg", TenantId: "default", Change: "created",
+					ExternalIds: map[string]string{"imdb": "tt0073195"}, Translations: map[string]*events.Translation{"pt-BR": {Title: "Tubarão"}}},
+				{Id: 2, Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott", TenantId: "default", Change: "created"},
+				{Id: 2, Isbn: "9780000000002", Title: "Aliens", Director: "James Cameron", TenantId: "default", Change: "updated"},
+				{Id: 3, Isbn: "9780000000019", Title: "Heat", Director: "Michael Mann", TenantId: "default", Change: "created"},
+				{Id: 3, Isbn: "9780000000019", Title: "Heat", Director: "Michael Mann (1995)", TenantId: "default", Change: "updated"},
+				{Id: 4, Isbn: "9780000000026", Title: "Ran", TenantId: "default", Change: "created"},
+				{Id: 2, TenantId: "default", Change: "deleted"},
+				{Id: 5, Isbn: "9780000000033", Title: "Seven", TenantId: "default", Change: "created"},
+				{Id: 1, TenantId: "default", Change: "deleted"},
+			}, sent)
+
+			for i, msg := range msgs {
+				assert.Equal(t, fmt.Sprintf("default/%d", sent[i].Id), string(msg.Key))
+				assert.Equal(t, "default", msg.Headers[encoder.TenantHeader])
+				assert.True(t, strings.HasPrefix(msg.Headers["content-type"], tc.contentType), msg.Headers["content-type"])
+			}
+		})
+	}
+}
+
+func TestEventsWhenKafkaFails(t *testing.T) {
+	down := errors.New("broker is down")
+	failing := map[string]bool{"default/1": true, "default/3": true}
+	s := newTestServer(t, "protobuf")
+	kafka := s.kafka
+	kafka.Fail = func(msg producer.Message) error {
+		if failing[string(msg.Key)] {
+			return down
+		}
+		return nil
+	}
+	router := s.router()
+
+	// the movie is kept without its event, a reindex sends it again
+	rec := apitest.Send(t, router, "POST", "/movies", `{"isbn": "9788401490040", "title": "Jaws", "director": "Steven Spielberg"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err := s.tenants.movies("default").GetMovieById(1)
+	assert.NoError(t, err)
+	assert.Empty(t, kafka.Messages())
+
+	// a batch stops producing at the first event that fails, as the kafka producer does
+	rec = apitest.Send(t, router, "POST", "/movies:batch", `{"operations": [`+
+		`{"op": "create", "movie": {"isbn": "9780000000002", "title": "Alien"}}, `+
+		`{"op": "create", "movie": {"isbn": "9780000000019", "title": "Heat"}}, `+
+		`{"op": "create", "movie": {"isbn": "9780000000026", "title": "Ran"}}]}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assertEvents(t, []*events.MovieEvent{
+		{Id: 2, Isbn: "9780000000002", Title: "Alien", TenantId: "default", Change: "created"},
+	}, decodeEvents(t, kafka.Messages()))
+
+	kafka.Fail = nil
+	kafka.Reset()
+	rec = apitest.Send(t, router, "POST", "/movies", `{"isbn": "9780000000033", "title": "Seven", "director": "David Fincher"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assertEvents(t, []*events.MovieEvent{
+		{Id: 5, Isbn: "9780000000033", Title: "Seven", Director: "David Fincher", TenantId: "default", Change: "created"},
+	}, decodeEvents(t, kafka.Messages()))
+}
+
+// TestEventsOfConcurrentRequests checks that every movie created gets one event, sent before the response
+func TestEventsOfConcurrentRequests(t *testing.T) {
+	s := newTestServer(t, "protobuf")
+	kafka := s.kafka
+	kafka.Latency = 10 * time.Millisecond
+	router := s.router()
+
+	isbns := []string{"9780000000002", "9780000000019", "9780000000026", "9780000000033",
+		"9780000000040", "9780000000057", "9780000000064", "9780000000071"}
+	const requests = 8
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := apitest.Send(t, router, "POST", "/movies", fmt.Sprintf(`{"isbn": "%s", "title": "Movie %d"}`, isbns[i], i), nil)
+			if !assert.Equal(t, http.StatusOK, rec.Code) {
+				return
+			}
+
+			var created struct {
+				ID int64 `json:"id"`
+			}
+			if !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created)) {
+				return
+			}
+
+			sent := false
+			for _, msg := range kafka.Messages() {
+				sent = sent || string(msg.Key) == fmt.Sprintf("default/%d", created.ID)
+			}
+			assert.True(t, sent, "no event for movie %d", created.ID)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int64]bool{}
+	for _, event := range decodeEvents(t, kafka.Messages()) {
+		assert.False(t, seen[event.Id], "two events for movie %d", event.Id)
+		seen[event.Id] = true
+	}
+	assert.Len(t, seen, requests)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/config"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/media"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/sqlite"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the responses")
+
+// testServer is the server of main with STORAGE=memory, its events being produced to kafka in format.
+// The features that keep their data in mysql answer 501 on it, as they do on every storage but mysql.
+type testServer struct {
+	*server
+	movies      *repository.MemoryDB
+	kafka       *producer.MemoryProducer
+	broadcaster *changes.Broadcaster
+}
+
+func newTestServer(t *testing.T, format string) *testServer {
+	movies := &repository.MemoryDB{}
+	return newServerOf(t, format, func(tenantId string) repository.MoviesRepository {
+		return &repository.MemoryRepository{DB: movies, Tenant: tenantId}
+	}, movies)
+}
+
+// newFailingServer keeps the movies in a database that is down
+func newFailingServer(t *testing.T) *testServer {
+	db, err := sqlite.GetSQLiteDB(filepath.Join(t.TempDir(), "movies.db"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	return newServerOf(t, "protobuf", func(tenantId string) repository.MoviesRepository {
+		return &repository.Repository{DB: db, Tenant: tenantId, Dialect: repository.SQLite}
+	}, nil)
+}
+
+func newServerOf(t *testing.T, format string, moviesRepository func(tenantId string) repository.MoviesRepository, movies *repository.MemoryDB) *testServer {
+	eventEncoder, err := encoder.GetEventEncoder(format, nil)
+	require.NoError(t, err)
+
+	cfg := config.Config{
+		Storage:            "memory",
+		BatchMaxOperations: 3,
+		JobsDir:            t.TempDir(),
+		MediaDir:           t.TempDir(),
+		MediaBaseURL:       "/media",
+		PosterMaxBytes:     1024 * 1024,
+		DefaultTenant:      "default",
+		DefaultLanguage:    "en",
+	}
+	kafka := &producer.MemoryProducer{}
+	broadcaster := &changes.Broadcaster{}
+	localMedia := &media.LocalStore{Dir: cfg.MediaDir, BaseURL: cfg.MediaBaseURL}
+
+	return &testServer{
+		server: &server{
+			cfg: cfg,
+			tenants: &catalogues{
+				repository:      moviesRepository,
+				kafkaProducer:   kafka,
+				reviewsProducer: kafka,
+				encoder:         eventEncoder,
+				reviewsEncoder:  eventEncoder,
+				broadcaster:     broadcaster,
+				blobs:           localMedia,
+				cfg:             cfg,
+			},
+			resolver:        &tenant.Resolver{Default: cfg.DefaultTenant},
+			spec:            apitest.Spec,
+			defaultLanguage: cfg.DefaultLanguage,
+			localMedia:      localMedia,
+			broadcaster:     broadcaster,
+		},
+		movies:      movies,
+		kafka:       kafka,
+		broadcaster: broadcaster,
+	}
+}
+
+// assertGolden compares body with testdata/<name>.golden, which go test -update rewrites
+func assertGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, body, 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create the golden file")
+	assert.Equal(t, string(want), string(body))
+}
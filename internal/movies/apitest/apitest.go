@@ -0,0 +1,53 @@
+// Package apitest sends the requests of the route and controller tests, checking their responses
+// against the OpenAPI description of the routes.
+package apitest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/api"
+	"github.com/iamthiago/movies-crud/internal/movies/openapi"
+)
+
+// Spec describes the routes, the responses of the tests are checked against it
+var Spec = func() *openapi.Spec {
+	spec, err := openapi.GetSpec(api.Spec)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}()
+
+// Send sends a request through the router, body and headers being optional,
+// and checks that the response is the one described for the route.
+// Bodies are sent as json unless headers say otherwise.
+func Send(t *testing.T, router http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// the router answers the methods it doesn't route by itself
+	if rec.Code != http.StatusMethodNotAllowed {
+		assert.NoError(t, Spec.ValidateResponse(req, rec.Code, rec.Header(), rec.Body.Bytes()), "%s %s", method, path)
+	}
+	return rec
+}
@@ -0,0 +1,261 @@
+package availability
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var (
+	ErrReleaseNotFound  = errors.New("no such release")
+	ErrWindowNotFound   = errors.New("no such availability window")
+	ErrDuplicateRelease = errors.New("the movie already has a release of this type in the country")
+)
+
+const (
+	duplicateEntry = 1062
+	// noReferencedRow is returned when the movie of a release or window doesn't exist
+	noReferencedRow = 1452
+)
+
+// AvailabilityRepository keeps where and when the movies come out and can be watched.
+// The releases and windows of deleted movies are removed along with them by the foreign key.
+type AvailabilityRepository interface {
+	GetReleases(movieId int64) ([]models.Release, error)
+	CreateRelease(release *models.Release) (*models.Release, error)
+	UpdateRelease(release *models.Release) (*models.Release, error)
+	DeleteRelease(movieId int64, id int64) error
+	GetWindows(movieId int64) ([]models.AvailabilityWindow, error)
+	CreateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error)
+	// UpdateWindow announces the window again when its start or end changes
+	UpdateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error)
+	DeleteWindow(movieId int64, id int64) error
+	// GetAvailableMovieIds returns the movies with a window open in the region at some time between from and to
+	GetAvailableMovieIds(region string, from time.Time, to time.Time) (map[int64]bool, error)
+}
+
+// Repository keeps the releases and windows of the movies of one tenant.
+type Repository struct {
+	DB     *sql.DB
+	Tenant string
+}
+
+func (r *Repository) GetReleases(movieId int64) ([]models.Release, error) {
+	if err := r.movieExists(movieId); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query("select id, movie_id, country, release_date, type from releases where tenant_id = ? and movie_id = ? order by release_date, country, type", r.Tenant, movieId)
+	if err != nil {
+		return nil, fmt.Errorf("getReleases %v", err)
+	}
+	defer rows.Close()
+
+	var releases []models.Release
+	for rows.Next() {
+		var release models.Release
+		var date time.Time
+		if err := rows.Scan(&release.ID, &release.MovieID, &release.Country, &date, &release.Type); err != nil {
+			return nil, fmt.Errorf("getReleases %v", err)
+		}
+		release.Date = date.Format(models.DateLayout)
+		releases = append(releases, release)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getReleases %v", err)
+	}
+
+	return releases, nil
+}
+
+func (r *Repository) CreateRelease(release *models.Release) (*models.Release, error) {
+	res, err := r.DB.Exec("insert into releases (tenant_id, movie_id, country, release_date, type) values (?, ?, ?, ?, ?)",
+		r.Tenant, release.MovieID, release.Country, release.Date, release.Type)
+	if err != nil {
+		return nil, releaseError("create release", release.MovieID, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get release last inserted id %v", err)
+	}
+
+	release.ID = id
+	return release, nil
+}
+
+func (r *Repository) UpdateRelease(release *models.Release) (*models.Release, error) {
+	res, err := r.DB.Exec("update releases set country = ?, release_date = ?, type = ? where id = ? and movie_id = ? and tenant_id = ?",
+		release.Country, release.Date, release.Type, release.ID, release.MovieID, r.Tenant)
+	if err != nil {
+		return nil, releaseError("update release", release.MovieID, err)
+	}
+
+	if err := found(res, fmt.Sprintf("update release %d", release.ID), ErrReleaseNotFound); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+func (r *Repository) DeleteRelease(movieId int64, id int64) error {
+	res, err := r.DB.Exec("delete from releases where id = ? and movie_id = ? and tenant_id = ?", id, movieId, r.Tenant)
+	if err != nil {
+		return fmt.Errorf("delete release %d: %v", id, err)
+	}
+	return found(res, fmt.Sprintf("delete release %d", id), ErrReleaseNotFound)
+}
+
+const windowColumns = "id, movie_id, region, platform, starts_at, ends_at"
+
+func (r *Repository) GetWindows(movieId int64) ([]models.AvailabilityWindow, error) {
+	if err := r.movieExists(movieId); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query("select "+windowColumns+" from availability_windows where tenant_id = ? and movie_id = ? order by starts_at, region, platform", r.Tenant, movieId)
+	if err != nil {
+		return nil, fmt.Errorf("getWindows %v", err)
+	}
+	defer rows.Close()
+
+	windows, err := scanWindows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("getWindows %v", err)
+	}
+	return windows, nil
+}
+
+func (r *Repository) CreateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error) {
+	res, err := r.DB.Exec("insert into availability_windows (tenant_id, movie_id, region, platform, starts_at, ends_at) values (?, ?, ?, ?, ?, ?)",
+		r.Tenant, window.MovieID, window.Region, window.Platform, window.Start.UTC(), utc(window.End))
+	if err != nil {
+		if isError(err, noReferencedRow) {
+			return nil, fmt.Errorf("create window of movie %d: %w", window.MovieID, repository.ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("create window: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get window last inserted id %v", err)
+	}
+
+	window.ID = id
+	return window, nil
+}
+
+func (r *Repository) UpdateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error) {
+	// the flags are set before the times, so they are compared with the times being replaced
+	res, err := r.DB.Exec("update availability_windows set "+
+		"opened_notified = opened_notified and starts_at = ?, closed_notified = closed_notified and ends_at <=> ?, "+
+		"region = ?, platform = ?, starts_at = ?, ends_at = ? where id = ? and movie_id = ? and tenant_id = ?",
+		window.Start.UTC(), utc(window.End), window.Region, window.Platform, window.Start.UTC(), utc(window.End), window.ID, window.MovieID, r.Tenant)
+	if err != nil {
+		return nil, fmt.Errorf("update window %d: %v", window.ID, err)
+	}
+
+	if err := found(res, fmt.Sprintf("update window %d", window.ID), ErrWindowNotFound); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+func (r *Repository) DeleteWindow(movieId int64, id int64) error {
+	res, err := r.DB.Exec("delete from availability_windows where id = ? and movie_id = ? and tenant_id = ?", id, movieId, r.Tenant)
+	if err != nil {
+		return fmt.Errorf("delete window %d: %v", id, err)
+	}
+	return found(res, fmt.Sprintf("delete window %d", id), ErrWindowNotFound)
+}
+
+func (r *Repository) GetAvailableMovieIds(region string, from time.Time, to time.Time) (map[int64]bool, error) {
+	rows, err := r.DB.Query("select distinct movie_id from availability_windows where tenant_id = ? and region = ? and starts_at < ? and (ends_at is null or ends_at > ?)",
+		r.Tenant, region, to.UTC(), from.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("getAvailableMovieIds %v", err)
+	}
+	defer rows.Close()
+
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("getAvailableMovieIds %v", err)
+		}
+		ids[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getAvailableMovieIds %v", err)
+	}
+
+	return ids, nil
+}
+
+func (r *Repository) movieExists(movieId int64) error {
+	var id int64
+	if err := r.DB.QueryRow("select id from movies where id = ? and tenant_id = ?", movieId, r.Tenant).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("movie %d: %w", movieId, repository.ErrMovieNotFound)
+		}
+		return fmt.Errorf("movie %d: %v", movieId, err)
+	}
+	return nil
+}
+
+func releaseError(operation string, movieId int64, err error) error {
+	switch {
+	case isError(err, duplicateEntry):
+		return fmt.Errorf("%s: %w", operation, ErrDuplicateRelease)
+	case isError(err, noReferencedRow):
+		return fmt.Errorf("%s of movie %d: %w", operation, movieId, repository.ErrMovieNotFound)
+	}
+	return fmt.Errorf("%s: %v", operation, err)
+}
+
+// found returns notFound when the statement changed no row
+func found(res sql.Result, operation string, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %v", operation, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, notFound)
+	}
+	return nil
+}
+
+func isError(err error, number uint16) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == number
+}
+
+func scanWindows(rows *sql.Rows) ([]models.AvailabilityWindow, error) {
+	var windows []models.AvailabilityWindow
+	for rows.Next() {
+		var window models.AvailabilityWindow
+		var end sql.NullTime
+		if err := rows.Scan(&window.ID, &window.MovieID, &window.Region, &window.Platform, &window.Start, &end); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			window.End = &end.Time
+		}
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+func utc(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
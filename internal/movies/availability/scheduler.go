@@ -0,0 +1,219 @@
+package availability
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	Opened = "opened"
+	Closed = "closed"
+)
+
+// scheduleBatch is how many windows are announced per query
+const scheduleBatch = 100
+
+// Schedule finds the windows of every tenant that opened or closed and were not announced yet.
+type Schedule interface {
+	GetDueOpenings(now time.Time, limit int) ([]models.AvailabilityWindow, error)
+	// GetDueClosings only returns the windows whose opening was announced
+	GetDueClosings(now time.Time, limit int) ([]models.AvailabilityWindow, error)
+	// MarkOpened and MarkClosed tell whether the caller is the one announcing the window,
+	// so each change is sent once when many instances run the scheduler
+	MarkOpened(id int64) (bool, error)
+	MarkClosed(id int64) (bool, error)
+	// SkipClosed marks the windows that closed before they were announced, which are never announced
+	SkipClosed(now time.Time) error
+}
+
+// ScheduleRepository is not scoped to a tenant, the windows it returns carry their tenant.
+type ScheduleRepository struct {
+	DB *sql.DB
+}
+
+func (r *ScheduleRepository) GetDueOpenings(now time.Time, limit int) ([]models.AvailabilityWindow, error) {
+	return r.getWindows("getDueOpenings", "opened_notified = false and starts_at <= ? and (ends_at is null or ends_at > ?) order by starts_at limit ?",
+		now.UTC(), now.UTC(), limit)
+}
+
+func (r *ScheduleRepository) GetDueClosings(now time.Time, limit int) ([]models.AvailabilityWindow, error) {
+	return r.getWindows("getDueClosings", "opened_notified = true and closed_notified = false and ends_at <= ? order by ends_at limit ?", now.UTC(), limit)
+}
+
+func (r *ScheduleRepository) MarkOpened(id int64) (bool, error) {
+	return r.mark("markOpened", "update availability_windows set opened_notified = true where id = ? and opened_notified = false", id)
+}
+
+func (r *ScheduleRepository) MarkClosed(id int64) (bool, error) {
+	return r.mark("markClosed", "update availability_windows set closed_notified = true where id = ? and closed_notified = false", id)
+}
+
+func (r *ScheduleRepository) SkipClosed(now time.Time) error {
+	_, err := r.DB.Exec("update availability_windows set opened_notified = true, closed_notified = true where opened_notified = false and ends_at <= ?", now.UTC())
+	if err != nil {
+		return fmt.Errorf("skipClosed %v", err)
+	}
+	return nil
+}
+
+func (r *ScheduleRepository) getWindows(operation string, where string, args ...interface{}) ([]models.AvailabilityWindow, error) {
+	rows, err := r.DB.Query("select tenant_id, "+windowColumns+" from availability_windows where "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", operation, err)
+	}
+	defer rows.Close()
+
+	var windows []models.AvailabilityWindow
+	for rows.Next() {
+		var window models.AvailabilityWindow
+		var end sql.NullTime
+		if err := rows.Scan(&window.Tenant, &window.ID, &window.MovieID, &window.Region, &window.Platform, &window.Start, &end); err != nil {
+			return nil, fmt.Errorf("%s %v", operation, err)
+		}
+		if end.Valid {
+			window.End = &end.Time
+		}
+		windows = append(windows, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s %v", operation, err)
+	}
+	return windows, nil
+}
+
+func (r *ScheduleRepository) mark(operation string, query string, id int64) (bool, error) {
+	res, err := r.DB.Exec(query, id)
+	if err != nil {
+		return false, fmt.Errorf("%s %d: %v", operation, id, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s %d: %v", operation, id, err)
+	}
+	return affected == 1, nil
+}
+
+// Scheduler sends an AvailabilityChanged event when a window opens or closes.
+// Windows are checked every Interval, so events are sent up to an Interval late.
+type Scheduler struct {
+	Schedule      Schedule
+	KafkaProducer producer.KafkaProducer
+	// Encoder writes the events in the configured format, protobuf when nil
+	Encoder  encoder.EventEncoder
+	Interval time.Duration
+	// Now is the time the windows are checked against, time.Now when nil
+	Now func() time.Time
+}
+
+func GetScheduler(schedule Schedule, kafkaProducer producer.KafkaProducer, eventEncoder encoder.EventEncoder) *Scheduler {
+	return &Scheduler{
+		Schedule:      schedule,
+		KafkaProducer: kafkaProducer,
+		Encoder:       eventEncoder,
+		Interval:      time.Minute,
+	}
+}
+
+// Run announces the windows every Interval until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Announce(); err != nil {
+			log.Println("Error announcing availability windows", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Announce sends the events of the windows that opened or closed since they were last checked.
+// A window is marked as announced before its event is sent, so events that fail to send are not retried.
+func (s *Scheduler) Announce() error {
+	now := s.now()
+
+	if err := s.Schedule.SkipClosed(now); err != nil {
+		return err
+	}
+	if err := s.announce(now, Opened, s.Schedule.GetDueOpenings, s.Schedule.MarkOpened); err != nil {
+		return err
+	}
+	return s.announce(now, Closed, s.Schedule.GetDueClosings, s.Schedule.MarkClosed)
+}
+
+func (s *Scheduler) announce(now time.Time, change string, due func(time.Time, int) ([]models.AvailabilityWindow, error), mark func(int64) (bool, error)) error {
+	for {
+		windows, err := due(now, scheduleBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, window := range windows {
+			marked, err := mark(window.ID)
+			if err != nil {
+				return err
+			}
+			if marked {
+				s.send(window, change)
+			}
+		}
+
+		if len(windows) < scheduleBatch {
+			return nil
+		}
+	}
+}
+
+func (s *Scheduler) send(window models.AvailabilityWindow, change string) {
+	event := &events.AvailabilityChanged{
+		WindowId: window.ID,
+		MovieId:  window.MovieID,
+		Region:   window.Region,
+		Platform: window.Platform,
+		Change:   change,
+		StartsAt: window.Start.UTC().Format(time.RFC3339),
+		TenantId: window.Tenant,
+	}
+	if window.End != nil {
+		event.EndsAt = window.End.UTC().Format(time.RFC3339)
+	}
+
+	msg, err := s.encoder().Encode(event)
+	if err != nil {
+		log.Println("Failed to encode availability event", err)
+		return
+	}
+
+	if err := s.KafkaProducer.SendMovieEvent(msg); err != nil {
+		log.Println("Failed to send availability event", err)
+	}
+}
+
+func (s *Scheduler) encoder() encoder.EventEncoder {
+	if s.Encoder == nil {
+		return &encoder.ProtobufEncoder{}
+	}
+	return s.Encoder
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
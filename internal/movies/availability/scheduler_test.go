@@ -0,0 +1,196 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type scheduledWindow struct {
+	window         models.AvailabilityWindow
+	openedNotified bool
+	closedNotified bool
+}
+
+// fakeSchedule keeps the windows and their flags like the availability_windows table
+type fakeSchedule struct {
+	windows []*scheduledWindow
+}
+
+func (f *fakeSchedule) GetDueOpenings(now time.Time, limit int) ([]models.AvailabilityWindow, error) {
+	return f.due(limit, func(w *scheduledWindow) bool {
+		return !w.openedNotified && w.window.IsOpen(now)
+	}), nil
+}
+
+func (f *fakeSchedule) GetDueClosings(now time.Time, limit int) ([]models.AvailabilityWindow, error) {
+	return f.due(limit, func(w *scheduledWindow) bool {
+		return w.openedNotified && !w.closedNotified && w.window.End != nil && !now.Before(*w.window.End)
+	}), nil
+}
+
+func (f *fakeSchedule) MarkOpened(id int64) (bool, error) {
+	w := f.find(id)
+	marked := !w.openedNotified
+	w.openedNotified = true
+	return marked, nil
+}
+
+func (f *fakeSchedule) MarkClosed(id int64) (bool, error) {
+	w := f.find(id)
+	marked := !w.closedNotified
+	w.closedNotified = true
+	return marked, nil
+}
+
+func (f *fakeSchedule) SkipClosed(now time.Time) error {
+	for _, w := range f.windows {
+		if !w.openedNotified && w.window.End != nil && !now.Before(*w.window.End) {
+			w.openedNotified = true
+			w.closedNotified = true
+		}
+	}
+	return nil
+}
+
+func (f *fakeSchedule) due(limit int, match func(*scheduledWindow) bool) []models.AvailabilityWindow {
+	var windows []models.AvailabilityWindow
+	for _, w := range f.windows {
+		if match(w) && len(windows) < limit {
+			windows = append(windows, w.window)
+		}
+	}
+	return windows
+}
+
+func (f *fakeSchedule) find(id int64) *scheduledWindow {
+	for _, w := range f.windows {
+		if w.window.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+type fakeProducer struct {
+	msgs []producer.Message
+}
+
+func (f *fakeProducer) SendMovieEvent(msg producer.Message) error {
+	f.msgs = append(f.msgs, msg)
+	return nil
+}
+
+func (f *fakeProducer) SendMovieEvents(msgs []producer.Message) error {
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func decodeEvent(t *testing.T, msg producer.Message) *events.AvailabilityChanged {
+	var event events.AvailabilityChanged
+	assert.NoError(t, encoder.Decode(msg.Value, msg.Headers, &event))
+	return &event
+}
+
+func date(day int, hour int) time.Time {
+	return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestAnnounce(t *testing.T) {
+	end := date(20, 0)
+	testCases := []struct {
+		name        string
+		now         time.Time
+		then        time.Time
+		encoder     encoder.EventEncoder
+		wantChanges []string
+	}{
+		{
+			name: "Should not announce a window before it opens",
+			now:  date(17, 23),
+		},
+		{
+			name:        "Should announce a window when it opens",
+			now:         date(18, 0),
+			wantChanges: []string{Opened},
+		},
+		{
+			name:        "Should announce a window in json",
+			now:         date(18, 0),
+			encoder:     &encoder.JSONEncoder{},
+			wantChanges: []string{Opened},
+		},
+		{
+			name:        "Should announce a window as a cloud event",
+			now:         date(18, 0),
+			encoder:     &encoder.CloudEventsEncoder{Mode: encoder.Structured, Data: &encoder.JSONEncoder{}},
+			wantChanges: []string{Opened},
+		},
+		{
+			name:        "Should announce a window when it opens and closes",
+			now:         date(18, 0),
+			then:        end,
+			wantChanges: []string{Opened, Closed},
+		},
+		{
+			name: "Should not announce a window that closed before it was announced",
+			now:  date(20, 0),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule := &fakeSchedule{windows: []*scheduledWindow{
+				{window: models.AvailabilityWindow{ID: 1, MovieID: 7, Region: "BR", Platform: "streamflix", Start: date(18, 0), End: &end, Tenant: "studio-a"}},
+			}}
+			kafka := &fakeProducer{}
+			now := tc.now
+			scheduler := GetScheduler(schedule, kafka, tc.encoder)
+			scheduler.Now = func() time.Time { return now }
+
+			assert.NoError(t, scheduler.Announce())
+			// announcing again sends nothing new
+			assert.NoError(t, scheduler.Announce())
+			// then is when the window is checked again, if it is
+			if !tc.then.IsZero() {
+				now = tc.then
+				assert.NoError(t, scheduler.Announce())
+			}
+
+			var changes []string
+			for _, msg := range kafka.msgs {
+				assert.Equal(t, "studio-a/7", string(msg.Key))
+				event := decodeEvent(t, msg)
+				assert.Equal(t, int64(1), event.WindowId)
+				assert.Equal(t, "BR", event.Region)
+				assert.Equal(t, "2026-10-18T00:00:00Z", event.StartsAt)
+				assert.Equal(t, "2026-10-20T00:00:00Z", event.EndsAt)
+				assert.Equal(t, "studio-a", event.TenantId)
+				changes = append(changes, event.Change)
+			}
+			assert.Equal(t, tc.wantChanges, changes)
+		})
+	}
+}
+
+func TestAnnounceMoreThanABatch(t *testing.T) {
+	schedule := &fakeSchedule{}
+	for i := 1; i <= scheduleBatch+1; i++ {
+		schedule.windows = append(schedule.windows, &scheduledWindow{
+			window: models.AvailabilityWindow{ID: int64(i), MovieID: int64(i), Region: "US", Platform: "cinema", Start: date(18, 0)},
+		})
+	}
+	kafka := &fakeProducer{}
+	scheduler := GetScheduler(schedule, kafka, nil)
+	scheduler.Now = func() time.Time { return date(19, 0) }
+
+	assert.NoError(t, scheduler.Announce())
+	assert.Len(t, kafka.msgs, scheduleBatch+1)
+	assert.Empty(t, decodeEvent(t, kafka.msgs[0]).EndsAt)
+}
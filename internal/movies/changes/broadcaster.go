@@ -0,0 +1,137 @@
+package changes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type Type string
+
+const (
+	Created Type = "created"
+	Updated Type = "updated"
+	Deleted Type = "deleted"
+)
+
+type Change struct {
+	ID     uint64       `json:"id"`
+	Type   Type         `json:"type"`
+	Movie  models.Movie `json:"movie"`
+	Time   time.Time    `json:"time"`
+	Tenant string       `json:"-"`
+}
+
+const (
+	// subscriberBuffer is how many changes a subscriber can lag behind before it gets dropped
+	subscriberBuffer = 64
+	// DefaultReplaySize is how many past changes are kept for subscribers resuming from an id
+	DefaultReplaySize = 256
+)
+
+// Broadcaster fans out movie changes to in-process subscribers.
+// A subscriber that can't keep up has its channel closed instead of blocking the publisher.
+// The last ReplaySize changes are kept so a subscriber can resume from the last change it saw.
+// Subscribers only get the changes of their tenant, those without one get the changes of every tenant.
+// The ids of the changes are numbered from the time the broadcaster is first used, in microseconds,
+// so the ids of a previous process are behind the ones of the current one and clients resuming from them
+// are told they missed changes.
+type Broadcaster struct {
+	ReplaySize int
+
+	mu          sync.Mutex
+	lastId      uint64
+	replay      []Change
+	subscribers map[chan Change]string
+}
+
+func (b *Broadcaster) Publish(tenant string, t Type, movie models.Movie) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.start()
+	b.lastId++
+	change := Change{ID: b.lastId, Type: t, Movie: movie, Time: time.Now().UTC(), Tenant: tenant}
+
+	b.replay = append(b.replay, change)
+	if len(b.replay) > b.replaySize() {
+		b.replay = b.replay[len(b.replay)-b.replaySize():]
+	}
+
+	for ch, subscriber := range b.subscribers {
+		if !sameTenant(subscriber, change) {
+			continue
+		}
+
+		select {
+		case ch <- change:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of the changes of the tenant and a function to stop receiving them.
+func (b *Broadcaster) Subscribe(tenant string) (<-chan Change, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(tenant)
+}
+
+// SubscribeFrom works like Subscribe, also returning the changes published after lastId.
+// complete is false when some of those changes are no longer in the replay buffer.
+func (b *Broadcaster) SubscribeFrom(tenant string, lastId uint64) (missed []Change, complete bool, ch <-chan Change, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.start()
+	// an id ahead of the last change was not published by this process
+	complete = lastId == b.lastId || (lastId < b.lastId && len(b.replay) > 0 && b.replay[0].ID <= lastId+1)
+	for _, change := range b.replay {
+		if change.ID > lastId && sameTenant(tenant, change) {
+			missed = append(missed, change)
+		}
+	}
+
+	ch, unsubscribe = b.subscribe(tenant)
+	return
+}
+
+func (b *Broadcaster) subscribe(tenant string) (<-chan Change, func()) {
+	ch := make(chan Change, subscriberBuffer)
+
+	if b.subscribers == nil {
+		b.subscribers = map[chan Change]string{}
+	}
+	b.subscribers[ch] = tenant
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Broadcaster) start() {
+	if b.lastId == 0 {
+		b.lastId = uint64(time.Now().UnixMicro())
+	}
+}
+
+func sameTenant(tenant string, change Change) bool {
+	return tenant == "" || tenant == change.Tenant
+}
+
+func (b *Broadcaster) replaySize() int {
+	if b.ReplaySize <= 0 {
+		return DefaultReplaySize
+	}
+	return b.ReplaySize
+}
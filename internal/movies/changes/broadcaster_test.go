@@ -0,0 +1,120 @@
+package changes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	b := Broadcaster{}
+	ch, unsubscribe := b.Subscribe("")
+
+	b.Publish("studio-a", Created, models.Movie{ID: 1, Title: "Jaws"})
+	b.Publish("studio-a", Deleted, models.Movie{ID: 1})
+
+	first := <-ch
+	assert.Equal(t, Created, first.Type)
+	assert.Equal(t, "Jaws", first.Movie.Title)
+
+	second := <-ch
+	assert.Equal(t, first.ID+1, second.ID)
+	assert.Equal(t, Deleted, second.Type)
+
+	unsubscribe()
+	_, open := <-ch
+	assert.False(t, open)
+
+	// unsubscribing twice is harmless
+	unsubscribe()
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	previous := Broadcaster{}
+	previous.Publish("studio-a", Updated, models.Movie{ID: 1})
+	previousId := previous.lastId
+	// the broadcaster of the next process starts later
+	time.Sleep(time.Millisecond)
+
+	b := Broadcaster{ReplaySize: 3}
+	ch, unsubscribe := b.Subscribe("")
+	for i := 1; i <= 5; i++ {
+		b.Publish("studio-a", Updated, models.Movie{ID: int64(i)})
+	}
+	unsubscribe()
+
+	// the ids of the changes, by the id of their movie
+	id := map[int64]uint64{}
+	for change := range ch {
+		id[change.Movie.ID] = change.ID
+	}
+
+	testCases := []struct {
+		name         string
+		lastId       uint64
+		wantMissed   []int64
+		wantComplete bool
+	}{
+		{name: "Should replay the changes after the last id", lastId: id[3], wantMissed: []int64{4, 5}, wantComplete: true},
+		{name: "Should replay the whole buffer right after its start", lastId: id[2], wantMissed: []int64{3, 4, 5}, wantComplete: true},
+		{name: "Should flag a gap when changes fell out of the buffer", lastId: id[1], wantMissed: []int64{3, 4, 5}, wantComplete: false},
+		{name: "Should replay nothing when up to date", lastId: id[5], wantMissed: nil, wantComplete: true},
+		{name: "Should flag a gap for an id of a previous process", lastId: previousId, wantMissed: []int64{3, 4, 5}, wantComplete: false},
+		{name: "Should flag a gap for an id not published yet", lastId: id[5] + 10, wantMissed: nil, wantComplete: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			missed, complete, _, unsubscribe := b.SubscribeFrom("", tc.lastId)
+			defer unsubscribe()
+
+			var movies []int64
+			for _, c := range missed {
+				movies = append(movies, c.Movie.ID)
+			}
+			assert.Equal(t, tc.wantMissed, movies)
+			assert.Equal(t, tc.wantComplete, complete)
+		})
+	}
+
+	// a broadcaster without changes yet knows an id of a previous process is not up to date
+	missed, complete, _, unsubscribe := (&Broadcaster{}).SubscribeFrom("", previousId)
+	defer unsubscribe()
+	assert.Empty(t, missed)
+	assert.False(t, complete)
+}
+
+func TestSubscribeTenant(t *testing.T) {
+	b := Broadcaster{}
+	ch, unsubscribe := b.Subscribe("studio-a")
+	defer unsubscribe()
+
+	b.Publish("studio-b", Created, models.Movie{ID: 1})
+	b.Publish("studio-a", Created, models.Movie{ID: 2})
+
+	change := <-ch
+	assert.Equal(t, int64(2), change.Movie.ID)
+
+	missed, _, _, unsubscribeFrom := b.SubscribeFrom("studio-b", 0)
+	defer unsubscribeFrom()
+	assert.Len(t, missed, 1)
+	assert.Equal(t, int64(1), missed[0].Movie.ID)
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := Broadcaster{}
+	ch, unsubscribe := b.Subscribe("")
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish("studio-a", Updated, models.Movie{ID: 1})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
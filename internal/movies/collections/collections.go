@@ -0,0 +1,167 @@
+package collections
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrNotOwner = errors.New("only its owner can change a collection")
+
+// Collections lets users curate lists of movies. Private collections are hidden from
+// other users, as if they didn't exist, public ones can be read by anyone.
+type Collections struct {
+	Repository CollectionsRepository
+	// Changed, when set, is told about the movies added to or removed from a collection,
+	// such as to refresh their similar movies
+	Changed func(movieIds ...int64)
+}
+
+func (s *Collections) GetCollections(ownerId string) ([]models.Collection, error) {
+	return s.Repository.GetCollections(ownerId)
+}
+
+// GetCollection returns the collection when it belongs to the user or is public.
+func (s *Collections) GetCollection(userId string, id int64) (*models.Collection, error) {
+	collection, err := s.Repository.GetCollection(id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.OwnerID != userId && collection.Visibility != models.CollectionPublic {
+		return nil, fmt.Errorf("getCollection %d: %w", id, ErrCollectionNotFound)
+	}
+	return collection, nil
+}
+
+// GetSharedCollection finds a public collection by the slug it is shared with.
+func (s *Collections) GetSharedCollection(slug string) (*models.Collection, error) {
+	collection, err := s.Repository.GetCollectionBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if collection.Visibility != models.CollectionPublic {
+		return nil, fmt.Errorf("getCollection %s: %w", slug, ErrCollectionNotFound)
+	}
+	return collection, nil
+}
+
+// CreateCollection creates the collection with the given movies in order, and a slug to share it with.
+func (s *Collections) CreateCollection(collection *models.Collection, movieIds []int64) (*models.Collection, error) {
+	if len(movieIds) > MaxItems {
+		return nil, ErrTooManyItems
+	}
+
+	slug, err := newSlug()
+	if err != nil {
+		return nil, err
+	}
+	collection.Slug = slug
+
+	created, err := s.Repository.CreateCollection(collection, movieIds)
+	if err != nil {
+		return nil, err
+	}
+	s.changed(movieIds...)
+	return created, nil
+}
+
+// UpdateCollection renames the collection or changes its visibility, its items are left as they are.
+func (s *Collections) UpdateCollection(userId string, collection *models.Collection) (*models.Collection, error) {
+	existing, err := s.owned(userId, collection.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Name = collection.Name
+	existing.Visibility = collection.Visibility
+	if err := s.Repository.UpdateCollection(existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *Collections) DeleteCollection(userId string, id int64) error {
+	collection, err := s.owned(userId, id)
+	if err != nil {
+		return err
+	}
+	if err := s.Repository.DeleteCollection(id); err != nil {
+		return err
+	}
+
+	movieIds := make([]int64, len(collection.Items))
+	for i, item := range collection.Items {
+		movieIds[i] = item.Movie.ID
+	}
+	s.changed(movieIds...)
+	return nil
+}
+
+func (s *Collections) AddItem(userId string, id int64, movieId int64, position int) (*models.Collection, error) {
+	return s.change(userId, id, func() error {
+		if err := s.Repository.AddItem(id, movieId, position); err != nil {
+			return err
+		}
+		s.changed(movieId)
+		return nil
+	})
+}
+
+func (s *Collections) RemoveItem(userId string, id int64, movieId int64) (*models.Collection, error) {
+	return s.change(userId, id, func() error {
+		if err := s.Repository.RemoveItem(id, movieId); err != nil {
+			return err
+		}
+		s.changed(movieId)
+		return nil
+	})
+}
+
+func (s *Collections) ReorderItems(userId string, id int64, movieIds []int64) (*models.Collection, error) {
+	return s.change(userId, id, func() error {
+		return s.Repository.ReorderItems(id, movieIds)
+	})
+}
+
+// change applies a change to the items of a collection of the user, returning the collection after it
+func (s *Collections) change(userId string, id int64, fn func() error) (*models.Collection, error) {
+	if _, err := s.owned(userId, id); err != nil {
+		return nil, err
+	}
+	if err := fn(); err != nil {
+		return nil, err
+	}
+	return s.Repository.GetCollection(id)
+}
+
+func (s *Collections) changed(movieIds ...int64) {
+	if s.Changed != nil && len(movieIds) > 0 {
+		s.Changed(movieIds...)
+	}
+}
+
+// owned returns the collection when it belongs to the user,
+// private collections of other users are not found rather than forbidden
+func (s *Collections) owned(userId string, id int64) (*models.Collection, error) {
+	collection, err := s.GetCollection(userId, id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.OwnerID != userId {
+		return nil, ErrNotOwner
+	}
+	return collection, nil
+}
+
+// newSlug returns a random slug that can't be guessed from the collection id
+func newSlug() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating collection slug %v", err)
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
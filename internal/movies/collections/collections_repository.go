@@ -0,0 +1,326 @@
+package collections
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("no such collection")
+	ErrItemNotFound       = errors.New("the movie is not in the collection")
+	ErrDuplicateItem      = errors.New("the movie is already in the collection")
+	ErrInvalidOrder       = errors.New("the order must list every movie of the collection once")
+	ErrTooManyItems       = fmt.Errorf("a collection can have at most %d movies", MaxItems)
+)
+
+// MaxItems is how many movies a collection can have
+const MaxItems = 1000
+
+const (
+	duplicateEntry = 1062
+	// noReferencedRow is returned when the movie of an item doesn't exist
+	noReferencedRow = 1452
+)
+
+// CollectionsRepository keeps the collections and their items ordered by position.
+// Items of deleted movies are removed along with them by the foreign key.
+type CollectionsRepository interface {
+	GetCollections(ownerId string) ([]models.Collection, error)
+	GetCollection(id int64) (*models.Collection, error)
+	GetCollectionBySlug(slug string) (*models.Collection, error)
+	CreateCollection(collection *models.Collection, movieIds []int64) (*models.Collection, error)
+	UpdateCollection(collection *models.Collection) error
+	DeleteCollection(id int64) error
+	// AddItem inserts the movie at the given position, shifting the items after it, or at the end when position is negative
+	AddItem(id int64, movieId int64, position int) error
+	RemoveItem(id int64, movieId int64) error
+	// ReorderItems sets the order of the items, movieIds must hold every movie of the collection
+	ReorderItems(id int64, movieIds []int64) error
+}
+
+// Repository keeps the collections of one tenant, which can only hold the movies of the same tenant.
+type Repository struct {
+	DB     *sql.DB
+	Tenant string
+}
+
+const collectionColumns = "c.id, c.owner_id, c.name, c.visibility, c.slug, c.created_at, c.updated_at, " +
+	"(select count(*) from collection_items ci where ci.collection_id = c.id)"
+
+func (r *Repository) GetCollections(ownerId string) ([]models.Collection, error) {
+	rows, err := r.DB.Query("select "+collectionColumns+" from collections c where c.tenant_id = ? and c.owner_id = ? order by c.id", r.Tenant, ownerId)
+	if err != nil {
+		return nil, fmt.Errorf("getCollections %v", err)
+	}
+	defer rows.Close()
+
+	var collections []models.Collection
+	for rows.Next() {
+		collection, err := scanCollection(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("getCollections %v", err)
+		}
+		collections = append(collections, *collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getCollections %v", err)
+	}
+
+	return collections, nil
+}
+
+func (r *Repository) GetCollection(id int64) (*models.Collection, error) {
+	return r.getCollection("c.id = ?", id)
+}
+
+func (r *Repository) GetCollectionBySlug(slug string) (*models.Collection, error) {
+	return r.getCollection("c.slug = ?", slug)
+}
+
+func (r *Repository) getCollection(where string, arg interface{}) (*models.Collection, error) {
+	collection, err := scanCollection(r.DB.QueryRow("select "+collectionColumns+" from collections c where c.tenant_id = ? and "+where, r.Tenant, arg).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("getCollection %v: %w", arg, ErrCollectionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getCollection %v: %v", arg, err)
+	}
+
+	rows, err := r.DB.Query("select m.id, m.isbn, m.title, m.director, ci.added_at from collection_items ci "+
+		"join movies m on m.tenant_id = ci.tenant_id and m.id = ci.movie_id where ci.collection_id = ? order by ci.position", collection.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getCollection %v: %v", arg, err)
+	}
+	defer rows.Close()
+
+	collection.Items = []models.CollectionItem{}
+	for rows.Next() {
+		var item models.CollectionItem
+		if err := rows.Scan(&item.Movie.ID, &item.Movie.Isbn, &item.Movie.Title, &item.Movie.Director, &item.AddedAt); err != nil {
+			return nil, fmt.Errorf("getCollection %v: %v", arg, err)
+		}
+		collection.Items = append(collection.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getCollection %v: %v", arg, err)
+	}
+
+	return collection, nil
+}
+
+func (r *Repository) CreateCollection(collection *models.Collection, movieIds []int64) (*models.Collection, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("add collection: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec("insert into collections (tenant_id, owner_id, name, visibility, slug, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?)",
+		r.Tenant, collection.OwnerID, collection.Name, collection.Visibility, collection.Slug, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("add collection: %v", err)
+	}
+
+	collection.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get collection last inserted id %v", err)
+	}
+
+	for position, movieId := range movieIds {
+		if _, err := tx.Exec("insert into collection_items (tenant_id, collection_id, movie_id, position, added_at) values (?, ?, ?, ?, ?)",
+			r.Tenant, collection.ID, movieId, position, now); err != nil {
+			return nil, itemError(movieId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("add collection: %v", err)
+	}
+
+	collection.CreatedAt, collection.UpdatedAt = now, now
+	collection.ItemCount = len(movieIds)
+	return collection, nil
+}
+
+func (r *Repository) UpdateCollection(collection *models.Collection) error {
+	collection.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := r.DB.Exec("update collections set name = ?, visibility = ?, updated_at = ? where id = ? and tenant_id = ?",
+		collection.Name, collection.Visibility, collection.UpdatedAt, collection.ID, r.Tenant)
+	if err != nil {
+		return fmt.Errorf("update collection: %v", err)
+	}
+	return notFound(result, collection.ID)
+}
+
+func (r *Repository) DeleteCollection(id int64) error {
+	result, err := r.DB.Exec("delete from collections where id = ? and tenant_id = ?", id, r.Tenant)
+	if err != nil {
+		return fmt.Errorf("delete collection: %v", err)
+	}
+	return notFound(result, id)
+}
+
+func (r *Repository) AddItem(id int64, movieId int64, position int) error {
+	tx, count, err := r.lockCollection(id)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if count >= MaxItems {
+		return fmt.Errorf("add item %d: %w", movieId, ErrTooManyItems)
+	}
+
+	// positions can have gaps left by deleted movies, so the new item takes the position
+	// of the item it goes before, or the one after the last item
+	var at int
+	err = sql.ErrNoRows
+	if position >= 0 {
+		err = tx.QueryRow("select position from collection_items where collection_id = ? order by position limit 1 offset ?", id, position).Scan(&at)
+	}
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("select coalesce(max(position) + 1, 0) from collection_items where collection_id = ?", id).Scan(&at)
+	}
+	if err != nil {
+		return fmt.Errorf("add item %d: %v", movieId, err)
+	}
+
+	if _, err := tx.Exec("update collection_items set position = position + 1 where collection_id = ? and position >= ?", id, at); err != nil {
+		return fmt.Errorf("add item %d: %v", movieId, err)
+	}
+	if _, err := tx.Exec("insert into collection_items (tenant_id, collection_id, movie_id, position, added_at) values (?, ?, ?, ?, ?)",
+		r.Tenant, id, movieId, at, time.Now().UTC().Truncate(time.Second)); err != nil {
+		return itemError(movieId, err)
+	}
+
+	return r.commit(tx, id)
+}
+
+func (r *Repository) RemoveItem(id int64, movieId int64) error {
+	tx, _, err := r.lockCollection(id)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow("select position from collection_items where collection_id = ? and movie_id = ?", id, movieId).Scan(&position)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("remove item %d: %w", movieId, ErrItemNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("remove item %d: %v", movieId, err)
+	}
+
+	if _, err := tx.Exec("delete from collection_items where collection_id = ? and movie_id = ?", id, movieId); err != nil {
+		return fmt.Errorf("remove item %d: %v", movieId, err)
+	}
+	if _, err := tx.Exec("update collection_items set position = position - 1 where collection_id = ? and position > ?", id, position); err != nil {
+		return fmt.Errorf("remove item %d: %v", movieId, err)
+	}
+
+	return r.commit(tx, id)
+}
+
+func (r *Repository) ReorderItems(id int64, movieIds []int64) error {
+	tx, count, err := r.lockCollection(id)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seen := map[int64]bool{}
+	for _, movieId := range movieIds {
+		seen[movieId] = true
+	}
+	if len(movieIds) != count || len(seen) != count {
+		return fmt.Errorf("reorder items: %w", ErrInvalidOrder)
+	}
+
+	for position, movieId := range movieIds {
+		result, err := tx.Exec("update collection_items set position = ? where collection_id = ? and movie_id = ?", position, id, movieId)
+		if err != nil {
+			return fmt.Errorf("reorder items: %v", err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("reorder items %d: %w", movieId, ErrInvalidOrder)
+		}
+	}
+
+	return r.commit(tx, id)
+}
+
+// lockCollection starts a transaction holding the collection row, so concurrent changes
+// of its items don't mix up their positions, and returns how many items it has.
+// The items of a collection are only reached through it, so checking its tenant here scopes them too.
+func (r *Repository) lockCollection(id int64) (*sql.Tx, int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("lock collection %d: %v", id, err)
+	}
+
+	var count int
+	err = tx.QueryRow("select id from collections where id = ? and tenant_id = ? for update", id, r.Tenant).Scan(&id)
+	if err == nil {
+		err = tx.QueryRow("select count(*) from collection_items where collection_id = ?", id).Scan(&count)
+	}
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, 0, fmt.Errorf("lock collection %d: %w", id, ErrCollectionNotFound)
+		}
+		return nil, 0, fmt.Errorf("lock collection %d: %v", id, err)
+	}
+
+	return tx, count, nil
+}
+
+func (r *Repository) commit(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec("update collections set updated_at = ? where id = ?", time.Now().UTC().Truncate(time.Second), id); err != nil {
+		return fmt.Errorf("update collection %d: %v", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("update collection %d: %v", id, err)
+	}
+	return nil
+}
+
+func itemError(movieId int64, err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case duplicateEntry:
+			return fmt.Errorf("add item %d: %w", movieId, ErrDuplicateItem)
+		case noReferencedRow:
+			return fmt.Errorf("add item %d: %w", movieId, repository.ErrMovieNotFound)
+		}
+	}
+	return fmt.Errorf("add item %d: %v", movieId, err)
+}
+
+func notFound(result sql.Result, id int64) error {
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("collection %d: %w", id, ErrCollectionNotFound)
+	}
+	return nil
+}
+
+func scanCollection(scan func(dest ...interface{}) error) (*models.Collection, error) {
+	var collection models.Collection
+	err := scan(&collection.ID, &collection.OwnerID, &collection.Name, &collection.Visibility, &collection.Slug,
+		&collection.CreatedAt, &collection.UpdatedAt, &collection.ItemCount)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
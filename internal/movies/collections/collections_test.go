@@ -0,0 +1,265 @@
+package collections
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type fakeRepository struct {
+	mu          sync.Mutex
+	collections []models.Collection
+}
+
+func (f *fakeRepository) GetCollections(ownerId string) ([]models.Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var list []models.Collection
+	for _, collection := range f.collections {
+		if collection.OwnerID == ownerId {
+			collection.Items = nil
+			list = append(list, collection)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) GetCollection(id int64) (*models.Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	collection, err := f.find(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *collection
+	copied.Items = append([]models.CollectionItem{}, collection.Items...)
+	return &copied, nil
+}
+
+func (f *fakeRepository) GetCollectionBySlug(slug string) (*models.Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, collection := range f.collections {
+		if collection.Slug == slug {
+			return &collection, nil
+		}
+	}
+	return nil, fmt.Errorf("getCollection %s: %w", slug, ErrCollectionNotFound)
+}
+
+func (f *fakeRepository) CreateCollection(collection *models.Collection, movieIds []int64) (*models.Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	collection.ID = int64(len(f.collections) + 1)
+	collection.Items = []models.CollectionItem{}
+	for _, movieId := range movieIds {
+		collection.Items = append(collection.Items, models.CollectionItem{Movie: models.Movie{ID: movieId}})
+	}
+	collection.ItemCount = len(movieIds)
+	f.collections = append(f.collections, *collection)
+	return collection, nil
+}
+
+func (f *fakeRepository) UpdateCollection(collection *models.Collection) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, err := f.find(collection.ID)
+	if err != nil {
+		return err
+	}
+	existing.Name = collection.Name
+	existing.Visibility = collection.Visibility
+	return nil
+}
+
+func (f *fakeRepository) DeleteCollection(id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	existing.ID = 0
+	return nil
+}
+
+func (f *fakeRepository) AddItem(id int64, movieId int64, position int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	collection, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	for _, item := range collection.Items {
+		if item.Movie.ID == movieId {
+			return ErrDuplicateItem
+		}
+	}
+
+	if position < 0 || position > len(collection.Items) {
+		position = len(collection.Items)
+	}
+	items := append([]models.CollectionItem{}, collection.Items[:position]...)
+	items = append(items, models.CollectionItem{Movie: models.Movie{ID: movieId}})
+	collection.Items = append(items, collection.Items[position:]...)
+	return nil
+}
+
+func (f *fakeRepository) RemoveItem(id int64, movieId int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	collection, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	for i, item := range collection.Items {
+		if item.Movie.ID == movieId {
+			collection.Items = append(collection.Items[:i], collection.Items[i+1:]...)
+			return nil
+		}
+	}
+	return ErrItemNotFound
+}
+
+func (f *fakeRepository) ReorderItems(id int64, movieIds []int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	collection, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	if len(movieIds) != len(collection.Items) {
+		return ErrInvalidOrder
+	}
+	collection.Items = nil
+	for _, movieId := range movieIds {
+		collection.Items = append(collection.Items, models.CollectionItem{Movie: models.Movie{ID: movieId}})
+	}
+	return nil
+}
+
+func (f *fakeRepository) find(id int64) (*models.Collection, error) {
+	for i := range f.collections {
+		if f.collections[i].ID == id && id != 0 {
+			return &f.collections[i], nil
+		}
+	}
+	return nil, fmt.Errorf("collection %d: %w", id, ErrCollectionNotFound)
+}
+
+func movieIds(collection *models.Collection) []int64 {
+	var ids []int64
+	for _, item := range collection.Items {
+		ids = append(ids, item.Movie.ID)
+	}
+	return ids
+}
+
+func TestCreateCollection(t *testing.T) {
+	service := Collections{Repository: &fakeRepository{}}
+
+	first, err := service.CreateCollection(&models.Collection{OwnerID: "ana", Name: "Watchlist", Visibility: models.CollectionPrivate}, []int64{3, 1})
+	assert.NoError(t, err)
+	assert.Len(t, first.Slug, 16)
+	assert.Equal(t, []int64{3, 1}, movieIds(first))
+
+	second, err := service.CreateCollection(&models.Collection{OwnerID: "ana", Name: "Sharks", Visibility: models.CollectionPublic}, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Slug, second.Slug)
+
+	_, err = service.CreateCollection(&models.Collection{OwnerID: "ana", Name: "Everything"}, make([]int64, MaxItems+1))
+	assert.ErrorIs(t, err, ErrTooManyItems)
+}
+
+func TestGetCollection(t *testing.T) {
+	repo := &fakeRepository{collections: []models.Collection{
+		{ID: 1, OwnerID: "ana", Name: "Watchlist", Visibility: models.CollectionPrivate, Slug: "private"},
+		{ID: 2, OwnerID: "ana", Name: "Sharks", Visibility: models.CollectionPublic, Slug: "public"},
+	}}
+	service := Collections{Repository: repo}
+
+	testCases := []struct {
+		name    string
+		userId  string
+		id      int64
+		wantErr error
+	}{
+		{name: "Should return a private collection to its owner", userId: "ana", id: 1},
+		{name: "Should hide a private collection from other users", userId: "bob", id: 1, wantErr: ErrCollectionNotFound},
+		{name: "Should hide a private collection from anonymous users", userId: "", id: 1, wantErr: ErrCollectionNotFound},
+		{name: "Should return a public collection to anyone", userId: "", id: 2},
+		{name: "Should not find an unknown collection", userId: "ana", id: 3, wantErr: ErrCollectionNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection, err := service.GetCollection(tc.userId, tc.id)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.id, collection.ID)
+		})
+	}
+
+	shared, err := service.GetSharedCollection("public")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), shared.ID)
+
+	_, err = service.GetSharedCollection("private")
+	assert.ErrorIs(t, err, ErrCollectionNotFound)
+}
+
+func TestChangeItems(t *testing.T) {
+	repo := &fakeRepository{collections: []models.Collection{
+		{ID: 1, OwnerID: "ana", Name: "Watchlist", Visibility: models.CollectionPublic, Items: []models.CollectionItem{{Movie: models.Movie{ID: 1}}}},
+	}}
+	var changed []int64
+	service := Collections{Repository: repo, Changed: func(movieIds ...int64) { changed = append(changed, movieIds...) }}
+
+	collection, err := service.AddItem("ana", 1, 2, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, movieIds(collection))
+
+	collection, err = service.AddItem("ana", 1, 3, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 1, 2}, movieIds(collection))
+
+	collection, err = service.ReorderItems("ana", 1, []int64{2, 3, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 1}, movieIds(collection))
+
+	collection, err = service.RemoveItem("ana", 1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, movieIds(collection))
+
+	// other users can read the public collection but not change it
+	_, err = service.AddItem("bob", 1, 4, -1)
+	assert.ErrorIs(t, err, ErrNotOwner)
+	assert.ErrorIs(t, service.DeleteCollection("bob", 1), ErrNotOwner)
+
+	_, err = service.UpdateCollection("ana", &models.Collection{ID: 1, Name: "Watched", Visibility: models.CollectionPrivate})
+	assert.NoError(t, err)
+
+	// once private it isn't found by them anymore
+	_, err = service.RemoveItem("bob", 1, 1)
+	assert.ErrorIs(t, err, ErrCollectionNotFound)
+
+	assert.NoError(t, service.DeleteCollection("ana", 1))
+	// reordering the items doesn't change which movies are collected together
+	assert.Equal(t, []int64{2, 3, 3, 2, 1}, changed)
+}
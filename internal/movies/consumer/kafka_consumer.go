@@ -0,0 +1,191 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+)
+
+type MovieEventHandler interface {
+	HandleMovieEvent(event *events.MovieEvent) error
+}
+
+type DeadLetterProducer interface {
+	SendDeadLetter(msg *kafka.Message, cause error) error
+}
+
+type KafkaConsumerConfig struct {
+	Consumer     *kafka.Consumer
+	Topic        *string
+	Handler      MovieEventHandler
+	DeadLetter   DeadLetterProducer
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// Run subscribes to the topic and processes messages until the context is cancelled.
+// Offsets are committed only after a message was handled or sent to the dead letter topic,
+// so a crash in between means the message is delivered again.
+func (k *KafkaConsumerConfig) Run(ctx context.Context) error {
+	err := k.Consumer.SubscribeTopics([]string{*k.Topic}, rebalance)
+	if err != nil {
+		return fmt.Errorf("error subscribing to topic %s %v", *k.Topic, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		switch e := k.Consumer.Poll(100).(type) {
+		case *kafka.Message:
+			if err := k.process(e); err != nil {
+				return err
+			}
+
+			if _, err := k.Consumer.CommitMessage(e); err != nil {
+				return fmt.Errorf("error committing offset %v %v", e.TopicPartition, err)
+			}
+		case kafka.Error:
+			log.Println("Kafka consumer error", e)
+			if e.IsFatal() {
+				return fmt.Errorf("fatal kafka consumer error %v", e)
+			}
+		}
+	}
+}
+
+func (k *KafkaConsumerConfig) process(msg *kafka.Message) error {
+	var event events.MovieEvent
+	if err := decode(msg, &event); err != nil {
+		return k.deadLetter(msg, fmt.Errorf("error decoding movie event %v", err))
+	}
+
+	backoff := k.RetryBackoff
+	var err error
+	for attempt := 0; attempt <= k.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err = k.Handler.HandleMovieEvent(&event); err == nil {
+			return nil
+		}
+		log.Printf("Failed to handle movie event %d (attempt %d): %v\n", event.Id, attempt+1, err)
+	}
+
+	return k.deadLetter(msg, err)
+}
+
+// decode accepts any of the formats the service can produce, based on the message headers
+func decode(msg *kafka.Message, event *events.MovieEvent) error {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return encoder.Decode(msg.Value, headers, event)
+}
+
+func (k *KafkaConsumerConfig) deadLetter(msg *kafka.Message, cause error) error {
+	if k.DeadLetter == nil {
+		log.Println("Dropping movie event, no dead letter topic configured", cause)
+		return nil
+	}
+
+	if err := k.DeadLetter.SendDeadLetter(msg, cause); err != nil {
+		return fmt.Errorf("error sending message to dead letter topic %v", err)
+	}
+	return nil
+}
+
+func (k *KafkaConsumerConfig) Close() {
+	k.Consumer.Close()
+	if d, ok := k.DeadLetter.(*KafkaDeadLetterProducer); ok {
+		d.Producer.Close()
+	}
+}
+
+func rebalance(c *kafka.Consumer, event kafka.Event) error {
+	switch e := event.(type) {
+	case kafka.AssignedPartitions:
+		log.Println("Assigned partitions", e.Partitions)
+	case kafka.RevokedPartitions:
+		if c.AssignmentLost() {
+			log.Println("Assignment lost involuntarily, partitions", e.Partitions)
+		} else {
+			log.Println("Revoked partitions", e.Partitions)
+		}
+	}
+	return nil
+}
+
+type KafkaDeadLetterProducer struct {
+	Producer *kafka.Producer
+	Topic    *string
+}
+
+func (d *KafkaDeadLetterProducer) SendDeadLetter(msg *kafka.Message, cause error) error {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: "dlq_error", Value: []byte(cause.Error())},
+		kafka.Header{Key: "dlq_original_topic", Value: []byte(*msg.TopicPartition.Topic)},
+		kafka.Header{Key: "dlq_original_partition", Value: []byte(strconv.Itoa(int(msg.TopicPartition.Partition)))},
+		kafka.Header{Key: "dlq_original_offset", Value: []byte(msg.TopicPartition.Offset.String())},
+	)
+
+	deliveryChan := make(chan kafka.Event, 1)
+	err := d.Producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: d.Topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers:        headers,
+	}, deliveryChan)
+	if err != nil {
+		return err
+	}
+
+	// wait for the delivery report, the original offset is committed right after
+	delivered := (<-deliveryChan).(*kafka.Message)
+	return delivered.TopicPartition.Error
+}
+
+func GetKafkaConsumer(groupId string, topic *string, handler MovieEventHandler, deadLetterTopic *string) (consumer KafkaConsumerConfig, err error) {
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  "localhost",
+		"group.id":           groupId,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return consumer, fmt.Errorf("error creating kafka consumer %v", err)
+	}
+
+	consumer = KafkaConsumerConfig{
+		Consumer:     c,
+		Topic:        topic,
+		Handler:      handler,
+		MaxRetries:   3,
+		RetryBackoff: 500 * time.Millisecond,
+	}
+
+	if deadLetterTopic != nil {
+		p, err := kafka.NewProducer(&kafka.ConfigMap{
+			"bootstrap.servers": "localhost",
+		})
+		if err != nil {
+			return consumer, fmt.Errorf("error creating dead letter producer %v", err)
+		}
+		consumer.DeadLetter = &KafkaDeadLetterProducer{Producer: p, Topic: deadLetterTopic}
+	}
+
+	return
+}
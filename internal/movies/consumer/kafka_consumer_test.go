@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+type mockHandler struct {
+	mock.Mock
+}
+
+func (m *mockHandler) HandleMovieEvent(event *events.MovieEvent) error {
+	args := m.Called(event.Id)
+	return args.Error(0)
+}
+
+type mockDeadLetter struct {
+	mock.Mock
+}
+
+func (m *mockDeadLetter) SendDeadLetter(msg *kafka.Message, cause error) error {
+	args := m.Called(msg, cause)
+	return args.Error(0)
+}
+
+func TestProcess(t *testing.T) {
+	topic := "movies"
+	eventBytes, _ := proto.Marshal(&events.MovieEvent{Id: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"})
+	validMsg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: eventBytes}
+	invalidMsg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: []byte{0xff, 0xff}}
+
+	testCases := []struct {
+		name      string
+		msg       *kafka.Message
+		mockSetup func(h *mockHandler, d *mockDeadLetter)
+		wantErr   bool
+	}{
+		{
+			name: "Should handle a movie event",
+			msg:  validMsg,
+			mockSetup: func(h *mockHandler, d *mockDeadLetter) {
+				h.On("HandleMovieEvent", int64(1)).Return(nil).Once()
+			},
+		},
+		{
+			name: "Should retry and then handle a movie event",
+			msg:  validMsg,
+			mockSetup: func(h *mockHandler, d *mockDeadLetter) {
+				h.On("HandleMovieEvent", int64(1)).Return(errors.New("failed")).Twice()
+				h.On("HandleMovieEvent", int64(1)).Return(nil).Once()
+			},
+		},
+		{
+			name: "Should send to dead letter topic after exhausting retries",
+			msg:  validMsg,
+			mockSetup: func(h *mockHandler, d *mockDeadLetter) {
+				h.On("HandleMovieEvent", int64(1)).Return(errors.New("failed")).Times(3)
+				d.On("SendDeadLetter", validMsg, errors.New("failed")).Return(nil).Once()
+			},
+		},
+		{
+			name: "Should send undecodable messages straight to dead letter topic",
+			msg:  invalidMsg,
+			mockSetup: func(h *mockHandler, d *mockDeadLetter) {
+				d.On("SendDeadLetter", invalidMsg, mock.Anything).Return(nil).Once()
+			},
+		},
+		{
+			name: "Should return an error when dead letter topic is unavailable",
+			msg:  validMsg,
+			mockSetup: func(h *mockHandler, d *mockDeadLetter) {
+				h.On("HandleMovieEvent", int64(1)).Return(errors.New("failed")).Times(3)
+				d.On("SendDeadLetter", validMsg, mock.Anything).Return(errors.New("unavailable")).Once()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := new(mockHandler)
+			deadLetter := new(mockDeadLetter)
+			tc.mockSetup(handler, deadLetter)
+
+			consumer := KafkaConsumerConfig{Handler: handler, DeadLetter: deadLetter, MaxRetries: 2}
+
+			err := consumer.process(tc.msg)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			handler.AssertExpectations(t)
+			deadLetter.AssertExpectations(t)
+		})
+	}
+}
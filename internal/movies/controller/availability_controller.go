@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/availability"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// GetReleases lists the releases of a movie by date.
+func GetReleases(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	releases, err := repo.GetReleases(movieId)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	if releases == nil {
+		releases = []models.Release{}
+	}
+	json.NewEncoder(w).Encode(releases)
+}
+
+// CreateRelease adds a release to a movie, a movie has one release of each type per country.
+func CreateRelease(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	release, ok := readRelease(w, r)
+	if !ok {
+		return
+	}
+	release.MovieID = movieId
+
+	created, err := repo.CreateRelease(release)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/movies/%d/releases/%d", movieId, created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func UpdateRelease(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := availabilityIds(w, r, "releaseId", "invalid release id")
+	if !ok {
+		return
+	}
+
+	release, ok := readRelease(w, r)
+	if !ok {
+		return
+	}
+	release.ID = id
+	release.MovieID = movieId
+
+	updated, err := repo.UpdateRelease(release)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteRelease(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := availabilityIds(w, r, "releaseId", "invalid release id")
+	if !ok {
+		return
+	}
+
+	if err := repo.DeleteRelease(movieId, id); err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWindows lists the availability windows of a movie by start.
+func GetWindows(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	windows, err := repo.GetWindows(movieId)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	if windows == nil {
+		windows = []models.AvailabilityWindow{}
+	}
+	json.NewEncoder(w).Encode(windows)
+}
+
+// CreateWindow makes a movie available on a platform in a region, an event is sent when the window opens and closes.
+func CreateWindow(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	window, ok := readWindow(w, r)
+	if !ok {
+		return
+	}
+	window.MovieID = movieId
+
+	created, err := repo.CreateWindow(window)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/movies/%d/availability/%d", movieId, created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateWindow replaces a window, it is announced again when its start or end changes.
+func UpdateWindow(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := availabilityIds(w, r, "windowId", "invalid window id")
+	if !ok {
+		return
+	}
+
+	window, ok := readWindow(w, r)
+	if !ok {
+		return
+	}
+	window.ID = id
+	window.MovieID = movieId
+
+	updated, err := repo.UpdateWindow(window)
+	if err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteWindow(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := availabilityIds(w, r, "windowId", "invalid window id")
+	if !ok {
+		return
+	}
+
+	if err := repo.DeleteWindow(movieId, id); err != nil {
+		writeAvailabilityError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// availableMovies reads the available_in and on query parameters of GET /movies,
+// returning nil when the movies are not filtered by availability. repo is nil when the storage doesn't keep the windows.
+func availableMovies(w http.ResponseWriter, r *http.Request, repo availability.AvailabilityRepository) (map[int64]bool, bool) {
+	query := r.URL.Query()
+	if query.Get("available_in") == "" {
+		if query.Get("on") != "" {
+			writeError(w, http.StatusBadRequest, "on requires available_in")
+			return nil, false
+		}
+		return nil, true
+	}
+	if repo == nil {
+		writeError(w, http.StatusNotImplemented, "available_in is not supported by the configured storage")
+		return nil, false
+	}
+
+	region, err := models.NormalizeRegion(query.Get("available_in"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "available_in must be an ISO 3166-1 alpha-2 country code")
+		return nil, false
+	}
+
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if on := query.Get("on"); on != "" {
+		if day, err = time.Parse(models.DateLayout, on); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("on must be formatted as %s", models.DateLayout))
+			return nil, false
+		}
+	}
+
+	ids, err := repo.GetAvailableMovieIds(region, day, day.Add(24*time.Hour))
+	if err != nil {
+		fmt.Println("Error fetching available movies", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	return ids, true
+}
+
+func availabilityIds(w http.ResponseWriter, r *http.Request, idVar string, invalid string) (int64, int64, bool) {
+	vars := mux.Vars(r)
+	movieId, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseInt(vars[idVar], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, invalid)
+		return 0, 0, false
+	}
+
+	return movieId, id, true
+}
+
+// readRelease reads a validated release with its country in upper case
+func readRelease(w http.ResponseWriter, r *http.Request) (*models.Release, bool) {
+	var release models.Release
+	if err := json.NewDecoder(r.Body).Decode(&release); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid release")
+		return nil, false
+	}
+
+	if err := release.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	release.Country, _ = models.NormalizeRegion(release.Country)
+	return &release, true
+}
+
+// readWindow reads a validated window with its region in upper case
+func readWindow(w http.ResponseWriter, r *http.Request) (*models.AvailabilityWindow, bool) {
+	var window models.AvailabilityWindow
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid availability window")
+		return nil, false
+	}
+
+	if err := window.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	window.Region, _ = models.NormalizeRegion(window.Region)
+	return &window, true
+}
+
+func writeAvailabilityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, availability.ErrDuplicateRelease):
+		writeError(w, http.StatusConflict, availability.ErrDuplicateRelease.Error())
+	case errors.Is(err, repository.ErrMovieNotFound):
+		writeError(w, http.StatusNotFound, "movie not found")
+	case errors.Is(err, availability.ErrReleaseNotFound):
+		writeError(w, http.StatusNotFound, "release not found")
+	case errors.Is(err, availability.ErrWindowNotFound):
+		writeError(w, http.StatusNotFound, "availability window not found")
+	default:
+		fmt.Println("Error handling availability", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/availability"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubAvailability keeps the releases and windows of movie 1, the only movie there is
+type stubAvailability struct {
+	releases []models.Release
+	windows  []models.AvailabilityWindow
+}
+
+func (s *stubAvailability) GetReleases(movieId int64) ([]models.Release, error) {
+	if movieId != 1 {
+		return nil, fmt.Errorf("getReleases %d: %w", movieId, repository.ErrMovieNotFound)
+	}
+	return s.releases, nil
+}
+
+func (s *stubAvailability) CreateRelease(release *models.Release) (*models.Release, error) {
+	for _, existing := range s.releases {
+		if existing.Country == release.Country && existing.Type == release.Type {
+			return nil, availability.ErrDuplicateRelease
+		}
+	}
+	release.ID = int64(len(s.releases) + 1)
+	s.releases = append(s.releases, *release)
+	return release, nil
+}
+
+func (s *stubAvailability) UpdateRelease(release *models.Release) (*models.Release, error) {
+	for i := range s.releases {
+		if s.releases[i].ID == release.ID {
+			s.releases[i] = *release
+			return release, nil
+		}
+	}
+	return nil, fmt.Errorf("updateRelease %d: %w", release.ID, availability.ErrReleaseNotFound)
+}
+
+func (s *stubAvailability) DeleteRelease(movieId int64, id int64) error {
+	return nil
+}
+
+func (s *stubAvailability) GetWindows(movieId int64) ([]models.AvailabilityWindow, error) {
+	return s.windows, nil
+}
+
+func (s *stubAvailability) CreateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error) {
+	window.ID = int64(len(s.windows) + 1)
+	s.windows = append(s.windows, *window)
+	return window, nil
+}
+
+func (s *stubAvailability) UpdateWindow(window *models.AvailabilityWindow) (*models.AvailabilityWindow, error) {
+	for i := range s.windows {
+		if s.windows[i].ID == window.ID {
+			s.windows[i] = *window
+			return window, nil
+		}
+	}
+	return nil, fmt.Errorf("updateWindow %d: %w", window.ID, availability.ErrWindowNotFound)
+}
+
+func (s *stubAvailability) DeleteWindow(movieId int64, id int64) error {
+	return fmt.Errorf("deleteWindow %d: %w", id, availability.ErrWindowNotFound)
+}
+
+func (s *stubAvailability) GetAvailableMovieIds(region string, from time.Time, to time.Time) (map[int64]bool, error) {
+	return map[int64]bool{}, nil
+}
+
+func TestAvailability(t *testing.T) {
+	repo := &stubAvailability{}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/releases", func(w http.ResponseWriter, r *http.Request) {
+		GetReleases(w, r, repo)
+	}).Methods("GET")
+	r.HandleFunc("/movies/{id}/releases", func(w http.ResponseWriter, r *http.Request) {
+		CreateRelease(w, r, repo)
+	}).Methods("POST")
+	r.HandleFunc("/movies/{id}/releases/{releaseId}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateRelease(w, r, repo)
+	}).Methods("PUT")
+	r.HandleFunc("/movies/{id}/releases/{releaseId}", func(w http.ResponseWriter, r *http.Request) {
+		DeleteRelease(w, r, repo)
+	}).Methods("DELETE")
+	r.HandleFunc("/movies/{id}/availability", func(w http.ResponseWriter, r *http.Request) {
+		GetWindows(w, r, repo)
+	}).Methods("GET")
+	r.HandleFunc("/movies/{id}/availability", func(w http.ResponseWriter, r *http.Request) {
+		CreateWindow(w, r, repo)
+	}).Methods("POST")
+	r.HandleFunc("/movies/{id}/availability/{windowId}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateWindow(w, r, repo)
+	}).Methods("PUT")
+	r.HandleFunc("/movies/{id}/availability/{windowId}", func(w http.ResponseWriter, r *http.Request) {
+		DeleteWindow(w, r, repo)
+	}).Methods("DELETE")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "Should list no releases", method: "GET", path: "/movies/1/releases", status: http.StatusOK},
+		{name: "Should create a release", method: "POST", path: "/movies/1/releases",
+			body: `{"country": "br", "date": "1975-12-25", "type": "theatrical"}`, status: http.StatusCreated},
+		{name: "Should not create a second theatrical release in a country", method: "POST", path: "/movies/1/releases",
+			body: `{"country": "BR", "date": "1976-01-01", "type": "theatrical"}`, status: http.StatusConflict},
+		{name: "Should not create an invalid release", method: "POST", path: "/movies/1/releases",
+			body: `{"country": "419", "date": "25/12/1975", "type": "streaming"}`, status: http.StatusBadRequest},
+		{name: "Should list the releases", method: "GET", path: "/movies/1/releases", status: http.StatusOK},
+		{name: "Should not list the releases of an unknown movie", method: "GET", path: "/movies/2/releases", status: http.StatusNotFound},
+		{name: "Should update a release", method: "PUT", path: "/movies/1/releases/1",
+			body: `{"country": "BR", "date": "1975-12-26", "type": "theatrical"}`, status: http.StatusOK},
+		{name: "Should not update an unknown release", method: "PUT", path: "/movies/1/releases/2",
+			body: `{"country": "BR", "date": "1975-12-26", "type": "digital"}`, status: http.StatusNotFound},
+		{name: "Should delete a release", method: "DELETE", path: "/movies/1/releases/1", status: http.StatusNoContent},
+		{name: "Should create an open window", method: "POST", path: "/movies/1/availability",
+			body: `{"region": "br", "platform": "cinema", "start": "2026-01-01T00:00:00Z"}`, status: http.StatusCreated},
+		{name: "Should not create a window ending before it starts", method: "POST", path: "/movies/1/availability",
+			body:   `{"region": "BR", "platform": "cinema", "start": "2026-01-01T00:00:00Z", "end": "2025-01-01T00:00:00Z"}`,
+			status: http.StatusBadRequest},
+		{name: "Should list the windows", method: "GET", path: "/movies/1/availability", status: http.StatusOK},
+		{name: "Should close a window", method: "PUT", path: "/movies/1/availability/1",
+			body:   `{"region": "BR", "platform": "cinema", "start": "2026-01-01T00:00:00Z", "end": "2026-02-01T00:00:00Z"}`,
+			status: http.StatusOK},
+		{name: "Should not delete an unknown window", method: "DELETE", path: "/movies/1/availability/2", status: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, nil)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, "BR", repo.releases[0].Country)
+	assert.Equal(t, "BR", repo.windows[0].Region)
+}
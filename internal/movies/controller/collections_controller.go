@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/collections"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type collectionRequest struct {
+	Name       string  `json:"name"`
+	Visibility string  `json:"visibility"`
+	MovieIDs   []int64 `json:"movie_ids"`
+}
+
+type itemRequest struct {
+	MovieID int64 `json:"movie_id"`
+	// Position is where the movie goes, at the end when it is missing
+	Position *int `json:"position"`
+}
+
+type orderRequest struct {
+	MovieIDs []int64 `json:"movie_ids"`
+}
+
+// GetCollections lists the collections of the user, without their items.
+func GetCollections(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := service.GetCollections(userId)
+	if err != nil {
+		fmt.Println("Error fetching collections", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []models.Collection{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetCollection returns a collection of the user, or a public collection of anyone.
+func GetCollection(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := service.GetCollection(r.Header.Get(UserHeader), id)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(collection)
+}
+
+func GetSharedCollection(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+
+	collection, err := service.GetSharedCollection(mux.Vars(r)["slug"])
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(collection)
+}
+
+// CreateCollection creates a private collection unless told otherwise, optionally with its first movies.
+func CreateCollection(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request collectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid collection")
+		return
+	}
+
+	collection := &models.Collection{OwnerID: userId, Name: request.Name, Visibility: request.Visibility}
+	if collection.Visibility == "" {
+		collection.Visibility = models.CollectionPrivate
+	}
+	if err := collection.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := service.CreateCollection(collection, request.MovieIDs)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/collections/%d", created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func UpdateCollection(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request collectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid collection")
+		return
+	}
+
+	collection := &models.Collection{ID: id, Name: request.Name, Visibility: request.Visibility}
+	if err := collection.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := service.UpdateCollection(userId, collection)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteCollection(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := service.DeleteCollection(userId, id); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func AddCollectionItem(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request itemRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MovieID == 0 {
+		writeError(w, http.StatusBadRequest, "movie_id is required")
+		return
+	}
+
+	position := -1
+	if request.Position != nil {
+		if *request.Position < 0 {
+			writeError(w, http.StatusBadRequest, "position must be a positive number")
+			return
+		}
+		position = *request.Position
+	}
+
+	collection, err := service.AddItem(userId, id, request.MovieID, position)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(collection)
+}
+
+func RemoveCollectionItem(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+	movieId, err := strconv.ParseInt(mux.Vars(r)["movieId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := service.RemoveItem(userId, id, movieId)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(collection)
+}
+
+// ReorderCollectionItems takes the movie ids of the collection in their new order.
+func ReorderCollectionItems(w http.ResponseWriter, r *http.Request, service *collections.Collections) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := collectionId(w, r)
+	if !ok {
+		return
+	}
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "movie_ids is required")
+		return
+	}
+
+	collection, err := service.ReorderItems(userId, id, request.MovieIDs)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(collection)
+}
+
+func collectionId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid collection id")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeCollectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, collections.ErrCollectionNotFound):
+		writeError(w, http.StatusNotFound, "collection not found")
+	case errors.Is(err, collections.ErrItemNotFound), errors.Is(err, repository.ErrMovieNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, collections.ErrNotOwner):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, collections.ErrDuplicateItem):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, collections.ErrInvalidOrder), errors.Is(err, collections.ErrTooManyItems):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		fmt.Println("Error handling collection", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
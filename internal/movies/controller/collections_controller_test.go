@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/collections"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubCollections keeps the collections, their items being movies without a title
+type stubCollections struct {
+	collections []models.Collection
+}
+
+func (s *stubCollections) GetCollections(ownerId string) ([]models.Collection, error) {
+	var list []models.Collection
+	for _, collection := range s.collections {
+		if collection.OwnerID == ownerId {
+			collection.Items = nil
+			list = append(list, collection)
+		}
+	}
+	return list, nil
+}
+
+func (s *stubCollections) GetCollection(id int64) (*models.Collection, error) {
+	collection, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *collection
+	return &copied, nil
+}
+
+func (s *stubCollections) GetCollectionBySlug(slug string) (*models.Collection, error) {
+	for _, collection := range s.collections {
+		if collection.Slug == slug {
+			return &collection, nil
+		}
+	}
+	return nil, fmt.Errorf("getCollection %s: %w", slug, collections.ErrCollectionNotFound)
+}
+
+func (s *stubCollections) CreateCollection(collection *models.Collection, movieIds []int64) (*models.Collection, error) {
+	collection.ID = int64(len(s.collections) + 1)
+	for _, movieId := range movieIds {
+		collection.Items = append(collection.Items, models.CollectionItem{Movie: models.Movie{ID: movieId}})
+	}
+	collection.ItemCount = len(movieIds)
+	s.collections = append(s.collections, *collection)
+	return collection, nil
+}
+
+func (s *stubCollections) UpdateCollection(collection *models.Collection) error {
+	existing, err := s.find(collection.ID)
+	if err != nil {
+		return err
+	}
+	existing.Name = collection.Name
+	existing.Visibility = collection.Visibility
+	return nil
+}
+
+func (s *stubCollections) DeleteCollection(id int64) error {
+	return nil
+}
+
+func (s *stubCollections) AddItem(id int64, movieId int64, position int) error {
+	collection, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	for _, item := range collection.Items {
+		if item.Movie.ID == movieId {
+			return collections.ErrDuplicateItem
+		}
+	}
+	collection.Items = append(collection.Items, models.CollectionItem{Movie: models.Movie{ID: movieId}})
+	return nil
+}
+
+func (s *stubCollections) RemoveItem(id int64, movieId int64) error {
+	return collections.ErrItemNotFound
+}
+
+func (s *stubCollections) ReorderItems(id int64, movieIds []int64) error {
+	return collections.ErrInvalidOrder
+}
+
+func (s *stubCollections) find(id int64) (*models.Collection, error) {
+	for i := range s.collections {
+		if s.collections[i].ID == id {
+			return &s.collections[i], nil
+		}
+	}
+	return nil, fmt.Errorf("collection %d: %w", id, collections.ErrCollectionNotFound)
+}
+
+func TestCollections(t *testing.T) {
+	repository := &stubCollections{collections: []models.Collection{
+		{ID: 1, OwnerID: "ana", Name: "Shared", Visibility: models.CollectionPublic, Slug: "shared"},
+	}}
+	service := &collections.Collections{Repository: repository}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/collections", func(w http.ResponseWriter, r *http.Request) {
+		GetCollections(w, r, service)
+	}).Methods("GET")
+	r.HandleFunc("/collections", func(w http.ResponseWriter, r *http.Request) {
+		CreateCollection(w, r, service)
+	}).Methods("POST")
+	r.HandleFunc("/collections/shared/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		GetSharedCollection(w, r, service)
+	}).Methods("GET")
+	r.HandleFunc("/collections/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetCollection(w, r, service)
+	}).Methods("GET")
+	r.HandleFunc("/collections/{id}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateCollection(w, r, service)
+	}).Methods("PUT")
+	r.HandleFunc("/collections/{id}", func(w http.ResponseWriter, r *http.Request) {
+		DeleteCollection(w, r, service)
+	}).Methods("DELETE")
+	r.HandleFunc("/collections/{id}/items", func(w http.ResponseWriter, r *http.Request) {
+		AddCollectionItem(w, r, service)
+	}).Methods("POST")
+	r.HandleFunc("/collections/{id}/items", func(w http.ResponseWriter, r *http.Request) {
+		ReorderCollectionItems(w, r, service)
+	}).Methods("PUT")
+	r.HandleFunc("/collections/{id}/items/{movieId}", func(w http.ResponseWriter, r *http.Request) {
+		RemoveCollectionItem(w, r, service)
+	}).Methods("DELETE")
+
+	ana := map[string]string{UserHeader: "ana"}
+	bruno := map[string]string{UserHeader: "bruno"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Should not list the collections without a user", method: "GET", path: "/collections", status: http.StatusUnauthorized},
+		{name: "Should list no collections", method: "GET", path: "/collections", headers: bruno, status: http.StatusOK},
+		{name: "Should create a private collection", method: "POST", path: "/collections", body: `{"name": "Horror", "movie_ids": [1, 2]}`,
+			headers: bruno, status: http.StatusCreated},
+		{name: "Should not create a collection without a name", method: "POST", path: "/collections", body: `{"visibility": "public"}`,
+			headers: bruno, status: http.StatusBadRequest},
+		{name: "Should list the collections of the user", method: "GET", path: "/collections", headers: bruno, status: http.StatusOK},
+		{name: "Should get a collection of the user", method: "GET", path: "/collections/2", headers: bruno, status: http.StatusOK},
+		{name: "Should hide the private collections of other users", method: "GET", path: "/collections/2", headers: ana, status: http.StatusNotFound},
+		{name: "Should get a public collection of anyone", method: "GET", path: "/collections/1", status: http.StatusOK},
+		{name: "Should get a shared collection", method: "GET", path: "/collections/shared/shared", status: http.StatusOK},
+		{name: "Should not get an unknown shared collection", method: "GET", path: "/collections/shared/unknown", status: http.StatusNotFound},
+		{name: "Should rename a collection", method: "PUT", path: "/collections/2", body: `{"name": "Scary", "visibility": "private"}`,
+			headers: bruno, status: http.StatusOK},
+		{name: "Should not change the collections of other users", method: "PUT", path: "/collections/1", body: `{"name": "Mine", "visibility": "public"}`,
+			headers: bruno, status: http.StatusForbidden},
+		{name: "Should add a movie", method: "POST", path: "/collections/2/items", body: `{"movie_id": 3}`, headers: bruno, status: http.StatusOK},
+		{name: "Should not add a movie twice", method: "POST", path: "/collections/2/items", body: `{"movie_id": 3}`,
+			headers: bruno, status: http.StatusConflict},
+		{name: "Should not add a movie at a negative position", method: "POST", path: "/collections/2/items", body: `{"movie_id": 4, "position": -1}`,
+			headers: bruno, status: http.StatusBadRequest},
+		{name: "Should not order part of the movies", method: "PUT", path: "/collections/2/items", body: `{"movie_ids": [3]}`,
+			headers: bruno, status: http.StatusBadRequest},
+		{name: "Should not remove a movie that isn't in the collection", method: "DELETE", path: "/collections/2/items/5",
+			headers: bruno, status: http.StatusNotFound},
+		{name: "Should delete a collection", method: "DELETE", path: "/collections/2", headers: bruno, status: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, tc.headers)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, "Scary", repository.collections[1].Name)
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/iamthiago/movies-crud/internal/movies/openapi"
+)
+
+// GetOpenAPI serves the OpenAPI description of the routes as json.
+func GetOpenAPI(w http.ResponseWriter, r *http.Request, spec *openapi.Spec) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec.JSON())
+}
+
+// GetDocs serves the page rendering the OpenAPI description, which loads it from /openapi.json.
+func GetDocs(w http.ResponseWriter, r *http.Request, page []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/enrichment"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+)
+
+func GetMovieMetadata(w http.ResponseWriter, r *http.Request, repository enrichment.MetadataRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	metadata, err := repository.GetMetadata(tenant.FromContext(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, enrichment.ErrMetadataNotFound) {
+			writeError(w, http.StatusNotFound, "the movie has no metadata")
+			return
+		}
+		fmt.Println("Error fetching movie metadata", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// EnrichMovie fills in the metadata the movie is missing from the provider, force=true replaces all of it.
+func EnrichMovie(w http.ResponseWriter, r *http.Request, service service.MoviesService, enricher *enrichment.Enricher) {
+	w.Header().Set("Content-Type", "application/json")
+	if enricher == nil {
+		writeError(w, http.StatusServiceUnavailable, "no metadata provider is configured")
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	movie, err := service.GetMovieById(id)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	metadata, err := enricher.Enrich(r.Context(), tenant.FromContext(r.Context()), *movie, force)
+	if err != nil {
+		if errors.Is(err, enrichment.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "the metadata provider doesn't know the movie")
+			return
+		}
+		fmt.Println("Error enriching movie", err)
+		writeError(w, http.StatusBadGateway, "error fetching metadata from the provider")
+		return
+	}
+
+	json.NewEncoder(w).Encode(metadata)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/enrichment"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubMetadata keeps the metadata of the movies of every tenant
+type stubMetadata struct {
+	metadata map[int64]models.MovieMetadata
+}
+
+func (s *stubMetadata) GetMetadata(tenant string, movieId int64) (*models.MovieMetadata, error) {
+	metadata, ok := s.metadata[movieId]
+	if !ok {
+		return nil, enrichment.ErrMetadataNotFound
+	}
+	return &metadata, nil
+}
+
+func (s *stubMetadata) SaveMetadata(tenant string, metadata *models.MovieMetadata) error {
+	s.metadata[metadata.MovieID] = *metadata
+	return nil
+}
+
+func TestEnrichment(t *testing.T) {
+	movies := &repository.MemoryRepository{DB: &repository.MemoryDB{}, Tenant: "default"}
+	for _, movie := range []models.Movie{
+		{Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg", ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"}},
+		{Isbn: "9780306406157", Title: "Unknown", Director: "Nobody"},
+	} {
+		_, err := movies.CreateMovie(&movie)
+		require.NoError(t, err)
+	}
+	moviesService := &service.Service{Tenant: "default", Repository: movies}
+
+	provider, err := enrichment.GetFileProvider("../enrichment/testdata/metadata.json")
+	require.NoError(t, err)
+	repo := &stubMetadata{metadata: map[int64]models.MovieMetadata{}}
+	enricher := &enrichment.Enricher{Provider: provider, Repository: repo}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/metadata", func(w http.ResponseWriter, r *http.Request) {
+		GetMovieMetadata(w, r, repo)
+	}).Methods("GET")
+	r.HandleFunc("/movies/{id}/enrich", func(w http.ResponseWriter, r *http.Request) {
+		EnrichMovie(w, r, moviesService, enricher)
+	}).Methods("POST")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{name: "Should not get the metadata of a movie not enriched yet", method: "GET", path: "/movies/1/metadata", status: http.StatusNotFound},
+		{name: "Should enrich a movie", method: "POST", path: "/movies/1/enrich", status: http.StatusOK},
+		{name: "Should get the metadata of an enriched movie", method: "GET", path: "/movies/1/metadata", status: http.StatusOK},
+		{name: "Should enrich a movie again", method: "POST", path: "/movies/1/enrich?force=true", status: http.StatusOK},
+		{name: "Should not enrich a movie the provider doesn't know", method: "POST", path: "/movies/2/enrich", status: http.StatusNotFound},
+		{name: "Should not enrich an unknown movie", method: "POST", path: "/movies/3/enrich", status: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, "", nil)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, 1975, repo.metadata[1].Year)
+
+	t.Run("Should not enrich movies without a provider", func(t *testing.T) {
+		r := mux.NewRouter()
+		r.HandleFunc("/movies/{id}/enrich", func(w http.ResponseWriter, r *http.Request) {
+			EnrichMovie(w, r, moviesService, nil)
+		}).Methods("POST")
+
+		rec := apitest.Send(t, r, "POST", "/movies/1/enrich", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: message})
+}
+
+// Unsupported answers the requests of the features the configured storage doesn't keep, with 501.
+func Unsupported(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, http.StatusNotImplemented, "not supported by the configured storage")
+}
+
+type conflictResponse struct {
+	Error      string `json:"error"`
+	ExistingID int64  `json:"existing_id"`
+}
+
+// writeConflict answers with 409 and the id of the movie holding the isbn or external id, when err is a duplicate
+func writeConflict(w http.ResponseWriter, err error) bool {
+	var duplicateIsbn *repository.DuplicateIsbnError
+	var duplicateExternalId *repository.DuplicateExternalIdError
+
+	var response conflictResponse
+	switch {
+	case errors.As(err, &duplicateIsbn):
+		response = conflictResponse{Error: duplicateIsbn.Error(), ExistingID: duplicateIsbn.ExistingID}
+	case errors.As(err, &duplicateExternalId):
+		response = conflictResponse{Error: duplicateExternalId.Error(), ExistingID: duplicateExternalId.ExistingID}
+	default:
+		return false
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(response)
+	return true
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/jobs"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/internal/movies/transfer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const jobsLimit = 100
+
+// SubmitImportJob saves the body to dir and imports it in the background,
+// for files too large to import within a request.
+func SubmitImportJob(w http.ResponseWriter, r *http.Request, manager *jobs.Manager, dir string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	opts, err := importOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f, err := os.CreateTemp(dir, "import-*."+opts.Format)
+	if err != nil {
+		fmt.Println("Error saving import file", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r.Body); err != nil {
+		os.Remove(f.Name())
+		writeError(w, http.StatusBadRequest, "error reading the import file")
+		return
+	}
+
+	params := jobs.ImportParams{File: filepath.Base(f.Name()), Format: opts.Format, DryRun: opts.DryRun, Upsert: opts.Upsert}
+	job, err := manager.Submit(tenant.FromContext(r.Context()), jobs.ImportJob, params)
+	if err != nil {
+		os.Remove(f.Name())
+		fmt.Println("Error submitting import job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeAccepted(w, job)
+}
+
+// SubmitExportJob exports the catalogue to a file that can be downloaded from /jobs/{id}/result.
+func SubmitExportJob(w http.ResponseWriter, r *http.Request, manager *jobs.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.CSV
+	}
+	if format != transfer.CSV && format != transfer.NDJSON {
+		writeError(w, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+
+	job, err := manager.Submit(tenant.FromContext(r.Context()), jobs.ExportJob, jobs.ExportParams{Format: format})
+	if err != nil {
+		fmt.Println("Error submitting export job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeAccepted(w, job)
+}
+
+// SubmitReindexJob sends the events of every movie again.
+func SubmitReindexJob(w http.ResponseWriter, r *http.Request, manager *jobs.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	job, err := manager.Submit(tenant.FromContext(r.Context()), jobs.ReindexJob, struct{}{})
+	if err != nil {
+		fmt.Println("Error submitting reindex job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeAccepted(w, job)
+}
+
+func GetJobs(w http.ResponseWriter, r *http.Request, repository jobs.JobsRepository) {
+	w.Header().Set("Content-Type", "application/json")
+
+	list, err := repository.GetJobs(tenant.FromContext(r.Context()), jobsLimit)
+	if err != nil {
+		fmt.Println("Error fetching jobs", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []models.Job{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func GetJob(w http.ResponseWriter, r *http.Request, repository jobs.JobsRepository) {
+	w.Header().Set("Content-Type", "application/json")
+
+	job, ok := findJob(w, r, repository)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelJob stops a queued or running job, finished jobs are left as they are.
+func CancelJob(w http.ResponseWriter, r *http.Request, manager *jobs.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+
+	job, ok := findJob(w, r, manager.Repository)
+	if !ok {
+		return
+	}
+	if job.IsFinished() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is already %s", job.Status))
+		return
+	}
+
+	if err := manager.Cancel(job.ID); err != nil {
+		fmt.Println("Error cancelling job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeAccepted(w, job)
+}
+
+// GetJobResult downloads the file of a finished export, other jobs return their result.
+func GetJobResult(w http.ResponseWriter, r *http.Request, repository jobs.JobsRepository, dir string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	job, ok := findJob(w, r, repository)
+	if !ok {
+		return
+	}
+	if job.Status != models.JobSucceeded {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is %s", job.Status))
+		return
+	}
+
+	if job.Type != jobs.ExportJob {
+		w.Write(job.Result)
+		return
+	}
+
+	var result jobs.ExportResult
+	if err := json.Unmarshal(job.Result, &result); err != nil {
+		fmt.Println("Error reading export result", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	path := filepath.Join(dir, filepath.Base(result.File))
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusGone, "the file of the export was removed, export the movies again")
+		return
+	}
+
+	if result.Format == transfer.NDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=movies.%s", result.Format))
+	http.ServeFile(w, r, path)
+}
+
+func findJob(w http.ResponseWriter, r *http.Request, repository jobs.JobsRepository) (*models.Job, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job id")
+		return nil, false
+	}
+
+	job, err := repository.GetJobById(tenant.FromContext(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			writeError(w, http.StatusNotFound, "job not found")
+			return nil, false
+		}
+		fmt.Println("Error fetching job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return job, true
+}
+
+func writeAccepted(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
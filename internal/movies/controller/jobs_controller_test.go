@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/jobs"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubJobs keeps the jobs, which are never claimed as the manager isn't started
+type stubJobs struct {
+	jobs []models.Job
+}
+
+func (s *stubJobs) GetJobs(tenant string, limit int) ([]models.Job, error) {
+	return s.jobs, nil
+}
+
+func (s *stubJobs) GetJobById(tenant string, id int64) (*models.Job, error) {
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return &job, nil
+		}
+	}
+	return nil, fmt.Errorf("getJobById %d: %w", id, jobs.ErrJobNotFound)
+}
+
+func (s *stubJobs) CreateJob(tenant string, jobType string, params json.RawMessage) (*models.Job, error) {
+	job := models.Job{ID: int64(len(s.jobs) + 1), Type: jobType, Status: models.JobQueued, Params: params, CreatedAt: time.Now().UTC()}
+	job.UpdatedAt = job.CreatedAt
+	s.jobs = append(s.jobs, job)
+	return &job, nil
+}
+
+func (s *stubJobs) ClaimNextJob() (*models.Job, error) {
+	return nil, nil
+}
+
+func (s *stubJobs) SaveProgress(id int64, progress json.RawMessage) error {
+	return nil
+}
+
+func (s *stubJobs) Heartbeat(id int64) (bool, error) {
+	return false, nil
+}
+
+func (s *stubJobs) FinishJob(id int64, status string, result json.RawMessage, errMsg string) error {
+	return nil
+}
+
+func (s *stubJobs) RequestCancel(id int64) error {
+	s.jobs[id-1].Status = models.JobCancelled
+	return nil
+}
+
+func (s *stubJobs) RequeueStaleJobs(lease time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func TestJobs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "export-1.csv"), []byte("isbn,title,director\n"), 0o644))
+
+	repository := &stubJobs{jobs: []models.Job{
+		{ID: 1, Type: jobs.ExportJob, Status: models.JobSucceeded, Result: json.RawMessage(`{"file":"export-1.csv","format":"csv","exported":0}`)},
+		{ID: 2, Type: jobs.ExportJob, Status: models.JobSucceeded, Result: json.RawMessage(`{"file":"export-2.csv","format":"csv","exported":0}`)},
+		{ID: 3, Type: jobs.ReindexJob, Status: models.JobSucceeded, Result: json.RawMessage(`{"reindexed":2}`)},
+	}}
+	manager := jobs.GetManager(repository, 1)
+	for _, jobType := range []string{jobs.ImportJob, jobs.ExportJob, jobs.ReindexJob} {
+		manager.Handlers[jobType] = func(ctx context.Context, job *models.Job, checkpoint jobs.Checkpoint) (interface{}, error) {
+			return nil, nil
+		}
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/export", func(w http.ResponseWriter, r *http.Request) {
+		SubmitExportJob(w, r, manager)
+	}).Methods("POST")
+	r.HandleFunc("/movies/import", func(w http.ResponseWriter, r *http.Request) {
+		SubmitImportJob(w, r, manager, dir)
+	}).Methods("POST").Queries("async", "true")
+	r.HandleFunc("/movies/reindex", func(w http.ResponseWriter, r *http.Request) {
+		SubmitReindexJob(w, r, manager)
+	}).Methods("POST")
+	r.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		GetJobs(w, r, repository)
+	}).Methods("GET")
+	r.HandleFunc("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetJob(w, r, repository)
+	}).Methods("GET")
+	r.HandleFunc("/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		CancelJob(w, r, manager)
+	}).Methods("POST")
+	r.HandleFunc("/jobs/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		GetJobResult(w, r, repository, dir)
+	}).Methods("GET")
+
+	csv := map[string]string{"Content-Type": "text/csv"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Should download the file of an export", method: "GET", path: "/jobs/1/result", status: http.StatusOK},
+		{name: "Should not download a removed export", method: "GET", path: "/jobs/2/result", status: http.StatusGone},
+		{name: "Should return the result of other jobs", method: "GET", path: "/jobs/3/result", status: http.StatusOK},
+		{name: "Should not cancel a finished job", method: "POST", path: "/jobs/3/cancel", status: http.StatusConflict},
+		{name: "Should submit an export", method: "POST", path: "/movies/export?format=ndjson", status: http.StatusAccepted},
+		{name: "Should not submit an export to an unknown format", method: "POST", path: "/movies/export?format=xml", status: http.StatusBadRequest},
+		{name: "Should submit an import", method: "POST", path: "/movies/import?async=true",
+			body: "isbn,title,director\n9780140449136,Jaws,Steven Spielberg\n", headers: csv, status: http.StatusAccepted},
+		{name: "Should submit a reindex", method: "POST", path: "/movies/reindex", status: http.StatusAccepted},
+		{name: "Should list the jobs", method: "GET", path: "/jobs", status: http.StatusOK},
+		{name: "Should get a job", method: "GET", path: "/jobs/5", status: http.StatusOK},
+		{name: "Should not get an unknown job", method: "GET", path: "/jobs/9", status: http.StatusNotFound},
+		{name: "Should not return the result of a queued job", method: "GET", path: "/jobs/4/result", status: http.StatusConflict},
+		{name: "Should cancel a queued job", method: "POST", path: "/jobs/6/cancel", status: http.StatusAccepted},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, tc.headers)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, models.JobCancelled, repository.jobs[5].Status)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/media"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+)
+
+// UploadPoster takes the poster as the "poster" file of a multipart form, up to maxBytes.
+// The content decides the image type, whatever the upload claims to be.
+func UploadPoster(w http.ResponseWriter, r *http.Request, service service.MoviesService, posters *media.Posters, maxBytes int64) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	if _, err := service.GetMovieById(id); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	// leaves room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64*1024)
+	file, _, err := r.FormFile("poster")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("poster must be at most %d bytes", maxBytes))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "the poster file is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error reading the poster")
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("poster must be at most %d bytes", maxBytes))
+		return
+	}
+
+	poster, err := posters.Upload(r.Context(), id, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrUnsupportedImage):
+			writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, media.ErrImageTooLarge):
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			fmt.Println("Error uploading poster", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(poster)
+}
+
+func DeletePoster(w http.ResponseWriter, r *http.Request, posters *media.Posters) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	if err := posters.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, media.ErrPosterNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		fmt.Println("Error deleting poster", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/media"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubPosters keeps the poster of each movie
+type stubPosters struct {
+	posters map[int64]media.PosterRecord
+}
+
+func (s *stubPosters) GetPoster(movieId int64) (*media.PosterRecord, error) {
+	poster, ok := s.posters[movieId]
+	if !ok {
+		return nil, fmt.Errorf("getPoster %d: %w", movieId, media.ErrPosterNotFound)
+	}
+	return &poster, nil
+}
+
+func (s *stubPosters) SavePoster(poster *media.PosterRecord) (*media.PosterRecord, error) {
+	previous, err := s.GetPoster(poster.MovieID)
+	s.posters[poster.MovieID] = *poster
+	if err != nil {
+		return nil, nil
+	}
+	return previous, nil
+}
+
+func (s *stubPosters) DeletePoster(movieId int64) (*media.PosterRecord, error) {
+	poster, err := s.GetPoster(movieId)
+	delete(s.posters, movieId)
+	return poster, err
+}
+
+// posterForm returns a multipart form with data as its poster file, and its content type
+func posterForm(t *testing.T, data []byte) (string, string) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("poster", "poster.png")
+	require.NoError(t, err)
+	_, err = file.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+	return body.String(), form.FormDataContentType()
+}
+
+func TestPosters(t *testing.T) {
+	movies := &repository.MemoryRepository{DB: &repository.MemoryDB{}, Tenant: "default"}
+	_, err := movies.CreateMovie(&models.Movie{Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg"})
+	require.NoError(t, err)
+	moviesService := &service.Service{Tenant: "default", Repository: movies}
+
+	posters := &media.Posters{
+		Store:      &media.LocalStore{Dir: t.TempDir(), BaseURL: "/media"},
+		Repository: &stubPosters{posters: map[int64]media.PosterRecord{}},
+	}
+	const maxBytes = 64 * 1024
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/poster", func(w http.ResponseWriter, r *http.Request) {
+		UploadPoster(w, r, moviesService, posters, maxBytes)
+	}).Methods("PUT")
+	r.HandleFunc("/movies/{id}/poster", func(w http.ResponseWriter, r *http.Request) {
+		DeletePoster(w, r, posters)
+	}).Methods("DELETE")
+
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 60))))
+	poster, posterType := posterForm(t, img.Bytes())
+	text, textType := posterForm(t, []byte("not an image"))
+	large, largeType := posterForm(t, make([]byte, maxBytes+1))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		contentType string
+		status      int
+	}{
+		{name: "Should not delete a poster the movie doesn't have", method: "DELETE", path: "/movies/1/poster", status: http.StatusNotFound},
+		{name: "Should upload a poster", method: "PUT", path: "/movies/1/poster", body: poster, contentType: posterType, status: http.StatusOK},
+		{name: "Should replace a poster", method: "PUT", path: "/movies/1/poster", body: poster, contentType: posterType, status: http.StatusOK},
+		{name: "Should not upload a poster that isn't an image", method: "PUT", path: "/movies/1/poster", body: text, contentType: textType,
+			status: http.StatusUnsupportedMediaType},
+		{name: "Should not upload a poster larger than the limit", method: "PUT", path: "/movies/1/poster", body: large, contentType: largeType,
+			status: http.StatusRequestEntityTooLarge},
+		{name: "Should not upload a poster without the file", method: "PUT", path: "/movies/1/poster", body: "{}",
+			contentType: "application/json", status: http.StatusBadRequest},
+		{name: "Should not upload the poster of an unknown movie", method: "PUT", path: "/movies/2/poster", body: poster, contentType: posterType,
+			status: http.StatusNotFound},
+		{name: "Should delete a poster", method: "DELETE", path: "/movies/1/poster", status: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, map[string]string{"Content-Type": tc.contentType})
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -2,55 +2,125 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"github.com/iamthiago/movies-crud/internal/movies/availability"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
 	"github.com/iamthiago/movies-crud/internal/movies/service"
 	"github.com/iamthiago/movies-crud/pkg/models"
 )
 
-func GetMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+// GetMovies lists the movies with their title in the language of the Accept-Language header,
+// or in defaultLanguage when they have no translation for it.
+// ?available_in=BR&on=2026-10-18 lists only the movies with an availability window open in the region that day, today by default.
+func GetMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService, repo availability.AvailabilityRepository, defaultLanguage string) {
 	w.Header().Set("Content-Type", "application/json")
 
+	available, ok := availableMovies(w, r, repo)
+	if !ok {
+		return
+	}
+
 	movies, err := service.GetMovies()
 	if err != nil {
 		fmt.Println("Error fetching movies", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if movies == nil {
+		movies = []models.Movie{}
+	}
+
+	if available != nil {
+		filtered := []models.Movie{}
+		for _, movie := range movies {
+			if available[movie.ID] {
+				filtered = append(filtered, movie)
+			}
+		}
+		movies = filtered
+	}
+
+	localized := make([]*models.Movie, len(movies))
+	for i := range movies {
+		localized[i] = &movies[i]
+	}
+	localize(w, r, defaultLanguage, localized...)
 
 	json.NewEncoder(w).Encode(movies)
 }
 
-func GetMovie(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+// GetMovie answers with the title and synopsis of the movie in the language of the Accept-Language header,
+// or in defaultLanguage when it has no translation for it.
+func GetMovie(w http.ResponseWriter, r *http.Request, service service.MoviesService, defaultLanguage string) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, err := strconv.ParseInt(params["id"], 10, 64)
 
 	if err != nil {
-		fmt.Println("Error during conversion")
+		writeError(w, http.StatusBadRequest, "invalid movie id")
 		return
 	}
 
 	movie, err := service.GetMovieById(id)
 	if err != nil {
-		if movie.IsEmpty() {
-			fmt.Println("Movie is empty", err)
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
+		writeLookupError(w, err)
+		return
+	}
 
-		fmt.Println("Error fetching movie by id", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	localize(w, r, defaultLanguage, movie)
+	json.NewEncoder(w).Encode(movie)
+}
+
+// GetMovieByIsbn accepts an ISBN-10 or ISBN-13, with or without hyphens.
+func GetMovieByIsbn(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+
+	movie, err := service.GetMovieByIsbn(mux.Vars(r)["isbn"])
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(movie)
+}
+
+// GetMovieByExternalId finds a movie by its id in another catalogue, such as /movies/by-external/imdb/tt0073195.
+func GetMovieByExternalId(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	params := mux.Vars(r)
+
+	if !models.IsExternalSource(params["source"]) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown source %s", params["source"]))
+		return
+	}
+
+	movie, err := service.GetMovieByExternalId(params["source"], params["id"])
+	if err != nil {
+		writeLookupError(w, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(movie)
 }
 
+func writeLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidIsbn):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrMovieNotFound):
+		writeError(w, http.StatusNotFound, "movie not found")
+	default:
+		fmt.Println("Error fetching movie", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 func CreateMovie(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
 	w.Header().Set("Content-Type", "application/json")
 	var movie models.Movie
@@ -58,6 +128,13 @@ func CreateMovie(w http.ResponseWriter, r *http.Request, service service.MoviesS
 
 	movieWithId, err := service.CreateMovie(&movie)
 	if err != nil {
+		if writeConflict(w, err) {
+			return
+		}
+		if errors.Is(err, models.ErrInvalidIsbn) || errors.Is(err, models.ErrInvalidLanguage) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		fmt.Println("Error creating movie", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -72,7 +149,7 @@ func UpdateMovie(w http.ResponseWriter, r *http.Request, service service.MoviesS
 	id, err := strconv.ParseInt(params["id"], 10, 64)
 
 	if err != nil {
-		fmt.Println("Error during conversion")
+		writeError(w, http.StatusBadRequest, "invalid movie id")
 		return
 	}
 
@@ -81,7 +158,18 @@ func UpdateMovie(w http.ResponseWriter, r *http.Request, service service.MoviesS
 
 	updatedMovie, dbErr := service.UpdateMovie(id, &movie)
 	if dbErr != nil {
-		fmt.Println("Error updating movie", err)
+		if writeConflict(w, dbErr) {
+			return
+		}
+		if errors.Is(dbErr, repository.ErrMovieNotFound) {
+			writeError(w, http.StatusNotFound, "movie not found")
+			return
+		}
+		if errors.Is(dbErr, models.ErrInvalidIsbn) || errors.Is(dbErr, models.ErrInvalidLanguage) {
+			writeError(w, http.StatusBadRequest, dbErr.Error())
+			return
+		}
+		fmt.Println("Error updating movie", dbErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -89,22 +177,103 @@ func UpdateMovie(w http.ResponseWriter, r *http.Request, service service.MoviesS
 	json.NewEncoder(w).Encode(updatedMovie)
 }
 
+// UpsertMovieByIsbn creates the movie with the isbn of the path, or replaces the one that already has it.
+// The isbn of the path and the one of the body, when set, can be any form of the same ISBN.
+// It answers with 201 when the movie was created and 200 when it was replaced.
+func UpsertMovieByIsbn(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	isbn, err := models.NormalizeIsbn(mux.Vars(r)["isbn"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%v %s", err, mux.Vars(r)["isbn"]))
+		return
+	}
+
+	var movie models.Movie
+	if err := json.NewDecoder(r.Body).Decode(&movie); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie")
+		return
+	}
+
+	if movie.Isbn != "" {
+		if bodyIsbn, err := models.NormalizeIsbn(movie.Isbn); err != nil || bodyIsbn != isbn {
+			writeError(w, http.StatusBadRequest, "isbn of the movie doesn't match the path")
+			return
+		}
+	}
+	movie.ID = 0
+	movie.Isbn = isbn
+
+	if err := movie.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upserted, created, err := service.UpsertMovieByIsbn(&movie)
+	if err != nil {
+		if writeConflict(w, err) {
+			return
+		}
+		fmt.Println("Error upserting movie", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if created {
+		w.Header().Set("Location", fmt.Sprintf("/movies/%d", upserted.ID))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(upserted)
+}
+
 func DeleteMovie(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, err := strconv.ParseInt(params["id"], 10, 64)
 
 	if err != nil {
-		fmt.Println("Error during conversion")
+		writeError(w, http.StatusBadRequest, "invalid movie id")
 		return
 	}
 
 	dbErr := service.DeleteMovie(id)
 	if dbErr != nil {
-		fmt.Println("Error deleting movie", err)
+		fmt.Println("Error deleting movie", dbErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// BatchMovies applies up to maxOperations creates, updates and deletes, returning the result of each one.
+// An atomic batch that fails is rolled back and answered with 422.
+func BatchMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService, maxOperations int) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var batch models.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid batch request")
+		return
+	}
+
+	if len(batch.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, "operations are required")
+		return
+	}
+	if len(batch.Operations) > maxOperations {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch accepts up to %d operations", maxOperations))
+		return
+	}
+
+	results, err := service.BatchMovies(batch.Operations, batch.Atomic)
+	if err != nil && !errors.Is(err, repository.ErrBatchAborted) {
+		fmt.Println("Error executing batch", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(map[string][]models.BatchResult{"results": results})
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/recommendations"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	defaultRecommendationsLimit = 10
+	maxRecommendationsLimit     = 50
+)
+
+// GetSimilarMovies returns the movies most similar to the movie, from the precomputed similarities.
+func GetSimilarMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService, recommender *recommendations.Recommender) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+	limit, ok := recommendationsLimit(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := service.GetMovieById(id); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	similar, err := recommender.Similar(tenant.FromContext(r.Context()), id, limit)
+	if err != nil {
+		fmt.Println("Error fetching similar movies", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeSimilarMovies(w, similar)
+}
+
+// GetRecommendations recommends movies to a user, only the user themselves can see them
+// since they reveal what is in their private collections.
+func GetRecommendations(w http.ResponseWriter, r *http.Request, recommender *recommendations.Recommender) {
+	w.Header().Set("Content-Type", "application/json")
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	if mux.Vars(r)["id"] != userId {
+		writeError(w, http.StatusForbidden, "users can only see their own recommendations")
+		return
+	}
+	limit, ok := recommendationsLimit(w, r)
+	if !ok {
+		return
+	}
+
+	recommended, err := recommender.Recommend(tenant.FromContext(r.Context()), userId, limit)
+	if err != nil {
+		fmt.Println("Error fetching recommendations", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeSimilarMovies(w, recommended)
+}
+
+func recommendationsLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultRecommendationsLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxRecommendationsLimit {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRecommendationsLimit))
+		return 0, false
+	}
+	return limit, true
+}
+
+func writeSimilarMovies(w http.ResponseWriter, similar []models.SimilarMovie) {
+	if similar == nil {
+		similar = []models.SimilarMovie{}
+	}
+	json.NewEncoder(w).Encode(similar)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/recommendations"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubRecommendations finds the movies similar to movie 1, and recommends the top rated movies to anyone
+type stubRecommendations struct {
+	similar  []models.SimilarMovie
+	topRated []models.SimilarMovie
+}
+
+func (s *stubRecommendations) GetSignals(tenant string, movieId int64) (*recommendations.Signals, error) {
+	return &recommendations.Signals{}, nil
+}
+
+func (s *stubRecommendations) SaveSimilar(tenant string, movieId int64, similar []recommendations.Similarity) error {
+	return nil
+}
+
+func (s *stubRecommendations) GetSimilar(tenant string, movieId int64, limit int) ([]models.SimilarMovie, error) {
+	if movieId != 1 {
+		return nil, nil
+	}
+	return s.similar, nil
+}
+
+func (s *stubRecommendations) GetUserMovies(tenant string, userId string) ([]int64, []int64, error) {
+	return nil, nil, nil
+}
+
+func (s *stubRecommendations) GetRecommendations(tenant string, seeds []int64, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	return nil, nil
+}
+
+func (s *stubRecommendations) GetTopRated(tenant string, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	return s.topRated, nil
+}
+
+func TestRecommendations(t *testing.T) {
+	movies := &repository.MemoryRepository{DB: &repository.MemoryDB{}, Tenant: "default"}
+	for _, movie := range []models.Movie{
+		{Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg"},
+		{Isbn: "9780306406157", Title: "Duel", Director: "Steven Spielberg"},
+	} {
+		_, err := movies.CreateMovie(&movie)
+		require.NoError(t, err)
+	}
+	moviesService := &service.Service{Tenant: "default", Repository: movies}
+
+	duel := models.Movie{ID: 2, Isbn: "9780306406157", Title: "Duel", Director: "Steven Spielberg"}
+	recommender := recommendations.GetRecommender(&stubRecommendations{
+		similar:  []models.SimilarMovie{{Movie: duel, Score: 0.4, Reasons: []string{models.SimilarDirector}}},
+		topRated: []models.SimilarMovie{{Movie: duel, Score: 0.9, Reasons: []string{models.RecommendedTopRated}}},
+	})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/similar", func(w http.ResponseWriter, r *http.Request) {
+		GetSimilarMovies(w, r, moviesService, recommender)
+	}).Methods("GET")
+	r.HandleFunc("/users/{id}/recommendations", func(w http.ResponseWriter, r *http.Request) {
+		GetRecommendations(w, r, recommender)
+	}).Methods("GET")
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Should list the similar movies", path: "/movies/1/similar", status: http.StatusOK},
+		{name: "Should list no similar movies", path: "/movies/2/similar?limit=5", status: http.StatusOK},
+		{name: "Should not list the similar movies of an unknown movie", path: "/movies/3/similar", status: http.StatusNotFound},
+		{name: "Should not list more similar movies than the limit", path: "/movies/1/similar?limit=51", status: http.StatusBadRequest},
+		{name: "Should recommend the top rated movies to new users", path: "/users/ana/recommendations",
+			headers: map[string]string{UserHeader: "ana"}, status: http.StatusOK},
+		{name: "Should not recommend movies without a user", path: "/users/ana/recommendations", status: http.StatusUnauthorized},
+		{name: "Should not show the recommendations of other users", path: "/users/ana/recommendations",
+			headers: map[string]string{UserHeader: "bruno"}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, "GET", tc.path, "", tc.headers)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/reviews"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// UserHeader identifies the user making the request, set by the gateway in front of the service
+const UserHeader = "X-User-ID"
+
+// RolesHeader lists the roles of the user making the request separated by commas, set by the gateway as well
+const RolesHeader = "X-User-Roles"
+
+// ModeratorRole lets a user see the reviews that aren't approved and set the status of the reviews
+const ModeratorRole = "moderator"
+
+const (
+	defaultReviewsLimit = 20
+	maxReviewsLimit     = 100
+)
+
+type reviewRequest struct {
+	Score int    `json:"score"`
+	Text  string `json:"text"`
+}
+
+type statusRequest struct {
+	Status string `json:"status"`
+}
+
+// GetReviews lists the approved reviews of a movie, newest first.
+// Moderators can list the pending or rejected ones with ?status=, other users get 403.
+func GetReviews(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status == "" {
+		status = models.ReviewApproved
+	}
+	if !models.IsReviewStatus(status) {
+		writeError(w, http.StatusBadRequest, "status must be pending, approved or rejected")
+		return
+	}
+	if status != models.ReviewApproved && !requireModerator(w, r) {
+		return
+	}
+
+	limit, offset := defaultReviewsLimit, 0
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxReviewsLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxReviewsLimit))
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "offset must be a positive number")
+			return
+		}
+	}
+
+	list, err := service.GetReviews(movieId, status, limit, offset)
+	if err != nil {
+		fmt.Println("Error fetching reviews", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []models.Review{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func GetReview(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := reviewIds(w, r)
+	if !ok {
+		return
+	}
+
+	review, err := service.GetReview(movieId, id)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(review)
+}
+
+// CreateReview reviews the movie as the user of the X-User-ID header, each user can review a movie once.
+func CreateReview(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	userId, review, ok := readReview(w, r)
+	if !ok {
+		return
+	}
+	review.MovieID = movieId
+	review.UserID = userId
+
+	created, err := service.Submit(review)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/movies/%d/reviews/%d", movieId, created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func UpdateReview(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := reviewIds(w, r)
+	if !ok {
+		return
+	}
+
+	userId, review, ok := readReview(w, r)
+	if !ok {
+		return
+	}
+	review.ID = id
+	review.MovieID = movieId
+
+	updated, err := service.Edit(userId, review)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteReview(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := reviewIds(w, r)
+	if !ok {
+		return
+	}
+
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := service.Delete(userId, movieId, id); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModerateReview sets the status of a review, only moderators can.
+func ModerateReview(w http.ResponseWriter, r *http.Request, service *reviews.Reviews) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, id, ok := reviewIds(w, r)
+	if !ok {
+		return
+	}
+	if !requireModerator(w, r) {
+		return
+	}
+
+	var request statusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !models.IsReviewStatus(request.Status) {
+		writeError(w, http.StatusBadRequest, "status must be pending, approved or rejected")
+		return
+	}
+
+	review, err := service.Moderate(movieId, id, request.Status)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(review)
+}
+
+func reviewIds(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	vars := mux.Vars(r)
+	movieId, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseInt(vars["reviewId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid review id")
+		return 0, 0, false
+	}
+
+	return movieId, id, true
+}
+
+// readReview reads the user and the validated score and text of a review
+func readReview(w http.ResponseWriter, r *http.Request) (string, *models.Review, bool) {
+	userId, ok := requireUser(w, r)
+	if !ok {
+		return "", nil, false
+	}
+
+	var request reviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid review")
+		return "", nil, false
+	}
+
+	review := &models.Review{Score: request.Score, Text: request.Text}
+	if err := review.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", nil, false
+	}
+
+	return userId, review, true
+}
+
+// requireUser returns the user of the X-User-ID header, answering with 401 when there is none
+func requireUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userId := r.Header.Get(UserHeader)
+	if userId == "" {
+		writeError(w, http.StatusUnauthorized, UserHeader+" header is required")
+		return "", false
+	}
+	if len(userId) > 64 {
+		writeError(w, http.StatusBadRequest, UserHeader+" is longer than 64 characters")
+		return "", false
+	}
+	return userId, true
+}
+
+// requireModerator tells whether the user of the request has the moderator role,
+// answering with 401 when there is no user and 403 when the user isn't a moderator
+func requireModerator(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := requireUser(w, r); !ok {
+		return false
+	}
+
+	for _, role := range strings.Split(r.Header.Get(RolesHeader), ",") {
+		if strings.TrimSpace(role) == ModeratorRole {
+			return true
+		}
+	}
+	writeError(w, http.StatusForbidden, "only moderators can do this")
+	return false
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	var duplicate *reviews.DuplicateReviewError
+
+	switch {
+	case errors.As(err, &duplicate):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(conflictResponse{Error: duplicate.Error(), ExistingID: duplicate.ExistingID})
+	case errors.Is(err, repository.ErrMovieNotFound):
+		writeError(w, http.StatusNotFound, "movie not found")
+	case errors.Is(err, reviews.ErrReviewNotFound):
+		writeError(w, http.StatusNotFound, "review not found")
+	case errors.Is(err, reviews.ErrNotAuthor):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		fmt.Println("Error handling review", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/reviews"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubReviews keeps the reviews of the movies, the ratings are left out
+type stubReviews struct {
+	reviews []models.Review
+}
+
+func (s *stubReviews) GetReviews(movieId int64, status string, limit int, offset int) ([]models.Review, error) {
+	list := []models.Review{}
+	for _, review := range s.reviews {
+		if review.MovieID == movieId && review.Status == status {
+			list = append(list, review)
+		}
+	}
+	return list, nil
+}
+
+func (s *stubReviews) GetReview(movieId int64, id int64) (*models.Review, error) {
+	for i := range s.reviews {
+		if s.reviews[i].MovieID == movieId && s.reviews[i].ID == id {
+			review := s.reviews[i]
+			return &review, nil
+		}
+	}
+	return nil, fmt.Errorf("getReview %d: %w", id, reviews.ErrReviewNotFound)
+}
+
+func (s *stubReviews) CreateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	for _, existing := range s.reviews {
+		if existing.MovieID == review.MovieID && existing.UserID == review.UserID {
+			return nil, nil, &reviews.DuplicateReviewError{UserID: review.UserID, ExistingID: existing.ID}
+		}
+	}
+	review.ID = int64(len(s.reviews) + 1)
+	s.reviews = append(s.reviews, *review)
+	return review, &models.Rating{}, nil
+}
+
+func (s *stubReviews) UpdateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	return review, &models.Rating{}, nil
+}
+
+func (s *stubReviews) DeleteReview(movieId int64, id int64) (*models.Rating, error) {
+	return &models.Rating{}, nil
+}
+
+func (s *stubReviews) SetReviewStatus(movieId int64, id int64, status string) (*models.Review, *models.Rating, error) {
+	for i := range s.reviews {
+		if s.reviews[i].MovieID == movieId && s.reviews[i].ID == id {
+			s.reviews[i].Status = status
+			review := s.reviews[i]
+			return &review, &models.Rating{}, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("setReviewStatus %d: %w", id, reviews.ErrReviewNotFound)
+}
+
+func (s *stubReviews) GetRating(movieId int64) (*models.Rating, error) {
+	return &models.Rating{}, nil
+}
+
+func TestModeration(t *testing.T) {
+	repository := &stubReviews{reviews: []models.Review{
+		{ID: 1, MovieID: 1, UserID: "ana", Score: 9, Text: "Still scary", Status: models.ReviewPending},
+	}}
+	service := &reviews.Reviews{Repository: repository}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		GetReviews(w, r, service)
+	}).Methods("GET")
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}/status", func(w http.ResponseWriter, r *http.Request) {
+		ModerateReview(w, r, service)
+	}).Methods("PUT")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Should list the approved reviews to anyone", method: "GET", path: "/movies/1/reviews", status: http.StatusOK},
+		{name: "Should not list the pending reviews without a user", method: "GET", path: "/movies/1/reviews?status=pending",
+			status: http.StatusUnauthorized},
+		{name: "Should not list the pending reviews to other users", method: "GET", path: "/movies/1/reviews?status=pending",
+			headers: map[string]string{UserHeader: "ana", RolesHeader: "critic"}, status: http.StatusForbidden},
+		{name: "Should not let the author approve their review", method: "PUT", path: "/movies/1/reviews/1/status", body: `{"status": "approved"}`,
+			headers: map[string]string{UserHeader: "ana"}, status: http.StatusForbidden},
+		{name: "Should not let anonymous requests moderate", method: "PUT", path: "/movies/1/reviews/1/status", body: `{"status": "approved"}`,
+			status: http.StatusUnauthorized},
+		{name: "Should list the pending reviews to moderators", method: "GET", path: "/movies/1/reviews?status=pending",
+			headers: map[string]string{UserHeader: "bruno", RolesHeader: "critic, moderator"}, status: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, tc.headers)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	assert.Equal(t, models.ReviewPending, repository.reviews[0].Status, "only moderators change the status")
+
+	rec := apitest.Send(t, r, "PUT", "/movies/1/reviews/1/status", `{"status": "approved"}`,
+		map[string]string{UserHeader: "bruno", RolesHeader: "moderator"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, models.ReviewApproved, repository.reviews[0].Status)
+}
+
+func TestReviews(t *testing.T) {
+	repository := &stubReviews{}
+	service := &reviews.Reviews{Repository: repository}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/movies/{id}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		CreateReview(w, r, service)
+	}).Methods("POST")
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", func(w http.ResponseWriter, r *http.Request) {
+		GetReview(w, r, service)
+	}).Methods("GET")
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateReview(w, r, service)
+	}).Methods("PUT")
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", func(w http.ResponseWriter, r *http.Request) {
+		DeleteReview(w, r, service)
+	}).Methods("DELETE")
+
+	ana := map[string]string{UserHeader: "ana"}
+	bruno := map[string]string{UserHeader: "bruno"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "Should review a movie", method: "POST", path: "/movies/1/reviews", body: `{"score": 9, "text": "Still scary"}`,
+			headers: ana, status: http.StatusCreated},
+		{name: "Should not review a movie twice", method: "POST", path: "/movies/1/reviews", body: `{"score": 8}`,
+			headers: ana, status: http.StatusConflict},
+		{name: "Should not review a movie without a user", method: "POST", path: "/movies/1/reviews", body: `{"score": 8}`,
+			status: http.StatusUnauthorized},
+		{name: "Should not review a movie with a score out of range", method: "POST", path: "/movies/1/reviews", body: `{"score": 11}`,
+			headers: bruno, status: http.StatusBadRequest},
+		{name: "Should get a review", method: "GET", path: "/movies/1/reviews/1", status: http.StatusOK},
+		{name: "Should not get an unknown review", method: "GET", path: "/movies/1/reviews/2", status: http.StatusNotFound},
+		{name: "Should edit a review", method: "PUT", path: "/movies/1/reviews/1", body: `{"score": 10, "text": "Even scarier"}`,
+			headers: ana, status: http.StatusOK},
+		{name: "Should not edit the reviews of other users", method: "PUT", path: "/movies/1/reviews/1", body: `{"score": 1}`,
+			headers: bruno, status: http.StatusForbidden},
+		{name: "Should not delete the reviews of other users", method: "DELETE", path: "/movies/1/reviews/1",
+			headers: bruno, status: http.StatusForbidden},
+		{name: "Should delete a review", method: "DELETE", path: "/movies/1/reviews/1", headers: ana, status: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, tc.headers)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+}
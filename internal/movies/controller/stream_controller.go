@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// StreamMovies pushes movie changes as server-sent events.
+// Clients reconnecting with Last-Event-ID get the changes they missed, or a reset event
+// when those are no longer available and they should fetch the movies again.
+func StreamMovies(w http.ResponseWriter, r *http.Request, broadcaster *changes.Broadcaster) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		fmt.Println("Streaming is not supported by the response writer")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	missed, complete, ch, unsubscribe := subscribe(broadcaster, tenant.FromContext(r.Context()), r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, change := range missed {
+		writeEvent(w, change)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case change, ok := <-ch:
+			if !ok {
+				// dropped for being too slow, the client reconnects with its Last-Event-ID
+				return
+			}
+			writeEvent(w, change)
+			flusher.Flush()
+		}
+	}
+}
+
+// WatchMovies pushes movie changes as json messages over a websocket,
+// resuming after the last_event_id query parameter when present.
+func WatchMovies(w http.ResponseWriter, r *http.Request, broadcaster *changes.Broadcaster) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Println("Error upgrading to websocket", err)
+		return
+	}
+	defer conn.Close()
+
+	missed, complete, ch, unsubscribe := subscribe(broadcaster, tenant.FromContext(r.Context()), r.URL.Query().Get("last_event_id"))
+	defer unsubscribe()
+
+	// the client is not expected to send anything, reading only detects when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if !complete {
+		conn.WriteJSON(map[string]string{"type": "reset"})
+	}
+	for _, change := range missed {
+		if err := conn.WriteJSON(change); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				return
+			}
+		case change, ok := <-ch:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+				return
+			}
+			if err := conn.WriteJSON(change); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribe follows the changes of the tenant of the request only
+func subscribe(broadcaster *changes.Broadcaster, tenantId string, lastEventId string) ([]changes.Change, bool, <-chan changes.Change, func()) {
+	if id, err := strconv.ParseUint(lastEventId, 10, 64); err == nil {
+		return broadcaster.SubscribeFrom(tenantId, id)
+	}
+
+	ch, unsubscribe := broadcaster.Subscribe(tenantId)
+	return nil, true, ch, unsubscribe
+}
+
+func writeEvent(w http.ResponseWriter, change changes.Change) {
+	data, _ := json.Marshal(change)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.ID, change.Type, data)
+}
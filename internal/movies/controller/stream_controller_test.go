@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// newStreamServer serves the change feed of studio-a, as the tenant middleware would resolve it
+func newStreamServer(t *testing.T, broadcaster *changes.Broadcaster) *httptest.Server {
+	r := http.NewServeMux()
+	r.HandleFunc("/movies/stream", func(w http.ResponseWriter, r *http.Request) {
+		StreamMovies(w, r.WithContext(tenant.NewContext(r.Context(), "studio-a")), broadcaster)
+	})
+	r.HandleFunc("/movies/stream/ws", func(w http.ResponseWriter, r *http.Request) {
+		WatchMovies(w, r.WithContext(tenant.NewContext(r.Context(), "studio-a")), broadcaster)
+	})
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// previousId publishes a change with a broadcaster started before the ones of the test, as a previous process would
+func previousId(t *testing.T) string {
+	previous := &changes.Broadcaster{}
+	ch, unsubscribe := previous.Subscribe("")
+	defer unsubscribe()
+	previous.Publish("studio-a", changes.Created, models.Movie{ID: 1})
+	change := <-ch
+
+	time.Sleep(time.Millisecond)
+	return strconv.FormatUint(change.ID, 10)
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event of the stream, skipping the comments
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event != (sseEvent{}):
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openStream(t *testing.T, server *httptest.Server, lastEventId string) *bufio.Reader {
+	req, err := http.NewRequest("GET", server.URL+"/movies/stream", nil)
+	require.NoError(t, err)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamMovies(t *testing.T) {
+	previous := previousId(t)
+	broadcaster := &changes.Broadcaster{}
+	server := newStreamServer(t, broadcaster)
+
+	// the headers are sent once subscribed
+	stream := openStream(t, server, "")
+	broadcaster.Publish("studio-b", changes.Created, models.Movie{ID: 1, Title: "Alien"})
+	broadcaster.Publish("studio-a", changes.Created, models.Movie{ID: 2, Title: "Jaws"})
+
+	created := readEvent(t, stream)
+	assert.Equal(t, "created", created.event)
+	var change changes.Change
+	require.NoError(t, json.Unmarshal([]byte(created.data), &change))
+	assert.Equal(t, "Jaws", change.Movie.Title)
+	assert.Equal(t, strconv.FormatUint(change.ID, 10), created.id)
+
+	broadcaster.Publish("studio-a", changes.Deleted, models.Movie{ID: 2})
+	deleted := readEvent(t, stream)
+	assert.Equal(t, "deleted", deleted.event)
+
+	t.Run("Should replay the changes after the last event id", func(t *testing.T) {
+		resumed := openStream(t, server, created.id)
+		assert.Equal(t, deleted, readEvent(t, resumed))
+	})
+
+	t.Run("Should reset the clients resuming from a previous process", func(t *testing.T) {
+		resumed := openStream(t, server, previous)
+		assert.Equal(t, "reset", readEvent(t, resumed).event)
+		assert.Equal(t, created, readEvent(t, resumed))
+		assert.Equal(t, deleted, readEvent(t, resumed))
+	})
+}
+
+func TestWatchMovies(t *testing.T) {
+	previous := previousId(t)
+	broadcaster := &changes.Broadcaster{}
+	server := newStreamServer(t, broadcaster)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/movies/stream/ws"
+
+	dial := func(t *testing.T, query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	ch, unsubscribe := broadcaster.Subscribe("studio-a")
+	broadcaster.Publish("studio-a", changes.Created, models.Movie{ID: 1, Title: "Jaws"})
+	broadcaster.Publish("studio-b", changes.Created, models.Movie{ID: 2, Title: "Alien"})
+	broadcaster.Publish("studio-a", changes.Updated, models.Movie{ID: 1, Title: "Jaws 2"})
+	created := <-ch
+	unsubscribe()
+
+	t.Run("Should replay the changes after the last event id", func(t *testing.T) {
+		conn := dial(t, "?last_event_id="+strconv.FormatUint(created.ID, 10))
+		var updated changes.Change
+		require.NoError(t, conn.ReadJSON(&updated))
+		assert.Equal(t, changes.Updated, updated.Type)
+		assert.Equal(t, "Jaws 2", updated.Movie.Title)
+
+		// the changes replayed, the live ones follow
+		broadcaster.Publish("studio-a", changes.Deleted, models.Movie{ID: 1})
+		var deleted changes.Change
+		require.NoError(t, conn.ReadJSON(&deleted))
+		assert.Equal(t, changes.Deleted, deleted.Type)
+		assert.Equal(t, updated.ID+1, deleted.ID)
+	})
+
+	t.Run("Should reset the clients resuming from a previous process", func(t *testing.T) {
+		conn := dial(t, "?last_event_id="+previous)
+		var reset map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&reset))
+		assert.Equal(t, "reset", reset["type"])
+	})
+}
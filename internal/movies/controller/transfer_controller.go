@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/transfer"
+)
+
+// ImportMovies streams a csv or ndjson body into the catalogue and reports the rows that failed.
+// The format comes from the format query parameter or the Content-Type header,
+// dry_run=true only validates the rows and upsert=true updates movies with the same isbn.
+func ImportMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+
+	opts, err := importOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := transfer.Import(r.Body, opts, service, nil)
+	if err != nil && report == nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		// some chunks may have been imported already, the report tells how far it went
+		fmt.Println("Error importing movies", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExportMovies streams the whole catalogue as csv or ndjson, defaulting to csv.
+func ExportMovies(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.CSV
+	}
+
+	switch format {
+	case transfer.CSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case transfer.NDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=movies.%s", format))
+
+	if _, err := transfer.Export(w, format, service); err != nil {
+		// the status is already sent, the client sees a truncated file
+		fmt.Println("Error exporting movies", err)
+	}
+}
+
+func importOptions(r *http.Request) (transfer.ImportOptions, error) {
+	query := r.URL.Query()
+	opts := transfer.ImportOptions{Format: query.Get("format")}
+
+	if opts.Format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			opts.Format = transfer.CSV
+		case "application/x-ndjson", "application/ndjson":
+			opts.Format = transfer.NDJSON
+		}
+	}
+	if opts.Format != transfer.CSV && opts.Format != transfer.NDJSON {
+		return opts, fmt.Errorf("format must be csv or ndjson")
+	}
+
+	var err error
+	if v := query.Get("dry_run"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("dry_run must be a boolean")
+		}
+	}
+	if v := query.Get("upsert"); v != "" {
+		if opts.Upsert, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("upsert must be a boolean")
+		}
+	}
+
+	return opts, nil
+}
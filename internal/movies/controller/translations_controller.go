@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/i18n"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type translationRequest struct {
+	Title    string `json:"title"`
+	Synopsis string `json:"synopsis"`
+}
+
+// GetTranslations lists the translations of a movie ordered by language.
+func GetTranslations(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return
+	}
+
+	translations, err := service.GetTranslations(movieId)
+	if err != nil {
+		writeTranslationError(w, err)
+		return
+	}
+
+	if translations == nil {
+		translations = []models.Translation{}
+	}
+	json.NewEncoder(w).Encode(translations)
+}
+
+func GetTranslation(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, language, ok := translationIds(w, r)
+	if !ok {
+		return
+	}
+
+	translations, err := service.GetTranslations(movieId)
+	if err != nil {
+		writeTranslationError(w, err)
+		return
+	}
+
+	for _, translation := range translations {
+		if translation.Language == language {
+			w.Header().Set("Content-Language", language)
+			json.NewEncoder(w).Encode(translation)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "translation not found")
+}
+
+// SaveTranslation creates or replaces the translation of a movie in the language of the path,
+// answering with 201 when it was created and 200 when it was replaced.
+func SaveTranslation(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, language, ok := translationIds(w, r)
+	if !ok {
+		return
+	}
+
+	var request translationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid translation")
+		return
+	}
+
+	translation := &models.Translation{Language: language, Title: request.Title, Synopsis: request.Synopsis}
+	if err := translation.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := service.SaveTranslation(movieId, translation)
+	if err != nil {
+		writeTranslationError(w, err)
+		return
+	}
+
+	if created {
+		w.Header().Set("Location", fmt.Sprintf("/movies/%d/translations/%s", movieId, translation.Language))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(translation)
+}
+
+func DeleteTranslation(w http.ResponseWriter, r *http.Request, service service.MoviesService) {
+	w.Header().Set("Content-Type", "application/json")
+	movieId, language, ok := translationIds(w, r)
+	if !ok {
+		return
+	}
+
+	if err := service.DeleteTranslation(movieId, language); err != nil {
+		writeTranslationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// translationIds reads the movie id and the language of the path, in its canonical form
+func translationIds(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	vars := mux.Vars(r)
+	movieId, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid movie id")
+		return 0, "", false
+	}
+
+	language, err := models.NormalizeLanguage(vars["language"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%v %s", err, vars["language"]))
+		return 0, "", false
+	}
+
+	return movieId, language, true
+}
+
+func writeTranslationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidLanguage):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrMovieNotFound):
+		writeError(w, http.StatusNotFound, "movie not found")
+	case errors.Is(err, repository.ErrTranslationNotFound):
+		writeError(w, http.StatusNotFound, "translation not found")
+	default:
+		fmt.Println("Error handling translation", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// localize picks the title and synopsis of the movies in the language preferred by the Accept-Language header,
+// naming the languages picked in the Content-Language header.
+func localize(w http.ResponseWriter, r *http.Request, defaultLanguage string, movies ...*models.Movie) {
+	preferences := i18n.Preferences(r.Header.Get("Accept-Language"))
+
+	var languages []string
+	seen := map[string]bool{}
+	for _, movie := range movies {
+		i18n.Localize(movie, preferences, defaultLanguage)
+		if !seen[movie.Language] {
+			seen[movie.Language] = true
+			languages = append(languages, movie.Language)
+		}
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	if len(languages) > 0 {
+		w.Header().Set("Content-Language", strings.Join(languages, ", "))
+	}
+}
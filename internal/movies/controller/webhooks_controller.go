@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/internal/movies/webhooks"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const deliveriesLimit = 100
+
+func GetWebhooks(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+
+	hooks, err := repository.GetWebhooks(tenant.FromContext(r.Context()))
+	if err != nil {
+		fmt.Println("Error fetching webhooks", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func GetWebhook(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	webhook, err := repository.GetWebhookById(tenant.FromContext(r.Context()), id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	webhook.Secret = ""
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// CreateWebhook generates a secret when none is given, it is only returned in this response.
+func CreateWebhook(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook")
+		return
+	}
+
+	if err := webhooks.Validate(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			fmt.Println("Error creating webhook", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = secret
+	}
+	webhook.Active = true
+
+	created, err := repository.CreateWebhook(tenant.FromContext(r.Context()), &webhook)
+	if err != nil {
+		fmt.Println("Error creating webhook", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateWebhook keeps the current secret when none is given, and setting active re-enables a disabled webhook.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook")
+		return
+	}
+
+	if err := webhooks.Validate(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	current, err := repository.GetWebhookById(tenant.FromContext(r.Context()), id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = current.Secret
+	}
+
+	updated, err := repository.UpdateWebhook(tenant.FromContext(r.Context()), id, &webhook)
+	if err != nil {
+		fmt.Println("Error updating webhook", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	updated.Secret = ""
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	if err := repository.DeleteWebhook(tenant.FromContext(r.Context()), id); err != nil {
+		fmt.Println("Error deleting webhook", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the latest delivery attempts of a webhook, to debug failing endpoints.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, repository webhooks.WebhooksRepository) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	if _, err := repository.GetWebhookById(tenant.FromContext(r.Context()), id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	deliveries, err := repository.GetDeliveries(id, deliveriesLimit)
+	if err != nil {
+		fmt.Println("Error fetching webhook deliveries", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, webhooks.ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	fmt.Println("Error fetching webhook", err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
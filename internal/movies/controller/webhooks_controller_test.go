@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/webhooks"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// stubWebhooks keeps the webhooks of every tenant and their deliveries,
+// webhooks for every change being read with no event types as the repository does
+type stubWebhooks struct {
+	webhooks   []models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *stubWebhooks) GetWebhooks(tenant string) ([]models.Webhook, error) {
+	var list []models.Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.Tenant == tenant {
+			list = append(list, webhook)
+		}
+	}
+	return list, nil
+}
+
+func (s *stubWebhooks) GetWebhookById(tenant string, id int64) (*models.Webhook, error) {
+	for _, webhook := range s.webhooks {
+		if webhook.Tenant == tenant && webhook.ID == id {
+			return &webhook, nil
+		}
+	}
+	return nil, fmt.Errorf("getWebhook %d: %w", id, webhooks.ErrWebhookNotFound)
+}
+
+func (s *stubWebhooks) CreateWebhook(tenant string, webhook *models.Webhook) (*models.Webhook, error) {
+	webhook.ID = int64(len(s.webhooks) + 1)
+	webhook.Tenant = tenant
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	s.webhooks = append(s.webhooks, *webhook)
+	return webhook, nil
+}
+
+func (s *stubWebhooks) UpdateWebhook(tenant string, id int64, webhook *models.Webhook) (*models.Webhook, error) {
+	webhook.ID = id
+	webhook.Tenant = tenant
+	s.webhooks[id-1] = *webhook
+	return webhook, nil
+}
+
+func (s *stubWebhooks) DeleteWebhook(tenant string, id int64) error {
+	return nil
+}
+
+func (s *stubWebhooks) SetWebhookStatus(id int64, active bool, failureCount int) error {
+	return nil
+}
+
+func (s *stubWebhooks) CreateDelivery(delivery *models.WebhookDelivery) error {
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+func (s *stubWebhooks) GetDeliveries(webhookId int64, limit int) ([]models.WebhookDelivery, error) {
+	var list []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookId {
+			list = append(list, delivery)
+		}
+	}
+	return list, nil
+}
+
+func TestWebhooks(t *testing.T) {
+	repository := &stubWebhooks{deliveries: []models.WebhookDelivery{
+		{ID: 1, WebhookID: 1, EventID: "1b4e28ba-2fa1-41d2-883f-0016d3cca427", EventType: "created", Attempt: 1, StatusCode: 500, Error: "500 Internal Server Error"},
+	}}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		GetWebhooks(w, r, repository)
+	}).Methods("GET")
+	r.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		CreateWebhook(w, r, repository)
+	}).Methods("POST")
+	r.HandleFunc("/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		GetWebhook(w, r, repository)
+	}).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateWebhook(w, r, repository)
+	}).Methods("PUT")
+	r.HandleFunc("/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		DeleteWebhook(w, r, repository)
+	}).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		GetWebhookDeliveries(w, r, repository)
+	}).Methods("GET")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "Should list no webhooks", method: "GET", path: "/webhooks", status: http.StatusOK},
+		{name: "Should create a webhook for every change", method: "POST", path: "/webhooks",
+			body: `{"url": "https://example.com/hooks"}`, status: http.StatusCreated},
+		{name: "Should create a webhook for some changes", method: "POST", path: "/webhooks",
+			body: `{"url": "https://example.com/deleted", "event_types": ["deleted"], "secret": "s3cr3t"}`, status: http.StatusCreated},
+		{name: "Should not create a webhook without an absolute url", method: "POST", path: "/webhooks",
+			body: `{"url": "/hooks"}`, status: http.StatusBadRequest},
+		{name: "Should list the webhooks", method: "GET", path: "/webhooks", status: http.StatusOK},
+		{name: "Should get a webhook", method: "GET", path: "/webhooks/1", status: http.StatusOK},
+		{name: "Should not get an unknown webhook", method: "GET", path: "/webhooks/3", status: http.StatusNotFound},
+		{name: "Should update a webhook", method: "PUT", path: "/webhooks/2",
+			body: `{"url": "https://example.com/changes", "event_types": ["created", "updated"], "active": true}`, status: http.StatusOK},
+		{name: "Should not update a webhook with an unknown event type", method: "PUT", path: "/webhooks/2",
+			body: `{"url": "https://example.com/changes", "event_types": ["renamed"]}`, status: http.StatusBadRequest},
+		{name: "Should list the deliveries of a webhook", method: "GET", path: "/webhooks/1/deliveries", status: http.StatusOK},
+		{name: "Should list no deliveries", method: "GET", path: "/webhooks/2/deliveries", status: http.StatusOK},
+		{name: "Should not list the deliveries of an unknown webhook", method: "GET", path: "/webhooks/3/deliveries", status: http.StatusNotFound},
+		{name: "Should delete a webhook", method: "DELETE", path: "/webhooks/1", status: http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := apitest.Send(t, r, tc.method, tc.path, tc.body, nil)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+			if tc.method == "GET" || tc.method == "PUT" {
+				assert.NotContains(t, rec.Body.String(), `"secret"`, "the secret is only returned when the webhook is created")
+			}
+		})
+	}
+	assert.Equal(t, "s3cr3t", repository.webhooks[1].Secret, "the secret is kept when none is given")
+}
@@ -0,0 +1,124 @@
+package encoder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	CloudEventsContentType = "application/cloudevents+json"
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsSource      = "/movies-crud"
+)
+
+type CloudEventsMode int
+
+const (
+	// Structured puts the whole event, attributes and data, in the message value
+	Structured CloudEventsMode = iota
+	// Binary keeps the data in the value and the attributes in ce_* headers
+	Binary
+)
+
+// CloudEventsEncoder wraps the message of the Data encoder in a CloudEvents 1.0 envelope,
+// following the kafka protocol binding.
+type CloudEventsEncoder struct {
+	Mode CloudEventsMode
+	Data EventEncoder
+}
+
+type cloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time"`
+	DataContentType string `json:"datacontenttype,omitempty"`
+	// TenantID is an extension attribute naming the tenant of the movie
+	TenantID   string          `json:"tenantid,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	DataBase64 string          `json:"data_base64,omitempty"`
+}
+
+func (e *CloudEventsEncoder) Encode(event Event) (producer.Message, error) {
+	data, err := e.Data.Encode(event)
+	if err != nil {
+		return producer.Message{}, err
+	}
+
+	id, err := uuid.New()
+	if err != nil {
+		return producer.Message{}, err
+	}
+
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          cloudEventsSource,
+		Type:            string(event.ProtoReflect().Descriptor().FullName()),
+		Subject:         strconv.FormatInt(movieId(event), 10),
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: data.Headers["content-type"],
+		TenantID:        event.GetTenantId(),
+	}
+
+	if e.Mode == Binary {
+		headers := map[string]string{
+			"content-type":   ce.DataContentType,
+			"ce_specversion": ce.SpecVersion,
+			"ce_id":          ce.ID,
+			"ce_source":      ce.Source,
+			"ce_type":        ce.Type,
+			"ce_subject":     ce.Subject,
+			"ce_time":        ce.Time,
+		}
+		if ce.TenantID != "" {
+			headers["ce_tenantid"] = ce.TenantID
+			headers[TenantHeader] = ce.TenantID
+		}
+		return producer.Message{Key: data.Key, Value: data.Value, Headers: headers}, nil
+	}
+
+	if strings.HasPrefix(ce.DataContentType, JSONContentType) {
+		ce.Data = data.Value
+	} else {
+		ce.DataBase64 = base64.StdEncoding.EncodeToString(data.Value)
+	}
+
+	value, err := json.Marshal(&ce)
+	if err != nil {
+		return producer.Message{}, fmt.Errorf("error encoding cloud event %v", err)
+	}
+
+	headers := map[string]string{"content-type": CloudEventsContentType + "; charset=UTF-8"}
+	if ce.TenantID != "" {
+		headers[TenantHeader] = ce.TenantID
+	}
+	return producer.Message{Key: data.Key, Value: value, Headers: headers}, nil
+}
+
+func decodeStructured(value []byte, event proto.Message) error {
+	var ce cloudEvent
+	if err := json.Unmarshal(value, &ce); err != nil {
+		return fmt.Errorf("error decoding cloud event %v", err)
+	}
+
+	if ce.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(ce.DataBase64)
+		if err != nil {
+			return fmt.Errorf("error decoding cloud event data %v", err)
+		}
+		return decodeData(data, ce.DataContentType, event)
+	}
+
+	return decodeData(ce.Data, ce.DataContentType, event)
+}
@@ -0,0 +1,145 @@
+package encoder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/schemaregistry"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ProtobufContentType = "application/x-protobuf"
+	JSONContentType     = "application/json"
+	// TenantHeader names the tenant of the movie, so consumers can route events without decoding them
+	TenantHeader = "tenant-id"
+)
+
+// Event is any of the messages of the events package, each of them is about a movie of a tenant.
+type Event interface {
+	proto.Message
+	GetTenantId() string
+}
+
+// EventEncoder turns an event into a kafka message, setting the content-type
+// header so consumers know how to read it.
+type EventEncoder interface {
+	Encode(event Event) (producer.Message, error)
+}
+
+// Serializer encodes protobuf messages, e.g. in the schema registry wire format.
+type Serializer interface {
+	Serialize(msg proto.Message) ([]byte, error)
+}
+
+type ProtobufEncoder struct {
+	Serializer Serializer
+}
+
+func (e *ProtobufEncoder) Encode(event Event) (producer.Message, error) {
+	var value []byte
+	var err error
+
+	if e.Serializer != nil {
+		value, err = e.Serializer.Serialize(event)
+	} else {
+		value, err = proto.Marshal(event)
+	}
+	if err != nil {
+		return producer.Message{}, fmt.Errorf("error encoding protobuf event %v", err)
+	}
+
+	return producer.Message{
+		Key:     eventKey(event),
+		Value:   value,
+		Headers: eventHeaders(event, ProtobufContentType),
+	}, nil
+}
+
+type JSONEncoder struct{}
+
+func (e *JSONEncoder) Encode(event Event) (producer.Message, error) {
+	value, err := protojson.Marshal(event)
+	if err != nil {
+		return producer.Message{}, fmt.Errorf("error encoding json event %v", err)
+	}
+
+	return producer.Message{
+		Key:     eventKey(event),
+		Value:   value,
+		Headers: eventHeaders(event, JSONContentType),
+	}, nil
+}
+
+// GetEventEncoder returns the encoder for one of the supported formats:
+// protobuf, json, cloudevents-structured or cloudevents-binary.
+// CloudEvents carry json data, so any consumer can read them without the proto.
+func GetEventEncoder(format string, serializer Serializer) (EventEncoder, error) {
+	switch format {
+	case "", "protobuf":
+		return &ProtobufEncoder{Serializer: serializer}, nil
+	case "json":
+		return &JSONEncoder{}, nil
+	case "cloudevents-structured":
+		return &CloudEventsEncoder{Mode: Structured, Data: &JSONEncoder{}}, nil
+	case "cloudevents-binary":
+		return &CloudEventsEncoder{Mode: Binary, Data: &JSONEncoder{}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown event format %s", format)
+}
+
+// Decode reads an event written by any of the encoders, based on its content-type header.
+func Decode(value []byte, headers map[string]string, event proto.Message) error {
+	contentType := headers["content-type"]
+	if strings.HasPrefix(contentType, CloudEventsContentType) {
+		return decodeStructured(value, event)
+	}
+
+	return decodeData(value, contentType, event)
+}
+
+func decodeData(data []byte, contentType string, event proto.Message) error {
+	if strings.HasPrefix(contentType, JSONContentType) {
+		return protojson.Unmarshal(data, event)
+	}
+
+	if schemaregistry.IsWireFormat(data) {
+		_, err := schemaregistry.Deserialize(data, event)
+		return err
+	}
+	return proto.Unmarshal(data, event)
+}
+
+// events of the same movie share a key, so they land on the same partition in order.
+// The key starts with the tenant, so the movies of a tenant can be told apart from the key alone.
+func eventKey(event Event) []byte {
+	id := strconv.FormatInt(movieId(event), 10)
+	if event.GetTenantId() == "" {
+		return []byte(id)
+	}
+	return []byte(event.GetTenantId() + "/" + id)
+}
+
+// movieId is the movie the event is about, the movie events carry it as their id
+func movieId(event Event) int64 {
+	switch e := event.(type) {
+	case *events.MovieEvent:
+		return e.Id
+	case interface{ GetMovieId() int64 }:
+		return e.GetMovieId()
+	}
+	return 0
+}
+
+func eventHeaders(event Event, contentType string) map[string]string {
+	headers := map[string]string{"content-type": contentType}
+	if event.GetTenantId() != "" {
+		headers[TenantHeader] = event.GetTenantId()
+	}
+	return headers
+}
@@ -0,0 +1,147 @@
+package encoder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/schemaregistry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncode(t *testing.T) {
+	event := &events.MovieEvent{Id: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}
+
+	testCases := []struct {
+		name        string
+		encoder     EventEncoder
+		contentType string
+		ceHeaders   bool
+	}{
+		{
+			name:        "Should encode protobuf",
+			encoder:     &ProtobufEncoder{},
+			contentType: ProtobufContentType,
+		},
+		{
+			name:        "Should encode protobuf in the schema registry wire format",
+			encoder:     &ProtobufEncoder{Serializer: &schemaregistry.ProtobufSerializer{Client: &schemaregistry.FakeClient{}, Subject: "movies-value", Schema: "schema"}},
+			contentType: ProtobufContentType,
+		},
+		{
+			name:        "Should encode json",
+			encoder:     &JSONEncoder{},
+			contentType: JSONContentType,
+		},
+		{
+			name:        "Should encode a structured cloud event",
+			encoder:     &CloudEventsEncoder{Mode: Structured, Data: &JSONEncoder{}},
+			contentType: CloudEventsContentType + "; charset=UTF-8",
+		},
+		{
+			name:        "Should encode a structured cloud event with binary data",
+			encoder:     &CloudEventsEncoder{Mode: Structured, Data: &ProtobufEncoder{}},
+			contentType: CloudEventsContentType + "; charset=UTF-8",
+		},
+		{
+			name:        "Should encode a binary cloud event",
+			encoder:     &CloudEventsEncoder{Mode: Binary, Data: &JSONEncoder{}},
+			contentType: JSONContentType,
+			ceHeaders:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := tc.encoder.Encode(event)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("1"), msg.Key)
+			assert.Equal(t, tc.contentType, msg.Headers["content-type"])
+
+			if tc.ceHeaders {
+				assert.Equal(t, "1.0", msg.Headers["ce_specversion"])
+				assert.Equal(t, "com.github.iamthiago.movies.v1.MovieEvent", msg.Headers["ce_type"])
+				assert.NotEmpty(t, msg.Headers["ce_id"])
+			}
+
+			var decoded events.MovieEvent
+			assert.NoError(t, Decode(msg.Value, msg.Headers, &decoded))
+			assert.True(t, proto.Equal(event, &decoded))
+		})
+	}
+}
+
+func TestEncodeTenant(t *testing.T) {
+	event := &events.MovieEvent{Id: 1, Title: "Jaws", TenantId: "studio-a"}
+
+	for _, encoder := range []EventEncoder{&ProtobufEncoder{}, &JSONEncoder{}, &CloudEventsEncoder{Mode: Structured, Data: &JSONEncoder{}}, &CloudEventsEncoder{Mode: Binary, Data: &JSONEncoder{}}} {
+		msg, err := encoder.Encode(event)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("studio-a/1"), msg.Key)
+		assert.Equal(t, "studio-a", msg.Headers[TenantHeader])
+
+		var decoded events.MovieEvent
+		assert.NoError(t, Decode(msg.Value, msg.Headers, &decoded))
+		assert.Equal(t, "studio-a", decoded.TenantId)
+	}
+}
+
+func TestStructuredCloudEventAttributes(t *testing.T) {
+	encoder := CloudEventsEncoder{Mode: Structured, Data: &JSONEncoder{}}
+
+	msg, err := encoder.Encode(&events.MovieEvent{Id: 7, Title: "Jaws"})
+	assert.NoError(t, err)
+
+	var ce map[string]interface{}
+	assert.NoError(t, json.Unmarshal(msg.Value, &ce))
+	assert.Equal(t, "1.0", ce["specversion"])
+	assert.Equal(t, "/movies-crud", ce["source"])
+	assert.Equal(t, "7", ce["subject"])
+	assert.Equal(t, JSONContentType, ce["datacontenttype"])
+	assert.Equal(t, map[string]interface{}{"id": "7", "title": "Jaws"}, ce["data"])
+}
+
+func TestGetEventEncoder(t *testing.T) {
+	for _, format := range []string{"protobuf", "json", "cloudevents-structured", "cloudevents-binary"} {
+		_, err := GetEventEncoder(format, nil)
+		assert.NoError(t, err, format)
+	}
+
+	_, err := GetEventEncoder("avro", nil)
+	assert.EqualError(t, err, "unknown event format avro")
+}
+
+func TestEncodeOtherEvents(t *testing.T) {
+	testCases := []struct {
+		name     string
+		event    Event
+		decoded  proto.Message
+		wantType string
+	}{
+		{name: "Should key a review event by its movie", event: &events.ReviewSubmitted{ReviewId: 9, MovieId: 3, Score: 8, TenantId: "studio-a"},
+			decoded: &events.ReviewSubmitted{}, wantType: "com.github.iamthiago.movies.v1.ReviewSubmitted"},
+		{name: "Should key an availability event by its movie", event: &events.AvailabilityChanged{WindowId: 9, MovieId: 3, Region: "BR", TenantId: "studio-a"},
+			decoded: &events.AvailabilityChanged{}, wantType: "com.github.iamthiago.movies.v1.AvailabilityChanged"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, encoder := range []EventEncoder{&ProtobufEncoder{}, &JSONEncoder{}, &CloudEventsEncoder{Mode: Structured, Data: &JSONEncoder{}}} {
+				msg, err := encoder.Encode(tc.event)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("studio-a/3"), msg.Key)
+				assert.Equal(t, "studio-a", msg.Headers[TenantHeader])
+
+				decoded := proto.Clone(tc.decoded)
+				assert.NoError(t, Decode(msg.Value, msg.Headers, decoded))
+				assert.True(t, proto.Equal(tc.event, decoded))
+			}
+
+			msg, err := (&CloudEventsEncoder{Mode: Binary, Data: &JSONEncoder{}}).Encode(tc.event)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantType, msg.Headers["ce_type"])
+			assert.Equal(t, "3", msg.Headers["ce_subject"])
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// Enricher fills in the metadata of movies from a provider.
+type Enricher struct {
+	Provider   MetadataProvider
+	Repository MetadataRepository
+	// QueueSize is how many created movies can wait to be enriched, the ones past it are skipped
+	QueueSize int
+}
+
+func GetEnricher(provider MetadataProvider, repository MetadataRepository, cacheTTL time.Duration) *Enricher {
+	return &Enricher{
+		Provider:   &CachedProvider{Provider: provider, TTL: cacheTTL},
+		Repository: repository,
+		QueueSize:  1000,
+	}
+}
+
+// Enrich looks the movie of the tenant up and fills in the fields it doesn't have yet, or every field when force is set.
+// It returns ErrNotFound when the provider doesn't know the movie.
+func (e *Enricher) Enrich(ctx context.Context, tenant string, movie models.Movie, force bool) (*models.MovieMetadata, error) {
+	current, err := e.Repository.GetMetadata(tenant, movie.ID)
+	if errors.Is(err, ErrMetadataNotFound) {
+		current, err = &models.MovieMetadata{MovieID: movie.ID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fetched, err := e.Provider.Lookup(ctx, QueryFor(movie))
+	if err != nil {
+		return nil, err
+	}
+
+	if merge(current, fetched, e.Provider.Name(), force, time.Now().UTC()) {
+		if err := e.Repository.SaveMetadata(tenant, current); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// Run enriches the movies created by every tenant until the context is cancelled,
+// one at a time so the provider isn't flooded.
+func (e *Enricher) Run(ctx context.Context, broadcaster *changes.Broadcaster) {
+	queue := make(chan changes.Change, e.QueueSize)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change := <-queue:
+				if _, err := e.Enrich(ctx, change.Tenant, change.Movie, false); err != nil && !errors.Is(err, ErrNotFound) {
+					log.Printf("Error enriching movie %d of tenant %s: %v\n", change.Movie.ID, change.Tenant, err)
+				}
+			}
+		}
+	}()
+
+	for {
+		ch, unsubscribe := broadcaster.Subscribe("")
+
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			case change, ok := <-ch:
+				if !ok {
+					log.Println("Enricher fell behind, some created movies were not enriched")
+					open = false
+					continue
+				}
+				if change.Type != changes.Created {
+					continue
+				}
+
+				select {
+				case queue <- change:
+				default:
+					log.Printf("Enrichment queue is full, movie %d was not enriched\n", change.Movie.ID)
+				}
+			}
+		}
+	}
+}
+
+// merge copies the fetched fields into the metadata, recording where they came from.
+// It tells whether anything changed.
+func merge(metadata *models.MovieMetadata, fetched *Metadata, source string, force bool, now time.Time) bool {
+	if metadata.Provenance == nil {
+		metadata.Provenance = map[string]models.Provenance{}
+	}
+	provenance := models.Provenance{Source: source, SourceID: fetched.SourceID, FetchedAt: now}
+	changed := false
+
+	set := func(field string, empty bool, known bool, assign func()) {
+		if known && (empty || force) {
+			assign()
+			metadata.Provenance[field] = provenance
+			changed = true
+		}
+	}
+
+	set(models.MetadataSynopsis, metadata.Synopsis == "", fetched.Synopsis != "", func() { metadata.Synopsis = fetched.Synopsis })
+	set(models.MetadataYear, metadata.Year == 0, fetched.Year != 0, func() { metadata.Year = fetched.Year })
+	set(models.MetadataRuntime, metadata.RuntimeMinutes == 0, fetched.RuntimeMinutes != 0, func() { metadata.RuntimeMinutes = fetched.RuntimeMinutes })
+	set(models.MetadataPosterURL, metadata.PosterURL == "", fetched.PosterURL != "", func() { metadata.PosterURL = fetched.PosterURL })
+
+	return changed
+}
@@ -0,0 +1,177 @@
+package enrichment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepository struct {
+	metadata map[int64]models.MovieMetadata
+	saves    int
+}
+
+func (f *fakeRepository) GetMetadata(tenant string, movieId int64) (*models.MovieMetadata, error) {
+	m, ok := f.metadata[movieId]
+	if !ok {
+		return nil, fmt.Errorf("getMetadata %d: %w", movieId, ErrMetadataNotFound)
+	}
+	return &m, nil
+}
+
+func (f *fakeRepository) SaveMetadata(tenant string, metadata *models.MovieMetadata) error {
+	f.saves++
+	f.metadata[metadata.MovieID] = *metadata
+	return nil
+}
+
+func TestEnrich(t *testing.T) {
+	provider, err := GetFileProvider("testdata/metadata.json")
+	assert.NoError(t, err)
+
+	jaws := models.Movie{ID: 1, Title: "Jaws", ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"}}
+	edited := models.Provenance{Source: "omdb", SourceID: "tt0073195"}
+
+	testCases := []struct {
+		name        string
+		movie       models.Movie
+		existing    *models.MovieMetadata
+		force       bool
+		want        models.MovieMetadata
+		wantSources map[string]string
+		wantSaves   int
+		wantErr     error
+	}{
+		{
+			name:  "Should fill in the metadata of a movie by its imdb id",
+			movie: jaws,
+			want: models.MovieMetadata{MovieID: 1, Synopsis: "A shark terrorizes a beach town.", Year: 1975, RuntimeMinutes: 124,
+				PosterURL: "https://example.com/jaws.jpg"},
+			wantSources: map[string]string{models.MetadataSynopsis: "file", models.MetadataYear: "file", models.MetadataRuntime: "file", models.MetadataPosterURL: "file"},
+			wantSaves:   1,
+		},
+		{
+			name:  "Should only fill in the fields the movie is missing",
+			movie: jaws,
+			existing: &models.MovieMetadata{MovieID: 1, Synopsis: "Amity island has a shark problem.", Year: 1975, RuntimeMinutes: 124,
+				PosterURL: "https://example.com/jaws.jpg", Provenance: map[string]models.Provenance{models.MetadataSynopsis: edited}},
+			want: models.MovieMetadata{MovieID: 1, Synopsis: "Amity island has a shark problem.", Year: 1975, RuntimeMinutes: 124,
+				PosterURL: "https://example.com/jaws.jpg"},
+			wantSources: map[string]string{models.MetadataSynopsis: "omdb"},
+		},
+		{
+			name:  "Should replace every field when forced",
+			movie: jaws,
+			existing: &models.MovieMetadata{MovieID: 1, Synopsis: "Amity island has a shark problem.",
+				Provenance: map[string]models.Provenance{models.MetadataSynopsis: edited}},
+			force: true,
+			want: models.MovieMetadata{MovieID: 1, Synopsis: "A shark terrorizes a beach town.", Year: 1975, RuntimeMinutes: 124,
+				PosterURL: "https://example.com/jaws.jpg"},
+			wantSources: map[string]string{models.MetadataSynopsis: "file", models.MetadataYear: "file", models.MetadataRuntime: "file", models.MetadataPosterURL: "file"},
+			wantSaves:   1,
+		},
+		{
+			name:        "Should look a movie up by its title without an imdb id",
+			movie:       models.Movie{ID: 2, Title: "The Martian"},
+			want:        models.MovieMetadata{MovieID: 2, Synopsis: "An astronaut is stranded on Mars.", Year: 2015, RuntimeMinutes: 144},
+			wantSources: map[string]string{models.MetadataSynopsis: "file", models.MetadataYear: "file", models.MetadataRuntime: "file"},
+			wantSaves:   1,
+		},
+		{
+			name:    "Should return not found for an unknown movie",
+			movie:   models.Movie{ID: 3, Title: "Alien"},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{metadata: map[int64]models.MovieMetadata{}}
+			if tc.existing != nil {
+				repo.metadata[tc.existing.MovieID] = *tc.existing
+			}
+			enricher := GetEnricher(provider, repo, time.Minute)
+
+			metadata, err := enricher.Enrich(context.Background(), "studio", tc.movie, tc.force)
+			assert.Equal(t, tc.wantSaves, repo.saves)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			// the provenance is checked on its own, since it holds the time of the lookup
+			sources := map[string]string{}
+			for field, provenance := range metadata.Provenance {
+				sources[field] = provenance.Source
+			}
+			assert.Equal(t, tc.wantSources, sources)
+			metadata.Provenance = nil
+			assert.Equal(t, tc.want, *metadata)
+		})
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request is rate limited
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		assert.Equal(t, "secret", r.URL.Query().Get("apikey"))
+		switch r.URL.Query().Get("i") {
+		case "tt0073195":
+			w.Write([]byte(`{"Response": "True", "imdbID": "tt0073195", "Year": "1975", "Runtime": "124 min", "Plot": "A shark.", "Poster": "N/A"}`))
+		default:
+			w.Write([]byte(`{"Response": "False", "Error": "Movie not found!"}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := GetHTTPProvider(server.URL, "secret", 100)
+
+	metadata, err := provider.Lookup(context.Background(), Query{IMDbID: "tt0073195"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Metadata{SourceID: "tt0073195", Synopsis: "A shark.", Year: 1975, RuntimeMinutes: 124}, metadata)
+	assert.Equal(t, int32(2), requests)
+
+	_, err = provider.Lookup(context.Background(), Query{IMDbID: "tt0000000"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+type countingProvider struct {
+	MetadataProvider
+	lookups int
+}
+
+func (c *countingProvider) Lookup(ctx context.Context, query Query) (*Metadata, error) {
+	c.lookups++
+	return c.MetadataProvider.Lookup(ctx, query)
+}
+
+func TestCachedProvider(t *testing.T) {
+	file, err := GetFileProvider("testdata/metadata.json")
+	assert.NoError(t, err)
+	counting := &countingProvider{MetadataProvider: file}
+	cached := &CachedProvider{Provider: counting, TTL: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		_, err := cached.Lookup(context.Background(), Query{IMDbID: "tt0073195"})
+		assert.NoError(t, err)
+		_, err = cached.Lookup(context.Background(), Query{Title: "Alien"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	assert.Equal(t, 2, counting.lookups)
+}
@@ -0,0 +1,55 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileProvider reads the metadata from a json file, for tests and for working without a provider.
+// The file maps imdb ids or titles to the metadata of the movie:
+//
+//	{"tt0073195": {"synopsis": "...", "year": 1975, "runtime_minutes": 124, "poster_url": "..."}}
+type FileProvider struct {
+	movies map[string]fileMetadata
+}
+
+type fileMetadata struct {
+	Synopsis       string `json:"synopsis"`
+	Year           int    `json:"year"`
+	RuntimeMinutes int    `json:"runtime_minutes"`
+	PosterURL      string `json:"poster_url"`
+}
+
+func GetFileProvider(path string) (*FileProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata file %v", err)
+	}
+
+	provider := &FileProvider{}
+	if err := json.Unmarshal(data, &provider.movies); err != nil {
+		return nil, fmt.Errorf("error parsing metadata file %v", err)
+	}
+	return provider, nil
+}
+
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+func (p *FileProvider) Lookup(ctx context.Context, query Query) (*Metadata, error) {
+	for _, key := range []string{query.IMDbID, query.Title} {
+		if m, ok := p.movies[key]; ok && key != "" {
+			return &Metadata{
+				SourceID:       key,
+				Synopsis:       m.Synopsis,
+				Year:           m.Year,
+				RuntimeMinutes: m.RuntimeMinutes,
+				PosterURL:      m.PosterURL,
+			}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
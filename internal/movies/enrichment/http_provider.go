@@ -0,0 +1,141 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPProvider looks movies up in an OMDb compatible api.
+// Requests are spaced out by MinInterval, and a 429 response pauses them for as long as the provider asks.
+type HTTPProvider struct {
+	URL         string
+	APIKey      string
+	Client      *http.Client
+	MinInterval time.Duration
+	MaxRetries  int
+
+	limiter rateLimiter
+}
+
+func GetHTTPProvider(url string, apiKey string, requestsPerSecond int) *HTTPProvider {
+	provider := &HTTPProvider{
+		URL:        url,
+		APIKey:     apiKey,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+	}
+	if requestsPerSecond > 0 {
+		provider.MinInterval = time.Second / time.Duration(requestsPerSecond)
+	}
+	return provider
+}
+
+type omdbResponse struct {
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+	IMDbID   string `json:"imdbID"`
+	Year     string `json:"Year"`
+	Runtime  string `json:"Runtime"`
+	Plot     string `json:"Plot"`
+	Poster   string `json:"Poster"`
+}
+
+func (p *HTTPProvider) Name() string {
+	return "omdb"
+}
+
+func (p *HTTPProvider) Lookup(ctx context.Context, query Query) (*Metadata, error) {
+	params := url.Values{"apikey": {p.APIKey}, "plot": {"short"}}
+	if query.IMDbID != "" {
+		params.Set("i", query.IMDbID)
+	} else {
+		params.Set("t", query.Title)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := p.limiter.wait(ctx, p.MinInterval); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("enrichment: %v", err)
+		}
+
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("enrichment: %v", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < p.MaxRetries {
+			resp.Body.Close()
+			p.limiter.pauseUntil(time.Now().Add(retryAfter(resp.Header.Get("Retry-After"), attempt)))
+			continue
+		}
+
+		metadata, err := decodeOMDb(resp)
+		resp.Body.Close()
+		return metadata, err
+	}
+}
+
+func decodeOMDb(resp *http.Response) (*Metadata, error) {
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrichment: unexpected status %d", resp.StatusCode)
+	}
+
+	var body omdbResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("enrichment: invalid response %v", err)
+	}
+
+	if body.Response == "False" {
+		if strings.Contains(strings.ToLower(body.Error), "not found") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("enrichment: %s", body.Error)
+	}
+
+	return &Metadata{
+		SourceID:       body.IMDbID,
+		Synopsis:       known(body.Plot),
+		Year:           leadingInt(known(body.Year)),
+		RuntimeMinutes: leadingInt(known(body.Runtime)),
+		PosterURL:      known(body.Poster),
+	}, nil
+}
+
+// retryAfter reads the seconds of a Retry-After header, backing off exponentially without one
+func retryAfter(header string, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Second << attempt
+}
+
+// known drops the "N/A" the api answers for unknown fields
+func known(value string) string {
+	if value == "N/A" {
+		return ""
+	}
+	return value
+}
+
+// leadingInt reads the number at the start of values like "1975" or "124 min"
+func leadingInt(value string) int {
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(value[:end])
+	return n
+}
@@ -0,0 +1,83 @@
+package enrichment
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrMetadataNotFound = errors.New("no metadata for the movie")
+
+// MetadataRepository keeps the metadata of the movies of every tenant, as the enricher works for all of them.
+type MetadataRepository interface {
+	GetMetadata(tenant string, movieId int64) (*models.MovieMetadata, error)
+	SaveMetadata(tenant string, metadata *models.MovieMetadata) error
+}
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func (r *Repository) GetMetadata(tenant string, movieId int64) (*models.MovieMetadata, error) {
+	metadata := models.MovieMetadata{MovieID: movieId, Provenance: map[string]models.Provenance{}}
+
+	row := r.DB.QueryRow("select synopsis, year, runtime_minutes, poster_url from movie_metadata where tenant_id = ? and movie_id = ?", tenant, movieId)
+	if err := row.Scan(&metadata.Synopsis, &metadata.Year, &metadata.RuntimeMinutes, &metadata.PosterURL); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getMetadata %d: %w", movieId, ErrMetadataNotFound)
+		}
+		return nil, fmt.Errorf("getMetadata %d: %v", movieId, err)
+	}
+
+	rows, err := r.DB.Query("select field, source, source_id, fetched_at from metadata_provenance where tenant_id = ? and movie_id = ?", tenant, movieId)
+	if err != nil {
+		return nil, fmt.Errorf("getMetadata %d: %v", movieId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field string
+		var provenance models.Provenance
+		if err := rows.Scan(&field, &provenance.Source, &provenance.SourceID, &provenance.FetchedAt); err != nil {
+			return nil, fmt.Errorf("getMetadata %d: %v", movieId, err)
+		}
+		metadata.Provenance[field] = provenance
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getMetadata %d: %v", movieId, err)
+	}
+
+	return &metadata, nil
+}
+
+func (r *Repository) SaveMetadata(tenant string, metadata *models.MovieMetadata) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("save metadata: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("insert into movie_metadata (tenant_id, movie_id, synopsis, year, runtime_minutes, poster_url) values (?, ?, ?, ?, ?, ?) "+
+		"on duplicate key update synopsis = values(synopsis), year = values(year), runtime_minutes = values(runtime_minutes), poster_url = values(poster_url)",
+		tenant, metadata.MovieID, metadata.Synopsis, metadata.Year, metadata.RuntimeMinutes, metadata.PosterURL)
+	if err != nil {
+		return fmt.Errorf("save metadata: %v", err)
+	}
+
+	for field, provenance := range metadata.Provenance {
+		_, err := tx.Exec("insert into metadata_provenance (tenant_id, movie_id, field, source, source_id, fetched_at) values (?, ?, ?, ?, ?, ?) "+
+			"on duplicate key update source = values(source), source_id = values(source_id), fetched_at = values(fetched_at)",
+			tenant, metadata.MovieID, field, provenance.Source, provenance.SourceID, provenance.FetchedAt)
+		if err != nil {
+			return fmt.Errorf("save metadata provenance: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save metadata: %v", err)
+	}
+	return nil
+}
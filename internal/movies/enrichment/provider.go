@@ -0,0 +1,134 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrNotFound = errors.New("enrichment: movie not found")
+
+// Query identifies a movie in a provider, by its imdb id when there is one and otherwise by its title.
+type Query struct {
+	IMDbID string
+	Title  string
+}
+
+func QueryFor(movie models.Movie) Query {
+	return Query{IMDbID: movie.ExternalIDs[models.SourceIMDb], Title: movie.Title}
+}
+
+func (q Query) key() string {
+	if q.IMDbID != "" {
+		return "imdb:" + q.IMDbID
+	}
+	return "title:" + q.Title
+}
+
+// Metadata is what a provider knows about a movie, zero values are unknown.
+type Metadata struct {
+	// SourceID is the id of the movie in the provider
+	SourceID       string
+	Synopsis       string
+	Year           int
+	RuntimeMinutes int
+	PosterURL      string
+}
+
+type MetadataProvider interface {
+	// Name is recorded as the source of the fields filled in by the provider
+	Name() string
+	// Lookup returns ErrNotFound when the provider doesn't know the movie
+	Lookup(ctx context.Context, query Query) (*Metadata, error)
+}
+
+// CachedProvider keeps the lookups of another provider for a while, including the movies it doesn't know.
+type CachedProvider struct {
+	Provider MetadataProvider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	metadata  *Metadata
+	err       error
+	expiresAt time.Time
+}
+
+func (c *CachedProvider) Name() string {
+	return c.Provider.Name()
+}
+
+func (c *CachedProvider) Lookup(ctx context.Context, query Query) (*Metadata, error) {
+	key := query.key()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.metadata, entry.err
+	}
+
+	metadata, err := c.Provider.Lookup(ctx, query)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	// expired entries are dropped as new ones come in, so the cache doesn't keep growing
+	for k, e := range c.entries {
+		if time.Now().After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{metadata: metadata, err: err, expiresAt: time.Now().Add(c.TTL)}
+
+	return metadata, err
+}
+
+// rateLimiter spaces out requests by a minimum interval, and can be paused when the provider asks to slow down.
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (l *rateLimiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(interval)
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (l *rateLimiter) pauseUntil(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.next) {
+		l.next = until
+	}
+}
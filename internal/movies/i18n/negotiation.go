@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// Preferences returns the language tags of an Accept-Language header, most preferred first.
+// Wildcards, the languages refused with q=0 and a malformed header are left out.
+func Preferences(acceptLanguage string) []string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return nil
+	}
+
+	preferences := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		// the wildcard is parsed as mul, multiple languages
+		if _, confidence := tag.Base(); confidence == language.Exact && tag.String() != "mul" {
+			preferences = append(preferences, tag.String())
+		}
+	}
+	return preferences
+}
+
+// Lookup returns the first of the available languages matching the preferences. Each preference falls back
+// from its most to its least specific tag before trying the next one, so zh-Hant-TW tries zh-Hant and then zh.
+func Lookup(preferences []string, available []string) (string, bool) {
+	for _, preference := range preferences {
+		for tag := preference; tag != ""; tag = parent(tag) {
+			for _, language := range available {
+				if strings.EqualFold(tag, language) {
+					return language, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// parent drops the last subtag, along with a single letter subtag left before it such as the x of private use tags
+func parent(tag string) string {
+	i := strings.LastIndex(tag, "-")
+	if i < 0 {
+		return ""
+	}
+
+	tag = tag[:i]
+	if i >= 2 && tag[i-2] == '-' {
+		tag = tag[:i-2]
+	}
+	return tag
+}
+
+// Localize replaces the title and synopsis of the movie with its translation in the preferred language,
+// falling back on its own title, which is in the default language. It sets the language it picked
+// and drops the other translations.
+func Localize(movie *models.Movie, preferences []string, defaultLanguage string) {
+	available := []string{defaultLanguage}
+	translations := map[string]models.Translation{}
+	for _, translation := range movie.Translations {
+		available = append(available, translation.Language)
+		translations[translation.Language] = translation
+	}
+
+	chain := make([]string, 0, len(preferences)+1)
+	chain = append(chain, preferences...)
+	chain = append(chain, defaultLanguage)
+
+	language, _ := Lookup(chain, available)
+	if translation, ok := translations[language]; ok {
+		movie.Title = translation.Title
+		movie.Synopsis = translation.Synopsis
+	}
+	movie.Language = language
+	movie.Translations = nil
+}
@@ -0,0 +1,92 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+func TestPreferences(t *testing.T) {
+	testCases := []struct {
+		name           string
+		acceptLanguage string
+		want           []string
+	}{
+		{name: "Should order by quality", acceptLanguage: "fr;q=0.5, pt-br, en;q=0.8", want: []string{"pt-BR", "en", "fr"}},
+		{name: "Should leave out refused languages and wildcards", acceptLanguage: "de;q=0, *;q=0.1, es", want: []string{"es"}},
+		{name: "Should ignore an empty header", acceptLanguage: "", want: []string{}},
+		{name: "Should ignore a malformed header", acceptLanguage: "en;q=high", want: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Preferences(tc.acceptLanguage))
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	available := []string{"en", "pt", "zh-Hant", "es-419"}
+
+	testCases := []struct {
+		name        string
+		preferences []string
+		want        string
+		found       bool
+	}{
+		{name: "Should match the exact tag", preferences: []string{"es-419"}, want: "es-419", found: true},
+		{name: "Should ignore the case", preferences: []string{"ZH-hant"}, want: "zh-Hant", found: true},
+		{name: "Should fall back on the language", preferences: []string{"pt-BR"}, want: "pt", found: true},
+		{name: "Should fall back on the script", preferences: []string{"zh-Hant-TW"}, want: "zh-Hant", found: true},
+		{name: "Should fall back on the language before the next preference", preferences: []string{"pt-PT", "en"}, want: "pt", found: true},
+		{name: "Should try the next preference", preferences: []string{"fr-CA", "en-GB"}, want: "en", found: true},
+		{name: "Should drop private use subtags", preferences: []string{"en-x-imdb"}, want: "en", found: true},
+		{name: "Should not match a more specific tag", preferences: []string{"es"}, found: false},
+		{name: "Should find nothing without preferences", preferences: nil, found: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, found := Lookup(tc.preferences, available)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	jaws := func() *models.Movie {
+		return &models.Movie{ID: 1, Title: "Jaws", Translations: []models.Translation{
+			{Language: "pt-BR", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."},
+			{Language: "es", Title: "Tiburón"},
+		}}
+	}
+
+	testCases := []struct {
+		name         string
+		preferences  []string
+		wantLanguage string
+		wantTitle    string
+		wantSynopsis string
+	}{
+		{name: "Should use the translation", preferences: []string{"pt-BR"}, wantLanguage: "pt-BR", wantTitle: "Tubarão", wantSynopsis: "Um tubarão aterroriza uma pequena cidade."},
+		{name: "Should fall back on a less specific translation", preferences: []string{"es-MX"}, wantLanguage: "es", wantTitle: "Tiburón"},
+		{name: "Should prefer the default language when asked first", preferences: []string{"en-US", "pt-BR"}, wantLanguage: "en", wantTitle: "Jaws"},
+		{name: "Should fall back on the default language", preferences: []string{"fr"}, wantLanguage: "en", wantTitle: "Jaws"},
+		{name: "Should use the default language without preferences", preferences: nil, wantLanguage: "en", wantTitle: "Jaws"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			movie := jaws()
+			Localize(movie, tc.preferences, "en")
+
+			assert.Equal(t, tc.wantLanguage, movie.Language)
+			assert.Equal(t, tc.wantTitle, movie.Title)
+			assert.Equal(t, tc.wantSynopsis, movie.Synopsis)
+			assert.Nil(t, movie.Translations)
+		})
+	}
+}
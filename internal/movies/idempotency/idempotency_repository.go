@@ -0,0 +1,124 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Record is the stored response of a request made with an idempotency key.
+// Until the request finishes it is locked and Completed is false.
+type Record struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyRepository keeps the keys of each tenant apart, so tenants can use the same keys.
+type IdempotencyRepository interface {
+	// Lock takes the key for a new request, when the key is already taken the existing record is returned.
+	// A lock older than lockTimeout, left by a request that never finished, is taken over.
+	Lock(tenant string, key string, requestHash string, ttl time.Duration, lockTimeout time.Duration) (existing *Record, err error)
+	Complete(tenant string, key string, status int, contentType string, body []byte) error
+	// Unlock drops the key of a request that failed, so it can be retried
+	Unlock(tenant string, key string) error
+	DeleteExpired() (int64, error)
+}
+
+type Repository struct {
+	DB *sql.DB
+}
+
+const duplicateEntry = 1062
+
+func (r *Repository) Lock(tenant string, key string, requestHash string, ttl time.Duration, lockTimeout time.Duration) (*Record, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := r.DB.Exec("insert into idempotency_keys (tenant_id, idempotency_key, request_hash, completed, status, content_type, body, locked_until, expires_at) "+
+			"values (?, ?, ?, false, 0, '', '', now() + interval ? second, now() + interval ? second)",
+			tenant, key, requestHash, int(lockTimeout.Seconds()), int(ttl.Seconds()))
+		if err == nil {
+			return nil, nil
+		}
+
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != duplicateEntry {
+			return nil, fmt.Errorf("lock idempotency key: %v", err)
+		}
+
+		// an expired key is free again
+		result, err := r.DB.Exec("delete from idempotency_keys where tenant_id = ? and idempotency_key = ? and expires_at < now()", tenant, key)
+		if err != nil {
+			return nil, fmt.Errorf("lock idempotency key: %v", err)
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 1 {
+			continue
+		}
+
+		result, err = r.DB.Exec("update idempotency_keys set locked_until = now() + interval ? second "+
+			"where tenant_id = ? and idempotency_key = ? and request_hash = ? and completed = false and locked_until < now()",
+			int(lockTimeout.Seconds()), tenant, key, requestHash)
+		if err != nil {
+			return nil, fmt.Errorf("lock idempotency key: %v", err)
+		}
+		if taken, _ := result.RowsAffected(); taken == 1 {
+			return nil, nil
+		}
+
+		existing, err := r.getRecord(tenant, key)
+		if err == sql.ErrNoRows {
+			// completed and expired in between, try again
+			continue
+		}
+		return existing, err
+	}
+
+	return nil, fmt.Errorf("lock idempotency key: %s is contended", key)
+}
+
+func (r *Repository) getRecord(tenant string, key string) (*Record, error) {
+	var record Record
+	var body string
+	err := r.DB.QueryRow("select idempotency_key, request_hash, completed, status, content_type, body, expires_at from idempotency_keys where tenant_id = ? and idempotency_key = ?", tenant, key).
+		Scan(&record.Key, &record.RequestHash, &record.Completed, &record.Status, &record.ContentType, &body, &record.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get idempotency key: %v", err)
+	}
+
+	record.Body = []byte(body)
+	return &record, nil
+}
+
+func (r *Repository) Complete(tenant string, key string, status int, contentType string, body []byte) error {
+	_, err := r.DB.Exec("update idempotency_keys set completed = true, status = ?, content_type = ?, body = ? where tenant_id = ? and idempotency_key = ?",
+		status, contentType, string(body), tenant, key)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) Unlock(tenant string, key string) error {
+	_, err := r.DB.Exec("delete from idempotency_keys where tenant_id = ? and idempotency_key = ? and completed = false", tenant, key)
+	if err != nil {
+		return fmt.Errorf("unlock idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteExpired() (int64, error) {
+	result, err := r.DB.Exec("delete from idempotency_keys where expires_at < now()")
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,154 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// Middleware makes retries of a request with the same Idempotency-Key header safe:
+// the first response is stored and replayed to the retries instead of running the request again.
+// Requests without the header are passed through.
+type Middleware struct {
+	Repository IdempotencyRepository
+	// TTL is how long a key and its response are kept
+	TTL time.Duration
+	// LockTimeout is how long a request can hold a key before a retry takes it over
+	LockTimeout time.Duration
+}
+
+func GetMiddleware(repository IdempotencyRepository, ttl time.Duration) *Middleware {
+	return &Middleware{
+		Repository:  repository,
+		TTL:         ttl,
+		LockTimeout: time.Minute,
+	}
+}
+
+func (m *Middleware) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "error reading the request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestHash(r, body)
+		tenantId := tenant.FromContext(r.Context())
+
+		existing, err := m.Repository.Lock(tenantId, key, hash, m.TTL, m.LockTimeout)
+		if err != nil {
+			log.Println("Error locking idempotency key", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				writeError(w, http.StatusConflict, "Idempotency-Key was already used with a different request")
+			case !existing.Completed:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			default:
+				w.Header().Set("Content-Type", existing.ContentType)
+				w.Header().Set(HeaderReplayed, "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		// server errors are not kept, so the request can be retried with the same key
+		if recorder.status >= http.StatusInternalServerError {
+			if err := m.Repository.Unlock(tenantId, key); err != nil {
+				log.Println("Error unlocking idempotency key", err)
+			}
+			return
+		}
+
+		if err := m.Repository.Complete(tenantId, key, recorder.status, w.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Println("Error saving idempotent response", err)
+		}
+	}
+}
+
+// PurgeExpired deletes the expired keys every interval until the context is cancelled.
+func (m *Middleware) PurgeExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.Repository.DeleteExpired(); err != nil {
+				log.Println("Error deleting expired idempotency keys", err)
+			}
+		}
+	}
+}
+
+// requestHash tells apart a retry from a different request reusing the key
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
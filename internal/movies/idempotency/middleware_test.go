@@ -0,0 +1,208 @@
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepository struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func (f *fakeRepository) Lock(tenant string, key string, requestHash string, ttl time.Duration, lockTimeout time.Duration) (*Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, ok := f.records[tenant+"/"+key]; ok {
+		record := *existing
+		return &record, nil
+	}
+	f.records[tenant+"/"+key] = &Record{Key: key, RequestHash: requestHash, ExpiresAt: time.Now().Add(ttl)}
+	return nil, nil
+}
+
+func (f *fakeRepository) Complete(tenant string, key string, status int, contentType string, body []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := f.records[tenant+"/"+key]
+	record.Completed, record.Status, record.ContentType, record.Body = true, status, contentType, body
+	return nil
+}
+
+func (f *fakeRepository) Unlock(tenant string, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.records, tenant+"/"+key)
+	return nil
+}
+
+func (f *fakeRepository) DeleteExpired() (int64, error) {
+	return 0, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	testCases := []struct {
+		name       string
+		key        string
+		first      string
+		retry      string
+		status     int
+		wantStatus int
+		wantBody   string
+		wantCalls  int
+		replayed   bool
+	}{
+		{
+			name:       "Should replay the response of a retry",
+			key:        "abc",
+			first:      `{"title": "Jaws"}`,
+			retry:      `{"title": "Jaws"}`,
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":1}`,
+			wantCalls:  1,
+			replayed:   true,
+		},
+		{
+			name:       "Should reject a key reused with a different body",
+			key:        "abc",
+			first:      `{"title": "Jaws"}`,
+			retry:      `{"title": "Alien"}`,
+			status:     http.StatusOK,
+			wantStatus: http.StatusConflict,
+			wantBody:   `{"error":"Idempotency-Key was already used with a different request"}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "Should run the request again after a server error",
+			key:        "abc",
+			first:      `{"title": "Jaws"}`,
+			retry:      `{"title": "Jaws"}`,
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"id":2}`,
+			wantCalls:  2,
+		},
+		{
+			name:       "Should run every request without a key",
+			first:      `{"title": "Jaws"}`,
+			retry:      `{"title": "Jaws"}`,
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":2}`,
+			wantCalls:  2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				fmt.Fprintf(w, `{"id":%d}`, calls)
+			}
+			middleware := GetMiddleware(&fakeRepository{records: map[string]*Record{}}, time.Hour)
+
+			send := func(body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(body))
+				if tc.key != "" {
+					req.Header.Set(HeaderKey, tc.key)
+				}
+				rec := httptest.NewRecorder()
+				middleware.Handle(handler)(rec, req)
+				return rec
+			}
+
+			send(tc.first)
+			rec := send(tc.retry)
+
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.JSONEq(t, tc.wantBody, rec.Body.String())
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantCalls, calls)
+			assert.Equal(t, tc.replayed, rec.Header().Get(HeaderReplayed) == "true")
+		})
+	}
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	middleware := GetMiddleware(&fakeRepository{records: map[string]*Record{}}, time.Hour)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := middleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(`{"title": "Jaws"}`))
+		req.Header.Set(HeaderKey, "abc")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send() }()
+	<-started
+
+	rec := send()
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.Equal(t, `{"id":1}`, send().Body.String())
+}
+
+func TestMiddlewareKeyTooLong(t *testing.T) {
+	middleware := GetMiddleware(&fakeRepository{records: map[string]*Record{}}, time.Hour)
+
+	req := httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(`{}`))
+	req.Header.Set(HeaderKey, strings.Repeat("k", 256))
+	rec := httptest.NewRecorder()
+	middleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("the request should not run")
+	})(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestMiddlewareTenants(t *testing.T) {
+	middleware := GetMiddleware(&fakeRepository{records: map[string]*Record{}}, time.Hour)
+
+	calls := 0
+	handler := middleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"id":%d}`, calls)
+	})
+
+	send := func(tenantId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/movies", strings.NewReader(`{"title": "Jaws"}`))
+		req = req.WithContext(tenant.NewContext(req.Context(), tenantId))
+		req.Header.Set(HeaderKey, "abc")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, `{"id":1}`, send("studio-a").Body.String())
+	// the same key of another tenant is a different request
+	rec := send("studio-b")
+	assert.Equal(t, `{"id":2}`, rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, `{"id":1}`, send("studio-a").Body.String())
+}
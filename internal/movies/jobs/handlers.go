@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/transfer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	ImportJob  = "import"
+	ExportJob  = "export"
+	ReindexJob = "reindex"
+)
+
+// checkpointEvery is how many movies are exported or reindexed between checkpoints
+const checkpointEvery = 500
+
+type ImportParams struct {
+	File   string `json:"file"`
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	Upsert bool   `json:"upsert"`
+}
+
+type ExportParams struct {
+	Format string `json:"format"`
+}
+
+type ExportProgress struct {
+	Exported int `json:"exported"`
+}
+
+type ExportResult struct {
+	File     string `json:"file"`
+	Format   string `json:"format"`
+	Exported int    `json:"exported"`
+}
+
+type ReindexProgress struct {
+	Published int   `json:"published"`
+	LastID    int64 `json:"last_id"`
+}
+
+// ImportHandler imports a file uploaded to dir, resuming after the rows of the last checkpoint.
+func ImportHandler(catalogue service.Catalogue, dir string) Handler {
+	return func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		svc := catalogue(job.Tenant)
+
+		var params ImportParams
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid import params %v", err)
+		}
+
+		path := filepath.Join(dir, params.File)
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening import file %v", err)
+		}
+		defer f.Close()
+
+		opts := transfer.ImportOptions{Format: params.Format, DryRun: params.DryRun, Upsert: params.Upsert}
+		if job.Progress != nil {
+			var previous transfer.ImportReport
+			if err := json.Unmarshal(job.Progress, &previous); err == nil {
+				opts.Resume = &previous
+			}
+		}
+
+		report, err := transfer.Import(f, opts, svc, func(report *transfer.ImportReport) error {
+			return checkpoint(report)
+		})
+
+		// keep the file while the job can still be resumed
+		if !errors.Is(err, context.Canceled) {
+			os.Remove(path)
+		}
+		return report, err
+	}
+}
+
+// ExportHandler writes the catalogue to a file in dir, to be downloaded once the job is done.
+func ExportHandler(catalogue service.Catalogue, dir string) Handler {
+	return func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		svc := catalogue(job.Tenant)
+
+		var params ExportParams
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid export params %v", err)
+		}
+
+		name := fmt.Sprintf("export-%d.%s", job.ID, params.Format)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error creating export file %v", err)
+		}
+		defer f.Close()
+
+		counting := progressService{MoviesService: svc, progress: func(count int) error {
+			return checkpoint(ExportProgress{Exported: count})
+		}}
+
+		count, err := transfer.Export(f, params.Format, &counting)
+		if err != nil {
+			os.Remove(f.Name())
+			return nil, err
+		}
+
+		return ExportResult{File: name, Format: params.Format, Exported: count}, checkpoint(ExportProgress{Exported: count})
+	}
+}
+
+// ReindexHandler sends the events of every movie again, so consumers can rebuild their read models.
+// It resumes after the last movie id of the last checkpoint.
+func ReindexHandler(catalogue service.Catalogue) Handler {
+	return func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		svc := catalogue(job.Tenant)
+
+		var progress ReindexProgress
+		if job.Progress != nil {
+			json.Unmarshal(job.Progress, &progress)
+		}
+
+		batch := make([]models.Movie, 0, checkpointEvery)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := svc.PublishMovies(batch); err != nil {
+				return err
+			}
+
+			progress.Published += len(batch)
+			progress.LastID = batch[len(batch)-1].ID
+			batch = batch[:0]
+			return checkpoint(progress)
+		}
+
+		err := svc.StreamMovies(func(movie models.Movie) error {
+			if movie.ID <= progress.LastID {
+				return nil
+			}
+
+			batch = append(batch, movie)
+			if len(batch) == checkpointEvery {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+
+		return progress, err
+	}
+}
+
+// SweepFiles removes the files of dir older than retention every interval, until the context is cancelled.
+// Exports can't be downloaded anymore once their file is gone, while the uploads of the imports
+// are removed when their job is done and only linger for the jobs that were cancelled.
+func SweepFiles(ctx context.Context, dir string, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := removeFilesBefore(dir, time.Now().Add(-retention)); err != nil {
+			log.Println("Error removing job files", err)
+		} else if n > 0 {
+			log.Printf("Removed %d job files\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func removeFilesBefore(dir string, before time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("error listing job files %v", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("error removing job file %v", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// progressService reports how many movies were streamed every checkpointEvery movies
+type progressService struct {
+	service.MoviesService
+	progress func(count int) error
+}
+
+func (p *progressService) StreamMovies(fn func(movie models.Movie) error) error {
+	count := 0
+	return p.MoviesService.StreamMovies(func(movie models.Movie) error {
+		if err := fn(movie); err != nil {
+			return err
+		}
+
+		count++
+		if count%checkpointEvery == 0 {
+			return p.progress(count)
+		}
+		return nil
+	})
+}
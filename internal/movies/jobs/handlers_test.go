@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/transfer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// newCatalogue serves the movies of every tenant from memory, keeping the events it produces
+func newCatalogue(kafka producer.KafkaProducer, movies ...models.Movie) service.Catalogue {
+	db := &repository.MemoryDB{}
+	catalogue := func(tenant string) service.MoviesService {
+		return &service.Service{Tenant: tenant, Repository: &repository.MemoryRepository{DB: db, Tenant: tenant}, KafkaProducer: kafka}
+	}
+
+	for i := range movies {
+		catalogue("studio").CreateMovie(&movies[i])
+	}
+	return catalogue
+}
+
+// checkpoints records the progress of a job as json
+type checkpoints []string
+
+func (c *checkpoints) save(progress interface{}) error {
+	data, err := json.Marshal(progress)
+	*c = append(*c, string(data))
+	return err
+}
+
+func jobOf(t *testing.T, jobType string, params interface{}, progress string) *models.Job {
+	data, err := json.Marshal(params)
+	require.NoError(t, err)
+
+	job := &models.Job{ID: 7, Tenant: "studio", Type: jobType, Params: data}
+	if progress != "" {
+		job.Progress = json.RawMessage(progress)
+	}
+	return job
+}
+
+func TestImportHandler(t *testing.T) {
+	body := "isbn,title,director\n" +
+		"9780000000002,Alien,Ridley Scott\n" +
+		"9780000000019,Heat,Michael Mann\n"
+
+	testCases := []struct {
+		name       string
+		progress   string
+		wantReport transfer.ImportReport
+		wantTitles []string
+	}{
+		{
+			name:       "Should import the file",
+			wantReport: transfer.ImportReport{Rows: 2, Created: 2, Errors: []transfer.RowError{}},
+			wantTitles: []string{"Alien", "Heat"},
+		},
+		{
+			name:       "Should resume after the rows of the last checkpoint",
+			progress:   `{"rows": 1, "created": 1, "errors": []}`,
+			wantReport: transfer.ImportReport{Rows: 2, Created: 2, Errors: []transfer.RowError{}},
+			wantTitles: []string{"Heat"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "import-1.csv"), []byte(body), 0o644))
+			catalogue := newCatalogue(&producer.MemoryProducer{})
+
+			job := jobOf(t, ImportJob, ImportParams{File: "import-1.csv", Format: transfer.CSV}, tc.progress)
+			var saved checkpoints
+			result, err := ImportHandler(catalogue, dir)(context.Background(), job, saved.save)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantReport, *result.(*transfer.ImportReport))
+			movies, _ := catalogue("studio").GetMovies()
+			var titles []string
+			for _, m := range movies {
+				titles = append(titles, m.Title)
+			}
+			assert.Equal(t, tc.wantTitles, titles)
+			assert.NoFileExists(t, filepath.Join(dir, "import-1.csv"), "the file is removed once imported")
+		})
+	}
+
+	t.Run("Should keep the file of a job that can be resumed", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "import-1.csv"), []byte(body), 0o644))
+		job := jobOf(t, ImportJob, ImportParams{File: "import-1.csv", Format: transfer.CSV}, "")
+
+		// the file ends before its first chunk, its progress is only saved at the end
+		interrupted := func(progress interface{}) error { return context.Canceled }
+		_, err := ImportHandler(newCatalogue(&producer.MemoryProducer{}), dir)(context.Background(), job, interrupted)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.FileExists(t, filepath.Join(dir, "import-1.csv"))
+	})
+
+	t.Run("Should fail without its file", func(t *testing.T) {
+		job := jobOf(t, ImportJob, ImportParams{File: "import-2.csv", Format: transfer.CSV}, "")
+		var saved checkpoints
+		_, err := ImportHandler(newCatalogue(&producer.MemoryProducer{}), t.TempDir())(context.Background(), job, saved.save)
+		assert.ErrorContains(t, err, "error opening import file")
+	})
+}
+
+func TestExportHandler(t *testing.T) {
+	dir := t.TempDir()
+	catalogue := newCatalogue(&producer.MemoryProducer{},
+		models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"},
+		models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"})
+
+	job := jobOf(t, ExportJob, ExportParams{Format: transfer.CSV}, "")
+	var saved checkpoints
+	result, err := ExportHandler(catalogue, dir)(context.Background(), job, saved.save)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ExportResult{File: "export-7.csv", Format: transfer.CSV, Exported: 2}, result)
+	assert.Equal(t, checkpoints{`{"exported":2}`}, saved)
+
+	exported, err := os.ReadFile(filepath.Join(dir, "export-7.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "id,isbn,title,director\n1,9788401490040,Jaws,Steven Spielberg\n2,9780000000002,Alien,Ridley Scott\n", string(exported))
+
+	t.Run("Should remove the file of a failed export", func(t *testing.T) {
+		job := jobOf(t, ExportJob, ExportParams{Format: "xml"}, "")
+		_, err := ExportHandler(catalogue, dir)(context.Background(), job, saved.save)
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(dir, "export-7.xml"))
+	})
+}
+
+func TestReindexHandler(t *testing.T) {
+	kafka := &producer.MemoryProducer{}
+	catalogue := newCatalogue(kafka,
+		models.Movie{Isbn: "9788401490040", Title: "Jaws"},
+		models.Movie{Isbn: "9780000000002", Title: "Alien"},
+		models.Movie{Isbn: "9780000000019", Title: "Heat"})
+
+	testCases := []struct {
+		name         string
+		progress     string
+		wantProgress ReindexProgress
+		wantEvents   int
+	}{
+		{name: "Should publish every movie", wantProgress: ReindexProgress{Published: 3, LastID: 3}, wantEvents: 3},
+		{name: "Should resume after the last movie of the last checkpoint", progress: `{"published": 1, "last_id": 1}`,
+			wantProgress: ReindexProgress{Published: 3, LastID: 3}, wantEvents: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kafka.Reset()
+			var saved checkpoints
+			result, err := ReindexHandler(catalogue)(context.Background(), jobOf(t, ReindexJob, nil, tc.progress), saved.save)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantProgress, result)
+			assert.Len(t, kafka.Messages(), tc.wantEvents)
+		})
+	}
+}
+
+func TestRemoveFilesBefore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"export-1.csv": 8 * 24 * time.Hour, "import-2.csv": 9 * 24 * time.Hour, "export-3.csv": time.Hour} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("isbn,title,director\n"), 0o644))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	removed, err := removeFilesBefore(dir, now.Add(-7*24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "export-3.csv", entries[0].Name())
+}
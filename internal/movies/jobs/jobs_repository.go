@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrJobNotFound = errors.New("no such job")
+
+// JobsRepository keeps the jobs of every tenant. They are listed and looked up within a tenant,
+// while the workers run the jobs of all of them, by id.
+type JobsRepository interface {
+	GetJobs(tenant string, limit int) ([]models.Job, error)
+	GetJobById(tenant string, id int64) (*models.Job, error)
+	CreateJob(tenant string, jobType string, params json.RawMessage) (*models.Job, error)
+	// ClaimNextJob marks the oldest queued job as running, nil when there is none
+	ClaimNextJob() (*models.Job, error)
+	SaveProgress(id int64, progress json.RawMessage) error
+	// Heartbeat keeps a running job from being considered stale and tells whether it should be cancelled
+	Heartbeat(id int64) (cancelRequested bool, err error)
+	FinishJob(id int64, status string, result json.RawMessage, errMsg string) error
+	// RequestCancel cancels a queued job right away, a running one is flagged for its worker to stop
+	RequestCancel(id int64) error
+	// RequeueStaleJobs puts back in the queue running jobs without a heartbeat for longer than the lease
+	RequeueStaleJobs(lease time.Duration) (int64, error)
+}
+
+type Repository struct {
+	DB *sql.DB
+}
+
+const jobColumns = "id, tenant_id, type, status, params, progress, result, error, cancel_requested, attempts, created_at, updated_at, started_at, finished_at"
+
+func (r *Repository) GetJobs(tenant string, limit int) ([]models.Job, error) {
+	rows, err := r.DB.Query("select "+jobColumns+" from jobs where tenant_id = ? order by id desc limit ?", tenant, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getJobs %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("getJobs %v", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getJobs %v", err)
+	}
+
+	return jobs, nil
+}
+
+func (r *Repository) GetJobById(tenant string, id int64) (*models.Job, error) {
+	job, err := scanJob(r.DB.QueryRow("select "+jobColumns+" from jobs where id = ? and tenant_id = ?", id, tenant))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getJobById %d: %w", id, ErrJobNotFound)
+		}
+		return nil, fmt.Errorf("getJobById %d: %v", id, err)
+	}
+	return job, nil
+}
+
+func (r *Repository) CreateJob(tenant string, jobType string, params json.RawMessage) (*models.Job, error) {
+	result, err := r.DB.Exec("insert into jobs (tenant_id, type, status, params, progress, result, error) values (?, ?, ?, ?, '', '', '')", tenant, jobType, models.JobQueued, string(params))
+	if err != nil {
+		return nil, fmt.Errorf("add job: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get job last inserted id %v", err)
+	}
+
+	return r.GetJobById(tenant, id)
+}
+
+func (r *Repository) ClaimNextJob() (*models.Job, error) {
+	for {
+		var id int64
+		var tenant string
+		err := r.DB.QueryRow("select id, tenant_id from jobs where status = ? order by id limit 1", models.JobQueued).Scan(&id, &tenant)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("claimNextJob %v", err)
+		}
+
+		// only one worker gets to flip the status, the others look for the next job
+		result, err := r.DB.Exec("update jobs set status = ?, attempts = attempts + 1, started_at = coalesce(started_at, now()) where id = ? and status = ?", models.JobRunning, id, models.JobQueued)
+		if err != nil {
+			return nil, fmt.Errorf("claimNextJob %v", err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 1 {
+			return r.GetJobById(tenant, id)
+		}
+	}
+}
+
+func (r *Repository) SaveProgress(id int64, progress json.RawMessage) error {
+	_, err := r.DB.Exec("update jobs set progress = ? where id = ?", string(progress), id)
+	if err != nil {
+		return fmt.Errorf("save job progress: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) Heartbeat(id int64) (bool, error) {
+	_, err := r.DB.Exec("update jobs set updated_at = now() where id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("job heartbeat: %v", err)
+	}
+
+	var cancelRequested bool
+	if err := r.DB.QueryRow("select cancel_requested from jobs where id = ?", id).Scan(&cancelRequested); err != nil {
+		return false, fmt.Errorf("job heartbeat: %v", err)
+	}
+	return cancelRequested, nil
+}
+
+func (r *Repository) FinishJob(id int64, status string, result json.RawMessage, errMsg string) error {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+
+	var err error
+	if status == models.JobQueued {
+		// interrupted by a shutdown, another worker resumes it from its progress
+		_, err = r.DB.Exec("update jobs set status = ? where id = ?", status, id)
+	} else {
+		_, err = r.DB.Exec("update jobs set status = ?, result = ?, error = ?, finished_at = now() where id = ?", status, string(result), errMsg, id)
+	}
+	if err != nil {
+		return fmt.Errorf("finish job: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) RequestCancel(id int64) error {
+	_, err := r.DB.Exec("update jobs set status = ?, cancel_requested = true, finished_at = now() where id = ? and status = ?", models.JobCancelled, id, models.JobQueued)
+	if err != nil {
+		return fmt.Errorf("cancel job: %v", err)
+	}
+
+	_, err = r.DB.Exec("update jobs set cancel_requested = true where id = ? and status = ?", id, models.JobRunning)
+	if err != nil {
+		return fmt.Errorf("cancel job: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) RequeueStaleJobs(lease time.Duration) (int64, error) {
+	result, err := r.DB.Exec("update jobs set status = ? where status = ? and updated_at < now() - interval ? second",
+		models.JobQueued, models.JobRunning, int(lease.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("requeue stale jobs: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*models.Job, error) {
+	var job models.Job
+	var params, progress, result string
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Tenant, &job.Type, &job.Status, &params, &progress, &result, &job.Error, &job.CancelRequested, &job.Attempts,
+		&job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Params = rawJSON(params)
+	job.Progress = rawJSON(progress)
+	job.Result = rawJSON(result)
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
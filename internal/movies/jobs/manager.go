@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// Checkpoint saves the progress of a job so it can resume from there after a restart.
+// It returns an error once the job is cancelled, which the handler should return.
+type Checkpoint func(progress interface{}) error
+
+// Handler runs a job of a given type for job.Tenant, when the job was interrupted before
+// job.Progress holds the last checkpoint.
+type Handler func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (result interface{}, err error)
+
+// Manager runs queued jobs with a pool of workers.
+// Running jobs send heartbeats, so jobs left running by a crashed process are put back in
+// the queue once their lease expires and resume from their last checkpoint.
+// A job started more than MaxAttempts times fails instead, as it would likely crash the next process as well.
+type Manager struct {
+	Repository        JobsRepository
+	Handlers          map[string]Handler
+	Concurrency       int
+	MaxAttempts       int
+	PollInterval      time.Duration
+	HeartbeatInterval time.Duration
+	Lease             time.Duration
+
+	wake    chan struct{}
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc
+}
+
+func GetManager(repository JobsRepository, concurrency int) *Manager {
+	return &Manager{
+		Repository:        repository,
+		Handlers:          map[string]Handler{},
+		Concurrency:       concurrency,
+		MaxAttempts:       3,
+		PollInterval:      5 * time.Second,
+		HeartbeatInterval: 10 * time.Second,
+		Lease:             time.Minute,
+	}
+}
+
+// Start runs the workers until the context is cancelled.
+// Jobs interrupted by the cancellation go back to the queue.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	m.wake = make(chan struct{}, m.Concurrency)
+	m.running = map[int64]context.CancelFunc{}
+	m.mu.Unlock()
+
+	go m.requeueStaleJobs(ctx)
+
+	for i := 0; i < m.Concurrency; i++ {
+		go m.worker(ctx)
+	}
+}
+
+// Submit queues a job of the tenant, params are handed to its handler as json.
+func (m *Manager) Submit(tenant string, jobType string, params interface{}) (*models.Job, error) {
+	if _, ok := m.Handlers[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type %s", jobType)
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding job params %v", err)
+	}
+
+	job, err := m.Repository.CreateJob(tenant, jobType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// let an idle worker pick it up right away instead of on the next poll
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+func (m *Manager) Cancel(id int64) error {
+	if err := m.Repository.RequestCancel(id); err != nil {
+		return err
+	}
+
+	// when it runs on another instance, its heartbeat picks the cancellation up
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cancel, ok := m.running[id]; ok {
+		cancel()
+	}
+	return nil
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := m.Repository.ClaimNextJob()
+		if err != nil {
+			log.Println("Error claiming job", err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.wake:
+			case <-time.After(m.PollInterval):
+			}
+			continue
+		}
+
+		m.run(ctx, job)
+	}
+}
+
+func (m *Manager) run(ctx context.Context, job *models.Job) {
+	if m.MaxAttempts > 0 && job.Attempts > m.MaxAttempts {
+		log.Printf("Job %d (%s) failed after %d attempts\n", job.ID, job.Type, m.MaxAttempts)
+		if err := m.Repository.FinishJob(job.ID, models.JobFailed, nil, fmt.Sprintf("gave up after %d attempts", m.MaxAttempts)); err != nil {
+			log.Println("Error finishing job", err)
+		}
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m.mu.Lock()
+	m.running[job.ID] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, job.ID)
+		m.mu.Unlock()
+	}()
+
+	if job.CancelRequested {
+		cancel()
+	}
+	go m.heartbeat(jobCtx, job.ID, cancel)
+
+	checkpoint := func(progress interface{}) error {
+		if err := jobCtx.Err(); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(progress)
+		if err != nil {
+			return fmt.Errorf("error encoding job progress %v", err)
+		}
+		job.Progress = data
+		return m.Repository.SaveProgress(job.ID, data)
+	}
+
+	var result interface{}
+	var err error
+	if handler, ok := m.Handlers[job.Type]; ok {
+		result, err = m.safeRun(jobCtx, handler, job, checkpoint)
+	} else {
+		err = fmt.Errorf("unknown job type %s", job.Type)
+	}
+
+	status := models.JobSucceeded
+	switch {
+	case ctx.Err() != nil:
+		status = models.JobQueued
+	case errors.Is(err, context.Canceled) || (err == nil && jobCtx.Err() != nil):
+		status = models.JobCancelled
+	case err != nil:
+		status = models.JobFailed
+	}
+
+	var resultData json.RawMessage
+	if result != nil {
+		resultData, _ = json.Marshal(result)
+	}
+
+	errMsg := ""
+	if err != nil && status == models.JobFailed {
+		errMsg = err.Error()
+		log.Printf("Job %d (%s) failed: %v\n", job.ID, job.Type, err)
+	}
+
+	if err := m.Repository.FinishJob(job.ID, status, resultData, errMsg); err != nil {
+		log.Println("Error finishing job", err)
+	}
+}
+
+// safeRun turns a panicking handler into a failed job instead of a crashed server
+func (m *Manager) safeRun(ctx context.Context, handler Handler, job *models.Job, checkpoint Checkpoint) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job, checkpoint)
+}
+
+func (m *Manager) heartbeat(ctx context.Context, id int64, cancel context.CancelFunc) {
+	ticker := time.NewTicker(m.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelRequested, err := m.Repository.Heartbeat(id)
+			if err != nil {
+				log.Println("Error sending job heartbeat", err)
+				continue
+			}
+			if cancelRequested {
+				cancel()
+			}
+		}
+	}
+}
+
+func (m *Manager) requeueStaleJobs(ctx context.Context) {
+	ticker := time.NewTicker(m.Lease)
+	defer ticker.Stop()
+
+	for {
+		if n, err := m.Repository.RequeueStaleJobs(m.Lease); err != nil {
+			log.Println("Error requeuing stale jobs", err)
+		} else if n > 0 {
+			log.Printf("Requeued %d interrupted jobs\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepository struct {
+	mu   sync.Mutex
+	jobs []models.Job
+}
+
+func (f *fakeRepository) GetJobs(tenant string, limit int) ([]models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.Job{}, f.jobs...), nil
+}
+
+func (f *fakeRepository) GetJobById(tenant string, id int64) (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id < 1 || int(id) > len(f.jobs) || f.jobs[id-1].Tenant != tenant {
+		return nil, fmt.Errorf("getJobById %d: %w", id, ErrJobNotFound)
+	}
+	job := f.jobs[id-1]
+	return &job, nil
+}
+
+func (f *fakeRepository) CreateJob(tenant string, jobType string, params json.RawMessage) (*models.Job, error) {
+	f.mu.Lock()
+	job := models.Job{ID: int64(len(f.jobs) + 1), Tenant: tenant, Type: jobType, Status: models.JobQueued, Params: params}
+	f.jobs = append(f.jobs, job)
+	f.mu.Unlock()
+	return &job, nil
+}
+
+func (f *fakeRepository) ClaimNextJob() (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.jobs {
+		if f.jobs[i].Status == models.JobQueued {
+			f.jobs[i].Status = models.JobRunning
+			f.jobs[i].Attempts++
+			job := f.jobs[i]
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRepository) SaveProgress(id int64, progress json.RawMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[id-1].Progress = progress
+	return nil
+}
+
+func (f *fakeRepository) Heartbeat(id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.jobs[id-1].CancelRequested, nil
+}
+
+func (f *fakeRepository) FinishJob(id int64, status string, result json.RawMessage, errMsg string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[id-1].Status = status
+	if status != models.JobQueued {
+		f.jobs[id-1].Result = result
+		f.jobs[id-1].Error = errMsg
+	}
+	return nil
+}
+
+func (f *fakeRepository) RequestCancel(id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.jobs[id-1].Status {
+	case models.JobQueued:
+		f.jobs[id-1].Status = models.JobCancelled
+		f.jobs[id-1].CancelRequested = true
+	case models.JobRunning:
+		f.jobs[id-1].CancelRequested = true
+	}
+	return nil
+}
+
+func (f *fakeRepository) RequeueStaleJobs(lease time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func getTestManager(repo *fakeRepository) *Manager {
+	manager := GetManager(repo, 2)
+	manager.PollInterval = 10 * time.Millisecond
+	manager.HeartbeatInterval = 10 * time.Millisecond
+	return manager
+}
+
+func waitForStatus(t *testing.T, repo *fakeRepository, id int64, status string) models.Job {
+	var job *models.Job
+	assert.Eventually(t, func() bool {
+		job, _ = repo.GetJobById("studio", id)
+		return job.Status == status
+	}, time.Second, 5*time.Millisecond)
+	return *job
+}
+
+func TestManagerRun(t *testing.T) {
+	testCases := []struct {
+		name       string
+		handler    Handler
+		wantStatus string
+		wantResult string
+		wantError  string
+	}{
+		{
+			name: "Should save the progress and result of a job",
+			handler: func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+				if err := checkpoint(map[string]int{"done": 1}); err != nil {
+					return nil, err
+				}
+				return map[string]int{"done": 2}, nil
+			},
+			wantStatus: models.JobSucceeded,
+			wantResult: `{"done":2}`,
+		},
+		{
+			name: "Should fail a job when its handler returns an error",
+			handler: func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+				return nil, errors.New("broken file")
+			},
+			wantStatus: models.JobFailed,
+			wantError:  "broken file",
+		},
+		{
+			name: "Should fail a job when its handler panics",
+			handler: func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+				panic("boom")
+			},
+			wantStatus: models.JobFailed,
+			wantError:  "job panicked: boom",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{}
+			manager := getTestManager(repo)
+			manager.Handlers["test"] = tc.handler
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager.Start(ctx)
+
+			job, err := manager.Submit("studio", "test", map[string]string{"file": "movies.csv"})
+			assert.NoError(t, err)
+
+			finished := waitForStatus(t, repo, job.ID, tc.wantStatus)
+			assert.Equal(t, tc.wantError, finished.Error)
+			if tc.wantResult != "" {
+				assert.JSONEq(t, tc.wantResult, string(finished.Result))
+			}
+		})
+	}
+}
+
+func TestManagerSubmitUnknownType(t *testing.T) {
+	manager := getTestManager(&fakeRepository{})
+	_, err := manager.Submit("studio", "unknown", nil)
+	assert.EqualError(t, err, "unknown job type unknown")
+}
+
+func TestManagerCancel(t *testing.T) {
+	repo := &fakeRepository{}
+	manager := getTestManager(repo)
+
+	started := make(chan struct{})
+	manager.Handlers["test"] = func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, checkpoint(nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	job, _ := manager.Submit("studio", "test", nil)
+	<-started
+
+	assert.NoError(t, manager.Cancel(job.ID))
+	waitForStatus(t, repo, job.ID, models.JobCancelled)
+}
+
+func TestManagerResume(t *testing.T) {
+	repo := &fakeRepository{}
+
+	// the job checkpoints its first step and then waits until the server shuts down
+	first := getTestManager(repo)
+	checkpointed := make(chan struct{})
+	first.Handlers["test"] = func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		if err := checkpoint(map[string]int{"step": 1}); err != nil {
+			return nil, err
+		}
+		close(checkpointed)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	first.Start(ctx)
+	job, _ := first.Submit("studio", "test", nil)
+	<-checkpointed
+	shutdown()
+	waitForStatus(t, repo, job.ID, models.JobQueued)
+
+	// after the restart it picks up from the checkpoint
+	second := getTestManager(repo)
+	second.Handlers["test"] = func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		var progress map[string]int
+		json.Unmarshal(job.Progress, &progress)
+		return map[string]int{"resumed_from": progress["step"]}, nil
+	}
+
+	ctx, shutdown = context.WithCancel(context.Background())
+	defer shutdown()
+	second.Start(ctx)
+
+	finished := waitForStatus(t, repo, job.ID, models.JobSucceeded)
+	assert.JSONEq(t, `{"resumed_from":1}`, string(finished.Result))
+	assert.Equal(t, 2, finished.Attempts)
+}
+
+func TestManagerMaxAttempts(t *testing.T) {
+	// a job put back in the queue by the crashes of three processes
+	repo := &fakeRepository{jobs: []models.Job{{ID: 1, Tenant: "studio", Type: "test", Status: models.JobQueued, Attempts: 3}}}
+	manager := getTestManager(repo)
+	manager.Handlers["test"] = func(ctx context.Context, job *models.Job, checkpoint Checkpoint) (interface{}, error) {
+		t.Error("the job should not run again")
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	finished := waitForStatus(t, repo, 1, models.JobFailed)
+	assert.Equal(t, "gave up after 3 attempts", finished.Error)
+	assert.Equal(t, 4, finished.Attempts)
+}
@@ -0,0 +1,106 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore keeps the uploaded media. Keys are slash separated paths like posters/1/abc.jpg.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients can download the blob from, signed when the store is private
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// LocalStore keeps the blobs in a directory and serves them itself under BaseURL.
+// Keys hold a hash of the content, so the blobs are served as immutable and cached by clients.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error storing %s %v", key, err)
+	}
+
+	// written next to the final file and renamed, so a blob is never served half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error storing %s %v", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error storing %s %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error storing %s %v", key, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error storing %s %v", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting %s %v", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(ctx context.Context, key string) (string, error) {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key, nil
+}
+
+// ServeHTTP serves the blobs, the request path is the key.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := s.path(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// path keeps keys inside the directory
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid blob key %s", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
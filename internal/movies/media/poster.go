@@ -0,0 +1,112 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	// decoders of the accepted poster formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("poster must be a jpeg, png or gif image")
+	ErrImageTooLarge    = errors.New("poster dimensions are too large")
+)
+
+const (
+	// maxDimension guards against images that are small files but huge once decoded
+	maxDimension   = 8000
+	thumbnailWidth = 200
+)
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// ProcessedPoster is an uploaded poster along with its thumbnail.
+type ProcessedPoster struct {
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Thumbnail   []byte
+}
+
+// ProcessPoster checks the content of the upload is an accepted image, whatever it claims to be,
+// and generates a jpeg thumbnail of it.
+func ProcessPoster(data []byte) (*ProcessedPoster, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, resize(img, thumbnailWidth), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("error generating thumbnail %v", err)
+	}
+
+	return &ProcessedPoster{
+		ContentType: contentType,
+		Extension:   ext,
+		Width:       config.Width,
+		Height:      config.Height,
+		Thumbnail:   thumbnail.Bytes(),
+	}, nil
+}
+
+// resize scales the image down to the width keeping its aspect ratio, averaging the pixels each one covers.
+// Smaller images are kept as they are.
+func resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= width {
+		return src
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
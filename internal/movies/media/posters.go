@@ -0,0 +1,108 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// Posters stores the posters of the movies and tells where to download them from.
+type Posters struct {
+	Store      BlobStore
+	Repository PostersRepository
+}
+
+// Upload stores the poster and its thumbnail, replacing the previous poster of the movie.
+func (p *Posters) Upload(ctx context.Context, movieId int64, data []byte) (*models.Poster, error) {
+	processed, err := ProcessPoster(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys change with the content, so their urls can be cached forever
+	hash := sha256.Sum256(data)
+	name := hex.EncodeToString(hash[:8])
+	record := &PosterRecord{
+		MovieID:      movieId,
+		Key:          fmt.Sprintf("posters/%d/%s.%s", movieId, name, processed.Extension),
+		ThumbnailKey: fmt.Sprintf("posters/%d/%s_thumb.jpg", movieId, name),
+		ContentType:  processed.ContentType,
+		Size:         len(data),
+		Width:        processed.Width,
+		Height:       processed.Height,
+	}
+
+	if err := p.Store.Put(ctx, record.Key, data, processed.ContentType); err != nil {
+		return nil, err
+	}
+	if err := p.Store.Put(ctx, record.ThumbnailKey, processed.Thumbnail, "image/jpeg"); err != nil {
+		return nil, err
+	}
+
+	previous, err := p.Repository.SavePoster(record)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.Key != record.Key {
+		p.deleteBlobs(ctx, previous)
+	}
+
+	return p.toPoster(ctx, record)
+}
+
+func (p *Posters) Delete(ctx context.Context, movieId int64) error {
+	record, err := p.Repository.DeletePoster(movieId)
+	if err != nil {
+		return err
+	}
+
+	p.deleteBlobs(ctx, record)
+	return nil
+}
+
+// Decorate fills in the poster of the movie, leaving it empty when the movie has none.
+func (p *Posters) Decorate(movie *models.Movie) error {
+	record, err := p.Repository.GetPoster(movie.ID)
+	if errors.Is(err, ErrPosterNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	movie.Poster, err = p.toPoster(context.Background(), record)
+	return err
+}
+
+func (p *Posters) toPoster(ctx context.Context, record *PosterRecord) (*models.Poster, error) {
+	url, err := p.Store.URL(ctx, record.Key)
+	if err != nil {
+		return nil, err
+	}
+	thumbnailURL, err := p.Store.URL(ctx, record.ThumbnailKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Poster{
+		URL:          url,
+		ThumbnailURL: thumbnailURL,
+		ContentType:  record.ContentType,
+		Width:        record.Width,
+		Height:       record.Height,
+	}, nil
+}
+
+// deleteBlobs is best effort, a blob left behind only takes some space
+func (p *Posters) deleteBlobs(ctx context.Context, record *PosterRecord) {
+	for _, key := range []string{record.Key, record.ThumbnailKey} {
+		if err := p.Store.Delete(ctx, key); err != nil {
+			log.Println("Error deleting poster", err)
+		}
+	}
+}
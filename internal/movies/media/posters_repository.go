@@ -0,0 +1,92 @@
+package media
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrPosterNotFound = errors.New("the movie has no poster")
+
+// PosterRecord is where the poster of a movie is kept in the blob store
+type PosterRecord struct {
+	MovieID      int64
+	Key          string
+	ThumbnailKey string
+	ContentType  string
+	Size         int
+	Width        int
+	Height       int
+}
+
+type PostersRepository interface {
+	GetPoster(movieId int64) (*PosterRecord, error)
+	// SavePoster returns the poster it replaced, if any, so its blobs can be deleted
+	SavePoster(poster *PosterRecord) (*PosterRecord, error)
+	DeletePoster(movieId int64) (*PosterRecord, error)
+}
+
+// Repository keeps the posters of the movies of one tenant.
+type Repository struct {
+	DB     *sql.DB
+	Tenant string
+}
+
+func (r *Repository) GetPoster(movieId int64) (*PosterRecord, error) {
+	poster, err := getPoster(r.DB.QueryRow, r.Tenant, movieId, "")
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("getPoster %d: %w", movieId, ErrPosterNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getPoster %d: %v", movieId, err)
+	}
+	return poster, nil
+}
+
+func (r *Repository) SavePoster(poster *PosterRecord) (*PosterRecord, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("save poster: %v", err)
+	}
+	defer tx.Rollback()
+
+	previous, err := getPoster(tx.QueryRow, r.Tenant, poster.MovieID, " for update")
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("save poster: %v", err)
+	}
+
+	_, err = tx.Exec("insert into movie_posters (tenant_id, movie_id, poster_key, thumbnail_key, content_type, size, width, height) values (?, ?, ?, ?, ?, ?, ?, ?) "+
+		"on duplicate key update poster_key = values(poster_key), thumbnail_key = values(thumbnail_key), content_type = values(content_type), "+
+		"size = values(size), width = values(width), height = values(height)",
+		r.Tenant, poster.MovieID, poster.Key, poster.ThumbnailKey, poster.ContentType, poster.Size, poster.Width, poster.Height)
+	if err != nil {
+		return nil, fmt.Errorf("save poster: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("save poster: %v", err)
+	}
+	return previous, nil
+}
+
+func (r *Repository) DeletePoster(movieId int64) (*PosterRecord, error) {
+	poster, err := r.GetPoster(movieId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.DB.Exec("delete from movie_posters where tenant_id = ? and movie_id = ? and poster_key = ?", r.Tenant, movieId, poster.Key); err != nil {
+		return nil, fmt.Errorf("delete poster: %v", err)
+	}
+	return poster, nil
+}
+
+func getPoster(queryRow func(query string, args ...interface{}) *sql.Row, tenant string, movieId int64, lock string) (*PosterRecord, error) {
+	var poster PosterRecord
+	err := queryRow("select movie_id, poster_key, thumbnail_key, content_type, size, width, height from movie_posters where tenant_id = ? and movie_id = ?"+lock, tenant, movieId).
+		Scan(&poster.MovieID, &poster.Key, &poster.ThumbnailKey, &poster.ContentType, &poster.Size, &poster.Width, &poster.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &poster, nil
+}
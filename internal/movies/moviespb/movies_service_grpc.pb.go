@@ -0,0 +1,322 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: proto/movies_service.proto
+
+package moviespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MoviesService_GetMovie_FullMethodName    = "/com.github.iamthiago.movies.v1.MoviesService/GetMovie"
+	MoviesService_ListMovies_FullMethodName  = "/com.github.iamthiago.movies.v1.MoviesService/ListMovies"
+	MoviesService_CreateMovie_FullMethodName = "/com.github.iamthiago.movies.v1.MoviesService/CreateMovie"
+	MoviesService_UpdateMovie_FullMethodName = "/com.github.iamthiago.movies.v1.MoviesService/UpdateMovie"
+	MoviesService_DeleteMovie_FullMethodName = "/com.github.iamthiago.movies.v1.MoviesService/DeleteMovie"
+	MoviesService_WatchMovies_FullMethodName = "/com.github.iamthiago.movies.v1.MoviesService/WatchMovies"
+)
+
+// MoviesServiceClient is the client API for MoviesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MoviesServiceClient interface {
+	GetMovie(ctx context.Context, in *GetMovieRequest, opts ...grpc.CallOption) (*Movie, error)
+	ListMovies(ctx context.Context, in *ListMoviesRequest, opts ...grpc.CallOption) (*ListMoviesResponse, error)
+	CreateMovie(ctx context.Context, in *CreateMovieRequest, opts ...grpc.CallOption) (*Movie, error)
+	UpdateMovie(ctx context.Context, in *UpdateMovieRequest, opts ...grpc.CallOption) (*Movie, error)
+	DeleteMovie(ctx context.Context, in *DeleteMovieRequest, opts ...grpc.CallOption) (*DeleteMovieResponse, error)
+	WatchMovies(ctx context.Context, in *WatchMoviesRequest, opts ...grpc.CallOption) (MoviesService_WatchMoviesClient, error)
+}
+
+type moviesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMoviesServiceClient(cc grpc.ClientConnInterface) MoviesServiceClient {
+	return &moviesServiceClient{cc}
+}
+
+func (c *moviesServiceClient) GetMovie(ctx context.Context, in *GetMovieRequest, opts ...grpc.CallOption) (*Movie, error) {
+	out := new(Movie)
+	err := c.cc.Invoke(ctx, MoviesService_GetMovie_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moviesServiceClient) ListMovies(ctx context.Context, in *ListMoviesRequest, opts ...grpc.CallOption) (*ListMoviesResponse, error) {
+	out := new(ListMoviesResponse)
+	err := c.cc.Invoke(ctx, MoviesService_ListMovies_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moviesServiceClient) CreateMovie(ctx context.Context, in *CreateMovieRequest, opts ...grpc.CallOption) (*Movie, error) {
+	out := new(Movie)
+	err := c.cc.Invoke(ctx, MoviesService_CreateMovie_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moviesServiceClient) UpdateMovie(ctx context.Context, in *UpdateMovieRequest, opts ...grpc.CallOption) (*Movie, error) {
+	out := new(Movie)
+	err := c.cc.Invoke(ctx, MoviesService_UpdateMovie_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moviesServiceClient) DeleteMovie(ctx context.Context, in *DeleteMovieRequest, opts ...grpc.CallOption) (*DeleteMovieResponse, error) {
+	out := new(DeleteMovieResponse)
+	err := c.cc.Invoke(ctx, MoviesService_DeleteMovie_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moviesServiceClient) WatchMovies(ctx context.Context, in *WatchMoviesRequest, opts ...grpc.CallOption) (MoviesService_WatchMoviesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MoviesService_ServiceDesc.Streams[0], MoviesService_WatchMovies_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &moviesServiceWatchMoviesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MoviesService_WatchMoviesClient interface {
+	Recv() (*MovieChange, error)
+	grpc.ClientStream
+}
+
+type moviesServiceWatchMoviesClient struct {
+	grpc.ClientStream
+}
+
+func (x *moviesServiceWatchMoviesClient) Recv() (*MovieChange, error) {
+	m := new(MovieChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MoviesServiceServer is the server API for MoviesService service.
+// All implementations must embed UnimplementedMoviesServiceServer
+// for forward compatibility
+type MoviesServiceServer interface {
+	GetMovie(context.Context, *GetMovieRequest) (*Movie, error)
+	ListMovies(context.Context, *ListMoviesRequest) (*ListMoviesResponse, error)
+	CreateMovie(context.Context, *CreateMovieRequest) (*Movie, error)
+	UpdateMovie(context.Context, *UpdateMovieRequest) (*Movie, error)
+	DeleteMovie(context.Context, *DeleteMovieRequest) (*DeleteMovieResponse, error)
+	WatchMovies(*WatchMoviesRequest, MoviesService_WatchMoviesServer) error
+	mustEmbedUnimplementedMoviesServiceServer()
+}
+
+// UnimplementedMoviesServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMoviesServiceServer struct {
+}
+
+func (UnimplementedMoviesServiceServer) GetMovie(context.Context, *GetMovieRequest) (*Movie, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMovie not implemented")
+}
+func (UnimplementedMoviesServiceServer) ListMovies(context.Context, *ListMoviesRequest) (*ListMoviesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMovies not implemented")
+}
+func (UnimplementedMoviesServiceServer) CreateMovie(context.Context, *CreateMovieRequest) (*Movie, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateMovie not implemented")
+}
+func (UnimplementedMoviesServiceServer) UpdateMovie(context.Context, *UpdateMovieRequest) (*Movie, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMovie not implemented")
+}
+func (UnimplementedMoviesServiceServer) DeleteMovie(context.Context, *DeleteMovieRequest) (*DeleteMovieResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMovie not implemented")
+}
+func (UnimplementedMoviesServiceServer) WatchMovies(*WatchMoviesRequest, MoviesService_WatchMoviesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchMovies not implemented")
+}
+func (UnimplementedMoviesServiceServer) mustEmbedUnimplementedMoviesServiceServer() {}
+
+// UnsafeMoviesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MoviesServiceServer will
+// result in compilation errors.
+type UnsafeMoviesServiceServer interface {
+	mustEmbedUnimplementedMoviesServiceServer()
+}
+
+func RegisterMoviesServiceServer(s grpc.ServiceRegistrar, srv MoviesServiceServer) {
+	s.RegisterService(&MoviesService_ServiceDesc, srv)
+}
+
+func _MoviesService_GetMovie_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMovieRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoviesServiceServer).GetMovie(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MoviesService_GetMovie_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoviesServiceServer).GetMovie(ctx, req.(*GetMovieRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MoviesService_ListMovies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMoviesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoviesServiceServer).ListMovies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MoviesService_ListMovies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoviesServiceServer).ListMovies(ctx, req.(*ListMoviesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MoviesService_CreateMovie_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateMovieRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoviesServiceServer).CreateMovie(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MoviesService_CreateMovie_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoviesServiceServer).CreateMovie(ctx, req.(*CreateMovieRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MoviesService_UpdateMovie_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMovieRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoviesServiceServer).UpdateMovie(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MoviesService_UpdateMovie_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoviesServiceServer).UpdateMovie(ctx, req.(*UpdateMovieRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MoviesService_DeleteMovie_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMovieRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoviesServiceServer).DeleteMovie(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MoviesService_DeleteMovie_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoviesServiceServer).DeleteMovie(ctx, req.(*DeleteMovieRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MoviesService_WatchMovies_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchMoviesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MoviesServiceServer).WatchMovies(m, &moviesServiceWatchMoviesServer{stream})
+}
+
+type MoviesService_WatchMoviesServer interface {
+	Send(*MovieChange) error
+	grpc.ServerStream
+}
+
+type moviesServiceWatchMoviesServer struct {
+	grpc.ServerStream
+}
+
+func (x *moviesServiceWatchMoviesServer) Send(m *MovieChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// MoviesService_ServiceDesc is the grpc.ServiceDesc for MoviesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MoviesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "com.github.iamthiago.movies.v1.MoviesService",
+	HandlerType: (*MoviesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMovie",
+			Handler:    _MoviesService_GetMovie_Handler,
+		},
+		{
+			MethodName: "ListMovies",
+			Handler:    _MoviesService_ListMovies_Handler,
+		},
+		{
+			MethodName: "CreateMovie",
+			Handler:    _MoviesService_CreateMovie_Handler,
+		},
+		{
+			MethodName: "UpdateMovie",
+			Handler:    _MoviesService_UpdateMovie_Handler,
+		},
+		{
+			MethodName: "DeleteMovie",
+			Handler:    _MoviesService_DeleteMovie_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchMovies",
+			Handler:       _MoviesService_WatchMovies_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/movies_service.proto",
+}
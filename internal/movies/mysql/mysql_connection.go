@@ -15,6 +15,9 @@ func GetMySQLDB() (db *sql.DB, err error) {
 		Addr:                 "localhost:3306",
 		DBName:               "movies",
 		AllowNativePasswords: true,
+		ParseTime:            true,
+		// report matched rows on update, so updating a movie with the same values isn't a not found
+		ClientFoundRows: true,
 	}
 
 	db, err = sql.Open("mysql", cfg.FormatDSN())
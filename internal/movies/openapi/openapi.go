@@ -0,0 +1,238 @@
+// Package openapi checks the http requests and responses against the OpenAPI description of the routes.
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func init() {
+	// the errors are sent back to the clients, without the schema and the value that failed
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	// imports, exports, the change feed and the docs page are plain text to the validation
+	for _, contentType := range []string{"text/csv", "application/x-ndjson", "application/ndjson", "text/event-stream", "text/html"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+}
+
+// Spec is an OpenAPI document, finding the operation of the requests it describes
+type Spec struct {
+	doc    *openapi3.T
+	router routers.Router
+	json   []byte
+}
+
+// GetSpec loads and validates an OpenAPI 3.1 document, in yaml or json.
+//
+// kin-openapi reads the schemas with its 3.0 model, so the document is kept to the part of JSON Schema
+// both versions agree on: the keywords only 3.1 has are rejected by the validation as unknown fields,
+// and the ones 3.0 gives another meaning, nullable and the boolean exclusiveMinimum and exclusiveMaximum,
+// are rejected here rather than checked the 3.0 way.
+func GetSpec(data []byte) (*Spec, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading openapi spec %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1.") {
+		return nil, fmt.Errorf("invalid openapi spec version %q, only 3.1 is supported", doc.OpenAPI)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec %v", err)
+	}
+	if err := checkSchemas(doc); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec %v", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error routing openapi spec %v", err)
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding openapi spec %v", err)
+	}
+
+	return &Spec{doc: doc, router: router, json: encoded}, nil
+}
+
+// JSON returns the document as json
+func (s *Spec) JSON() []byte {
+	return s.json
+}
+
+// Operations lists the operations of the document as "METHOD /path/{param}", sorted
+func (s *Spec) Operations() []string {
+	var operations []string
+	for path, item := range s.doc.Paths {
+		for method := range item.Operations() {
+			operations = append(operations, method+" "+path)
+		}
+	}
+
+	sort.Strings(operations)
+	return operations
+}
+
+// Middleware answers with 400 the requests that don't match their operation, the requests
+// the document doesn't describe are left to the router. The bodies of the operations taking json are checked
+// as json whatever their Content-Type, as the handlers read them, unless they are of another type
+// the operation takes: the files of the imports and posters are streamed to the handlers as they come.
+func (s *Spec) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := s.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		checked := r
+		jsonBody := readsJSON(route.Operation, r.Header.Get("Content-Type"))
+		if jsonBody && !isJSON(r.Header.Get("Content-Type")) {
+			// such as curl -d, which says it sends a form
+			checked = r.Clone(r.Context())
+			checked.Header.Set("Content-Type", "application/json")
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    checked,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !jsonBody,
+				// the tenant of the request was resolved already
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		// the body was read to be checked, the handler reads the copy left in its place
+		r.Body, r.GetBody = checked.Body, checked.GetBody
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ValidateResponse checks a response to r against its operation, an undocumented status being an error.
+// It is meant for the tests of the routes, so the document can't drift from the handlers.
+func (s *Spec) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	route, params, err := s.router.FindRoute(r)
+	if err != nil {
+		return fmt.Errorf("%s %s is not described %w", r.Method, r.URL.Path, err)
+	}
+
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{Request: r, PathParams: params, Route: route},
+		Status:                 status,
+		Header:                 header,
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	input.SetBodyBytes(body)
+
+	return openapi3filter.ValidateResponse(r.Context(), input)
+}
+
+// checkSchemas rejects the schemas of the document using the keywords OpenAPI 3.0 reads differently from 3.1
+func checkSchemas(doc *openapi3.T) error {
+	seen := map[*openapi3.Schema]bool{}
+	checkContent := func(name string, content openapi3.Content) error {
+		for mediaType, media := range content {
+			if err := checkSchema(name+" "+mediaType, media.Schema, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if doc.Components != nil {
+		for name, ref := range doc.Components.Schemas {
+			if err := checkSchema(name, ref, seen); err != nil {
+				return err
+			}
+		}
+	}
+	for path, item := range doc.Paths {
+		for method, operation := range item.Operations() {
+			name := method + " " + path
+			parameters := append(append(openapi3.Parameters{}, item.Parameters...), operation.Parameters...)
+			for _, parameter := range parameters {
+				if err := checkSchema(name+" "+parameter.Value.Name, parameter.Value.Schema, seen); err != nil {
+					return err
+				}
+			}
+			if operation.RequestBody != nil {
+				if err := checkContent(name, operation.RequestBody.Value.Content); err != nil {
+					return err
+				}
+			}
+			for status, response := range operation.Responses {
+				for header, ref := range response.Value.Headers {
+					if err := checkSchema(name+" "+status+" "+header, ref.Value.Schema, seen); err != nil {
+						return err
+					}
+				}
+				if err := checkContent(name+" "+status, response.Value.Content); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkSchema(name string, ref *openapi3.SchemaRef, seen map[*openapi3.Schema]bool) error {
+	if ref == nil || ref.Value == nil || seen[ref.Value] {
+		return nil
+	}
+	schema := ref.Value
+	seen[schema] = true
+
+	if schema.Nullable {
+		return fmt.Errorf("schema %s: nullable is not part of 3.1, add \"null\" to its types", name)
+	}
+	if schema.ExclusiveMin || schema.ExclusiveMax {
+		return fmt.Errorf("schema %s: exclusiveMinimum and exclusiveMaximum are numbers in 3.1", name)
+	}
+
+	for property, child := range schema.Properties {
+		if err := checkSchema(name+"."+property, child, seen); err != nil {
+			return err
+		}
+	}
+	children := append([]*openapi3.SchemaRef{schema.Items, schema.Not, schema.AdditionalProperties.Schema}, schema.AllOf...)
+	children = append(append(children, schema.AnyOf...), schema.OneOf...)
+	for _, child := range children {
+		if err := checkSchema(name, child, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// readsJSON tells whether the handler of the operation reads a body of contentType as json
+func readsJSON(operation *openapi3.Operation, contentType string) bool {
+	if operation.RequestBody == nil || operation.RequestBody.Value.Content.Get("application/json") == nil {
+		return false
+	}
+	return isJSON(contentType) || operation.RequestBody.Value.Content.Get(contentType) == nil
+}
@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/api"
+)
+
+func TestGetSpec(t *testing.T) {
+	spec, err := GetSpec(api.Spec)
+	require.NoError(t, err)
+
+	assert.Contains(t, spec.Operations(), "GET /movies/{id}")
+	assert.Contains(t, spec.Operations(), "POST /movies:batch")
+	assert.Contains(t, string(spec.JSON()), `"openapi":"3.1.0"`)
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{name: "incomplete", spec: `openapi: 3.1.0`, wantErr: "invalid openapi spec"},
+		{name: "3.0", spec: "openapi: 3.0.3\ninfo: {title: Movies, version: 1.0.0}\npaths: {}",
+			wantErr: `invalid openapi spec version "3.0.3", only 3.1 is supported`},
+		{name: "3.0 nullable", spec: "openapi: 3.1.0\ninfo: {title: Movies, version: 1.0.0}\npaths: {}\n" +
+			"components: {schemas: {Movie: {type: object, properties: {title: {type: string, nullable: true}}}}}",
+			wantErr: "schema Movie.title: nullable is not part of 3.1"},
+		{name: "3.0 exclusive minimum", spec: "openapi: 3.1.0\ninfo: {title: Movies, version: 1.0.0}\n" +
+			"paths: {/movies: {get: {parameters: [{name: limit, in: query, schema: {type: integer, minimum: 0, exclusiveMinimum: true}}], " +
+			"responses: {'200': {description: The movies}}}}}",
+			wantErr: "schema GET /movies limit: exclusiveMinimum and exclusiveMaximum are numbers in 3.1"},
+		{name: "3.1 only keyword", spec: "openapi: 3.1.0\ninfo: {title: Movies, version: 1.0.0}\npaths: {}\n" +
+			"components: {schemas: {Change: {type: string, const: created}}}",
+			wantErr: "invalid openapi spec"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GetSpec([]byte(tc.spec))
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	spec, err := GetSpec(api.Spec)
+	require.NoError(t, err)
+
+	jsonHeaders := map[string]string{"Content-Type": "application/json"}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "valid", method: "PUT", path: "/movies/1", headers: jsonHeaders,
+			body: `{"isbn": "9788401490040", "title": "Jaws"}`, wantStatus: http.StatusOK},
+		{name: "invalid path parameter", method: "GET", path: "/movies/jaws", wantStatus: http.StatusBadRequest,
+			wantError: `parameter "id" in path has an error: value jaws: an invalid integer: invalid syntax`},
+		{name: "invalid query parameter", method: "GET", path: "/movies/1/reviews?limit=500", wantStatus: http.StatusBadRequest,
+			wantError: `parameter "limit" in query has an error: number must be at most 100`},
+		{name: "invalid header", method: "GET", path: "/collections", headers: map[string]string{"X-User-ID": strings.Repeat("u", 65)},
+			wantStatus: http.StatusBadRequest,
+			wantError:  `parameter "X-User-ID" in header has an error: maximum string length is 64`},
+		{name: "invalid json", method: "POST", path: "/movies", headers: jsonHeaders, body: `{"title": `,
+			wantStatus: http.StatusBadRequest, wantError: "request body has an error"},
+		{name: "body not matching its schema", method: "POST", path: "/movies:batch", headers: jsonHeaders,
+			body: `{"operations": {"op": "delete"}}`, wantStatus: http.StatusBadRequest, wantError: "request body has an error"},
+		{name: "body not sent as json", method: "POST", path: "/movies", body: `{"title": 1}`, wantStatus: http.StatusBadRequest,
+			wantError: "request body has an error"},
+		{name: "body sent as a form", method: "POST", path: "/movies", headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body: `{"isbn": "9788401490040", "title": "Jaws"}`, wantStatus: http.StatusOK},
+		{name: "body of another type", method: "PUT", path: "/movies/1", headers: map[string]string{"Content-Type": "text/plain"},
+			body: "Jaws", wantStatus: http.StatusBadRequest, wantError: "request body has an error"},
+		{name: "csv import", method: "POST", path: "/movies/import?dry_run=true", headers: map[string]string{"Content-Type": "text/csv"},
+			body: "isbn,title\n9788401490040,Jaws\n", wantStatus: http.StatusOK},
+		{name: "not described", method: "GET", path: "/movies/1/cast", wantStatus: http.StatusOK},
+		// literal segments where a parameter could match too
+		{name: "export", method: "GET", path: "/movies/export?format=ndjson", wantStatus: http.StatusOK},
+		{name: "stream", method: "GET", path: "/movies/stream/ws", wantStatus: http.StatusOK},
+		{name: "shared collection", method: "GET", path: "/collections/shared/f00d", wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := spec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+			}))
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantError != "" {
+				var response struct {
+					Error string `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.True(t, strings.HasPrefix(response.Error, tc.wantError), response.Error)
+				return
+			}
+			assert.Equal(t, tc.body, received, "the handler gets the whole body")
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	spec, err := GetSpec(api.Spec)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{name: "valid", method: "GET", path: "/movies/1", status: http.StatusOK,
+			body: `{"id": 1, "isbn": "9788401490040", "title": "Jaws", "director": "Steven Spielberg"}`},
+		{name: "missing field", method: "GET", path: "/movies/1", status: http.StatusOK,
+			body: `{"id": 1, "title": "Jaws"}`, wantErr: true},
+		{name: "undocumented status", method: "GET", path: "/movies/1", status: http.StatusTeapot,
+			body: `{"error": "teapot"}`, wantErr: true},
+		{name: "error", method: "GET", path: "/movies/1", status: http.StatusNotFound, body: `{"error": "movie not found"}`},
+		{name: "error without its message", method: "GET", path: "/movies/1", status: http.StatusNotFound, body: `{}`, wantErr: true},
+		{name: "empty body of a server error", method: "DELETE", path: "/movies/1", status: http.StatusInternalServerError},
+		{name: "not described", method: "GET", path: "/movies/1/cast", status: http.StatusOK, body: `[]`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{"Content-Type": []string{"application/json"}}
+			err := spec.ValidateResponse(httptest.NewRequest(tc.method, tc.path, nil), tc.status, header, []byte(tc.body))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+-- The movies tables of movies.ddl for postgres, created when the database is opened.
+-- The languages sort byte by byte, whatever the locale of the database.
+CREATE TABLE IF NOT EXISTS movies (
+    id              BIGINT GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id       VARCHAR(64) NOT NULL,
+    isbn            VARCHAR(128) NOT NULL,
+    title           VARCHAR(128) NOT NULL,
+    director        VARCHAR(128) NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT movies_isbn UNIQUE (tenant_id, isbn),
+    CONSTRAINT movies_tenant UNIQUE (tenant_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS external_ids (
+    tenant_id       VARCHAR(64) NOT NULL,
+    movie_id        BIGINT NOT NULL,
+    source          VARCHAR(16) NOT NULL,
+    external_id     VARCHAR(128) NOT NULL,
+    PRIMARY KEY (movie_id, source),
+    CONSTRAINT external_ids_source UNIQUE (tenant_id, source, external_id),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS movie_translations (
+    tenant_id       VARCHAR(64) NOT NULL,
+    movie_id        BIGINT NOT NULL,
+    language        VARCHAR(35) COLLATE "C" NOT NULL,
+    title           VARCHAR(128) NOT NULL,
+    synopsis        TEXT NOT NULL,
+    PRIMARY KEY (movie_id, language),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+);
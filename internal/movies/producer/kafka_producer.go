@@ -2,12 +2,20 @@ package producer
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
 
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
 type KafkaProducer interface {
-	SendMovieEvent(movieBytes []byte) (err error)
+	SendMovieEvent(msg Message) (err error)
+	SendMovieEvents(msgs []Message) (err error)
 }
 
 type KafkaProducerConfig struct {
@@ -15,10 +23,12 @@ type KafkaProducerConfig struct {
 	Topic    *string
 }
 
-func (k *KafkaProducerConfig) SendMovieEvent(movieBytes []byte) error {
+func (k *KafkaProducerConfig) SendMovieEvent(msg Message) error {
 	err := k.Producer.Produce(&kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: k.Topic, Partition: kafka.PartitionAny},
-		Value:          movieBytes,
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers:        toKafkaHeaders(msg.Headers),
 	}, nil)
 
 	if err != nil {
@@ -28,6 +38,35 @@ func (k *KafkaProducerConfig) SendMovieEvent(movieBytes []byte) error {
 	return nil
 }
 
+// SendMovieEvents enqueues all the events at once, librdkafka takes care of batching them.
+func (k *KafkaProducerConfig) SendMovieEvents(msgs []Message) error {
+	for _, msg := range msgs {
+		if err := k.SendMovieEvent(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toKafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kafkaHeaders := make([]kafka.Header, 0, len(keys))
+	for _, k := range keys {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(headers[k])})
+	}
+	return kafkaHeaders
+}
+
 func GetKafkaProducer(topic *string) (producer KafkaProducerConfig, err error) {
 	p, err := kafka.NewProducer(&kafka.ConfigMap{
 		"bootstrap.servers": "localhost",
@@ -0,0 +1,77 @@
+package producer
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryProducer keeps the messages it is sent instead of producing them to kafka, in the order they were sent.
+// It stands in for a kafka cluster in tests, Fail and Latency simulating a broker that is down or slow.
+// Its zero value is ready to use.
+type MemoryProducer struct {
+	// Fail, when set, is asked about every message before it is kept, the message is dropped when it returns an error
+	Fail func(msg Message) error
+	// Latency is waited before every message is kept
+	Latency time.Duration
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (p *MemoryProducer) SendMovieEvent(msg Message) error {
+	if p.Latency > 0 {
+		time.Sleep(p.Latency)
+	}
+	if p.Fail != nil {
+		if err := p.Fail(msg); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, copyMessage(msg))
+	return nil
+}
+
+// SendMovieEvents keeps the messages until one fails, as the kafka producer enqueues them one by one.
+func (p *MemoryProducer) SendMovieEvents(msgs []Message) error {
+	for _, msg := range msgs {
+		if err := p.SendMovieEvent(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Messages returns the messages kept so far, oldest first
+func (p *MemoryProducer) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Message(nil), p.messages...)
+}
+
+// Reset forgets the messages kept so far
+func (p *MemoryProducer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = nil
+}
+
+// copyMessage keeps the message from changing when the sender reuses its buffers
+func copyMessage(msg Message) Message {
+	copied := Message{
+		Key:   append([]byte(nil), msg.Key...),
+		Value: append([]byte(nil), msg.Value...),
+	}
+	if msg.Headers != nil {
+		copied.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			copied.Headers[k] = v
+		}
+	}
+	return copied
+}
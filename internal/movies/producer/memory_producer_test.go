@@ -0,0 +1,34 @@
+package producer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryProducer(t *testing.T) {
+	down := errors.New("broker is down")
+	p := &MemoryProducer{Fail: func(msg Message) error {
+		if string(msg.Key) == "default/2" {
+			return down
+		}
+		return nil
+	}}
+
+	value := []byte("jaws")
+	headers := map[string]string{"content-type": "application/json"}
+	assert.NoError(t, p.SendMovieEvent(Message{Key: []byte("default/1"), Value: value, Headers: headers}))
+	value[0], headers["content-type"] = 'J', "text/plain"
+
+	err := p.SendMovieEvents([]Message{{Key: []byte("default/3")}, {Key: []byte("default/2")}, {Key: []byte("default/4")}})
+	assert.ErrorIs(t, err, down)
+
+	assert.Equal(t, []Message{
+		{Key: []byte("default/1"), Value: []byte("jaws"), Headers: map[string]string{"content-type": "application/json"}},
+		{Key: []byte("default/3")},
+	}, p.Messages())
+
+	p.Reset()
+	assert.Empty(t, p.Messages())
+}
@@ -0,0 +1,133 @@
+package projection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// JSONStore is a reference read model that materializes movie events into a local json file.
+type JSONStore struct {
+	Path   string
+	mu     sync.Mutex
+	movies map[int64]models.Movie
+}
+
+func GetJSONStore(path string) (*JSONStore, error) {
+	store := JSONStore{Path: path, movies: map[int64]models.Movie{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading projection file %v", err)
+	}
+
+	var movies []models.Movie
+	if err := json.Unmarshal(data, &movies); err != nil {
+		return nil, fmt.Errorf("error decoding projection file %v", err)
+	}
+
+	for _, m := range movies {
+		store.movies[m.ID] = m
+	}
+
+	return &store, nil
+}
+
+// HandleMovieEvent removes the movie of a deleted event, any other event has the movie as it is now and replaces it
+func (s *JSONStore) HandleMovieEvent(event *events.MovieEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.Change == string(changes.Deleted) {
+		delete(s.movies, event.Id)
+		return s.flush()
+	}
+
+	s.movies[event.Id] = models.Movie{
+		ID:           event.Id,
+		Isbn:         event.Isbn,
+		Title:        event.Title,
+		Director:     event.Director,
+		ExternalIDs:  event.ExternalIds,
+		Translations: translations(event.Translations),
+	}
+
+	return s.flush()
+}
+
+// translations orders the translations of an event by language, as the api lists them
+func translations(byLanguage map[string]*events.Translation) []models.Translation {
+	languages := make([]string, 0, len(byLanguage))
+	for language := range byLanguage {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	var translations []models.Translation
+	for _, language := range languages {
+		t := byLanguage[language]
+		translations = append(translations, models.Translation{Language: language, Title: t.Title, Synopsis: t.Synopsis})
+	}
+	return translations
+}
+
+func (s *JSONStore) GetMovies() []models.Movie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sorted()
+}
+
+func (s *JSONStore) sorted() []models.Movie {
+	movies := make([]models.Movie, 0, len(s.movies))
+	for _, m := range s.movies {
+		movies = append(movies, m)
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].ID < movies[j].ID })
+
+	return movies
+}
+
+// flush writes to a temp file next to the projection and renames it over it, so a crash mid-write
+// leaves either the previous file or the new one, never a partially written one
+func (s *JSONStore) flush() error {
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding projection %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating projection file %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing projection file %v", err)
+	}
+	// the data has to be on disk before the rename, or a crash could leave the renamed file empty
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing projection file %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing projection file %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("error replacing projection file %v", err)
+	}
+	return nil
+}
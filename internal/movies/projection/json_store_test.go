@@ -0,0 +1,108 @@
+package projection
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+func TestHandleMovieEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movies.json")
+	store, err := GetJSONStore(path)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		event *events.MovieEvent
+		want  []models.Movie
+	}{
+		{
+			name:  "Should add a movie",
+			event: &events.MovieEvent{Id: 2, Isbn: "9780306406157", Title: "Duel", Director: "Steven Spielberg"},
+			want:  []models.Movie{{ID: 2, Isbn: "9780306406157", Title: "Duel", Director: "Steven Spielberg"}},
+		},
+		{
+			name: "Should add a movie ordered by id",
+			event: &events.MovieEvent{Id: 1, Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg",
+				Translations: map[string]*events.Translation{"pt-BR": {Title: "Tubarão"}, "es": {Title: "Tiburón"}}},
+			want: []models.Movie{
+				{ID: 1, Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg",
+					Translations: []models.Translation{{Language: "es", Title: "Tiburón"}, {Language: "pt-BR", Title: "Tubarão"}}},
+				{ID: 2, Isbn: "9780306406157", Title: "Duel", Director: "Steven Spielberg"},
+			},
+		},
+		{
+			name:  "Should replace a movie",
+			event: &events.MovieEvent{Id: 2, Change: "updated", Isbn: "9780306406157", Title: "Duel (1971)", Director: "Steven Spielberg"},
+			want: []models.Movie{
+				{ID: 1, Isbn: "9780140449136", Title: "Jaws", Director: "Steven Spielberg",
+					Translations: []models.Translation{{Language: "es", Title: "Tiburón"}, {Language: "pt-BR", Title: "Tubarão"}}},
+				{ID: 2, Isbn: "9780306406157", Title: "Duel (1971)", Director: "Steven Spielberg"},
+			},
+		},
+		{
+			name:  "Should remove a deleted movie",
+			event: &events.MovieEvent{Id: 1, Change: "deleted"},
+			want:  []models.Movie{{ID: 2, Isbn: "9780306406157", Title: "Duel (1971)", Director: "Steven Spielberg"}},
+		},
+		{
+			name:  "Should ignore the deletion of an unknown movie",
+			event: &events.MovieEvent{Id: 3, Change: "deleted"},
+			want:  []models.Movie{{ID: 2, Isbn: "9780306406157", Title: "Duel (1971)", Director: "Steven Spielberg"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, store.HandleMovieEvent(tc.event))
+			assert.Equal(t, tc.want, store.GetMovies())
+
+			reloaded, err := GetJSONStore(path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, reloaded.GetMovies())
+		})
+	}
+
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "no temp file should be left behind")
+}
+
+func TestGetJSONStore(t *testing.T) {
+	t.Run("Should start empty without a projection file", func(t *testing.T) {
+		store, err := GetJSONStore(filepath.Join(t.TempDir(), "movies.json"))
+		require.NoError(t, err)
+		assert.Empty(t, store.GetMovies())
+	})
+
+	t.Run("Should not load a corrupted projection file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "movies.json")
+		require.NoError(t, os.WriteFile(path, []byte(`[{"id": 1, "title": "Ja`), 0644))
+
+		_, err := GetJSONStore(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should keep the previous projection when a write crashed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "movies.json")
+		store, err := GetJSONStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.HandleMovieEvent(&events.MovieEvent{Id: 1, Title: "Jaws"}))
+
+		// a crash mid-write leaves a partial temp file next to the projection
+		require.NoError(t, os.WriteFile(path+".123.tmp", []byte(`[{"id": 1, "title": "Ja`), 0644))
+
+		reloaded, err := GetJSONStore(path)
+		require.NoError(t, err)
+		assert.Equal(t, []models.Movie{{ID: 1, Title: "Jaws"}}, reloaded.GetMovies())
+
+		require.NoError(t, reloaded.HandleMovieEvent(&events.MovieEvent{Id: 2, Title: "Duel"}))
+		assert.Equal(t, []models.Movie{{ID: 1, Title: "Jaws"}, {ID: 2, Title: "Duel"}}, reloaded.GetMovies())
+	})
+}
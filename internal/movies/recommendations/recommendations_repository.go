@@ -0,0 +1,252 @@
+package recommendations
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// maxDirectorCandidates bounds how many movies of the same director are compared with a movie
+const maxDirectorCandidates = 200
+
+// topRatedMinReviews is how many approved reviews a movie needs to be recommended as top rated
+const topRatedMinReviews = 3
+
+// RecommendationsRepository reads the signals of the movies and keeps their precomputed similarities.
+// Movies are only compared with the movies of their own tenant, and users of a tenant
+// only get its movies recommended, as the same user id can be a different user in another tenant.
+type RecommendationsRepository interface {
+	GetSignals(tenant string, movieId int64) (*Signals, error)
+	// SaveSimilar replaces the similarities of the movie, in both directions
+	SaveSimilar(tenant string, movieId int64, similar []Similarity) error
+	GetSimilar(tenant string, movieId int64, limit int) ([]models.SimilarMovie, error)
+	// GetUserMovies returns the movies the user liked or collected, and every movie they reviewed or collected
+	GetUserMovies(tenant string, userId string) (liked []int64, seen []int64, err error)
+	// GetRecommendations sums the similarities of the seeds, leaving out the excluded movies
+	GetRecommendations(tenant string, seeds []int64, exclude []int64, limit int) ([]models.SimilarMovie, error)
+	GetTopRated(tenant string, exclude []int64, limit int) ([]models.SimilarMovie, error)
+}
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func (r *Repository) GetSignals(tenant string, movieId int64) (*Signals, error) {
+	signals := Signals{MovieID: movieId, Candidates: map[int64]*Candidate{}}
+	candidate := func(id int64) *Candidate {
+		if signals.Candidates[id] == nil {
+			signals.Candidates[id] = &Candidate{}
+		}
+		return signals.Candidates[id]
+	}
+
+	var director string
+	if err := r.DB.QueryRow("select director from movies where id = ? and tenant_id = ?", movieId, tenant).Scan(&director); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getSignals %d: %w", movieId, repository.ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+
+	err := r.query("select id from movies where tenant_id = ? and director = ? and id <> ? limit ?", []interface{}{tenant, director, movieId, maxDirectorCandidates},
+		func(scan func(dest ...interface{}) error) error {
+			var id int64
+			if err := scan(&id); err != nil {
+				return err
+			}
+			candidate(id).SameDirector = true
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+
+	if err := r.DB.QueryRow("select count(*) from collection_items where tenant_id = ? and movie_id = ?", tenant, movieId).Scan(&signals.Collections); err != nil {
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+	err = r.query("select other.movie_id, count(*), (select count(*) from collection_items c where c.tenant_id = other.tenant_id and c.movie_id = other.movie_id) "+
+		"from collection_items this join collection_items other on other.collection_id = this.collection_id and other.movie_id <> this.movie_id "+
+		"where this.tenant_id = ? and this.movie_id = ? group by other.movie_id", []interface{}{tenant, movieId},
+		func(scan func(dest ...interface{}) error) error {
+			var id int64
+			var shared, total int
+			if err := scan(&id, &shared, &total); err != nil {
+				return err
+			}
+			candidate(id).SharedCollections, candidate(id).Collections = shared, total
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+
+	liked := func(alias string) string {
+		return alias + ".status = '" + models.ReviewApproved + "' and " + alias + ".score >= ?"
+	}
+	if err := r.DB.QueryRow("select count(*) from reviews f where f.tenant_id = ? and f.movie_id = ? and "+liked("f"), tenant, movieId, LikedScore).Scan(&signals.Fans); err != nil {
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+	err = r.query("select other.movie_id, count(*), (select count(*) from reviews f where f.tenant_id = other.tenant_id and f.movie_id = other.movie_id and "+liked("f")+") "+
+		"from reviews this join reviews other on other.tenant_id = this.tenant_id and other.user_id = this.user_id and other.movie_id <> this.movie_id "+
+		"where this.tenant_id = ? and this.movie_id = ? and "+liked("this")+" and "+liked("other")+" group by other.movie_id",
+		[]interface{}{LikedScore, tenant, movieId, LikedScore, LikedScore},
+		func(scan func(dest ...interface{}) error) error {
+			var id int64
+			var shared, total int
+			if err := scan(&id, &shared, &total); err != nil {
+				return err
+			}
+			candidate(id).SharedFans, candidate(id).Fans = shared, total
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("getSignals %d: %v", movieId, err)
+	}
+
+	return &signals, nil
+}
+
+// SaveSimilar also drops the movie from the similarities of the others, unless it is among the ones given.
+// A movie can lose a neighbour it would have kept this way, until that neighbour is refreshed itself.
+func (r *Repository) SaveSimilar(tenant string, movieId int64, similar []Similarity) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("save similar movies: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from movie_similarities where tenant_id = ? and (movie_id = ? or similar_movie_id = ?)", tenant, movieId, movieId); err != nil {
+		return fmt.Errorf("save similar movies: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, s := range similar {
+		reasons := strings.Join(s.Reasons, ",")
+		if _, err := tx.Exec("insert into movie_similarities (tenant_id, movie_id, similar_movie_id, score, reasons, computed_at) values (?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?)",
+			tenant, movieId, s.MovieID, s.Score, reasons, now, tenant, s.MovieID, movieId, s.Score, reasons, now); err != nil {
+			return fmt.Errorf("save similar movies: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save similar movies: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetSimilar(tenant string, movieId int64, limit int) ([]models.SimilarMovie, error) {
+	similar, err := r.similarMovies("select m.id, m.isbn, m.title, m.director, s.score, s.reasons from movie_similarities s "+
+		"join movies m on m.tenant_id = s.tenant_id and m.id = s.similar_movie_id where s.tenant_id = ? and s.movie_id = ? order by s.score desc, m.id limit ?", tenant, movieId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getSimilar %d: %v", movieId, err)
+	}
+	return similar, nil
+}
+
+func (r *Repository) GetUserMovies(tenant string, userId string) ([]int64, []int64, error) {
+	var liked, seen []int64
+	err := r.query("select movie_id, score >= ? and status = ? from reviews where tenant_id = ? and user_id = ? "+
+		"union all select ci.movie_id, true from collection_items ci join collections c on c.id = ci.collection_id where c.tenant_id = ? and c.owner_id = ?",
+		[]interface{}{LikedScore, models.ReviewApproved, tenant, userId, tenant, userId},
+		func(scan func(dest ...interface{}) error) error {
+			var id int64
+			var like bool
+			if err := scan(&id, &like); err != nil {
+				return err
+			}
+			if like {
+				liked = append(liked, id)
+			}
+			seen = append(seen, id)
+			return nil
+		})
+	if err != nil {
+		return nil, nil, fmt.Errorf("getUserMovies %s: %v", userId, err)
+	}
+	return liked, seen, nil
+}
+
+func (r *Repository) GetRecommendations(tenant string, seeds []int64, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	if len(seeds) == 0 {
+		return nil, nil
+	}
+
+	args := append(ids(seeds), ids(exclude)...)
+	args = append([]interface{}{len(seeds), tenant}, append(args, limit)...)
+	query := "select m.id, m.isbn, m.title, m.director, sum(s.score) / ?, '" + models.RecommendedSimilar + "' from movie_similarities s " +
+		"join movies m on m.tenant_id = s.tenant_id and m.id = s.similar_movie_id where s.tenant_id = ? and s.movie_id in (" + placeholders(len(seeds)) + ")" + notIn("s.similar_movie_id", len(exclude)) +
+		" group by m.id, m.isbn, m.title, m.director order by 5 desc, m.id limit ?"
+
+	similar, err := r.similarMovies(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getRecommendations %v", err)
+	}
+	return similar, nil
+}
+
+// GetTopRated scores the movies by their average rating, from 0 to 1
+func (r *Repository) GetTopRated(tenant string, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	args := append([]interface{}{models.MaxReviewScore, tenant, topRatedMinReviews}, append(ids(exclude), limit)...)
+	query := "select m.id, m.isbn, m.title, m.director, r.average / ?, '" + models.RecommendedTopRated + "' from movie_ratings r " +
+		"join movies m on m.tenant_id = r.tenant_id and m.id = r.movie_id where r.tenant_id = ? and r.review_count >= ?" + notIn("m.id", len(exclude)) +
+		" order by r.average desc, r.review_count desc, m.id limit ?"
+
+	similar, err := r.similarMovies(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getTopRated %v", err)
+	}
+	return similar, nil
+}
+
+func (r *Repository) similarMovies(query string, args ...interface{}) ([]models.SimilarMovie, error) {
+	var similar []models.SimilarMovie
+	err := r.query(query, args, func(scan func(dest ...interface{}) error) error {
+		var s models.SimilarMovie
+		var reasons string
+		if err := scan(&s.Movie.ID, &s.Movie.Isbn, &s.Movie.Title, &s.Movie.Director, &s.Score, &reasons); err != nil {
+			return err
+		}
+		s.Reasons = strings.Split(reasons, ",")
+		similar = append(similar, s)
+		return nil
+	})
+	return similar, err
+}
+
+func (r *Repository) query(query string, args []interface{}, fn func(scan func(dest ...interface{}) error) error) error {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func notIn(column string, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return " and " + column + " not in (" + placeholders(n) + ")"
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func ids(values []int64) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
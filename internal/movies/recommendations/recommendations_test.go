@@ -0,0 +1,255 @@
+package recommendations
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		name      string
+		signals   Signals
+		limit     int
+		wantIds   []int64
+		wantScore []float64
+		wantWhy   [][]string
+	}{
+		{
+			name: "Should score a movie of the same director",
+			signals: Signals{Candidates: map[int64]*Candidate{
+				2: {SameDirector: true},
+			}},
+			limit:     10,
+			wantIds:   []int64{2},
+			wantScore: []float64{0.4},
+			wantWhy:   [][]string{{models.SimilarDirector}},
+		},
+		{
+			name: "Should add up every signal",
+			signals: Signals{Collections: 4, Fans: 1, Candidates: map[int64]*Candidate{
+				2: {SameDirector: true, SharedCollections: 4, Collections: 4, SharedFans: 1, Fans: 1},
+				3: {SharedCollections: 1, Collections: 1},
+			}},
+			limit:     10,
+			wantIds:   []int64{2, 3},
+			wantScore: []float64{1, 0.175},
+			wantWhy:   [][]string{{models.SimilarDirector, models.SimilarCollections, models.SimilarReviews}, {models.SimilarCollections}},
+		},
+		{
+			name: "Should not make a movie in every collection similar to everything",
+			signals: Signals{Collections: 1, Candidates: map[int64]*Candidate{
+				2: {SharedCollections: 1, Collections: 100},
+				3: {SharedCollections: 1, Collections: 1},
+			}},
+			limit:     10,
+			wantIds:   []int64{3, 2},
+			wantScore: []float64{0.35, 0.035},
+			wantWhy:   [][]string{{models.SimilarCollections}, {models.SimilarCollections}},
+		},
+		{
+			name: "Should keep only the most similar movies",
+			signals: Signals{Candidates: map[int64]*Candidate{
+				4: {SameDirector: true},
+				2: {SameDirector: true},
+				3: {SameDirector: true},
+			}},
+			limit:     2,
+			wantIds:   []int64{2, 3},
+			wantScore: []float64{0.4, 0.4},
+			wantWhy:   [][]string{{models.SimilarDirector}, {models.SimilarDirector}},
+		},
+		{
+			name:    "Should leave out candidates with nothing in common",
+			signals: Signals{Candidates: map[int64]*Candidate{2: {Collections: 3, Fans: 2}}},
+			limit:   10,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			similar := Score(&tc.signals, tc.limit)
+
+			var ids []int64
+			var scores []float64
+			var reasons [][]string
+			for _, s := range similar {
+				ids = append(ids, s.MovieID)
+				scores = append(scores, s.Score)
+				reasons = append(reasons, s.Reasons)
+			}
+			assert.Equal(t, tc.wantIds, ids)
+			assert.Equal(t, tc.wantScore, scores)
+			assert.Equal(t, tc.wantWhy, reasons)
+		})
+	}
+}
+
+type fakeRepository struct {
+	mu       sync.Mutex
+	signals  map[int64]*Signals
+	saved    map[int64][]Similarity
+	liked    []int64
+	seen     []int64
+	similar  []models.SimilarMovie
+	topRated []models.SimilarMovie
+	excluded []int64
+	tenants  []string
+}
+
+func (f *fakeRepository) GetSignals(tenant string, movieId int64) (*Signals, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tenants = append(f.tenants, tenant)
+	signals, ok := f.signals[movieId]
+	if !ok {
+		return nil, fmt.Errorf("getSignals %d: %w", movieId, repository.ErrMovieNotFound)
+	}
+	return signals, nil
+}
+
+func (f *fakeRepository) SaveSimilar(tenant string, movieId int64, similar []Similarity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.saved[movieId] = similar
+	return nil
+}
+
+func (f *fakeRepository) refreshed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.tenants...)
+}
+
+func (f *fakeRepository) GetSimilar(tenant string, movieId int64, limit int) ([]models.SimilarMovie, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) GetUserMovies(tenant string, userId string) ([]int64, []int64, error) {
+	return f.liked, f.seen, nil
+}
+
+func (f *fakeRepository) GetRecommendations(tenant string, seeds []int64, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	if len(seeds) == 0 {
+		return nil, nil
+	}
+	return f.similar, nil
+}
+
+func (f *fakeRepository) GetTopRated(tenant string, exclude []int64, limit int) ([]models.SimilarMovie, error) {
+	f.excluded = exclude
+	if len(f.topRated) > limit {
+		return f.topRated[:limit], nil
+	}
+	return f.topRated, nil
+}
+
+func TestHandleMovieEvent(t *testing.T) {
+	repo := &fakeRepository{
+		signals: map[int64]*Signals{1: {MovieID: 1, Candidates: map[int64]*Candidate{2: {SameDirector: true}}}},
+		saved:   map[int64][]Similarity{},
+	}
+	recommender := GetRecommender(repo)
+
+	assert.NoError(t, recommender.HandleMovieEvent(&events.MovieEvent{Id: 1, TenantId: "studio-a"}))
+	assert.Equal(t, []Similarity{{MovieID: 2, Score: 0.4, Reasons: []string{models.SimilarDirector}}}, repo.saved[1])
+
+	// a movie deleted after its event has nothing to refresh
+	assert.NoError(t, recommender.HandleMovieEvent(&events.MovieEvent{Id: 5}))
+
+	// events without a tenant are from before catalogues were split by tenant
+	assert.Equal(t, []string{"studio-a", tenant.Default}, repo.tenants)
+}
+
+func TestRun(t *testing.T) {
+	director := &Signals{MovieID: 1, Candidates: map[int64]*Candidate{2: {SameDirector: true}}}
+	repo := &fakeRepository{signals: map[int64]*Signals{1: director, 2: director, 3: director}, saved: map[int64][]Similarity{}}
+	recommender := GetRecommender(repo)
+	broadcaster := &changes.Broadcaster{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go recommender.Run(ctx, broadcaster)
+
+	// the broadcaster only sends the changes published once subscribed
+	assert.Eventually(t, func() bool {
+		broadcaster.Publish("studio-a", changes.Updated, models.Movie{ID: 1})
+		return len(repo.refreshed()) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	broadcaster.Publish("studio-a", changes.Created, models.Movie{ID: 4})
+	recommender.Changed("studio-b", 2, 3)
+
+	assert.Eventually(t, func() bool {
+		queued := 0
+		for _, tenant := range repo.refreshed() {
+			if tenant == "studio-b" {
+				queued++
+			}
+		}
+		return queued == 2
+	}, time.Second, 10*time.Millisecond)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Contains(t, repo.saved, int64(2))
+	assert.Contains(t, repo.saved, int64(3))
+	assert.NotContains(t, repo.saved, int64(4), "created movies are refreshed from their events")
+}
+
+func TestRecommend(t *testing.T) {
+	similar := models.SimilarMovie{Movie: models.Movie{ID: 3}, Score: 0.4, Reasons: []string{models.RecommendedSimilar}}
+	topRated := []models.SimilarMovie{
+		{Movie: models.Movie{ID: 7}, Score: 0.9, Reasons: []string{models.RecommendedTopRated}},
+		{Movie: models.Movie{ID: 8}, Score: 0.8, Reasons: []string{models.RecommendedTopRated}},
+	}
+
+	testCases := []struct {
+		name        string
+		liked       []int64
+		seen        []int64
+		wantIds     []int64
+		wantExclude []int64
+	}{
+		{
+			name:        "Should recommend movies similar to the liked ones, then top rated ones",
+			liked:       []int64{1},
+			seen:        []int64{1, 2},
+			wantIds:     []int64{3, 7},
+			wantExclude: []int64{1, 2, 3},
+		},
+		{
+			name:    "Should recommend top rated movies to a new user",
+			wantIds: []int64{7, 8},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{liked: tc.liked, seen: tc.seen, similar: []models.SimilarMovie{similar}, topRated: topRated}
+			recommender := GetRecommender(repo)
+
+			recommended, err := recommender.Recommend("studio-a", "ana", 2)
+			assert.NoError(t, err)
+
+			var ids []int64
+			for _, m := range recommended {
+				ids = append(ids, m.Movie.ID)
+			}
+			assert.Equal(t, tc.wantIds, ids)
+			assert.ElementsMatch(t, tc.wantExclude, repo.excluded)
+		})
+	}
+}
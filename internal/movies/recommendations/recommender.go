@@ -0,0 +1,150 @@
+package recommendations
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	// DefaultNeighbors is how many similar movies are kept for each movie
+	DefaultNeighbors = 50
+	// maxSeeds bounds how many of the movies of a user are used to recommend others
+	maxSeeds = 200
+	// queueSize bounds how many changed movies wait to be refreshed
+	queueSize = 1000
+)
+
+// Recommender finds similar movies from the precomputed similarities, which are refreshed
+// by consuming the movie events and by Run, and recommends movies to users from the ones they liked.
+type Recommender struct {
+	Repository RecommendationsRepository
+	Neighbors  int
+	queue      chan refresh
+}
+
+type refresh struct {
+	tenant  string
+	movieId int64
+}
+
+func GetRecommender(repo RecommendationsRepository) *Recommender {
+	return &Recommender{Repository: repo, Neighbors: DefaultNeighbors, queue: make(chan refresh, queueSize)}
+}
+
+// HandleMovieEvent refreshes the similarities of the movie of the event, within its tenant.
+// Reindexing the catalogue sends every movie again, which refreshes all of them.
+func (r *Recommender) HandleMovieEvent(event *events.MovieEvent) error {
+	// events sent before catalogues were split by tenant belong to the default one
+	tenantId := event.TenantId
+	if tenantId == "" {
+		tenantId = tenant.Default
+	}
+
+	err := r.Refresh(tenantId, event.Id)
+	if errors.Is(err, repository.ErrMovieNotFound) {
+		// deleted since, its similarities went with it
+		return nil
+	}
+	return err
+}
+
+// Refresh computes the similarities of the movie of the tenant again.
+func (r *Recommender) Refresh(tenant string, movieId int64) error {
+	signals, err := r.Repository.GetSignals(tenant, movieId)
+	if err != nil {
+		return err
+	}
+	return r.Repository.SaveSimilar(tenant, movieId, Score(signals, r.Neighbors))
+}
+
+// Changed queues the movies of the tenant to be refreshed by Run, for the changes that don't send movie events
+// such as reviews and collection items. Movies are dropped when the queue is full.
+func (r *Recommender) Changed(tenant string, movieIds ...int64) {
+	for _, movieId := range movieIds {
+		select {
+		case r.queue <- refresh{tenant: tenant, movieId: movieId}:
+		default:
+			log.Printf("Similarities queue is full, movie %d was not refreshed\n", movieId)
+		}
+	}
+}
+
+// Run refreshes the movies updated in the broadcaster and the ones queued by Changed, one at a time,
+// until the context is cancelled. Created movies are refreshed from their events.
+func (r *Recommender) Run(ctx context.Context, broadcaster *changes.Broadcaster) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case next := <-r.queue:
+				if err := r.Refresh(next.tenant, next.movieId); err != nil && !errors.Is(err, repository.ErrMovieNotFound) {
+					log.Printf("Error refreshing the similarities of movie %d of tenant %s: %v\n", next.movieId, next.tenant, err)
+				}
+			}
+		}
+	}()
+
+	for {
+		ch, unsubscribe := broadcaster.Subscribe("")
+
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			case change, ok := <-ch:
+				if !ok {
+					log.Println("Similarities fell behind, some updated movies were not refreshed")
+					open = false
+					continue
+				}
+				if change.Type == changes.Updated {
+					r.Changed(change.Tenant, change.Movie.ID)
+				}
+			}
+		}
+	}
+}
+
+func (r *Recommender) Similar(tenant string, movieId int64, limit int) ([]models.SimilarMovie, error) {
+	return r.Repository.GetSimilar(tenant, movieId, limit)
+}
+
+// Recommend returns movies similar to the ones the user liked or collected, leaving out the ones
+// they already reviewed or collected. Users with nothing to go by get the top rated movies.
+func (r *Recommender) Recommend(tenant string, userId string, limit int) ([]models.SimilarMovie, error) {
+	liked, seen, err := r.Repository.GetUserMovies(tenant, userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(liked) > maxSeeds {
+		liked = liked[:maxSeeds]
+	}
+
+	recommended, err := r.Repository.GetRecommendations(tenant, liked, seen, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(recommended) >= limit {
+		return recommended, nil
+	}
+
+	// fill up with top rated movies, so new users and niche tastes still get something
+	exclude := append([]int64{}, seen...)
+	for _, m := range recommended {
+		exclude = append(exclude, m.Movie.ID)
+	}
+	topRated, err := r.Repository.GetTopRated(tenant, exclude, limit-len(recommended))
+	if err != nil {
+		return nil, err
+	}
+	return append(recommended, topRated...), nil
+}
@@ -0,0 +1,89 @@
+package recommendations
+
+import (
+	"math"
+	"sort"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// weights of each signal in the similarity, they add up to 1
+const (
+	directorWeight    = 0.4
+	collectionsWeight = 0.35
+	reviewsWeight     = 0.25
+)
+
+// LikedScore is the lowest review score that counts as liking a movie
+const LikedScore = 7
+
+// Signals is what a movie has in common with each of its candidates.
+// Collections and Fans count the collections the movie is in and the users who liked it.
+type Signals struct {
+	MovieID     int64
+	Collections int
+	Fans        int
+	Candidates  map[int64]*Candidate
+}
+
+type Candidate struct {
+	SameDirector      bool
+	SharedCollections int
+	Collections       int
+	SharedFans        int
+	Fans              int
+}
+
+// Similarity is how similar a movie is to another one, Score is between 0 and 1.
+type Similarity struct {
+	MovieID int64
+	Score   float64
+	Reasons []string
+}
+
+// Score ranks the candidates of the movie by similarity, returning at most limit of them.
+// Co-occurrences are compared with the cosine similarity, so movies that are in every collection
+// don't end up similar to everything.
+func Score(signals *Signals, limit int) []Similarity {
+	var similar []Similarity
+	for id, candidate := range signals.Candidates {
+		similarity := Similarity{MovieID: id}
+
+		if candidate.SameDirector {
+			similarity.Score += directorWeight
+			similarity.Reasons = append(similarity.Reasons, models.SimilarDirector)
+		}
+		if c := cosine(candidate.SharedCollections, signals.Collections, candidate.Collections); c > 0 {
+			similarity.Score += collectionsWeight * c
+			similarity.Reasons = append(similarity.Reasons, models.SimilarCollections)
+		}
+		if c := cosine(candidate.SharedFans, signals.Fans, candidate.Fans); c > 0 {
+			similarity.Score += reviewsWeight * c
+			similarity.Reasons = append(similarity.Reasons, models.SimilarReviews)
+		}
+
+		if similarity.Score > 0 {
+			similarity.Score = math.Round(similarity.Score*10000) / 10000
+			similar = append(similar, similarity)
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Score != similar[j].Score {
+			return similar[i].Score > similar[j].Score
+		}
+		return similar[i].MovieID < similar[j].MovieID
+	})
+
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar
+}
+
+func cosine(shared int, a int, b int) float64 {
+	if shared == 0 || a == 0 || b == 0 {
+		return 0
+	}
+	return math.Min(1, float64(shared)/math.Sqrt(float64(a)*float64(b)))
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect is what changes in the statements of Repository from one database to another.
+// The statements are written for MySQL and rewritten by the dialect before they run.
+type Dialect interface {
+	// Rebind rewrites the ? placeholders of a statement to the ones of the database
+	Rebind(query string) string
+	// Insert runs an insert of one row and returns its id
+	Insert(db execer, query string, args ...interface{}) (int64, error)
+	IsDuplicate(err error) bool
+	IsNoReferencedRow(err error) bool
+}
+
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	// SQLite expects the database to be opened with foreign keys on, and its transactions to take
+	// the write lock when they begin, as sqlite.GetSQLiteDB does.
+	SQLite Dialect = sqliteDialect{}
+)
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dialectDB runs the statements of the repository on a database or a transaction, in its dialect
+type dialectDB struct {
+	db      execer
+	dialect Dialect
+}
+
+func (d dialectDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.db.Exec(d.dialect.Rebind(query), args...)
+}
+
+func (d dialectDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.Query(d.dialect.Rebind(query), args...)
+}
+
+func (d dialectDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRow(d.dialect.Rebind(query), args...)
+}
+
+func (d dialectDB) insert(query string, args ...interface{}) (int64, error) {
+	return d.dialect.Insert(d, query, args...)
+}
+
+// savepoint undoes what fn did when it fails, without aborting the transaction db runs in,
+// as postgres refuses any other statement in a transaction once one of them failed
+func (d dialectDB) savepoint(fn func() error) error {
+	if _, ok := d.db.(*sql.Tx); !ok {
+		return fn()
+	}
+
+	if _, err := d.db.Exec("savepoint batch_insert"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := d.db.Exec("rollback to savepoint batch_insert"); rollbackErr != nil {
+			return fmt.Errorf("%v, rollback to savepoint %v", err, rollbackErr)
+		}
+		return err
+	}
+	_, err := d.db.Exec("release savepoint batch_insert")
+	return err
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) Insert(db execer, query string, args ...interface{}) (int64, error) {
+	return lastInsertId(db.Exec(query, args...))
+}
+
+func (mysqlDialect) IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+func (mysqlDialect) IsNoReferencedRow(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlNoReferencedRow
+}
+
+const (
+	postgresUniqueViolation     = "23505"
+	postgresForeignKeyViolation = "23503"
+)
+
+type postgresDialect struct{}
+
+// Rebind numbers the placeholders, none of the statements has a ? in a literal
+func (postgresDialect) Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Insert returns the id of the row, postgres has no last insert id
+func (postgresDialect) Insert(db execer, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := db.QueryRow(query+" returning id", args...).Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) IsDuplicate(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == postgresUniqueViolation
+}
+
+func (postgresDialect) IsNoReferencedRow(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == postgresForeignKeyViolation
+}
+
+type sqliteDialect struct{}
+
+// Rebind drops the row locks, the transactions of sqlite lock the whole database instead
+func (sqliteDialect) Rebind(query string) string {
+	return strings.TrimSuffix(query, " for update")
+}
+
+func (sqliteDialect) Insert(db execer, query string, args ...interface{}) (int64, error) {
+	return lastInsertId(db.Exec(query, args...))
+}
+
+func (sqliteDialect) IsDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) IsNoReferencedRow(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+func lastInsertId(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("last insert id %v", err)
+	}
+	return id, nil
+}
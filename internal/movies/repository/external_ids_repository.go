@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// DuplicateExternalIdError is returned when a movie would take the external id of another one
+type DuplicateExternalIdError struct {
+	Source     string
+	ExternalID string
+	ExistingID int64
+}
+
+func (e *DuplicateExternalIdError) Error() string {
+	return fmt.Sprintf("a movie with %s id %s already exists with id %d", e.Source, e.ExternalID, e.ExistingID)
+}
+
+func (r *Repository) GetMovieByIsbn(isbn string) (*models.Movie, error) {
+	var movie models.Movie
+
+	row := r.db().QueryRow("select id, isbn, title, director from movies where tenant_id = ? and isbn = ?", r.Tenant, isbn)
+	if err := row.Scan(&movie.ID, &movie.Isbn, &movie.Title, &movie.Director); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getMovieByIsbn %s: %w", isbn, ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("getMovieByIsbn %s: %v", isbn, err)
+	}
+
+	if err := r.loadExternalIds(&movie); err != nil {
+		return nil, err
+	}
+	if err := r.loadTranslations(&movie); err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+func (r *Repository) GetMovieByExternalId(source string, externalId string) (*models.Movie, error) {
+	var movie models.Movie
+
+	row := r.db().QueryRow("select m.id, m.isbn, m.title, m.director from movies m join external_ids e on e.tenant_id = m.tenant_id and e.movie_id = m.id "+
+		"where m.tenant_id = ? and e.source = ? and e.external_id = ?", r.Tenant, source, externalId)
+	if err := row.Scan(&movie.ID, &movie.Isbn, &movie.Title, &movie.Director); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getMovieByExternalId %s %s: %w", source, externalId, ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("getMovieByExternalId %s %s: %v", source, externalId, err)
+	}
+
+	if err := r.loadExternalIds(&movie); err != nil {
+		return nil, err
+	}
+	if err := r.loadTranslations(&movie); err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+func (r *Repository) loadExternalIds(movie *models.Movie) error {
+	ids, err := r.getExternalIds("select movie_id, source, external_id from external_ids where tenant_id = ? and movie_id = ?", r.Tenant, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	movie.ExternalIDs = ids[movie.ID]
+	return nil
+}
+
+// getExternalIds returns the external ids found by the query, keyed by movie id
+func (r *Repository) getExternalIds(query string, args ...interface{}) (map[int64]map[string]string, error) {
+	rows, err := r.db().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getExternalIds %v", err)
+	}
+	defer rows.Close()
+
+	ids := map[int64]map[string]string{}
+	for rows.Next() {
+		var movieId int64
+		var source, externalId string
+		if err := rows.Scan(&movieId, &source, &externalId); err != nil {
+			return nil, fmt.Errorf("getExternalIds %v", err)
+		}
+
+		if ids[movieId] == nil {
+			ids[movieId] = map[string]string{}
+		}
+		ids[movieId][source] = externalId
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getExternalIds %v", err)
+	}
+
+	return ids, nil
+}
+
+func (r *Repository) saveExternalIds(db dialectDB, movieId int64, ids map[string]string) error {
+	sources := make([]string, 0, len(ids))
+	for source := range ids {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		_, err := db.Exec("insert into external_ids (tenant_id, movie_id, source, external_id) values (?, ?, ?, ?)", r.Tenant, movieId, source, ids[source])
+		if err == nil {
+			continue
+		}
+
+		if !db.dialect.IsDuplicate(err) {
+			return fmt.Errorf("add external ids: %v", err)
+		}
+
+		var existingId int64
+		if err := r.db().QueryRow("select movie_id from external_ids where tenant_id = ? and source = ? and external_id = ?", r.Tenant, source, ids[source]).Scan(&existingId); err != nil {
+			return fmt.Errorf("find movie with %s id %s: %v", source, ids[source], err)
+		}
+		return &DuplicateExternalIdError{Source: source, ExternalID: ids[source], ExistingID: existingId}
+	}
+
+	return nil
+}
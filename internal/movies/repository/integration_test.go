@@ -0,0 +1,373 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// The integration tests put the SQL of repository.Repository under load: every method on movies that don't exist,
+// conflicting writes running at the same time and tenants with thousands of movies. They run offline on sqlite,
+// and on postgres and mysql when their databases are given:
+//
+//	go test -tags integration ./internal/movies/repository/
+
+const (
+	concurrentWriters = 16
+	largeCatalogue    = 2500
+)
+
+var integrationTenants atomic.Int64
+
+func TestIntegrationSQLite(t *testing.T) {
+	runIntegration(t, sqliteRepositories(t))
+}
+
+func TestIntegrationPostgres(t *testing.T) {
+	runIntegration(t, postgresRepositories(t))
+}
+
+func TestIntegrationMySQL(t *testing.T) {
+	runIntegration(t, mysqlRepositories(t))
+}
+
+func runIntegration(t *testing.T, repositoryOf repositories) {
+	run := time.Now().UnixNano()
+	newRepository := func() *repository.Repository {
+		return repositoryOf(fmt.Sprintf("integration-%d-%d", run, integrationTenants.Add(1)))
+	}
+
+	t.Run("EveryMethodOfAMissingMovie", func(t *testing.T) {
+		testMissingMovie(t, newRepository())
+	})
+	t.Run("DuplicateOnUpdate", func(t *testing.T) {
+		testDuplicateOnUpdate(t, newRepository())
+	})
+	t.Run("ConcurrentUpdates", func(t *testing.T) {
+		testConcurrentUpdates(t, newRepository())
+	})
+	t.Run("ConcurrentCreates", func(t *testing.T) {
+		testConcurrentCreates(t, newRepository())
+	})
+	t.Run("ConcurrentUpserts", func(t *testing.T) {
+		testConcurrentUpserts(t, newRepository())
+	})
+	t.Run("ConcurrentTranslations", func(t *testing.T) {
+		testConcurrentTranslations(t, newRepository())
+	})
+	t.Run("LargeCatalogue", func(t *testing.T) {
+		testLargeCatalogue(t, newRepository())
+	})
+}
+
+func testMissingMovie(t *testing.T, repo *repository.Repository) {
+	const missing = 999999999
+	movie := &models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "GetMovieById", call: func() error {
+			_, err := repo.GetMovieById(missing)
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "GetMovieByIsbn", call: func() error {
+			_, err := repo.GetMovieByIsbn(movie.Isbn)
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "GetMovieByExternalId", call: func() error {
+			_, err := repo.GetMovieByExternalId(models.SourceIMDb, "tt0078748")
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "UpdateMovie", call: func() error {
+			_, err := repo.UpdateMovie(missing, movie)
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "DeleteMovie", call: func() error {
+			return repo.DeleteMovie(missing)
+		}},
+		{name: "GetTranslations", call: func() error {
+			_, err := repo.GetTranslations(missing)
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "SaveTranslation", call: func() error {
+			_, err := repo.SaveTranslation(missing, &models.Translation{Language: "fr", Title: "Alien, le huitième passager"})
+			return err
+		}, want: repository.ErrMovieNotFound},
+		{name: "DeleteTranslation", call: func() error {
+			return repo.DeleteTranslation(missing, "fr")
+		}, want: repository.ErrTranslationNotFound},
+		{name: "LoadTranslations", call: func() error {
+			movies := []models.Movie{{ID: missing}}
+			if err := repo.LoadTranslations(movies); err != nil {
+				return err
+			}
+			if movies[0].Translations != nil {
+				return fmt.Errorf("translations of a missing movie: %v", movies[0].Translations)
+			}
+			return nil
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Empty(t, movies)
+
+	movies, err = repo.GetMoviesByIsbn([]string{movie.Isbn})
+	assert.NoError(t, err)
+	assert.Empty(t, movies)
+
+	calls := 0
+	assert.NoError(t, repo.StreamMovies(func(models.Movie) error {
+		calls++
+		return nil
+	}))
+	assert.Zero(t, calls)
+
+	results, err := repo.BatchMovies([]models.BatchOperation{
+		{Op: models.BatchUpdate, ID: missing, Movie: movie},
+		{Op: models.BatchDelete, ID: missing},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.BatchNotFound, models.BatchNotFound}, batchStatuses(results))
+}
+
+func testDuplicateOnUpdate(t *testing.T, repo *repository.Repository) {
+	jaws, err := repo.CreateMovie(&models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"}})
+	require.NoError(t, err)
+	alien, err := repo.CreateMovie(&models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"})
+	require.NoError(t, err)
+
+	_, err = repo.UpdateMovie(alien.ID, &models.Movie{Isbn: "9788401490040", Title: "Alien", Director: "Ridley Scott"})
+	var duplicate *repository.DuplicateIsbnError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, jaws.ID, duplicate.ExistingID)
+
+	_, err = repo.UpdateMovie(alien.ID, &models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"}})
+	var duplicateId *repository.DuplicateExternalIdError
+	require.ErrorAs(t, err, &duplicateId)
+	assert.Equal(t, jaws.ID, duplicateId.ExistingID)
+
+	// the failed updates are rolled back
+	got, err := repo.GetMovieById(alien.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Movie{ID: alien.ID, Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"}, got)
+}
+
+// testConcurrentUpdates checks that an update replaces the movie and its external ids together,
+// whatever the updates running at the same time
+func testConcurrentUpdates(t *testing.T, repo *repository.Repository) {
+	movie, err := repo.CreateMovie(&models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"})
+	require.NoError(t, err)
+
+	errs := concurrently(func(i int) error {
+		_, err := repo.UpdateMovie(movie.ID, &models.Movie{
+			Isbn:        "9788401490040",
+			Title:       fmt.Sprintf("Jaws %d", i),
+			Director:    "Steven Spielberg",
+			ExternalIDs: map[string]string{models.SourceTMDB: fmt.Sprint(i)},
+		})
+		return err
+	})
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	got, err := repo.GetMovieById(movie.ID)
+	require.NoError(t, err)
+	require.Len(t, got.ExternalIDs, 1)
+	assert.Equal(t, "Jaws "+got.ExternalIDs[models.SourceTMDB], got.Title)
+}
+
+// testConcurrentCreates checks that only one of the movies with the same isbn is created,
+// the others being told which one it is
+func testConcurrentCreates(t *testing.T, repo *repository.Repository) {
+	ids := make([]int64, concurrentWriters)
+	errs := concurrently(func(i int) error {
+		created, err := repo.CreateMovie(&models.Movie{Isbn: "9788401490040", Title: fmt.Sprintf("Jaws %d", i)})
+		if err == nil {
+			ids[i] = created.ID
+		}
+		return err
+	})
+
+	var winner int64
+	for i, err := range errs {
+		if err == nil {
+			assert.Zero(t, winner, "more than one movie was created")
+			winner = ids[i]
+		}
+	}
+	require.NotZero(t, winner)
+
+	for _, err := range errs {
+		var duplicate *repository.DuplicateIsbnError
+		if err != nil && assert.ErrorAs(t, err, &duplicate) {
+			assert.Equal(t, winner, duplicate.ExistingID)
+		}
+	}
+
+	movies, err := repo.GetMovies()
+	require.NoError(t, err)
+	assert.Len(t, movies, 1)
+}
+
+func testConcurrentUpserts(t *testing.T, repo *repository.Repository) {
+	var created atomic.Int64
+	errs := concurrently(func(i int) error {
+		_, wasCreated, err := repo.UpsertMovieByIsbn(&models.Movie{Isbn: "9788401490040", Title: fmt.Sprintf("Jaws %d", i)})
+		if wasCreated {
+			created.Add(1)
+		}
+		return err
+	})
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), created.Load())
+
+	movies, err := repo.GetMovies()
+	require.NoError(t, err)
+	assert.Len(t, movies, 1)
+}
+
+func testConcurrentTranslations(t *testing.T, repo *repository.Repository) {
+	movie, err := repo.CreateMovie(&models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"})
+	require.NoError(t, err)
+
+	var created atomic.Int64
+	errs := concurrently(func(i int) error {
+		wasCreated, err := repo.SaveTranslation(movie.ID, &models.Translation{Language: "pt-BR", Title: fmt.Sprintf("Tubarão %d", i)})
+		if wasCreated {
+			created.Add(1)
+		}
+		return err
+	})
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), created.Load())
+
+	translations, err := repo.GetTranslations(movie.ID)
+	require.NoError(t, err)
+	assert.Len(t, translations, 1)
+}
+
+// testLargeCatalogue reads a tenant with more movies than a batch chunk, or than a page of rows of the drivers.
+// The batch only creates the movies, every hundredth one is translated afterwards
+func testLargeCatalogue(t *testing.T, repo *repository.Repository) {
+	ops := make([]models.BatchOperation, largeCatalogue)
+	isbns := make([]string, largeCatalogue)
+	for i := range ops {
+		isbns[i] = fmt.Sprintf("978%010d", i)
+		ops[i] = models.BatchOperation{Op: models.BatchCreate, Movie: &models.Movie{
+			Isbn:     isbns[i],
+			Title:    fmt.Sprintf("Movie %d", i),
+			Director: "Director",
+		}}
+	}
+
+	results, err := repo.BatchMovies(ops, true)
+	require.NoError(t, err)
+	for _, result := range results {
+		require.Equal(t, models.BatchCreated, result.Status, result.Error)
+	}
+
+	for i := 0; i < largeCatalogue; i += 100 {
+		_, err := repo.SaveTranslation(results[i].Movie.ID, &models.Translation{Language: "pt-BR", Title: fmt.Sprintf("Filme %d", i)})
+		require.NoError(t, err)
+	}
+	translated := func(t *testing.T, i int, movie models.Movie) {
+		if i%100 != 0 {
+			assert.Nil(t, movie.Translations)
+			return
+		}
+		assert.Equal(t, []models.Translation{{Language: "pt-BR", Title: fmt.Sprintf("Filme %d", i)}}, movie.Translations)
+	}
+
+	movies, err := repo.GetMovies()
+	require.NoError(t, err)
+	require.Len(t, movies, largeCatalogue)
+	for i, movie := range movies {
+		assert.Equal(t, results[i].Movie.ID, movie.ID)
+		assert.Equal(t, fmt.Sprintf("Movie %d", i), movie.Title)
+		translated(t, i, movie)
+	}
+
+	byIsbn, err := repo.GetMoviesByIsbn(isbns)
+	require.NoError(t, err)
+	require.Len(t, byIsbn, largeCatalogue)
+
+	require.NoError(t, repo.LoadTranslations(byIsbn))
+	for i, movie := range byIsbn {
+		assert.Equal(t, isbns[i], movie.Isbn)
+		translated(t, i, movie)
+	}
+
+	streamed := 0
+	var last int64
+	err = repo.StreamMovies(func(movie models.Movie) error {
+		if movie.ID <= last {
+			return errors.New("movies are not streamed by id")
+		}
+		last = movie.ID
+		streamed++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, largeCatalogue, streamed)
+}
+
+// concurrently runs concurrentWriters calls of fn at the same time, returning their errors
+func concurrently(fn func(i int) error) []error {
+	errs := make([]error, concurrentWriters)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+func batchStatuses(results []models.BatchResult) []string {
+	statuses := make([]string, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
@@ -0,0 +1,455 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// MemoryDB keeps the movies of every tenant in memory, so the service runs without a database.
+// It is safe for concurrent use and its zero value is empty, everything in it is lost when the service stops.
+type MemoryDB struct {
+	mu     sync.RWMutex
+	lastId int64
+	// movies are replaced rather than changed in place, so the map can be copied to be rolled back
+	movies map[int64]memoryMovie
+}
+
+type memoryMovie struct {
+	tenant string
+	movie  models.Movie
+}
+
+// MemoryRepository keeps the movies of one tenant in a MemoryDB shared by all of them,
+// it finds and rejects the same movies as Repository does.
+type MemoryRepository struct {
+	DB     *MemoryDB
+	Tenant string
+}
+
+func (r *MemoryRepository) GetMovies() ([]models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var movies []models.Movie
+	for _, m := range r.list() {
+		movies = append(movies, copyMovie(m))
+	}
+	return movies, nil
+}
+
+func (r *MemoryRepository) GetMoviesPage(afterId int64, limit int) ([]models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var movies []models.Movie
+	for _, m := range r.list() {
+		if len(movies) == limit {
+			break
+		}
+		if m.ID > afterId {
+			movies = append(movies, baseMovie(m))
+		}
+	}
+	return movies, nil
+}
+
+func (r *MemoryRepository) GetMovieById(id int64) (*models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	m, ok := r.get(id)
+	if !ok {
+		return nil, fmt.Errorf("getMovieById %d: %w", id, ErrMovieNotFound)
+	}
+	movie := copyMovie(m)
+	return &movie, nil
+}
+
+func (r *MemoryRepository) GetMovieByIsbn(isbn string) (*models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	m, ok := r.find(func(m models.Movie) bool { return m.Isbn == isbn })
+	if !ok {
+		return nil, fmt.Errorf("getMovieByIsbn %s: %w", isbn, ErrMovieNotFound)
+	}
+	movie := copyMovie(m)
+	return &movie, nil
+}
+
+func (r *MemoryRepository) GetMovieByExternalId(source string, externalId string) (*models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	m, ok := r.find(func(m models.Movie) bool { return hasExternalId(m, source, externalId) })
+	if !ok {
+		return nil, fmt.Errorf("getMovieByExternalId %s %s: %w", source, externalId, ErrMovieNotFound)
+	}
+	movie := copyMovie(m)
+	return &movie, nil
+}
+
+// GetMoviesByIsbn returns the movies without their external ids and translations, like Repository
+func (r *MemoryRepository) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, isbn := range isbns {
+		wanted[isbn] = true
+	}
+
+	var movies []models.Movie
+	for _, m := range r.list() {
+		if wanted[m.Isbn] {
+			movies = append(movies, baseMovie(m))
+		}
+	}
+	return movies, nil
+}
+
+// StreamMovies calls fn without holding the lock, so fn can use the repository
+func (r *MemoryRepository) StreamMovies(fn func(movie models.Movie) error) error {
+	r.DB.mu.RLock()
+	movies := r.list()
+	r.DB.mu.RUnlock()
+
+	for _, m := range movies {
+		if err := fn(baseMovie(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateMovie(movie *models.Movie) (*models.Movie, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	return r.create(movie)
+}
+
+// UpdateMovie replaces the external ids and translations of the movie only when they are given
+func (r *MemoryRepository) UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	return r.update(id, movie)
+}
+
+func (r *MemoryRepository) DeleteMovie(id int64) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if _, ok := r.get(id); ok {
+		delete(r.DB.movies, id)
+	}
+	return nil
+}
+
+func (r *MemoryRepository) UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if existing, ok := r.find(func(m models.Movie) bool { return m.Isbn == movie.Isbn }); ok {
+		updated, err := r.update(existing.ID, movie)
+		return updated, false, err
+	}
+
+	created, err := r.create(movie)
+	return created, err == nil, err
+}
+
+// BatchMovies applies the operations in order. When atomic, the movies are put back as they were
+// on the first failed operation, returning ErrBatchAborted along with the results.
+func (r *MemoryRepository) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = models.BatchResult{Index: i, Op: op.Op}
+	}
+
+	saved := make(map[int64]memoryMovie, len(r.DB.movies))
+	for id, m := range r.DB.movies {
+		saved[id] = m
+	}
+
+	for i, op := range ops {
+		r.executeOperation(op, &results[i])
+		if !atomic || results[i].Succeeded() {
+			continue
+		}
+
+		r.DB.movies = saved
+		for i := range results {
+			if results[i].Status == "" || results[i].Succeeded() {
+				results[i].Status = models.BatchAborted
+				results[i].Movie = nil
+			}
+		}
+		return results, ErrBatchAborted
+	}
+
+	return results, nil
+}
+
+func (r *MemoryRepository) executeOperation(op models.BatchOperation, result *models.BatchResult) {
+	switch {
+	case op.Op == models.BatchCreate && op.Movie == nil:
+		result.Status, result.Error = models.BatchInvalid, "movie is required"
+	case op.Op == models.BatchUpdate && (op.ID == 0 || op.Movie == nil):
+		result.Status, result.Error = models.BatchInvalid, "id and movie are required"
+	case op.Op == models.BatchDelete && op.ID == 0:
+		result.Status, result.Error = models.BatchInvalid, "id is required"
+	case op.Op == models.BatchCreate:
+		// batches only set the isbn, title and director of the movies
+		if _, ok := r.find(func(m models.Movie) bool { return m.Isbn == op.Movie.Isbn }); ok {
+			result.Status, result.Error = models.BatchConflict, "a movie with this isbn already exists"
+			return
+		}
+		movie := *op.Movie
+		movie.ID = r.insert(models.Movie{Isbn: movie.Isbn, Title: movie.Title, Director: movie.Director})
+		result.Status, result.Movie = models.BatchCreated, &movie
+	case op.Op == models.BatchUpdate:
+		existing, ok := r.get(op.ID)
+		if !ok {
+			result.Status, result.Error = models.BatchNotFound, ErrMovieNotFound.Error()
+			return
+		}
+		if other, ok := r.find(func(m models.Movie) bool { return m.Isbn == op.Movie.Isbn }); ok && other.ID != op.ID {
+			result.Status, result.Error = models.BatchConflict, "a movie with this isbn already exists"
+			return
+		}
+		existing.Isbn, existing.Title, existing.Director = op.Movie.Isbn, op.Movie.Title, op.Movie.Director
+		r.DB.movies[op.ID] = memoryMovie{tenant: r.Tenant, movie: existing}
+
+		movie := *op.Movie
+		movie.ID = op.ID
+		result.Status, result.Movie = models.BatchUpdated, &movie
+	case op.Op == models.BatchDelete:
+		if _, ok := r.get(op.ID); !ok {
+			result.Status, result.Error = models.BatchNotFound, ErrMovieNotFound.Error()
+			return
+		}
+		delete(r.DB.movies, op.ID)
+		result.Status, result.Movie = models.BatchDeleted, &models.Movie{ID: op.ID}
+	default:
+		result.Status, result.Error = models.BatchInvalid, fmt.Sprintf("unknown operation %s", op.Op)
+	}
+}
+
+func (r *MemoryRepository) GetTranslations(movieId int64) ([]models.Translation, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	m, ok := r.get(movieId)
+	if !ok {
+		return nil, fmt.Errorf("getTranslations %d: %w", movieId, ErrMovieNotFound)
+	}
+	return copyMovie(m).Translations, nil
+}
+
+func (r *MemoryRepository) SaveTranslation(movieId int64, translation *models.Translation) (bool, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	m, ok := r.get(movieId)
+	if !ok {
+		return false, fmt.Errorf("save translation %d %s: %w", movieId, translation.Language, ErrMovieNotFound)
+	}
+
+	m = copyMovie(m)
+	created := true
+	for i, t := range m.Translations {
+		if t.Language == translation.Language {
+			m.Translations = append(m.Translations[:i], m.Translations[i+1:]...)
+			created = false
+			break
+		}
+	}
+	m.Translations = sortTranslations(append(m.Translations, *translation))
+
+	r.DB.movies[movieId] = memoryMovie{tenant: r.Tenant, movie: m}
+	return created, nil
+}
+
+func (r *MemoryRepository) DeleteTranslation(movieId int64, language string) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if m, ok := r.get(movieId); ok {
+		m = copyMovie(m)
+		for i, t := range m.Translations {
+			if t.Language == language {
+				m.Translations = append(m.Translations[:i], m.Translations[i+1:]...)
+				if len(m.Translations) == 0 {
+					m.Translations = nil
+				}
+				r.DB.movies[movieId] = memoryMovie{tenant: r.Tenant, movie: m}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("delete translation %d %s: %w", movieId, language, ErrTranslationNotFound)
+}
+
+func (r *MemoryRepository) LoadTranslations(movies []models.Movie) error {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	for i := range movies {
+		movies[i].Translations = nil
+		if m, ok := r.get(movies[i].ID); ok {
+			movies[i].Translations = copyMovie(m).Translations
+		}
+	}
+	return nil
+}
+
+// create adds the movie, the lock is expected to be held
+func (r *MemoryRepository) create(movie *models.Movie) (*models.Movie, error) {
+	if existing, ok := r.find(func(m models.Movie) bool { return m.Isbn == movie.Isbn }); ok {
+		return nil, &DuplicateIsbnError{Isbn: movie.Isbn, ExistingID: existing.ID}
+	}
+	if err := r.checkExternalIds(0, movie.ExternalIDs); err != nil {
+		return nil, err
+	}
+
+	movie.ID = r.insert(storedMovie(*movie))
+	return movie, nil
+}
+
+// update replaces the movie, the lock is expected to be held
+func (r *MemoryRepository) update(id int64, movie *models.Movie) (*models.Movie, error) {
+	existing, ok := r.get(id)
+	if !ok {
+		return nil, fmt.Errorf("update movie %d: %w", id, ErrMovieNotFound)
+	}
+	if other, ok := r.find(func(m models.Movie) bool { return m.Isbn == movie.Isbn }); ok && other.ID != id {
+		return nil, &DuplicateIsbnError{Isbn: movie.Isbn, ExistingID: other.ID}
+	}
+
+	if movie.ExternalIDs != nil {
+		if err := r.checkExternalIds(id, movie.ExternalIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	stored := storedMovie(*movie)
+	stored.ID = id
+	if movie.ExternalIDs == nil {
+		stored.ExternalIDs = existing.ExternalIDs
+	}
+	if movie.Translations == nil {
+		stored.Translations = existing.Translations
+	}
+	r.DB.movies[id] = memoryMovie{tenant: r.Tenant, movie: stored}
+
+	movie.ID = id
+	return movie, nil
+}
+
+// checkExternalIds returns a DuplicateExternalIdError when another movie than id has one of the ids
+func (r *MemoryRepository) checkExternalIds(id int64, ids map[string]string) error {
+	sources := make([]string, 0, len(ids))
+	for source := range ids {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		existing, ok := r.find(func(m models.Movie) bool { return m.ID != id && hasExternalId(m, source, ids[source]) })
+		if ok {
+			return &DuplicateExternalIdError{Source: source, ExternalID: ids[source], ExistingID: existing.ID}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) insert(movie models.Movie) int64 {
+	if r.DB.movies == nil {
+		r.DB.movies = map[int64]memoryMovie{}
+	}
+
+	r.DB.lastId++
+	movie.ID = r.DB.lastId
+	r.DB.movies[movie.ID] = memoryMovie{tenant: r.Tenant, movie: movie}
+	return movie.ID
+}
+
+func (r *MemoryRepository) get(id int64) (models.Movie, bool) {
+	m, ok := r.DB.movies[id]
+	if !ok || m.tenant != r.Tenant {
+		return models.Movie{}, false
+	}
+	return m.movie, true
+}
+
+func (r *MemoryRepository) find(match func(m models.Movie) bool) (models.Movie, bool) {
+	for _, m := range r.list() {
+		if match(m) {
+			return m, true
+		}
+	}
+	return models.Movie{}, false
+}
+
+// list returns the movies of the tenant ordered by id
+func (r *MemoryRepository) list() []models.Movie {
+	var movies []models.Movie
+	for _, m := range r.DB.movies {
+		if m.tenant == r.Tenant {
+			movies = append(movies, m.movie)
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].ID < movies[j].ID })
+	return movies
+}
+
+func hasExternalId(movie models.Movie, source string, externalId string) bool {
+	id, ok := movie.ExternalIDs[source]
+	return ok && id == externalId
+}
+
+// storedMovie keeps what Repository stores of a movie, its fields of the movies table,
+// its external ids and its translations by language
+func storedMovie(movie models.Movie) models.Movie {
+	stored := copyMovie(baseMovie(movie))
+	stored.ExternalIDs = copyMovie(movie).ExternalIDs
+	stored.Translations = sortTranslations(copyMovie(movie).Translations)
+	return stored
+}
+
+// copyMovie copies the external ids and translations, which would otherwise be shared with the caller
+func copyMovie(movie models.Movie) models.Movie {
+	if len(movie.ExternalIDs) == 0 {
+		movie.ExternalIDs = nil
+	} else {
+		ids := make(map[string]string, len(movie.ExternalIDs))
+		for source, id := range movie.ExternalIDs {
+			ids[source] = id
+		}
+		movie.ExternalIDs = ids
+	}
+	if len(movie.Translations) > 0 {
+		movie.Translations = append([]models.Translation(nil), movie.Translations...)
+	} else {
+		movie.Translations = nil
+	}
+	return movie
+}
+
+// baseMovie keeps the fields of the movies table
+func baseMovie(movie models.Movie) models.Movie {
+	return models.Movie{ID: movie.ID, Isbn: movie.Isbn, Title: movie.Title, Director: movie.Director}
+}
+
+func sortTranslations(translations []models.Translation) []models.Translation {
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Language < translations[j].Language })
+	return translations
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// batchInsertSize is how many rows go in a single multi-row insert
+const batchInsertSize = 500
+
+var ErrBatchAborted = errors.New("batch aborted")
+
+// BatchMovies applies the operations in order, inserting consecutive creates with multi-row inserts.
+// When atomic, everything runs in a transaction that is rolled back on the first failed operation,
+// returning ErrBatchAborted along with the results. Otherwise each operation succeeds or fails on its own.
+func (r *Repository) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = models.BatchResult{Index: i, Op: op.Op}
+	}
+
+	if !atomic {
+		executeBatch(r.db(), r.Tenant, ops, results, false)
+		return results, nil
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("batch movies: %v", err)
+	}
+
+	if ok := executeBatch(r.in(tx), r.Tenant, ops, results, true); !ok {
+		tx.Rollback()
+		for i := range results {
+			if results[i].Status == "" || results[i].Succeeded() {
+				results[i].Status = models.BatchAborted
+				results[i].Movie = nil
+			}
+		}
+		return results, ErrBatchAborted
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("batch movies commit: %v", err)
+	}
+	return results, nil
+}
+
+// executeBatch fills in the results and tells whether every operation succeeded,
+// when stopOnError it returns as soon as one fails.
+func executeBatch(db dialectDB, tenant string, ops []models.BatchOperation, results []models.BatchResult, stopOnError bool) bool {
+	ok := true
+	pending := -1
+
+	flush := func(end int) bool {
+		if pending < 0 {
+			return true
+		}
+		inserted := insertMovies(db, tenant, ops[pending:end], results[pending:end], stopOnError)
+		pending = -1
+		return inserted
+	}
+
+	for i, op := range ops {
+		if op.Op == models.BatchCreate && op.Movie != nil {
+			if pending < 0 {
+				pending = i
+			}
+			continue
+		}
+
+		if !flush(i) {
+			ok = false
+			if stopOnError {
+				return false
+			}
+		}
+
+		executeOperation(db, tenant, op, &results[i])
+		if !results[i].Succeeded() {
+			ok = false
+			if stopOnError {
+				return false
+			}
+		}
+	}
+
+	return flush(len(ops)) && ok
+}
+
+func executeOperation(db dialectDB, tenant string, op models.BatchOperation, result *models.BatchResult) {
+	switch {
+	case op.Op == models.BatchCreate:
+		result.Status, result.Error = models.BatchInvalid, "movie is required"
+	case op.Op == models.BatchUpdate && (op.ID == 0 || op.Movie == nil):
+		result.Status, result.Error = models.BatchInvalid, "id and movie are required"
+	case op.Op == models.BatchDelete && op.ID == 0:
+		result.Status, result.Error = models.BatchInvalid, "id is required"
+	case op.Op == models.BatchUpdate:
+		res, err := db.Exec("update movies set isbn = ?, title = ?, director = ? where id = ? and tenant_id = ?", op.Movie.Isbn, op.Movie.Title, op.Movie.Director, op.ID, tenant)
+		if setStatus(db, res, err, result, models.BatchUpdated) {
+			movie := *op.Movie
+			movie.ID = op.ID
+			result.Movie = &movie
+		}
+	case op.Op == models.BatchDelete:
+		res, err := db.Exec("delete from movies where id = ? and tenant_id = ?", op.ID, tenant)
+		if setStatus(db, res, err, result, models.BatchDeleted) {
+			result.Movie = &models.Movie{ID: op.ID}
+		}
+	default:
+		result.Status, result.Error = models.BatchInvalid, fmt.Sprintf("unknown operation %s", op.Op)
+	}
+}
+
+func setStatus(db dialectDB, res sql.Result, err error, result *models.BatchResult, success string) bool {
+	if db.dialect.IsDuplicate(err) {
+		result.Status, result.Error = models.BatchConflict, "a movie with this isbn already exists"
+		return false
+	}
+	if err != nil {
+		result.Status, result.Error = models.BatchFailed, err.Error()
+		return false
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		result.Status, result.Error = models.BatchFailed, err.Error()
+		return false
+	}
+	if affected == 0 {
+		result.Status, result.Error = models.BatchNotFound, ErrMovieNotFound.Error()
+		return false
+	}
+
+	result.Status = success
+	return true
+}
+
+// insertMovies inserts the movies in chunks, when a chunk fails its rows are inserted
+// one by one to find out which of them is the culprit.
+func insertMovies(db dialectDB, tenant string, ops []models.BatchOperation, results []models.BatchResult, stopOnError bool) bool {
+	ok := true
+
+	for start := 0; start < len(ops); start += batchInsertSize {
+		end := start + batchInsertSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		err := db.savepoint(func() error {
+			return insertChunk(db, tenant, ops[start:end], results[start:end])
+		})
+		if err == nil {
+			continue
+		}
+
+		for i := start; i < end; i++ {
+			err := db.savepoint(func() error {
+				return insertChunk(db, tenant, ops[i:i+1], results[i:i+1])
+			})
+			if err != nil {
+				results[i].Status, results[i].Error = models.BatchFailed, err.Error()
+				if db.dialect.IsDuplicate(err) {
+					results[i].Status, results[i].Error = models.BatchConflict, "a movie with this isbn already exists"
+				}
+				ok = false
+				if stopOnError {
+					return false
+				}
+			}
+		}
+	}
+
+	return ok
+}
+
+// insertChunk inserts the movies with a multi-row insert, then finds their ids by isbn:
+// the ids of the rows are not consecutive when other inserts run at the same time,
+// such as with the interleaved auto-increment locks of MySQL.
+func insertChunk(db dialectDB, tenant string, ops []models.BatchOperation, results []models.BatchResult) error {
+	placeholders := make([]string, len(ops))
+	args := make([]interface{}, 0, len(ops)*4)
+	isbns := []interface{}{tenant}
+	for i, op := range ops {
+		placeholders[i] = "(?, ?, ?, ?)"
+		args = append(args, tenant, op.Movie.Isbn, op.Movie.Title, op.Movie.Director)
+		isbns = append(isbns, op.Movie.Isbn)
+	}
+
+	if _, err := db.Exec("insert into movies (tenant_id, isbn, title, director) values "+strings.Join(placeholders, ", "), args...); err != nil {
+		return fmt.Errorf("add movies: %w", err)
+	}
+
+	rows, err := db.Query("select id, isbn from movies where tenant_id = ? and isbn in (?"+strings.Repeat(", ?", len(ops)-1)+")", isbns...)
+	if err != nil {
+		return fmt.Errorf("add movies ids: %v", err)
+	}
+	defer rows.Close()
+
+	ids := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var isbn string
+		if err := rows.Scan(&id, &isbn); err != nil {
+			return fmt.Errorf("add movies ids: %v", err)
+		}
+		ids[isbn] = id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("add movies ids: %v", err)
+	}
+
+	for i, op := range ops {
+		movie := *op.Movie
+		movie.ID = ids[op.Movie.Isbn]
+		results[i].Status = models.BatchCreated
+		results[i].Movie = &movie
+		results[i].Error = ""
+	}
+	return nil
+}
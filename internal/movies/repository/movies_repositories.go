@@ -2,27 +2,77 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/iamthiago/movies-crud/pkg/models"
 )
 
+var ErrMovieNotFound = errors.New("no such movie")
+
+// DuplicateIsbnError is returned when a movie would take the isbn of another one
+type DuplicateIsbnError struct {
+	Isbn       string
+	ExistingID int64
+}
+
+func (e *DuplicateIsbnError) Error() string {
+	return fmt.Sprintf("a movie with isbn %s already exists with id %d", e.Isbn, e.ExistingID)
+}
+
+const (
+	mysqlDuplicateEntry  = 1062
+	mysqlNoReferencedRow = 1452
+)
+
 type MoviesRepository interface {
 	GetMovies() ([]models.Movie, error)
+	// GetMoviesPage returns up to limit movies with an id greater than afterId, ordered by id,
+	// without their external ids and translations
+	GetMoviesPage(afterId int64, limit int) ([]models.Movie, error)
 	GetMovieById(id int64) (*models.Movie, error)
+	GetMovieByIsbn(isbn string) (*models.Movie, error)
+	GetMovieByExternalId(source string, externalId string) (*models.Movie, error)
 	CreateMovie(movie *models.Movie) (*models.Movie, error)
 	UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error)
 	DeleteMovie(id int64) error
+	// UpsertMovieByIsbn creates the movie, or replaces the one with the same isbn, telling which one happened
+	UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error)
+	BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	GetMoviesByIsbn(isbns []string) ([]models.Movie, error)
+	StreamMovies(fn func(movie models.Movie) error) error
+	GetTranslations(movieId int64) ([]models.Translation, error)
+	SaveTranslation(movieId int64, translation *models.Translation) (bool, error)
+	DeleteTranslation(movieId int64, language string) error
+	LoadTranslations(movies []models.Movie) error
 }
 
+// Repository keeps the movies of one tenant, every query is scoped to it
+// and the movies of other tenants are not found.
+// It runs on MySQL, or on another database given its Dialect.
 type Repository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Tenant  string
+	Dialect Dialect
+}
+
+func (r *Repository) db() dialectDB {
+	return r.in(r.DB)
+}
+
+// in runs the statements in a transaction
+func (r *Repository) in(db execer) dialectDB {
+	if r.Dialect == nil {
+		return dialectDB{db: db, dialect: MySQL}
+	}
+	return dialectDB{db: db, dialect: r.Dialect}
 }
 
 func (r *Repository) GetMovies() ([]models.Movie, error) {
 	var movies []models.Movie
 
-	rows, err := r.DB.Query("select id, isbn, title, director from movies")
+	rows, err := r.db().Query("select id, isbn, title, director from movies where tenant_id = ? order by id", r.Tenant)
 	if err != nil {
 		return nil, fmt.Errorf("getMovies %v", err)
 	}
@@ -41,51 +91,244 @@ func (r *Repository) GetMovies() ([]models.Movie, error) {
 		return nil, fmt.Errorf("getMovies %v", err)
 	}
 
+	ids, err := r.getExternalIds("select movie_id, source, external_id from external_ids where tenant_id = ?", r.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	translations, err := r.getTranslations("select movie_id, language, title, synopsis from movie_translations where tenant_id = ? order by language", r.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	for i := range movies {
+		movies[i].ExternalIDs = ids[movies[i].ID]
+		movies[i].Translations = translations[movies[i].ID]
+	}
+
 	return movies, nil
 }
 
+func (r *Repository) GetMoviesPage(afterId int64, limit int) ([]models.Movie, error) {
+	rows, err := r.db().Query("select id, isbn, title, director from movies where tenant_id = ? and id > ? order by id limit ?", r.Tenant, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getMoviesPage %v", err)
+	}
+	defer rows.Close()
+
+	var movies []models.Movie
+	for rows.Next() {
+		var m models.Movie
+		if err := rows.Scan(&m.ID, &m.Isbn, &m.Title, &m.Director); err != nil {
+			return nil, fmt.Errorf("getMoviesPage %v", err)
+		}
+		movies = append(movies, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getMoviesPage %v", err)
+	}
+
+	return movies, nil
+}
+
+func (r *Repository) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	if len(isbns) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(isbns))
+	args := []interface{}{r.Tenant}
+	for i, isbn := range isbns {
+		placeholders[i] = "?"
+		args = append(args, isbn)
+	}
+
+	rows, err := r.db().Query("select id, isbn, title, director from movies where tenant_id = ? and isbn in ("+strings.Join(placeholders, ", ")+") order by id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("getMoviesByIsbn %v", err)
+	}
+	defer rows.Close()
+
+	var movies []models.Movie
+	for rows.Next() {
+		var m models.Movie
+		if err := rows.Scan(&m.ID, &m.Isbn, &m.Title, &m.Director); err != nil {
+			return nil, fmt.Errorf("getMoviesByIsbn %v", err)
+		}
+		movies = append(movies, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getMoviesByIsbn %v", err)
+	}
+
+	return movies, nil
+}
+
+// StreamMovies calls fn for every movie ordered by id, without loading the whole table in memory.
+func (r *Repository) StreamMovies(fn func(movie models.Movie) error) error {
+	rows, err := r.db().Query("select id, isbn, title, director from movies where tenant_id = ? order by id", r.Tenant)
+	if err != nil {
+		return fmt.Errorf("streamMovies %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.Movie
+		if err := rows.Scan(&m.ID, &m.Isbn, &m.Title, &m.Director); err != nil {
+			return fmt.Errorf("streamMovies %v", err)
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("streamMovies %v", err)
+	}
+
+	return nil
+}
+
 func (r *Repository) GetMovieById(id int64) (*models.Movie, error) {
 	var movie models.Movie
 
-	row := r.DB.QueryRow("select id, isbn, title, director from movies where id = ?", id)
+	row := r.db().QueryRow("select id, isbn, title, director from movies where id = ? and tenant_id = ?", id, r.Tenant)
 	if err := row.Scan(&movie.ID, &movie.Isbn, &movie.Title, &movie.Director); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("getMovieById %d: no such movie", id)
+			return nil, fmt.Errorf("getMovieById %d: %w", id, ErrMovieNotFound)
 		}
 		return nil, fmt.Errorf("getMovieById %d: %v", id, err)
 	}
+
+	if err := r.loadExternalIds(&movie); err != nil {
+		return nil, err
+	}
+	if err := r.loadTranslations(&movie); err != nil {
+		return nil, err
+	}
 	return &movie, nil
 }
 
 func (r *Repository) CreateMovie(movie *models.Movie) (*models.Movie, error) {
-	movieResult, movErr := r.DB.Exec("insert into movies (isbn, title, director) values (?, ?, ?)", movie.Isbn, movie.Title, movie.Director)
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("add movies: %v", err)
+	}
+	defer tx.Rollback()
+	db := r.in(tx)
+
+	movieId, movErr := db.insert("insert into movies (tenant_id, isbn, title, director) values (?, ?, ?, ?)", r.Tenant, movie.Isbn, movie.Title, movie.Director)
 	if movErr != nil {
+		if db.dialect.IsDuplicate(movErr) {
+			tx.Rollback()
+			return nil, r.duplicateIsbn(movie.Isbn)
+		}
 		return nil, fmt.Errorf("add movies: %v", movErr)
 	}
-	movieId, movLAstInsertErr := movieResult.LastInsertId()
-	if movLAstInsertErr != nil {
-		return nil, fmt.Errorf("get movie last inserted id %v", movLAstInsertErr)
+
+	if err := r.saveExternalIds(db, movieId, movie.ExternalIDs); err != nil {
+		return nil, err
+	}
+	if err := r.saveTranslations(db, movieId, movie.Translations); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("add movies: %v", err)
 	}
 
 	movie.ID = movieId
 	return movie, nil
 }
 
+// UpdateMovie replaces the external ids and translations of the movie only when they are given
 func (r *Repository) UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error) {
-	_, movErr := r.DB.Exec("update movies set isbn = ?, title = ?, director = ? where id = ?", movie.Isbn, movie.Title, movie.Director, id)
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("update movies: %v", err)
+	}
+	defer tx.Rollback()
+	db := r.in(tx)
+
+	var existing int64
+	if err := db.QueryRow("select id from movies where id = ? and tenant_id = ? for update", id, r.Tenant).Scan(&existing); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("update movie %d: %w", id, ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("update movies: %v", err)
+	}
+
+	_, movErr := db.Exec("update movies set isbn = ?, title = ?, director = ? where id = ? and tenant_id = ?", movie.Isbn, movie.Title, movie.Director, id, r.Tenant)
 	if movErr != nil {
+		if db.dialect.IsDuplicate(movErr) {
+			tx.Rollback()
+			return nil, r.duplicateIsbn(movie.Isbn)
+		}
 		return nil, fmt.Errorf("update movies: %v", movErr)
 	}
 
+	if movie.ExternalIDs != nil {
+		if _, err := db.Exec("delete from external_ids where movie_id = ? and tenant_id = ?", id, r.Tenant); err != nil {
+			return nil, fmt.Errorf("update external ids: %v", err)
+		}
+		if err := r.saveExternalIds(db, id, movie.ExternalIDs); err != nil {
+			return nil, err
+		}
+	}
+	if movie.Translations != nil {
+		if _, err := db.Exec("delete from movie_translations where movie_id = ? and tenant_id = ?", id, r.Tenant); err != nil {
+			return nil, fmt.Errorf("update translations: %v", err)
+		}
+		if err := r.saveTranslations(db, id, movie.Translations); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("update movies: %v", err)
+	}
+
 	movie.ID = id
 
 	return movie, nil
 }
 
 func (r *Repository) DeleteMovie(id int64) error {
-	_, err := r.DB.Exec("delete from movies where id = ?", id)
+	_, err := r.db().Exec("delete from movies where id = ? and tenant_id = ?", id, r.Tenant)
 	if err != nil {
 		return fmt.Errorf("delete movies: %v", err)
 	}
 	return nil
 }
+
+func (r *Repository) UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error) {
+	// a concurrent upsert of the same isbn can insert it between the lookup and the insert,
+	// the second attempt then finds it and updates it
+	for attempt := 0; attempt < 2; attempt++ {
+		var id int64
+		err := r.db().QueryRow("select id from movies where tenant_id = ? and isbn = ?", r.Tenant, movie.Isbn).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, false, fmt.Errorf("upsert movie %s: %v", movie.Isbn, err)
+		}
+
+		if err == nil {
+			updated, err := r.UpdateMovie(id, movie)
+			return updated, false, err
+		}
+
+		created, err := r.CreateMovie(movie)
+		var duplicate *DuplicateIsbnError
+		if errors.As(err, &duplicate) {
+			continue
+		}
+		return created, err == nil, err
+	}
+
+	return nil, false, fmt.Errorf("upsert movie %s: isbn is contended", movie.Isbn)
+}
+
+func (r *Repository) duplicateIsbn(isbn string) error {
+	var id int64
+	if err := r.db().QueryRow("select id from movies where tenant_id = ? and isbn = ?", r.Tenant, isbn).Scan(&id); err != nil {
+		return fmt.Errorf("find movie with isbn %s: %v", isbn, err)
+	}
+	return &DuplicateIsbnError{Isbn: isbn, ExistingID: id}
+}
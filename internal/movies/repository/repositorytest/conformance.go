@@ -0,0 +1,520 @@
+// Package repositorytest checks that the implementations of repository.MoviesRepository behave alike,
+// whatever database they keep the movies in.
+package repositorytest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// unknownId is the id of no movie of the tenants of the tests
+const unknownId = 999999999
+
+var tenants atomic.Int64
+
+// Run checks the repositories returned by newRepository for a tenant. Every test takes tenants
+// of its own, so the repositories can share a database which already holds other movies.
+func Run(t *testing.T, newRepository func(tenant string) repository.MoviesRepository) {
+	run := time.Now().UnixNano()
+	repositoryOf := func(t *testing.T) repository.MoviesRepository {
+		return newRepository(fmt.Sprintf("conformance-%d-%d", run, tenants.Add(1)))
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository)
+	}{
+		{name: "CreateAndGet", test: testCreateAndGet},
+		{name: "NotFound", test: testNotFound},
+		{name: "DuplicateIsbn", test: testDuplicateIsbn},
+		{name: "DuplicateExternalId", test: testDuplicateExternalId},
+		{name: "Update", test: testUpdate},
+		{name: "Delete", test: testDelete},
+		{name: "Upsert", test: testUpsert},
+		{name: "List", test: testList},
+		{name: "Batch", test: testBatch},
+		{name: "AtomicBatch", test: testAtomicBatch},
+		{name: "ConcurrentBatches", test: testConcurrentBatches},
+		{name: "Translations", test: testTranslations},
+		{name: "Tenants", test: testTenants},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, repositoryOf)
+		})
+	}
+}
+
+func jaws() *models.Movie {
+	return &models.Movie{
+		Isbn:        "9788401490040",
+		Title:       "Jaws",
+		Director:    "Steven Spielberg",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195", models.SourceTMDB: "578"},
+		Translations: []models.Translation{
+			{Language: "pt-BR", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."},
+			{Language: "es", Title: "Tiburón"},
+		},
+	}
+}
+
+func alien() *models.Movie {
+	return &models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"}
+}
+
+func create(t *testing.T, repo repository.MoviesRepository, movie *models.Movie) *models.Movie {
+	created, err := repo.CreateMovie(movie)
+	require.NoError(t, err)
+	require.NotZero(t, created.ID)
+	return created
+}
+
+func testCreateAndGet(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	created := create(t, repo, jaws())
+
+	want := jaws()
+	want.ID = created.ID
+	want.Translations = []models.Translation{want.Translations[1], want.Translations[0]}
+
+	byId, err := repo.GetMovieById(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, want, byId)
+
+	byIsbn, err := repo.GetMovieByIsbn("9788401490040")
+	assert.NoError(t, err)
+	assert.Equal(t, want, byIsbn)
+
+	byExternalId, err := repo.GetMovieByExternalId(models.SourceTMDB, "578")
+	assert.NoError(t, err)
+	assert.Equal(t, want, byExternalId)
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Movie{*want}, movies)
+}
+
+func testNotFound(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	create(t, repo, jaws())
+
+	_, err := repo.GetMovieById(unknownId)
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	_, err = repo.GetMovieByIsbn("9780000000002")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	_, err = repo.GetMovieByExternalId(models.SourceIMDb, "tt0078748")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	_, err = repo.GetMovieByExternalId(models.SourceEIDR, "")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	_, err = repo.UpdateMovie(unknownId, alien())
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Len(t, movies, 1)
+}
+
+func testDuplicateIsbn(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	first := create(t, repo, jaws())
+	second := create(t, repo, alien())
+
+	_, err := repo.CreateMovie(&models.Movie{Isbn: "9788401490040", Title: "Jaws 2"})
+	var duplicate *repository.DuplicateIsbnError
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, first.ID, duplicate.ExistingID)
+	}
+
+	_, err = repo.UpdateMovie(second.ID, &models.Movie{Isbn: "9788401490040", Title: "Alien"})
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, first.ID, duplicate.ExistingID)
+	}
+
+	unchanged, err := repo.GetMovieById(second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "9780000000002", unchanged.Isbn)
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Len(t, movies, 2)
+}
+
+func testDuplicateExternalId(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	first := create(t, repo, jaws())
+
+	movie := alien()
+	movie.ExternalIDs = map[string]string{models.SourceIMDb: "tt0073195"}
+	_, err := repo.CreateMovie(movie)
+	var duplicate *repository.DuplicateExternalIdError
+	if assert.ErrorAs(t, err, &duplicate) {
+		assert.Equal(t, models.SourceIMDb, duplicate.Source)
+		assert.Equal(t, first.ID, duplicate.ExistingID)
+	}
+
+	_, err = repo.GetMovieByIsbn("9780000000002")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound, "the movie was created without its external ids")
+}
+
+func testUpdate(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	created := create(t, repo, jaws())
+
+	// without external ids and translations, those of the movie are kept
+	_, err := repo.UpdateMovie(created.ID, &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Spielberg"})
+	assert.NoError(t, err)
+
+	updated, err := repo.GetMovieById(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Spielberg", updated.Director)
+	assert.Len(t, updated.ExternalIDs, 2)
+	assert.Len(t, updated.Translations, 2)
+
+	// updating a movie with the values it already has is not a not found
+	_, err = repo.UpdateMovie(created.ID, &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Spielberg"})
+	assert.NoError(t, err)
+
+	replaced, err := repo.UpdateMovie(created.ID, &models.Movie{
+		Isbn:         "9788401490040",
+		Title:        "Jaws",
+		Director:     "Steven Spielberg",
+		ExternalIDs:  map[string]string{models.SourceIMDb: "tt0073195"},
+		Translations: []models.Translation{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, replaced.ID)
+
+	updated, err = repo.GetMovieById(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Movie{
+		ID:          created.ID,
+		Isbn:        "9788401490040",
+		Title:       "Jaws",
+		Director:    "Steven Spielberg",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"},
+	}, updated)
+
+	_, err = repo.GetMovieByExternalId(models.SourceTMDB, "578")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+}
+
+func testDelete(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	created := create(t, repo, jaws())
+
+	assert.NoError(t, repo.DeleteMovie(created.ID))
+
+	_, err := repo.GetMovieById(created.ID)
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+	_, err = repo.GetMovieByExternalId(models.SourceIMDb, "tt0073195")
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	assert.NoError(t, repo.DeleteMovie(created.ID), "deleting a movie that doesn't exist is not an error")
+
+	// the isbn and external ids of a deleted movie can be taken again
+	create(t, repo, jaws())
+}
+
+func testUpsert(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+
+	upserted, created, err := repo.UpsertMovieByIsbn(jaws())
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	movie := jaws()
+	movie.Title = "Jaws (1975)"
+	replaced, created, err := repo.UpsertMovieByIsbn(movie)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, upserted.ID, replaced.ID)
+
+	found, err := repo.GetMovieByIsbn("9788401490040")
+	assert.NoError(t, err)
+	assert.Equal(t, "Jaws (1975)", found.Title)
+}
+
+func testList(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Empty(t, movies)
+
+	first := create(t, repo, jaws())
+	second := create(t, repo, alien())
+	third := create(t, repo, &models.Movie{Isbn: "9780000000019", Title: "Heat", Director: "Michael Mann"})
+
+	movies, err = repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID, third.ID}, ids(movies))
+
+	page, err := repo.GetMoviesPage(0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID}, ids(page))
+	assert.Equal(t, models.Movie{ID: first.ID, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}, page[0])
+
+	page, err = repo.GetMoviesPage(second.ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{third.ID}, ids(page))
+
+	page, err = repo.GetMoviesPage(third.ID, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+	byIsbn, err := repo.GetMoviesByIsbn([]string{"9780000000019", "9788401490040", "9780000000026"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Movie{
+		{ID: first.ID, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"},
+		{ID: third.ID, Isbn: "9780000000019", Title: "Heat", Director: "Michael Mann"},
+	}, byIsbn)
+
+	byIsbn, err = repo.GetMoviesByIsbn(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, byIsbn)
+
+	var streamed []models.Movie
+	assert.NoError(t, repo.StreamMovies(func(movie models.Movie) error {
+		streamed = append(streamed, movie)
+		return nil
+	}))
+	assert.Equal(t, []int64{first.ID, second.ID, third.ID}, ids(streamed))
+	assert.Equal(t, models.Movie{ID: first.ID, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}, streamed[0])
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = repo.StreamMovies(func(movie models.Movie) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func testBatch(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	existing := create(t, repo, jaws())
+
+	results, err := repo.BatchMovies([]models.BatchOperation{
+		{Op: models.BatchCreate, Movie: alien()},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9788401490040", Title: "Jaws 2"}},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780000000019", Title: "Heat"}},
+		{Op: models.BatchUpdate, ID: existing.ID, Movie: &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Spielberg"}},
+		{Op: models.BatchUpdate, ID: unknownId, Movie: alien()},
+		{Op: models.BatchDelete, ID: unknownId},
+		{Op: models.BatchCreate},
+		{Op: "rename", ID: existing.ID},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		models.BatchCreated, models.BatchConflict, models.BatchCreated, models.BatchUpdated,
+		models.BatchNotFound, models.BatchNotFound, models.BatchInvalid, models.BatchInvalid,
+	}, statuses(results))
+
+	for _, i := range []int{0, 2} {
+		movie, err := repo.GetMovieById(results[i].Movie.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, results[i].Movie.Title, movie.Title)
+		}
+	}
+
+	updated, err := repo.GetMovieById(existing.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Spielberg", updated.Director)
+	assert.Len(t, updated.ExternalIDs, 2, "batch updates keep the external ids")
+	assert.Len(t, updated.Translations, 2, "batch updates keep the translations")
+
+	results, err = repo.BatchMovies([]models.BatchOperation{{Op: models.BatchDelete, ID: existing.ID}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.BatchDeleted}, statuses(results))
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Len(t, movies, 2)
+}
+
+// testConcurrentBatches checks the ids of batches inserting movies at the same time,
+// which are not consecutive when the inserts interleave
+func testConcurrentBatches(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+
+	const batches, size = 4, 20
+	results := make([][]models.BatchResult, batches)
+	var wg sync.WaitGroup
+	for b := 0; b < batches; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			ops := make([]models.BatchOperation, size)
+			for i := range ops {
+				ops[i] = models.BatchOperation{Op: models.BatchCreate, Movie: &models.Movie{Isbn: fmt.Sprintf("978%04d%06d", b, i), Title: fmt.Sprintf("Movie %d", i)}}
+			}
+
+			var err error
+			results[b], err = repo.BatchMovies(ops, b%2 == 0)
+			assert.NoError(t, err)
+		}(b)
+	}
+	wg.Wait()
+
+	for _, batch := range results {
+		for _, result := range batch {
+			if !assert.Equal(t, models.BatchCreated, result.Status) {
+				continue
+			}
+			movie, err := repo.GetMovieById(result.Movie.ID)
+			if assert.NoError(t, err) {
+				assert.Equal(t, result.Movie.Isbn, movie.Isbn)
+			}
+		}
+	}
+}
+
+func testAtomicBatch(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	existing := create(t, repo, jaws())
+
+	results, err := repo.BatchMovies([]models.BatchOperation{
+		{Op: models.BatchCreate, Movie: alien()},
+		{Op: models.BatchDelete, ID: existing.ID},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780000000019", Title: "Heat"}},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780000000019", Title: "Heat again"}},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780000000026", Title: "Ran"}},
+	}, true)
+	assert.ErrorIs(t, err, repository.ErrBatchAborted)
+	assert.Equal(t, []string{
+		models.BatchAborted, models.BatchAborted, models.BatchAborted, models.BatchConflict, models.BatchAborted,
+	}, statuses(results))
+	for _, result := range results {
+		assert.Nil(t, result.Movie)
+	}
+
+	movies, err := repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{existing.ID}, ids(movies), "the batch was rolled back")
+
+	results, err = repo.BatchMovies([]models.BatchOperation{
+		{Op: models.BatchCreate, Movie: alien()},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780000000019", Title: "Heat"}},
+		{Op: models.BatchDelete, ID: existing.ID},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.BatchCreated, models.BatchCreated, models.BatchDeleted}, statuses(results))
+
+	movies, err = repo.GetMovies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{results[0].Movie.ID, results[1].Movie.ID}, ids(movies))
+}
+
+func testTranslations(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	repo := repositoryOf(t)
+	movie := create(t, repo, alien())
+
+	_, err := repo.GetTranslations(unknownId)
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	translations, err := repo.GetTranslations(movie.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, translations)
+
+	_, err = repo.SaveTranslation(unknownId, &models.Translation{Language: "fr", Title: "Alien, le huitième passager"})
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	created, err := repo.SaveTranslation(movie.ID, &models.Translation{Language: "fr", Title: "Alien"})
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = repo.SaveTranslation(movie.ID, &models.Translation{Language: "fr", Title: "Alien, le huitième passager"})
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	_, err = repo.SaveTranslation(movie.ID, &models.Translation{Language: "de", Title: "Alien – Das unheimliche Wesen aus einer fremden Welt"})
+	assert.NoError(t, err)
+
+	translations, err = repo.GetTranslations(movie.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Translation{
+		{Language: "de", Title: "Alien – Das unheimliche Wesen aus einer fremden Welt"},
+		{Language: "fr", Title: "Alien, le huitième passager"},
+	}, translations)
+
+	other := create(t, repo, jaws())
+	movies := []models.Movie{{ID: movie.ID}, {ID: other.ID}, {ID: unknownId}}
+	assert.NoError(t, repo.LoadTranslations(movies))
+	assert.Equal(t, translations, movies[0].Translations)
+	assert.Len(t, movies[1].Translations, 2)
+	assert.Empty(t, movies[2].Translations)
+
+	assert.NoError(t, repo.DeleteTranslation(movie.ID, "de"))
+	assert.ErrorIs(t, repo.DeleteTranslation(movie.ID, "de"), repository.ErrTranslationNotFound)
+	assert.ErrorIs(t, repo.DeleteTranslation(unknownId, "fr"), repository.ErrTranslationNotFound)
+
+	translations, err = repo.GetTranslations(movie.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Translation{{Language: "fr", Title: "Alien, le huitième passager"}}, translations)
+}
+
+func testTenants(t *testing.T, repositoryOf func(t *testing.T) repository.MoviesRepository) {
+	studioA, studioB := repositoryOf(t), repositoryOf(t)
+	movie := create(t, studioA, jaws())
+
+	// each tenant has its own isbns and external ids
+	other := create(t, studioB, jaws())
+	assert.NotEqual(t, movie.ID, other.ID)
+
+	assert.NoError(t, studioB.DeleteMovie(movie.ID))
+	_, err := studioB.UpdateMovie(movie.ID, alien())
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+	_, err = studioB.SaveTranslation(movie.ID, &models.Translation{Language: "fr", Title: "Les Dents de la mer"})
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+	assert.ErrorIs(t, studioB.DeleteTranslation(movie.ID, "es"), repository.ErrTranslationNotFound)
+
+	results, err := studioB.BatchMovies([]models.BatchOperation{
+		{Op: models.BatchUpdate, ID: movie.ID, Movie: alien()},
+		{Op: models.BatchDelete, ID: movie.ID},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.BatchNotFound, models.BatchNotFound}, statuses(results))
+
+	found, err := studioA.GetMovieById(movie.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Jaws", found.Title)
+	assert.Len(t, found.Translations, 2)
+
+	_, err = studioB.GetMovieById(movie.ID)
+	assert.ErrorIs(t, err, repository.ErrMovieNotFound)
+
+	movies, err := studioB.GetMovies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{other.ID}, ids(movies))
+}
+
+func ids(movies []models.Movie) []int64 {
+	var ids []int64
+	for _, movie := range movies {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+func statuses(results []models.BatchResult) []string {
+	var statuses []string
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
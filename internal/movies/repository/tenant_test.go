@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDriver keeps the statements run against it, finding no rows for any query
+// as if the database only held the movies of other tenants
+type recordingDriver struct {
+	mu         sync.Mutex
+	statements map[string][]statement
+}
+
+type statement struct {
+	query string
+	args  []driver.Value
+}
+
+var recording = &recordingDriver{statements: map[string][]statement{}}
+
+func init() {
+	sql.Register("recording", recording)
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d, name: name}, nil
+}
+
+func (d *recordingDriver) record(name string, query string, args []driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements[name] = append(d.statements[name], statement{query: query, args: args})
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+	name   string
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recordingConn) Commit() error             { return nil }
+func (c *recordingConn) Rollback() error           { return nil }
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.driver.record(s.conn.name, s.query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.driver.record(s.conn.name, s.query, args)
+	return noRows{}, nil
+}
+
+type noRows struct{}
+
+func (noRows) Columns() []string              { return []string{"id"} }
+func (noRows) Close() error                   { return nil }
+func (noRows) Next(dest []driver.Value) error { return io.EOF }
+
+func openRecording(t *testing.T) (*sql.DB, func() []statement) {
+	db, err := sql.Open("recording", t.Name())
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db, func() []statement {
+		recording.mu.Lock()
+		defer recording.mu.Unlock()
+		return recording.statements[t.Name()]
+	}
+}
+
+func TestRepositoryTenantScope(t *testing.T) {
+	jaws := func() *models.Movie {
+		return &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg", ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"},
+			Translations: []models.Translation{{Language: "pt-BR", Title: "Tubarão"}}}
+	}
+
+	testCases := []struct {
+		name string
+		run  func(r *Repository)
+	}{
+		{name: "GetMovies", run: func(r *Repository) { r.GetMovies() }},
+		{name: "GetMovieById", run: func(r *Repository) { r.GetMovieById(1) }},
+		{name: "GetMovieByIsbn", run: func(r *Repository) { r.GetMovieByIsbn("9788401490040") }},
+		{name: "GetMovieByExternalId", run: func(r *Repository) { r.GetMovieByExternalId(models.SourceIMDb, "tt0073195") }},
+		{name: "GetMoviesByIsbn", run: func(r *Repository) { r.GetMoviesByIsbn([]string{"9788401490040", "9780000000002"}) }},
+		{name: "StreamMovies", run: func(r *Repository) { r.StreamMovies(func(models.Movie) error { return nil }) }},
+		{name: "CreateMovie", run: func(r *Repository) { r.CreateMovie(jaws()) }},
+		{name: "UpdateMovie", run: func(r *Repository) { r.UpdateMovie(1, jaws()) }},
+		{name: "DeleteMovie", run: func(r *Repository) { r.DeleteMovie(1) }},
+		{name: "UpsertMovieByIsbn", run: func(r *Repository) { r.UpsertMovieByIsbn(jaws()) }},
+		{name: "GetTranslations", run: func(r *Repository) { r.GetTranslations(1) }},
+		{name: "SaveTranslation", run: func(r *Repository) { r.SaveTranslation(1, &models.Translation{Language: "pt-BR", Title: "Tubarão"}) }},
+		{name: "DeleteTranslation", run: func(r *Repository) { r.DeleteTranslation(1, "pt-BR") }},
+		{name: "LoadTranslations", run: func(r *Repository) { r.LoadTranslations([]models.Movie{{ID: 1}, {ID: 2}}) }},
+		{name: "BatchMovies", run: func(r *Repository) {
+			r.BatchMovies([]models.BatchOperation{
+				{Op: models.BatchCreate, Movie: jaws()},
+				{Op: models.BatchUpdate, ID: 1, Movie: jaws()},
+				{Op: models.BatchDelete, ID: 2},
+			}, false)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, statements := openRecording(t)
+
+			tc.run(&Repository{DB: db, Tenant: "studio-a"})
+
+			assert.NotEmpty(t, statements())
+			for _, s := range statements() {
+				assert.Contains(t, s.query, "tenant_id", s.query)
+				assert.Contains(t, s.args, "studio-a", s.query)
+			}
+		})
+	}
+}
+
+func TestUpdateMovieOfAnotherTenant(t *testing.T) {
+	db, statements := openRecording(t)
+	repo := Repository{DB: db, Tenant: "studio-a"}
+
+	_, err := repo.UpdateMovie(1, &models.Movie{Isbn: "9788401490040", Title: "Jaws"})
+
+	assert.ErrorIs(t, err, ErrMovieNotFound)
+	for _, s := range statements() {
+		assert.False(t, strings.HasPrefix(s.query, "update"), "the movie of another tenant was updated: %s", s.query)
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrTranslationNotFound = errors.New("no such translation")
+
+// GetTranslations returns the translations of a movie ordered by language, ErrMovieNotFound when there is no such movie
+func (r *Repository) GetTranslations(movieId int64) ([]models.Translation, error) {
+	var id int64
+	if err := r.db().QueryRow("select id from movies where id = ? and tenant_id = ?", movieId, r.Tenant).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getTranslations %d: %w", movieId, ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("getTranslations %d: %v", movieId, err)
+	}
+
+	translations, err := r.getTranslations("select movie_id, language, title, synopsis from movie_translations where tenant_id = ? and movie_id = ? order by language", r.Tenant, movieId)
+	if err != nil {
+		return nil, err
+	}
+	return translations[movieId], nil
+}
+
+// SaveTranslation creates or replaces the translation of a movie in its language, telling whether it was created
+func (r *Repository) SaveTranslation(movieId int64, translation *models.Translation) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("save translation %d %s: %v", movieId, translation.Language, err)
+	}
+	defer tx.Rollback()
+	db := r.in(tx)
+
+	var language string
+	err = db.QueryRow("select language from movie_translations where tenant_id = ? and movie_id = ? and language = ? for update",
+		r.Tenant, movieId, translation.Language).Scan(&language)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("save translation %d %s: %v", movieId, translation.Language, err)
+	}
+	created := err == sql.ErrNoRows
+
+	if created {
+		_, err = db.Exec("insert into movie_translations (tenant_id, movie_id, language, title, synopsis) values (?, ?, ?, ?, ?)",
+			r.Tenant, movieId, translation.Language, translation.Title, translation.Synopsis)
+	} else {
+		_, err = db.Exec("update movie_translations set title = ?, synopsis = ? where tenant_id = ? and movie_id = ? and language = ?",
+			translation.Title, translation.Synopsis, r.Tenant, movieId, translation.Language)
+	}
+	if err != nil {
+		if db.dialect.IsNoReferencedRow(err) {
+			return false, fmt.Errorf("save translation %d %s: %w", movieId, translation.Language, ErrMovieNotFound)
+		}
+		return false, fmt.Errorf("save translation %d %s: %v", movieId, translation.Language, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("save translation %d %s: %v", movieId, translation.Language, err)
+	}
+	return created, nil
+}
+
+func (r *Repository) DeleteTranslation(movieId int64, language string) error {
+	res, err := r.db().Exec("delete from movie_translations where tenant_id = ? and movie_id = ? and language = ?", r.Tenant, movieId, language)
+	if err != nil {
+		return fmt.Errorf("delete translation %d %s: %v", movieId, language, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete translation %d %s: %v", movieId, language, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("delete translation %d %s: %w", movieId, language, ErrTranslationNotFound)
+	}
+	return nil
+}
+
+// LoadTranslations fills in the translations of the movies with a single query
+func (r *Repository) LoadTranslations(movies []models.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(movies))
+	args := []interface{}{r.Tenant}
+	for i, movie := range movies {
+		placeholders[i] = "?"
+		args = append(args, movie.ID)
+	}
+
+	translations, err := r.getTranslations("select movie_id, language, title, synopsis from movie_translations "+
+		"where tenant_id = ? and movie_id in ("+strings.Join(placeholders, ", ")+") order by language", args...)
+	if err != nil {
+		return err
+	}
+
+	for i := range movies {
+		movies[i].Translations = translations[movies[i].ID]
+	}
+	return nil
+}
+
+func (r *Repository) loadTranslations(movie *models.Movie) error {
+	translations, err := r.getTranslations("select movie_id, language, title, synopsis from movie_translations where tenant_id = ? and movie_id = ? order by language", r.Tenant, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	movie.Translations = translations[movie.ID]
+	return nil
+}
+
+// getTranslations returns the translations found by the query, keyed by movie id
+func (r *Repository) getTranslations(query string, args ...interface{}) (map[int64][]models.Translation, error) {
+	rows, err := r.db().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations %v", err)
+	}
+	defer rows.Close()
+
+	translations := map[int64][]models.Translation{}
+	for rows.Next() {
+		var movieId int64
+		var t models.Translation
+		if err := rows.Scan(&movieId, &t.Language, &t.Title, &t.Synopsis); err != nil {
+			return nil, fmt.Errorf("getTranslations %v", err)
+		}
+		translations[movieId] = append(translations[movieId], t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getTranslations %v", err)
+	}
+
+	return translations, nil
+}
+
+// saveTranslations adds the translations of a new movie, or replaces those of an updated one
+func (r *Repository) saveTranslations(db dialectDB, movieId int64, translations []models.Translation) error {
+	for _, t := range translations {
+		_, err := db.Exec("insert into movie_translations (tenant_id, movie_id, language, title, synopsis) values (?, ?, ?, ?, ?)",
+			r.Tenant, movieId, t.Language, t.Title, t.Synopsis)
+		if err != nil {
+			return fmt.Errorf("add translations: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package reviews
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrNotAuthor = errors.New("only its author can change a review")
+
+// Reviews lets users score movies and sends a ReviewSubmitted event for every new or edited review.
+type Reviews struct {
+	// Tenant the movies belong to, set on the events
+	Tenant        string
+	Repository    ReviewsRepository
+	KafkaProducer producer.KafkaProducer
+	// Encoder writes the events in the configured format, protobuf when nil
+	Encoder encoder.EventEncoder
+	// Premoderation keeps new and edited reviews pending until a moderator approves them,
+	// otherwise they are approved right away and moderators can reject them later
+	Premoderation bool
+	// Changed, when set, is told about the movies whose reviews changed, such as to refresh their similar movies
+	Changed func(movieIds ...int64)
+}
+
+func (s *Reviews) GetReviews(movieId int64, status string, limit int, offset int) ([]models.Review, error) {
+	return s.Repository.GetReviews(movieId, status, limit, offset)
+}
+
+func (s *Reviews) GetReview(movieId int64, id int64) (*models.Review, error) {
+	return s.Repository.GetReview(movieId, id)
+}
+
+// Submit creates the review of a user, each user can review a movie once.
+func (s *Reviews) Submit(review *models.Review) (*models.Review, error) {
+	review.Status = models.ReviewApproved
+	if s.Premoderation {
+		review.Status = models.ReviewPending
+	}
+
+	created, rating, err := s.Repository.CreateReview(review)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sendSubmitted(created, rating, false)
+	s.changed(created.MovieID)
+	return created, nil
+}
+
+// Edit replaces the score and text of a review, only the user who wrote it can edit it.
+// Without premoderation the review keeps its status, so a rejected review stays rejected.
+func (s *Reviews) Edit(userId string, review *models.Review) (*models.Review, error) {
+	existing, err := s.Repository.GetReview(review.MovieID, review.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserID != userId {
+		return nil, ErrNotAuthor
+	}
+
+	existing.Score = review.Score
+	existing.Text = review.Text
+	if s.Premoderation {
+		existing.Status = models.ReviewPending
+	}
+
+	updated, rating, err := s.Repository.UpdateReview(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sendSubmitted(updated, rating, true)
+	s.changed(updated.MovieID)
+	return updated, nil
+}
+
+func (s *Reviews) Delete(userId string, movieId int64, id int64) error {
+	existing, err := s.Repository.GetReview(movieId, id)
+	if err != nil {
+		return err
+	}
+	if existing.UserID != userId {
+		return ErrNotAuthor
+	}
+
+	if _, err := s.Repository.DeleteReview(movieId, id); err != nil {
+		return err
+	}
+	s.changed(movieId)
+	return nil
+}
+
+// Moderate approves or rejects a review, only approved reviews count towards the rating of the movie.
+func (s *Reviews) Moderate(movieId int64, id int64, status string) (*models.Review, error) {
+	if !models.IsReviewStatus(status) {
+		return nil, fmt.Errorf("unknown review status %s", status)
+	}
+
+	review, _, err := s.Repository.SetReviewStatus(movieId, id, status)
+	if err != nil {
+		return nil, err
+	}
+	s.changed(movieId)
+	return review, nil
+}
+
+func (s *Reviews) changed(movieId int64) {
+	if s.Changed != nil {
+		s.Changed(movieId)
+	}
+}
+
+// Decorate fills in the rating of the movie.
+func (s *Reviews) Decorate(movie *models.Movie) error {
+	rating, err := s.Repository.GetRating(movie.ID)
+	if err != nil {
+		return err
+	}
+
+	movie.Rating = rating
+	return nil
+}
+
+// sendSubmitted is best effort, the review is saved whether the event could be sent or not
+func (s *Reviews) sendSubmitted(review *models.Review, rating *models.Rating, edited bool) {
+	if s.KafkaProducer == nil {
+		return
+	}
+
+	msg, err := s.encoder().Encode(&events.ReviewSubmitted{
+		ReviewId:    review.ID,
+		MovieId:     review.MovieID,
+		UserId:      review.UserID,
+		Score:       int32(review.Score),
+		Text:        review.Text,
+		Status:      review.Status,
+		SubmittedAt: review.UpdatedAt.Format(time.RFC3339),
+		Edited:      edited,
+		Average:     rating.Average,
+		ReviewCount: int64(rating.Count),
+		TenantId:    s.Tenant,
+	})
+	if err != nil {
+		log.Println("Failed to encode review event", err)
+		return
+	}
+
+	if err := s.KafkaProducer.SendMovieEvent(msg); err != nil {
+		log.Println("Failed to send review event", err)
+	}
+}
+
+func (s *Reviews) encoder() encoder.EventEncoder {
+	if s.Encoder == nil {
+		return &encoder.ProtobufEncoder{}
+	}
+	return s.Encoder
+}
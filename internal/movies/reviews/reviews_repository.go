@@ -0,0 +1,280 @@
+package reviews
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrReviewNotFound = errors.New("no such review")
+
+const duplicateEntry = 1062
+
+// DuplicateReviewError is returned when a user reviews a movie they already reviewed
+type DuplicateReviewError struct {
+	UserID     string
+	ExistingID int64
+}
+
+func (e *DuplicateReviewError) Error() string {
+	return fmt.Sprintf("user %s already reviewed the movie in review %d", e.UserID, e.ExistingID)
+}
+
+// ReviewsRepository keeps the reviews and the rating of each movie,
+// the methods changing a review return the rating of the movie after the change.
+type ReviewsRepository interface {
+	GetReviews(movieId int64, status string, limit int, offset int) ([]models.Review, error)
+	GetReview(movieId int64, id int64) (*models.Review, error)
+	CreateReview(review *models.Review) (*models.Review, *models.Rating, error)
+	UpdateReview(review *models.Review) (*models.Review, *models.Rating, error)
+	DeleteReview(movieId int64, id int64) (*models.Rating, error)
+	SetReviewStatus(movieId int64, id int64, status string) (*models.Review, *models.Rating, error)
+	GetRating(movieId int64) (*models.Rating, error)
+}
+
+// Repository keeps the reviews of the movies of one tenant.
+type Repository struct {
+	DB     *sql.DB
+	Tenant string
+}
+
+const reviewColumns = "id, movie_id, user_id, score, text, status, created_at, updated_at"
+
+func (r *Repository) GetReviews(movieId int64, status string, limit int, offset int) ([]models.Review, error) {
+	rows, err := r.DB.Query("select "+reviewColumns+" from reviews where tenant_id = ? and movie_id = ? and status = ? order by id desc limit ? offset ?",
+		r.Tenant, movieId, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("getReviews %v", err)
+	}
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		review, err := scanReview(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("getReviews %v", err)
+		}
+		reviews = append(reviews, *review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getReviews %v", err)
+	}
+
+	return reviews, nil
+}
+
+func (r *Repository) GetReview(movieId int64, id int64) (*models.Review, error) {
+	review, err := scanReview(r.DB.QueryRow("select "+reviewColumns+" from reviews where tenant_id = ? and movie_id = ? and id = ?", r.Tenant, movieId, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("getReview %d: %w", id, ErrReviewNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getReview %d: %v", id, err)
+	}
+	return review, nil
+}
+
+func (r *Repository) CreateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	tx, err := r.lockMovie(review.MovieID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec("insert into reviews (tenant_id, movie_id, user_id, score, text, status, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Tenant, review.MovieID, review.UserID, review.Score, review.Text, review.Status, now, now)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == duplicateEntry {
+			return nil, nil, r.duplicateReview(tx, review)
+		}
+		return nil, nil, fmt.Errorf("add review: %v", err)
+	}
+
+	review.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, nil, fmt.Errorf("get review last inserted id %v", err)
+	}
+	review.CreatedAt, review.UpdatedAt = now, now
+
+	rating, err := r.commit(tx, review.MovieID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return review, rating, nil
+}
+
+func (r *Repository) UpdateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	tx, err := r.lockMovie(review.MovieID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	review.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if _, err := tx.Exec("update reviews set score = ?, text = ?, status = ?, updated_at = ? where tenant_id = ? and movie_id = ? and id = ?",
+		review.Score, review.Text, review.Status, review.UpdatedAt, r.Tenant, review.MovieID, review.ID); err != nil {
+		return nil, nil, fmt.Errorf("update review: %v", err)
+	}
+
+	rating, err := r.commit(tx, review.MovieID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return review, rating, nil
+}
+
+func (r *Repository) DeleteReview(movieId int64, id int64) (*models.Rating, error) {
+	tx, err := r.lockMovie(movieId)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("delete from reviews where tenant_id = ? and movie_id = ? and id = ?", r.Tenant, movieId, id)
+	if err != nil {
+		return nil, fmt.Errorf("delete review: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("delete review %d: %w", id, ErrReviewNotFound)
+	}
+
+	return r.commit(tx, movieId)
+}
+
+func (r *Repository) SetReviewStatus(movieId int64, id int64, status string) (*models.Review, *models.Rating, error) {
+	tx, err := r.lockMovie(movieId)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	review, err := scanReview(tx.QueryRow("select "+reviewColumns+" from reviews where tenant_id = ? and movie_id = ? and id = ?", r.Tenant, movieId, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("set review status %d: %w", id, ErrReviewNotFound)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("set review status %d: %v", id, err)
+	}
+
+	// moderating a review isn't an edit, so updated_at is left as it is
+	if _, err := tx.Exec("update reviews set status = ? where tenant_id = ? and id = ?", status, r.Tenant, id); err != nil {
+		return nil, nil, fmt.Errorf("set review status %d: %v", id, err)
+	}
+	review.Status = status
+
+	rating, err := r.commit(tx, movieId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return review, rating, nil
+}
+
+// GetRating returns an empty rating for movies without approved reviews
+func (r *Repository) GetRating(movieId int64) (*models.Rating, error) {
+	var rating models.Rating
+	var histogram []byte
+
+	err := r.DB.QueryRow("select review_count, average, histogram from movie_ratings where tenant_id = ? and movie_id = ?", r.Tenant, movieId).
+		Scan(&rating.Count, &rating.Average, &histogram)
+	if err == sql.ErrNoRows {
+		return models.NewRating(nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getRating %d: %v", movieId, err)
+	}
+
+	if err := json.Unmarshal(histogram, &rating.Histogram); err != nil {
+		return nil, fmt.Errorf("getRating %d: %v", movieId, err)
+	}
+	return &rating, nil
+}
+
+// lockMovie starts a transaction holding the movie row, so concurrent reviews
+// of the same movie update its rating one after the other
+func (r *Repository) lockMovie(movieId int64) (*sql.Tx, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("lock movie %d: %v", movieId, err)
+	}
+
+	var id int64
+	if err := tx.QueryRow("select id from movies where id = ? and tenant_id = ? for update", movieId, r.Tenant).Scan(&id); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("lock movie %d: %w", movieId, repository.ErrMovieNotFound)
+		}
+		return nil, fmt.Errorf("lock movie %d: %v", movieId, err)
+	}
+	return tx, nil
+}
+
+// commit recomputes the rating of the movie from its approved reviews before committing the change
+func (r *Repository) commit(tx *sql.Tx, movieId int64) (*models.Rating, error) {
+	counts, err := countScores(tx, r.Tenant, movieId)
+	if err != nil {
+		return nil, fmt.Errorf("update rating %d: %v", movieId, err)
+	}
+
+	rating := models.NewRating(counts)
+	histogram, err := json.Marshal(rating.Histogram)
+	if err != nil {
+		return nil, fmt.Errorf("update rating %d: %v", movieId, err)
+	}
+
+	_, err = tx.Exec("insert into movie_ratings (tenant_id, movie_id, review_count, average, histogram) values (?, ?, ?, ?, ?) "+
+		"on duplicate key update review_count = values(review_count), average = values(average), histogram = values(histogram)",
+		r.Tenant, movieId, rating.Count, rating.Average, histogram)
+	if err != nil {
+		return nil, fmt.Errorf("update rating %d: %v", movieId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("update rating %d: %v", movieId, err)
+	}
+	return rating, nil
+}
+
+func (r *Repository) duplicateReview(tx *sql.Tx, review *models.Review) error {
+	var id int64
+	if err := tx.QueryRow("select id from reviews where tenant_id = ? and movie_id = ? and user_id = ?", r.Tenant, review.MovieID, review.UserID).Scan(&id); err != nil {
+		return fmt.Errorf("find review of user %s: %v", review.UserID, err)
+	}
+	return &DuplicateReviewError{UserID: review.UserID, ExistingID: id}
+}
+
+func countScores(tx *sql.Tx, tenant string, movieId int64) (map[int]int, error) {
+	rows, err := tx.Query("select score, count(*) from reviews where tenant_id = ? and movie_id = ? and status = ? group by score", tenant, movieId, models.ReviewApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var score, count int
+		if err := rows.Scan(&score, &count); err != nil {
+			return nil, err
+		}
+		counts[score] = count
+	}
+	return counts, rows.Err()
+}
+
+func scanReview(scan func(dest ...interface{}) error) (*models.Review, error) {
+	var review models.Review
+	err := scan(&review.ID, &review.MovieID, &review.UserID, &review.Score, &review.Text, &review.Status, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
@@ -0,0 +1,301 @@
+package reviews
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+type fakeRepository struct {
+	mu      sync.Mutex
+	reviews []models.Review
+}
+
+func (f *fakeRepository) GetReviews(movieId int64, status string, limit int, offset int) ([]models.Review, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var list []models.Review
+	for _, review := range f.reviews {
+		if review.MovieID == movieId && review.Status == status {
+			list = append(list, review)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) GetReview(movieId int64, id int64) (*models.Review, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(movieId, id)
+	if i < 0 {
+		return nil, fmt.Errorf("getReview %d: %w", id, ErrReviewNotFound)
+	}
+	review := f.reviews[i]
+	return &review, nil
+}
+
+func (f *fakeRepository) CreateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, existing := range f.reviews {
+		if existing.MovieID == review.MovieID && existing.UserID == review.UserID {
+			return nil, nil, &DuplicateReviewError{UserID: review.UserID, ExistingID: existing.ID}
+		}
+	}
+
+	review.ID = int64(len(f.reviews) + 1)
+	f.reviews = append(f.reviews, *review)
+	return review, f.rating(review.MovieID), nil
+}
+
+func (f *fakeRepository) UpdateReview(review *models.Review) (*models.Review, *models.Rating, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reviews[f.find(review.MovieID, review.ID)] = *review
+	return review, f.rating(review.MovieID), nil
+}
+
+func (f *fakeRepository) DeleteReview(movieId int64, id int64) (*models.Rating, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(movieId, id)
+	f.reviews = append(f.reviews[:i], f.reviews[i+1:]...)
+	return f.rating(movieId), nil
+}
+
+func (f *fakeRepository) SetReviewStatus(movieId int64, id int64, status string) (*models.Review, *models.Rating, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(movieId, id)
+	if i < 0 {
+		return nil, nil, fmt.Errorf("set review status %d: %w", id, ErrReviewNotFound)
+	}
+	f.reviews[i].Status = status
+	review := f.reviews[i]
+	return &review, f.rating(movieId), nil
+}
+
+func (f *fakeRepository) GetRating(movieId int64) (*models.Rating, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rating(movieId), nil
+}
+
+func (f *fakeRepository) find(movieId int64, id int64) int {
+	for i, review := range f.reviews {
+		if review.MovieID == movieId && review.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *fakeRepository) rating(movieId int64) *models.Rating {
+	counts := map[int]int{}
+	for _, review := range f.reviews {
+		if review.MovieID == movieId && review.Status == models.ReviewApproved {
+			counts[review.Score]++
+		}
+	}
+	return models.NewRating(counts)
+}
+
+type fakeProducer struct {
+	msgs []producer.Message
+}
+
+func (f *fakeProducer) SendMovieEvent(msg producer.Message) error {
+	f.msgs = append(f.msgs, msg)
+	return nil
+}
+
+func (f *fakeProducer) SendMovieEvents(msgs []producer.Message) error {
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func decodeEvent(t *testing.T, msg producer.Message) *events.ReviewSubmitted {
+	var event events.ReviewSubmitted
+	assert.NoError(t, encoder.Decode(msg.Value, msg.Headers, &event))
+	return &event
+}
+
+func TestSubmit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		premoderation bool
+		encoder       encoder.EventEncoder
+		wantStatus    string
+		wantCount     int64
+		wantAverage   float64
+	}{
+		{
+			name:        "Should approve the review and count it in the rating",
+			wantStatus:  models.ReviewApproved,
+			wantCount:   2,
+			wantAverage: 7.5,
+		},
+		{
+			name:          "Should keep the review pending with premoderation",
+			premoderation: true,
+			wantStatus:    models.ReviewPending,
+			wantCount:     1,
+			wantAverage:   9,
+		},
+		{
+			name:        "Should send the event in json",
+			encoder:     &encoder.JSONEncoder{},
+			wantStatus:  models.ReviewApproved,
+			wantCount:   2,
+			wantAverage: 7.5,
+		},
+		{
+			name:        "Should send the event as a cloud event",
+			encoder:     &encoder.CloudEventsEncoder{Mode: encoder.Binary, Data: &encoder.JSONEncoder{}},
+			wantStatus:  models.ReviewApproved,
+			wantCount:   2,
+			wantAverage: 7.5,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{reviews: []models.Review{{ID: 1, MovieID: 1, UserID: "ana", Score: 9, Status: models.ReviewApproved}}}
+			kafka := &fakeProducer{}
+			reviews := Reviews{Repository: repo, KafkaProducer: kafka, Encoder: tc.encoder, Premoderation: tc.premoderation}
+
+			review, err := reviews.Submit(&models.Review{MovieID: 1, UserID: "bob", Score: 6, Text: "Too long"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, review.Status)
+
+			assert.Len(t, kafka.msgs, 1)
+			assert.Equal(t, "1", string(kafka.msgs[0].Key))
+			event := decodeEvent(t, kafka.msgs[0])
+			assert.Equal(t, review.ID, event.ReviewId)
+			assert.Equal(t, "bob", event.UserId)
+			assert.Equal(t, tc.wantStatus, event.Status)
+			assert.Equal(t, tc.wantCount, event.ReviewCount)
+			assert.Equal(t, tc.wantAverage, event.Average)
+			assert.False(t, event.Edited)
+		})
+	}
+}
+
+func TestSubmitTwice(t *testing.T) {
+	reviews := Reviews{Repository: &fakeRepository{}, KafkaProducer: &fakeProducer{}}
+
+	first, err := reviews.Submit(&models.Review{MovieID: 1, UserID: "ana", Score: 9})
+	assert.NoError(t, err)
+
+	_, err = reviews.Submit(&models.Review{MovieID: 1, UserID: "ana", Score: 3})
+	var duplicate *DuplicateReviewError
+	assert.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, first.ID, duplicate.ExistingID)
+}
+
+func TestEdit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		userId        string
+		premoderation bool
+		status        string
+		wantStatus    string
+		wantErr       error
+	}{
+		{
+			name:       "Should let the author edit the review",
+			userId:     "ana",
+			status:     models.ReviewApproved,
+			wantStatus: models.ReviewApproved,
+		},
+		{
+			name:       "Should keep a rejected review rejected",
+			userId:     "ana",
+			status:     models.ReviewRejected,
+			wantStatus: models.ReviewRejected,
+		},
+		{
+			name:          "Should put the review back in moderation with premoderation",
+			userId:        "ana",
+			premoderation: true,
+			status:        models.ReviewApproved,
+			wantStatus:    models.ReviewPending,
+		},
+		{
+			name:    "Should not let other users edit the review",
+			userId:  "bob",
+			status:  models.ReviewApproved,
+			wantErr: ErrNotAuthor,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{reviews: []models.Review{{ID: 1, MovieID: 1, UserID: "ana", Score: 9, Status: tc.status}}}
+			kafka := &fakeProducer{}
+			reviews := Reviews{Repository: repo, KafkaProducer: kafka, Premoderation: tc.premoderation}
+
+			review, err := reviews.Edit(tc.userId, &models.Review{ID: 1, MovieID: 1, Score: 4, Text: "Worse the second time"})
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Empty(t, kafka.msgs)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, 4, review.Score)
+			assert.Equal(t, tc.wantStatus, review.Status)
+			assert.True(t, decodeEvent(t, kafka.msgs[0]).Edited)
+		})
+	}
+}
+
+func TestModerateAndDecorate(t *testing.T) {
+	repo := &fakeRepository{reviews: []models.Review{
+		{ID: 1, MovieID: 1, UserID: "ana", Score: 9, Status: models.ReviewPending},
+		{ID: 2, MovieID: 1, UserID: "bob", Score: 4, Status: models.ReviewApproved},
+	}}
+	var changed []int64
+	reviews := Reviews{Repository: repo, Changed: func(movieIds ...int64) { changed = append(changed, movieIds...) }}
+
+	review, err := reviews.Moderate(1, 1, models.ReviewApproved)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReviewApproved, review.Status)
+	assert.Equal(t, []int64{1}, changed)
+
+	_, err = reviews.Moderate(1, 1, "hidden")
+	assert.EqualError(t, err, "unknown review status hidden")
+	assert.Equal(t, []int64{1}, changed)
+
+	movie := models.Movie{ID: 1}
+	assert.NoError(t, reviews.Decorate(&movie))
+	assert.Equal(t, 2, movie.Rating.Count)
+	assert.Equal(t, 6.5, movie.Rating.Average)
+	assert.Equal(t, 1, movie.Rating.Histogram[9])
+	assert.Len(t, movie.Rating.Histogram, models.MaxReviewScore)
+}
+
+func TestDelete(t *testing.T) {
+	repo := &fakeRepository{reviews: []models.Review{{ID: 1, MovieID: 1, UserID: "ana", Score: 9, Status: models.ReviewApproved}}}
+	var changed []int64
+	reviews := Reviews{Repository: repo, Changed: func(movieIds ...int64) { changed = append(changed, movieIds...) }}
+
+	assert.ErrorIs(t, reviews.Delete("bob", 1, 1), ErrNotAuthor)
+	assert.ErrorIs(t, reviews.Delete("ana", 1, 2), ErrReviewNotFound)
+	assert.NoError(t, reviews.Delete("ana", 1, 1))
+	assert.Empty(t, repo.reviews)
+	assert.Equal(t, []int64{1}, changed, "only the deleted review changes the movie")
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/iamthiago/movies-crud/internal/movies/moviespb"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+)
+
+// GetGRPCServer registers the movies service along with the health and reflection services.
+// The calls to the movies service are resolved to a tenant the same way as the http requests.
+func GetGRPCServer(movies *MoviesServer, resolver *tenant.Resolver) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryTenant(resolver)),
+		grpc.StreamInterceptor(streamTenant(resolver)),
+	)
+	moviespb.RegisterMoviesServiceServer(server, movies)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(moviespb.MoviesService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+
+	return server
+}
+
+func unaryTenant(resolver *tenant.Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !isMoviesMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, err := resolveTenant(ctx, resolver)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamTenant(resolver *tenant.Resolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !isMoviesMethod(info.FullMethod) {
+			return handler(srv, stream)
+		}
+
+		ctx, err := resolveTenant(stream.Context(), resolver)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// isMoviesMethod tells the calls to the movies service apart from the health checks and reflection, which have no tenant
+func isMoviesMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+moviespb.MoviesService_ServiceDesc.ServiceName+"/")
+}
+
+// resolveTenant adds the tenant of the call, given by its authorization and x-tenant-id metadata, to the context
+func resolveTenant(ctx context.Context, resolver *tenant.Resolver) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	id, err := resolver.Resolve(first("authorization"), first(strings.ToLower(tenant.Header)))
+	if err != nil {
+		return nil, status.Error(tenantCode(err), err.Error())
+	}
+	return tenant.NewContext(ctx, id), nil
+}
+
+func tenantCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, tenant.ErrMissingToken), errors.Is(err, tenant.ErrInvalidToken):
+		return codes.Unauthenticated
+	case errors.Is(err, tenant.ErrTenantMismatch):
+		return codes.PermissionDenied
+	}
+	return codes.InvalidArgument
+}
+
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/moviespb"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// MoviesServer exposes service.MoviesService over gRPC, serving each call from the catalogue of its tenant.
+type MoviesServer struct {
+	moviespb.UnimplementedMoviesServiceServer
+	Catalogue   service.Catalogue
+	Broadcaster *changes.Broadcaster
+}
+
+// service returns the catalogue of the tenant the interceptors resolved for the call
+func (s *MoviesServer) service(ctx context.Context) service.MoviesService {
+	return s.Catalogue(tenant.FromContext(ctx))
+}
+
+func (s *MoviesServer) GetMovie(ctx context.Context, req *moviespb.GetMovieRequest) (*moviespb.Movie, error) {
+	movie, err := s.service(ctx).GetMovieById(req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(movie), nil
+}
+
+// ListMovies pages through the movies ordered by id, the page token is the last id of the previous page.
+func (s *MoviesServer) ListMovies(ctx context.Context, req *moviespb.ListMoviesRequest) (*moviespb.ListMoviesResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	var afterId int64
+	if req.PageToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		if afterId, err = strconv.ParseInt(string(token), 10, 64); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	// one more movie than the page tells whether there is a next one
+	movies, err := s.service(ctx).GetMoviesPage(afterId, pageSize+1)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := moviespb.ListMoviesResponse{}
+	for i := range movies {
+		if len(resp.Movies) == pageSize {
+			last := resp.Movies[len(resp.Movies)-1].Id
+			resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(last, 10)))
+			break
+		}
+		resp.Movies = append(resp.Movies, toProto(&movies[i]))
+	}
+
+	return &resp, nil
+}
+
+func (s *MoviesServer) CreateMovie(ctx context.Context, req *moviespb.CreateMovieRequest) (*moviespb.Movie, error) {
+	if req.Movie == nil {
+		return nil, status.Error(codes.InvalidArgument, "movie is required")
+	}
+
+	movie, err := s.service(ctx).CreateMovie(fromProto(req.Movie))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(movie), nil
+}
+
+func (s *MoviesServer) UpdateMovie(ctx context.Context, req *moviespb.UpdateMovieRequest) (*moviespb.Movie, error) {
+	if req.Movie == nil {
+		return nil, status.Error(codes.InvalidArgument, "movie is required")
+	}
+
+	movie, err := s.service(ctx).UpdateMovie(req.Id, fromProto(req.Movie))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(movie), nil
+}
+
+func (s *MoviesServer) DeleteMovie(ctx context.Context, req *moviespb.DeleteMovieRequest) (*moviespb.DeleteMovieResponse, error) {
+	if err := s.service(ctx).DeleteMovie(req.Id); err != nil {
+		return nil, toStatus(err)
+	}
+	return &moviespb.DeleteMovieResponse{}, nil
+}
+
+func (s *MoviesServer) WatchMovies(req *moviespb.WatchMoviesRequest, stream moviespb.MoviesService_WatchMoviesServer) error {
+	if s.Broadcaster == nil {
+		return status.Error(codes.Unimplemented, "watching movies is not enabled")
+	}
+
+	ch, unsubscribe := s.Broadcaster.Subscribe(tenant.FromContext(stream.Context()))
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-ch:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client is too slow, reconnect to keep watching")
+			}
+
+			err := stream.Send(&moviespb.MovieChange{Type: toProtoType(change.Type), Movie: toProto(&change.Movie)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toStatus maps the errors of the service to grpc codes, the unexpected ones are logged
+// rather than sent to the client as they can hold database details
+func toStatus(err error) error {
+	if errors.Is(err, repository.ErrMovieNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	var duplicateIsbn *repository.DuplicateIsbnError
+	var duplicateExternalId *repository.DuplicateExternalIdError
+	if errors.As(err, &duplicateIsbn) || errors.As(err, &duplicateExternalId) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	if errors.Is(err, models.ErrInvalidIsbn) || errors.Is(err, models.ErrInvalidLanguage) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Println("Error handling grpc call", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func toProtoType(t changes.Type) moviespb.MovieChange_Type {
+	switch t {
+	case changes.Created:
+		return moviespb.MovieChange_TYPE_CREATED
+	case changes.Updated:
+		return moviespb.MovieChange_TYPE_UPDATED
+	case changes.Deleted:
+		return moviespb.MovieChange_TYPE_DELETED
+	}
+	return moviespb.MovieChange_TYPE_UNSPECIFIED
+}
+
+func toProto(movie *models.Movie) *moviespb.Movie {
+	return &moviespb.Movie{
+		Id:       movie.ID,
+		Isbn:     movie.Isbn,
+		Title:    movie.Title,
+		Director: movie.Director,
+	}
+}
+
+func fromProto(movie *moviespb.Movie) *models.Movie {
+	return &models.Movie{
+		ID:       movie.Id,
+		Isbn:     movie.Isbn,
+		Title:    movie.Title,
+		Director: movie.Director,
+	}
+}
@@ -0,0 +1,340 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/moviespb"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) GetMovies() ([]models.Movie, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Movie), nil
+}
+
+func (m *mockService) GetMoviesPage(afterId int64, limit int) ([]models.Movie, error) {
+	args := m.Called(afterId, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Movie), nil
+}
+
+func (m *mockService) GetMovieById(id int64) (*models.Movie, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockService) GetMovieByIsbn(isbn string) (*models.Movie, error) {
+	args := m.Called(isbn)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockService) GetMovieByExternalId(source string, externalId string) (*models.Movie, error) {
+	args := m.Called(source, externalId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockService) CreateMovie(movie *models.Movie) (*models.Movie, error) {
+	args := m.Called(movie)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockService) UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error) {
+	args := m.Called(id, movie)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockService) DeleteMovie(id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockService) UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error) {
+	args := m.Called(movie)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+	return args.Get(0).(*models.Movie), args.Bool(1), nil
+}
+
+func (m *mockService) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	args := m.Called(ops, atomic)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BatchResult), args.Error(1)
+}
+
+func (m *mockService) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	args := m.Called(isbns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Movie), nil
+}
+
+func (m *mockService) StreamMovies(fn func(movie models.Movie) error) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *mockService) PublishMovies(movies []models.Movie) error {
+	args := m.Called(movies)
+	return args.Error(0)
+}
+
+func (m *mockService) GetTranslations(movieId int64) ([]models.Translation, error) {
+	args := m.Called(movieId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Translation), nil
+}
+
+func (m *mockService) SaveTranslation(movieId int64, translation *models.Translation) (bool, error) {
+	args := m.Called(movieId, translation)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockService) DeleteTranslation(movieId int64, language string) error {
+	args := m.Called(movieId, language)
+	return args.Error(0)
+}
+
+// serverOf serves every tenant from the same service
+func serverOf(svc service.MoviesService) *MoviesServer {
+	return &MoviesServer{Catalogue: func(string) service.MoviesService { return svc }}
+}
+
+func TestListMovies(t *testing.T) {
+	svc := &service.Service{
+		Repository:    &repository.MemoryRepository{DB: &repository.MemoryDB{}, Tenant: tenant.Default},
+		KafkaProducer: &producer.MemoryProducer{},
+	}
+	server := serverOf(svc)
+
+	for i, isbn := range []string{"9780000000002", "9780000000019", "9780000000026", "9780000000033", "9780000000040"} {
+		_, err := svc.CreateMovie(&models.Movie{Isbn: isbn, Title: fmt.Sprintf("Movie %d", i+1)})
+		assert.NoError(t, err)
+	}
+
+	var ids []int64
+	pageToken := ""
+	pages := 0
+	for {
+		resp, err := server.ListMovies(context.Background(), &moviespb.ListMoviesRequest{PageSize: 2, PageToken: pageToken})
+		assert.NoError(t, err)
+		pages++
+
+		for _, m := range resp.Movies {
+			ids = append(ids, m.Id)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+	assert.Equal(t, 3, pages)
+
+	// a page ending with the last movie has no next one
+	resp, err := server.ListMovies(context.Background(), &moviespb.ListMoviesRequest{PageSize: 5})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Movies, 5)
+	assert.Empty(t, resp.NextPageToken)
+
+	_, err = server.ListMovies(context.Background(), &moviespb.ListMoviesRequest{PageToken: "not a token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetMovie(t *testing.T) {
+	mockSvc := new(mockService)
+	server := serverOf(mockSvc)
+
+	mockSvc.On("GetMovieById", int64(1)).Return(&models.Movie{ID: 1, Title: "Jaws"}, nil)
+	mockSvc.On("GetMovieById", int64(2)).Return(nil, fmt.Errorf("getMovieById 2: %w", repository.ErrMovieNotFound))
+
+	movie, err := server.GetMovie(context.Background(), &moviespb.GetMovieRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jaws", movie.Title)
+
+	_, err = server.GetMovie(context.Background(), &moviespb.GetMovieRequest{Id: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{name: "Should not find a missing movie", err: fmt.Errorf("getMovieById 2: %w", repository.ErrMovieNotFound),
+			code: codes.NotFound, message: "getMovieById 2: no such movie"},
+		{name: "Should not create a movie with the isbn of another", err: &repository.DuplicateIsbnError{Isbn: "9788401490040", ExistingID: 1},
+			code: codes.AlreadyExists},
+		{name: "Should not create a movie with the external id of another", err: &repository.DuplicateExternalIdError{Source: "imdb", ExternalID: "tt0073195", ExistingID: 1},
+			code: codes.AlreadyExists, message: "a movie with imdb id tt0073195 already exists with id 1"},
+		{name: "Should not create a movie with an invalid isbn", err: fmt.Errorf("createMovie: %w", models.ErrInvalidIsbn),
+			code: codes.InvalidArgument},
+		{name: "Should hide the unexpected errors", err: fmt.Errorf("createMovie: Error 1146 (42S02): Table 'movies.movies' doesn't exist"),
+			code: codes.Internal, message: "internal error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st := status.Convert(toStatus(tc.err))
+			assert.Equal(t, tc.code, st.Code())
+			if tc.message != "" {
+				assert.Equal(t, tc.message, st.Message())
+			}
+		})
+	}
+}
+
+// watchStream records the changes sent to a WatchMovies call
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	mu   sync.Mutex
+	sent []*moviespb.MovieChange
+}
+
+func (w *watchStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *watchStream) Send(change *moviespb.MovieChange) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sent = append(w.sent, change)
+	return nil
+}
+
+func (w *watchStream) changes() []*moviespb.MovieChange {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*moviespb.MovieChange(nil), w.sent...)
+}
+
+func TestWatchMovies(t *testing.T) {
+	broadcaster := &changes.Broadcaster{}
+	server := &MoviesServer{Broadcaster: broadcaster}
+
+	ctx, cancel := context.WithCancel(tenant.NewContext(context.Background(), "studio-a"))
+	stream := &watchStream{ctx: ctx}
+	done := make(chan error)
+	go func() { done <- server.WatchMovies(&moviespb.WatchMoviesRequest{}, stream) }()
+
+	// the call subscribes in the background, the first changes may be published before it does
+	assert.Eventually(t, func() bool {
+		broadcaster.Publish("studio-a", changes.Created, models.Movie{ID: 1, Title: "Jaws"})
+		return len(stream.changes()) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	broadcaster.Publish("studio-b", changes.Created, models.Movie{ID: 2, Title: "Alien"})
+	broadcaster.Publish("studio-a", changes.Deleted, models.Movie{ID: 1})
+	assert.Eventually(t, func() bool {
+		sent := stream.changes()
+		return sent[len(sent)-1].Type == moviespb.MovieChange_TYPE_DELETED
+	}, time.Second, 10*time.Millisecond)
+
+	for _, change := range stream.changes() {
+		assert.Equal(t, int64(1), change.Movie.Id, "only the changes of the tenant are sent")
+	}
+	assert.Equal(t, "Jaws", stream.changes()[0].Movie.Title)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	err := (&MoviesServer{}).WatchMovies(&moviespb.WatchMoviesRequest{}, &watchStream{ctx: context.Background()})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestTenantInterceptor(t *testing.T) {
+	testCases := []struct {
+		name       string
+		metadata   metadata.MD
+		method     string
+		wantTenant string
+		wantCode   codes.Code
+	}{
+		{
+			name:       "Should serve the tenant of the metadata",
+			metadata:   metadata.Pairs("x-tenant-id", "studio-a"),
+			method:     "/com.github.iamthiago.movies.v1.MoviesService/GetMovie",
+			wantTenant: "studio-a",
+		},
+		{
+			name:       "Should serve the default tenant without metadata",
+			method:     "/com.github.iamthiago.movies.v1.MoviesService/GetMovie",
+			wantTenant: tenant.Default,
+		},
+		{
+			name:     "Should reject an invalid tenant",
+			metadata: metadata.Pairs("x-tenant-id", "Studio A"),
+			method:   "/com.github.iamthiago.movies.v1.MoviesService/GetMovie",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "Should not resolve a tenant for health checks",
+			metadata: metadata.Pairs("x-tenant-id", "Studio A"),
+			method:   "/grpc.health.v1.Health/Check",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			interceptor := unaryTenant(&tenant.Resolver{Default: tenant.Default})
+			ctx := metadata.NewIncomingContext(context.Background(), tc.metadata)
+
+			var got string
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				got = tenant.FromContext(ctx)
+				return nil, nil
+			})
+
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantTenant, got)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// DefaultTimeout bounds the calls of a client built without its own http.Client,
+// so an unreachable registry fails the produce instead of hanging it
+const DefaultTimeout = 5 * time.Second
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+var ErrNotFound = errors.New("schema registry: not found")
+
+type Client interface {
+	Register(subject string, schema string) (id int, err error)
+	GetSchema(id int) (schema string, err error)
+	GetLatestSchema(subject string) (id int, schema string, err error)
+	TestCompatibility(subject string, schema string) (compatible bool, err error)
+}
+
+// HTTPClient talks to a Confluent compatible schema registry rest api.
+// Client defaults to an http.Client with DefaultTimeout.
+type HTTPClient struct {
+	URL    string
+	Client *http.Client
+
+	mu      sync.Mutex
+	schemas map[int]string
+}
+
+type schemaRequest struct {
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+}
+
+type schemaResponse struct {
+	ID           int    `json:"id"`
+	Schema       string `json:"schema"`
+	IsCompatible bool   `json:"is_compatible"`
+}
+
+func (c *HTTPClient) Register(subject string, schema string) (int, error) {
+	var resp schemaResponse
+	err := c.do(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", &schemaRequest{SchemaType: "PROTOBUF", Schema: schema}, &resp)
+	if err != nil {
+		return 0, fmt.Errorf("register schema for subject %s: %v", subject, err)
+	}
+	return resp.ID, nil
+}
+
+func (c *HTTPClient) GetSchema(id int) (string, error) {
+	c.mu.Lock()
+	schema, ok := c.schemas[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp schemaResponse
+	if err := c.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return "", fmt.Errorf("get schema %d: %w", id, err)
+	}
+
+	// schemas are immutable once registered, so they can be cached forever
+	c.mu.Lock()
+	if c.schemas == nil {
+		c.schemas = map[int]string{}
+	}
+	c.schemas[id] = resp.Schema
+	c.mu.Unlock()
+
+	return resp.Schema, nil
+}
+
+func (c *HTTPClient) GetLatestSchema(subject string) (int, string, error) {
+	var resp schemaResponse
+	if err := c.do(http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &resp); err != nil {
+		return 0, "", fmt.Errorf("get latest schema for subject %s: %w", subject, err)
+	}
+	return resp.ID, resp.Schema, nil
+}
+
+func (c *HTTPClient) TestCompatibility(subject string, schema string) (bool, error) {
+	var resp schemaResponse
+	err := c.do(http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", &schemaRequest{SchemaType: "PROTOBUF", Schema: schema}, &resp)
+	if errors.Is(err, ErrNotFound) {
+		// nothing registered yet, any schema is compatible
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("test compatibility for subject %s: %v", subject, err)
+	}
+	return resp.IsCompatible, nil
+}
+
+func (c *HTTPClient) do(method string, path string, body interface{}, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
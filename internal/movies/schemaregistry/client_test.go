@@ -0,0 +1,31 @@
+package schemaregistry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &HTTPClient{URL: server.URL, Client: &http.Client{Timeout: 50 * time.Millisecond}}
+
+	start := time.Now()
+	_, err := client.GetSchema(1)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestHTTPClientDefaultTimeout(t *testing.T) {
+	assert.Equal(t, DefaultTimeout, defaultClient.Timeout)
+	assert.NotZero(t, defaultClient.Timeout)
+}
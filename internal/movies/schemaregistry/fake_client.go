@@ -0,0 +1,80 @@
+package schemaregistry
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeClient is an in-memory registry for tests.
+// Every schema is compatible unless Compatible says otherwise.
+type FakeClient struct {
+	Compatible func(subject string, latest string, schema string) bool
+
+	mu       sync.Mutex
+	nextId   int
+	schemas  map[int]string
+	subjects map[string][]int
+}
+
+func (f *FakeClient) Register(subject string, schema string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.schemas == nil {
+		f.schemas = map[int]string{}
+		f.subjects = map[string][]int{}
+	}
+
+	for id, s := range f.schemas {
+		if s == schema {
+			f.addVersion(subject, id)
+			return id, nil
+		}
+	}
+
+	f.nextId++
+	f.schemas[f.nextId] = schema
+	f.addVersion(subject, f.nextId)
+
+	return f.nextId, nil
+}
+
+func (f *FakeClient) addVersion(subject string, id int) {
+	for _, v := range f.subjects[subject] {
+		if v == id {
+			return
+		}
+	}
+	f.subjects[subject] = append(f.subjects[subject], id)
+}
+
+func (f *FakeClient) GetSchema(id int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	schema, ok := f.schemas[id]
+	if !ok {
+		return "", fmt.Errorf("get schema %d: %w", id, ErrNotFound)
+	}
+	return schema, nil
+}
+
+func (f *FakeClient) GetLatestSchema(subject string) (int, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions := f.subjects[subject]
+	if len(versions) == 0 {
+		return 0, "", fmt.Errorf("get latest schema for subject %s: %w", subject, ErrNotFound)
+	}
+	id := versions[len(versions)-1]
+	return id, f.schemas[id], nil
+}
+
+func (f *FakeClient) TestCompatibility(subject string, schema string) (bool, error) {
+	_, latest, err := f.GetLatestSchema(subject)
+	if err != nil || f.Compatible == nil {
+		return true, nil
+	}
+	return f.Compatible(subject, latest, schema), nil
+}
@@ -0,0 +1,138 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const magicByte byte = 0
+
+var ErrIncompatibleSchema = errors.New("schema registry: schema is not compatible with the latest registered version")
+
+// ProtobufSerializer writes messages in the Confluent wire format:
+// magic byte, 4 bytes big endian schema id, message indexes and the protobuf payload.
+// The schema is checked for compatibility and registered on first use.
+type ProtobufSerializer struct {
+	Client  Client
+	Subject string
+	Schema  string
+	// MessageIndexes points to the message inside the schema, nil means the first message
+	MessageIndexes []int
+
+	mu       sync.Mutex
+	schemaId int
+}
+
+func (s *ProtobufSerializer) Serialize(msg proto.Message) ([]byte, error) {
+	id, err := s.getSchemaId()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding protobuf message %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(magicByte)
+	binary.Write(&buf, binary.BigEndian, uint32(id))
+	buf.Write(encodeMessageIndexes(s.MessageIndexes))
+	buf.Write(payload)
+
+	return buf.Bytes(), nil
+}
+
+func (s *ProtobufSerializer) getSchemaId() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.schemaId != 0 {
+		return s.schemaId, nil
+	}
+
+	compatible, err := s.Client.TestCompatibility(s.Subject, s.Schema)
+	if err != nil {
+		return 0, err
+	}
+	if !compatible {
+		return 0, fmt.Errorf("subject %s: %w", s.Subject, ErrIncompatibleSchema)
+	}
+
+	id, err := s.Client.Register(s.Subject, s.Schema)
+	if err != nil {
+		return 0, err
+	}
+
+	s.schemaId = id
+	return id, nil
+}
+
+// Deserialize reads a message written in the Confluent wire format into msg
+// and returns the schema id it was written with.
+func Deserialize(data []byte, msg proto.Message) (int, error) {
+	schemaId, _, payload, err := ParseWireFormat(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return 0, fmt.Errorf("error decoding protobuf message %v", err)
+	}
+
+	return schemaId, nil
+}
+
+func ParseWireFormat(data []byte) (schemaId int, messageIndexes []int, payload []byte, err error) {
+	if len(data) < 6 || data[0] != magicByte {
+		return 0, nil, nil, errors.New("schema registry: invalid wire format")
+	}
+
+	schemaId = int(binary.BigEndian.Uint32(data[1:5]))
+
+	reader := bytes.NewReader(data[5:])
+	count, err := binary.ReadVarint(reader)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("schema registry: invalid message indexes %v", err)
+	}
+
+	if count == 0 {
+		messageIndexes = []int{0}
+	}
+	for i := int64(0); i < count; i++ {
+		index, err := binary.ReadVarint(reader)
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("schema registry: invalid message indexes %v", err)
+		}
+		messageIndexes = append(messageIndexes, int(index))
+	}
+
+	payload = data[len(data)-reader.Len():]
+	return
+}
+
+// IsWireFormat tells whether data starts with the wire format magic byte.
+// A plain protobuf message never starts with a zero byte since field number 0 is invalid.
+func IsWireFormat(data []byte) bool {
+	return len(data) > 0 && data[0] == magicByte
+}
+
+// encodeMessageIndexes writes the indexes as zig-zag varints prefixed by their count,
+// the common case of the first message in the schema is a single zero.
+func encodeMessageIndexes(indexes []int) []byte {
+	if len(indexes) == 0 || (len(indexes) == 1 && indexes[0] == 0) {
+		return []byte{0}
+	}
+
+	buf := make([]byte, 0, binary.MaxVarintLen64*(len(indexes)+1))
+	buf = binary.AppendVarint(buf, int64(len(indexes)))
+	for _, index := range indexes {
+		buf = binary.AppendVarint(buf, int64(index))
+	}
+	return buf
+}
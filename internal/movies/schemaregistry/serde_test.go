@@ -0,0 +1,84 @@
+package schemaregistry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+const movieEventSchema = `syntax = "proto3"; message MovieEvent { int64 id = 1; }`
+
+func TestSerialize(t *testing.T) {
+	event := &events.MovieEvent{Id: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}
+
+	testCases := []struct {
+		name           string
+		client         *FakeClient
+		messageIndexes []int
+		wantIndexes    []int
+		wantErr        error
+	}{
+		{
+			name:        "Should serialize the first message of the schema",
+			client:      &FakeClient{},
+			wantIndexes: []int{0},
+		},
+		{
+			name:           "Should serialize a nested message of the schema",
+			client:         &FakeClient{},
+			messageIndexes: []int{1, 0, 2},
+			wantIndexes:    []int{1, 0, 2},
+		},
+		{
+			name: "Should refuse to serialize with an incompatible schema",
+			client: func() *FakeClient {
+				c := &FakeClient{Compatible: func(subject, latest, schema string) bool { return false }}
+				c.Register("movies-value", "previous")
+				return c
+			}(),
+			wantErr: ErrIncompatibleSchema,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			serializer := ProtobufSerializer{Client: tc.client, Subject: "movies-value", Schema: movieEventSchema, MessageIndexes: tc.messageIndexes}
+
+			data, err := serializer.Serialize(event)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, IsWireFormat(data))
+
+			schemaId, indexes, _, err := ParseWireFormat(data)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantIndexes, indexes)
+
+			schema, err := tc.client.GetSchema(schemaId)
+			assert.NoError(t, err)
+			assert.Equal(t, movieEventSchema, schema)
+
+			var decoded events.MovieEvent
+			_, err = Deserialize(data, &decoded)
+			assert.NoError(t, err)
+			assert.True(t, proto.Equal(event, &decoded))
+		})
+	}
+}
+
+func TestDeserializeInvalidData(t *testing.T) {
+	raw, _ := proto.Marshal(&events.MovieEvent{Id: 1})
+
+	var decoded events.MovieEvent
+	_, err := Deserialize(raw, &decoded)
+	assert.Error(t, err)
+	assert.False(t, IsWireFormat(raw))
+
+	_, err = Deserialize([]byte{0, 0, 0}, &decoded)
+	assert.Error(t, err)
+}
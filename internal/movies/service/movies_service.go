@@ -1,70 +1,404 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
 	"github.com/iamthiago/movies-crud/internal/movies/events"
 	"github.com/iamthiago/movies-crud/internal/movies/producer"
 	"github.com/iamthiago/movies-crud/internal/movies/repository"
 	"github.com/iamthiago/movies-crud/pkg/models"
-	"google.golang.org/protobuf/proto"
 )
 
 type MoviesService interface {
 	GetMovies() ([]models.Movie, error)
+	GetMoviesPage(afterId int64, limit int) ([]models.Movie, error)
 	GetMovieById(id int64) (*models.Movie, error)
+	GetMovieByIsbn(isbn string) (*models.Movie, error)
+	GetMovieByExternalId(source string, externalId string) (*models.Movie, error)
 	CreateMovie(movie *models.Movie) (*models.Movie, error)
 	UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error)
 	DeleteMovie(id int64) error
+	UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error)
+	BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	GetMoviesByIsbn(isbns []string) ([]models.Movie, error)
+	StreamMovies(fn func(movie models.Movie) error) error
+	PublishMovies(movies []models.Movie) error
+	GetTranslations(movieId int64) ([]models.Translation, error)
+	SaveTranslation(movieId int64, translation *models.Translation) (bool, error)
+	DeleteTranslation(movieId int64, language string) error
 }
 
+// Catalogue returns the service of the movies of a tenant,
+// for the parts of the app serving every tenant such as the gRPC server and the jobs.
+type Catalogue func(tenant string) MoviesService
+
+// MovieDecorator fills in what other features know about a movie, like its poster or rating
+type MovieDecorator interface {
+	Decorate(movie *models.Movie) error
+}
+
+// Service is the catalogue of one tenant, set on its events and changes.
+// Its repository is expected to be scoped to the same tenant.
 type Service struct {
+	Tenant        string
 	Repository    repository.MoviesRepository
 	KafkaProducer producer.KafkaProducer
+	Encoder       encoder.EventEncoder
+	Broadcaster   *changes.Broadcaster
+	// Decorators complete the movies returned by GetMovieById, the lists of movies are left out
+	// since they would take a query per movie
+	Decorators []MovieDecorator
 }
 
 func (s *Service) GetMovies() ([]models.Movie, error) {
 	return s.Repository.GetMovies()
 }
 
+// GetMoviesPage returns up to limit movies with an id greater than afterId, ordered by id,
+// without their external ids and translations
+func (s *Service) GetMoviesPage(afterId int64, limit int) ([]models.Movie, error) {
+	return s.Repository.GetMoviesPage(afterId, limit)
+}
+
 func (s *Service) GetMovieById(id int64) (*models.Movie, error) {
-	return s.Repository.GetMovieById(id)
+	movie, err := s.Repository.GetMovieById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// decorating is best effort, a movie without its poster or rating is better than no movie
+	for _, decorator := range s.Decorators {
+		if err := decorator.Decorate(movie); err != nil {
+			log.Println("Failed to decorate movie", movie.ID, err)
+		}
+	}
+	return movie, nil
+}
+
+// GetMovieByIsbn accepts an ISBN-10 or ISBN-13 with or without hyphens,
+// movies stored with the ISBN-10 of the same book are found as well.
+func (s *Service) GetMovieByIsbn(isbn string) (*models.Movie, error) {
+	isbn13, err := models.NormalizeIsbn(isbn)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s", err, isbn)
+	}
+
+	movie, err := s.Repository.GetMovieByIsbn(isbn13)
+	if isbn10, ok := models.Isbn10(isbn13); ok && errors.Is(err, repository.ErrMovieNotFound) {
+		return s.Repository.GetMovieByIsbn(isbn10)
+	}
+	return movie, err
+}
+
+func (s *Service) GetMovieByExternalId(source string, externalId string) (*models.Movie, error) {
+	return s.Repository.GetMovieByExternalId(source, externalId)
+}
+
+func (s *Service) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	return s.Repository.GetMoviesByIsbn(isbns)
+}
+
+func (s *Service) StreamMovies(fn func(movie models.Movie) error) error {
+	return s.Repository.StreamMovies(fn)
 }
 
 func (s *Service) CreateMovie(movie *models.Movie) (*models.Movie, error) {
+	if err := normalize(movie); err != nil {
+		return nil, err
+	}
+
 	m, err := s.Repository.CreateMovie(movie)
 	if err != nil {
-		return nil, fmt.Errorf("error when creating movie %v", err)
+		return nil, fmt.Errorf("error when creating movie %w", err)
 	}
 
-	eventBytes, protoErr := toProtoEvent(m)
-	if protoErr != nil {
-		log.Fatalln("Failed to encode movie event", protoErr)
+	s.sendCreated(m)
+	return m, nil
+}
+
+// UpsertMovieByIsbn creates the movie or replaces the one with the same isbn, telling whether it was created.
+func (s *Service) UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error) {
+	if err := normalize(movie); err != nil {
+		return nil, false, err
 	}
 
-	s.KafkaProducer.SendMovieEvent(eventBytes)
+	m, created, err := s.Repository.UpsertMovieByIsbn(movie)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !created {
+		s.sendUpdated(m)
+		return m, false, nil
+	}
 
-	return m, err
+	s.sendCreated(m)
+	return m, true, nil
+}
+
+func (s *Service) sendCreated(m *models.Movie) {
+	s.send(changes.Created, m)
+	s.publish(changes.Created, *m)
+}
+
+func (s *Service) sendUpdated(m *models.Movie) {
+	s.send(changes.Updated, s.saved(m))
+	s.publish(changes.Updated, *m)
+}
+
+// saved reads back an updated movie for its event, as an update keeps the external ids and translations
+// it leaves out without returning them
+func (s *Service) saved(m *models.Movie) *models.Movie {
+	movie, err := s.Repository.GetMovieById(m.ID)
+	if err != nil {
+		log.Println("Failed to read updated movie", m.ID, err)
+		return m
+	}
+	return movie
+}
+
+// send produces the event of a movie that is saved already, so failures are only logged:
+// a consumer missing its event can catch up with a reindex
+func (s *Service) send(t changes.Type, m *models.Movie) {
+	msg, err := s.encoder().Encode(s.toProtoEvent(t, m))
+	if err != nil {
+		log.Println("Failed to encode movie event", err)
+		return
+	}
+
+	if err := s.KafkaProducer.SendMovieEvent(msg); err != nil {
+		log.Println("Failed to send movie event", err)
+	}
 }
 
 func (s *Service) UpdateMovie(id int64, movie *models.Movie) (*models.Movie, error) {
-	return s.Repository.UpdateMovie(id, movie)
+	if err := normalize(movie); err != nil {
+		return nil, err
+	}
+
+	m, err := s.Repository.UpdateMovie(id, movie)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sendUpdated(m)
+	return m, nil
 }
 
 func (s *Service) DeleteMovie(id int64) error {
-	return s.Repository.DeleteMovie(id)
+	if err := s.Repository.DeleteMovie(id); err != nil {
+		return err
+	}
+
+	deleted := models.Movie{ID: id}
+	s.send(changes.Deleted, &deleted)
+	s.publish(changes.Deleted, deleted)
+	return nil
 }
 
-func toProtoEvent(movie *models.Movie) (eventBytes []byte, err error) {
-	event := events.MovieEvent{
-		Id:       movie.ID,
-		Isbn:     movie.Isbn,
-		Title:    movie.Title,
-		Director: movie.Director,
+func (s *Service) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results, err := s.batchMovies(ops, atomic)
+	if err != nil {
+		return results, err
+	}
+
+	var msgs []producer.Message
+	for _, result := range results {
+		var t changes.Type
+		event := result.Movie
+		switch result.Status {
+		case models.BatchCreated:
+			t = changes.Created
+		case models.BatchUpdated:
+			t, event = changes.Updated, s.saved(result.Movie)
+		case models.BatchDeleted:
+			t = changes.Deleted
+		default:
+			continue
+		}
+
+		s.publish(t, *result.Movie)
+		msg, encodeErr := s.encoder().Encode(s.toProtoEvent(t, event))
+		if encodeErr != nil {
+			log.Println("Failed to encode movie event", encodeErr)
+			continue
+		}
+		msgs = append(msgs, msg)
 	}
 
-	eventBytes, err = proto.Marshal(&event)
+	if len(msgs) > 0 {
+		if err := s.KafkaProducer.SendMovieEvents(msgs); err != nil {
+			log.Println("Failed to send movie events", err)
+		}
+	}
+
+	return results, nil
+}
 
-	return
+// batchMovies normalizes the isbns of the operations and leaves the ones with an invalid isbn out of the batch,
+// an atomic batch with one of them is aborted without running any operation
+func (s *Service) batchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(ops))
+	valid := make([]models.BatchOperation, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		results[i] = models.BatchResult{Index: i, Op: op.Op, Status: models.BatchAborted}
+		if op.Op != models.BatchDelete && op.Movie != nil {
+			if err := normalizeIsbn(op.Movie); err != nil {
+				results[i].Status, results[i].Error = models.BatchInvalid, err.Error()
+				continue
+			}
+		}
+		valid = append(valid, op)
+		indexes = append(indexes, i)
+	}
+
+	if len(valid) == len(ops) {
+		return s.Repository.BatchMovies(ops, atomic)
+	}
+	if atomic {
+		return results, repository.ErrBatchAborted
+	}
+
+	applied, err := s.Repository.BatchMovies(valid, false)
+	for i, result := range applied {
+		result.Index = indexes[i]
+		results[indexes[i]] = result
+	}
+	return results, err
+}
+
+// PublishMovies sends the events of existing movies again, so consumers can rebuild their read models.
+// The events have no change, they are the current state of the movies.
+func (s *Service) PublishMovies(movies []models.Movie) error {
+	if err := s.Repository.LoadTranslations(movies); err != nil {
+		return err
+	}
+
+	msgs := make([]producer.Message, 0, len(movies))
+	for i := range movies {
+		msg, err := s.encoder().Encode(s.toProtoEvent("", &movies[i]))
+		if err != nil {
+			return fmt.Errorf("error when encoding movie event %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return s.KafkaProducer.SendMovieEvents(msgs)
+}
+
+func (s *Service) GetTranslations(movieId int64) ([]models.Translation, error) {
+	return s.Repository.GetTranslations(movieId)
+}
+
+// SaveTranslation creates or replaces the translation of a movie in its language, telling whether it was created.
+// The event of the movie is sent again with all its translations.
+func (s *Service) SaveTranslation(movieId int64, translation *models.Translation) (bool, error) {
+	language, err := models.NormalizeLanguage(translation.Language)
+	if err != nil {
+		return false, fmt.Errorf("%w %s", err, translation.Language)
+	}
+	translation.Language = language
+
+	created, err := s.Repository.SaveTranslation(movieId, translation)
+	if err != nil {
+		return false, err
+	}
+	return created, s.sendTranslated(movieId)
+}
+
+func (s *Service) DeleteTranslation(movieId int64, language string) error {
+	normalized, err := models.NormalizeLanguage(language)
+	if err != nil {
+		return fmt.Errorf("%w %s", err, language)
+	}
+
+	if err := s.Repository.DeleteTranslation(movieId, normalized); err != nil {
+		return err
+	}
+	return s.sendTranslated(movieId)
+}
+
+// sendTranslated sends the event of a movie whose translations changed, so consumers get all of them
+func (s *Service) sendTranslated(movieId int64) error {
+	movie, err := s.Repository.GetMovieById(movieId)
+	if err != nil {
+		return err
+	}
+
+	s.send(changes.Updated, movie)
+	s.publish(changes.Updated, *movie)
+	return nil
+}
+
+// normalize stores the isbn of a movie as an ISBN-13 and the languages of its translations as BCP 47 tags,
+// so it can be found by any form of them
+func normalize(movie *models.Movie) error {
+	if err := normalizeIsbn(movie); err != nil {
+		return err
+	}
+	return normalizeTranslations(movie)
+}
+
+func normalizeIsbn(movie *models.Movie) error {
+	isbn13, err := models.NormalizeIsbn(movie.Isbn)
+	if err != nil {
+		return fmt.Errorf("%w %s", err, movie.Isbn)
+	}
+	movie.Isbn = isbn13
+	return nil
+}
+
+// normalizeTranslations turns the languages of the translations of a movie into canonical BCP 47 tags
+func normalizeTranslations(movie *models.Movie) error {
+	for i := range movie.Translations {
+		language, err := models.NormalizeLanguage(movie.Translations[i].Language)
+		if err != nil {
+			return fmt.Errorf("%w %s", err, movie.Translations[i].Language)
+		}
+		movie.Translations[i].Language = language
+	}
+	return nil
+}
+
+func (s *Service) publish(t changes.Type, movie models.Movie) {
+	if s.Broadcaster != nil {
+		s.Broadcaster.Publish(s.Tenant, t, movie)
+	}
+}
+
+func (s *Service) encoder() encoder.EventEncoder {
+	if s.Encoder == nil {
+		return &encoder.ProtobufEncoder{}
+	}
+	return s.Encoder
+}
+
+func (s *Service) toProtoEvent(t changes.Type, movie *models.Movie) *events.MovieEvent {
+	return &events.MovieEvent{
+		Id:           movie.ID,
+		Isbn:         movie.Isbn,
+		Title:        movie.Title,
+		Director:     movie.Director,
+		ExternalIds:  movie.ExternalIDs,
+		TenantId:     s.Tenant,
+		Translations: toProtoTranslations(movie.Translations),
+		Change:       string(t),
+	}
+}
+
+func toProtoTranslations(translations []models.Translation) map[string]*events.Translation {
+	if len(translations) == 0 {
+		return nil
+	}
+
+	protoTranslations := make(map[string]*events.Translation, len(translations))
+	for _, t := range translations {
+		protoTranslations[t.Language] = &events.Translation{Title: t.Title, Synopsis: t.Synopsis}
+	}
+	return protoTranslations
 }
@@ -3,11 +3,18 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/events"
+	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
 	"github.com/iamthiago/movies-crud/pkg/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
 )
 
 type mockRepo struct {
@@ -23,6 +30,15 @@ func (m *mockRepo) GetMovies() ([]models.Movie, error) {
 	return args.Get(0).([]models.Movie), nil
 }
 
+func (m *mockRepo) GetMoviesPage(afterId int64, limit int) ([]models.Movie, error) {
+	args := m.Called(afterId, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]models.Movie), nil
+}
+
 func (m *mockRepo) GetMovieById(id int64) (*models.Movie, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -31,6 +47,22 @@ func (m *mockRepo) GetMovieById(id int64) (*models.Movie, error) {
 	return args.Get(0).(*models.Movie), nil
 }
 
+func (m *mockRepo) GetMovieByIsbn(isbn string) (*models.Movie, error) {
+	args := m.Called(isbn)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
+func (m *mockRepo) GetMovieByExternalId(source string, externalId string) (*models.Movie, error) {
+	args := m.Called(source, externalId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Movie), nil
+}
+
 func (m *mockRepo) CreateMovie(movie *models.Movie) (*models.Movie, error) {
 	args := m.Called(movie)
 	if args.Get(0) == nil {
@@ -54,16 +86,96 @@ func (m *mockRepo) DeleteMovie(id int64) error {
 	return args.Error(0)
 }
 
+func (m *mockRepo) UpsertMovieByIsbn(movie *models.Movie) (*models.Movie, bool, error) {
+	args := m.Called(movie)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+
+	return args.Get(0).(*models.Movie), args.Bool(1), nil
+}
+
+func (m *mockRepo) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	args := m.Called(ops, atomic)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]models.BatchResult), args.Error(1)
+}
+
+func (m *mockRepo) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	args := m.Called(isbns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]models.Movie), nil
+}
+
+func (m *mockRepo) StreamMovies(fn func(movie models.Movie) error) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *mockRepo) GetTranslations(movieId int64) ([]models.Translation, error) {
+	args := m.Called(movieId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]models.Translation), nil
+}
+
+func (m *mockRepo) SaveTranslation(movieId int64, translation *models.Translation) (bool, error) {
+	args := m.Called(movieId, translation)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockRepo) DeleteTranslation(movieId int64, language string) error {
+	args := m.Called(movieId, language)
+	return args.Error(0)
+}
+
+func (m *mockRepo) LoadTranslations(movies []models.Movie) error {
+	args := m.Called(movies)
+	return args.Error(0)
+}
+
 type mockKafkaProducer struct {
 	Producer mock.Mock
 	Topic    *string
 }
 
-func (m *mockKafkaProducer) SendMovieEvent(movieBytes []byte) error {
-	args := m.Producer.Called(movieBytes)
+func (m *mockKafkaProducer) SendMovieEvent(msg producer.Message) error {
+	args := m.Producer.Called(msg)
 	return args.Error(0)
 }
 
+func (m *mockKafkaProducer) SendMovieEvents(msgs []producer.Message) error {
+	args := m.Producer.Called(msgs)
+	return args.Error(0)
+}
+
+// assertSentEvent checks that want is the only event sent, or that none was when want is nil
+func assertSentEvent(t *testing.T, m *mockKafkaProducer, want *events.MovieEvent) {
+	t.Helper()
+	defer func() { m.Producer.Calls = nil }()
+
+	if want == nil {
+		assert.Empty(t, m.Producer.Calls)
+		return
+	}
+	if !assert.Len(t, m.Producer.Calls, 1) {
+		return
+	}
+
+	msg := m.Producer.Calls[0].Arguments.Get(0).(producer.Message)
+	got := &events.MovieEvent{}
+	assert.NoError(t, encoder.Decode(msg.Value, msg.Headers, got))
+	assert.True(t, proto.Equal(want, got), "want %v\ngot  %v", want, got)
+}
+
 func TestGetMovies(t *testing.T) {
 	mockRepository := new(mockRepo)
 	service := Service{Repository: mockRepository}
@@ -189,6 +301,37 @@ func TestGetMovieById(t *testing.T) {
 	}
 }
 
+type decoratorFunc func(movie *models.Movie) error
+
+func (f decoratorFunc) Decorate(movie *models.Movie) error {
+	return f(movie)
+}
+
+func TestGetMovieByIdDecorators(t *testing.T) {
+	mockRepository := new(mockRepo)
+	rated := decoratorFunc(func(movie *models.Movie) error {
+		movie.Rating = &models.Rating{Average: 8.5, Count: 2}
+		return nil
+	})
+	failing := decoratorFunc(func(movie *models.Movie) error {
+		return errors.New("storage is down")
+	})
+	service := Service{Repository: mockRepository, Decorators: []MovieDecorator{failing, rated}}
+
+	call := mockRepository.On("GetMovieById", int64(1)).Return(&models.Movie{ID: 1, Title: "Jaws"}, nil)
+	defer call.Unset()
+
+	movie, err := service.GetMovieById(1)
+	assert.NoError(t, err, "a failing decorator doesn't fail the movie")
+	assert.Equal(t, &models.Movie{ID: 1, Title: "Jaws", Rating: &models.Rating{Average: 8.5, Count: 2}}, movie)
+}
+
+type failingSerializer struct{}
+
+func (f failingSerializer) Serialize(msg proto.Message) ([]byte, error) {
+	return nil, errors.New("schema not registered")
+}
+
 func TestCreateMovie(t *testing.T) {
 	mockRepository := new(mockRepo)
 	mockKafkaProducer := new(mockKafkaProducer)
@@ -198,7 +341,9 @@ func TestCreateMovie(t *testing.T) {
 	testCases := []struct {
 		name      string
 		mockSetup func(movie *models.Movie) []*mock.Call
+		encoder   encoder.EventEncoder
 		req       models.Movie
+		wantIsbn  string
 		wantErr   bool
 		err       string
 	}{
@@ -235,11 +380,60 @@ func TestCreateMovie(t *testing.T) {
 			wantErr: true,
 			err:     "error when creating movie failed",
 		},
+		{
+			// the movie is saved, a retry would only get a conflict
+			name: "Should return the movie when its event can't be encoded",
+			mockSetup: func(movie *models.Movie) []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("CreateMovie", mock.Anything).Return(movie, nil),
+				}
+			},
+			encoder: &encoder.ProtobufEncoder{Serializer: failingSerializer{}},
+			req: models.Movie{
+				ID:       123,
+				Isbn:     "9788401490040",
+				Title:    "Jaws",
+				Director: "Steven Spielberg",
+			},
+			wantErr: false,
+			err:     "",
+		},
+		{
+			name: "Should store the ISBN-13 of a hyphenated ISBN-10",
+			mockSetup: func(movie *models.Movie) []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("CreateMovie", mock.Anything).Return(movie, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvent", mock.Anything).Return(nil),
+				}
+			},
+			req: models.Movie{
+				Isbn:     "0-553-41802-5",
+				Title:    "The Martian",
+				Director: "Ridley Scott",
+			},
+			wantIsbn: "9780553418026",
+			wantErr:  false,
+			err:      "",
+		},
+		{
+			name: "Should reject an invalid isbn",
+			mockSetup: func(movie *models.Movie) []*mock.Call {
+				return nil
+			},
+			req: models.Movie{
+				Isbn:     "9780553418027",
+				Title:    "The Martian",
+				Director: "Ridley Scott",
+			},
+			wantErr: true,
+			err:     "invalid isbn 9780553418027",
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			calls := tc.mockSetup(&tc.req)
+			service.Encoder = tc.encoder
 
 			resp, err := service.CreateMovie(&tc.req)
 			if tc.wantErr {
@@ -249,6 +443,9 @@ func TestCreateMovie(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, resp)
 			}
+			if tc.wantIsbn != "" {
+				assert.Equal(t, tc.wantIsbn, mockRepository.Calls[len(mockRepository.Calls)-1].Arguments.Get(0).(*models.Movie).Isbn)
+			}
 
 			for _, call := range calls {
 				call.Unset()
@@ -259,7 +456,12 @@ func TestCreateMovie(t *testing.T) {
 
 func TestUpdateMovie(t *testing.T) {
 	mockRepository := new(mockRepo)
-	service := Service{Repository: mockRepository}
+	mockKafkaProducer := new(mockKafkaProducer)
+	service := Service{Tenant: "default", Repository: mockRepository, KafkaProducer: mockKafkaProducer}
+
+	// the update left the external ids of the movie as they were, its event has them
+	saved := &models.Movie{ID: 456, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"}}
 
 	testCases := []struct {
 		name      string
@@ -268,14 +470,17 @@ func TestUpdateMovie(t *testing.T) {
 			id    int64
 			movie models.Movie
 		}
-		wantErr bool
-		err     string
+		wantEvent *events.MovieEvent
+		wantErr   bool
+		err       string
 	}{
 		{
 			name: "Should update movie",
 			mockSetup: func(id int64, movie *models.Movie) []*mock.Call {
 				return []*mock.Call{
 					mockRepository.On("UpdateMovie", mock.Anything, mock.Anything).Return(movie, nil),
+					mockRepository.On("GetMovieById", int64(456)).Return(saved, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvent", mock.Anything).Return(nil),
 				}
 			},
 			args: struct {
@@ -290,6 +495,8 @@ func TestUpdateMovie(t *testing.T) {
 					Director: "Steven Spielberg",
 				},
 			},
+			wantEvent: &events.MovieEvent{Id: 456, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg",
+				ExternalIds: map[string]string{models.SourceIMDb: "tt0073195"}, TenantId: "default", Change: "updated"},
 			wantErr: false,
 			err:     "",
 		},
@@ -329,6 +536,7 @@ func TestUpdateMovie(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, resp)
 			}
+			assertSentEvent(t, mockKafkaProducer, tc.wantEvent)
 
 			for _, call := range calls {
 				call.Unset()
@@ -339,7 +547,8 @@ func TestUpdateMovie(t *testing.T) {
 
 func TestDeleteMovie(t *testing.T) {
 	mockRepository := new(mockRepo)
-	service := Service{Repository: mockRepository}
+	mockKafkaProducer := new(mockKafkaProducer)
+	service := Service{Tenant: "default", Repository: mockRepository, KafkaProducer: mockKafkaProducer}
 
 	testCases := []struct {
 		name      string
@@ -347,19 +556,22 @@ func TestDeleteMovie(t *testing.T) {
 		args      struct {
 			id int64
 		}
-		wantErr bool
-		err     string
+		wantEvent *events.MovieEvent
+		wantErr   bool
+		err       string
 	}{
 		{
 			name: "Should delete movie by id",
 			mockSetup: func(id int64) []*mock.Call {
 				return []*mock.Call{
 					mockRepository.On("DeleteMovie", mock.Anything).Return(nil),
+					mockKafkaProducer.Producer.On("SendMovieEvent", mock.Anything).Return(nil),
 				}
 			},
-			args:    struct{ id int64 }{id: 567},
-			wantErr: false,
-			err:     "",
+			args:      struct{ id int64 }{id: 567},
+			wantEvent: &events.MovieEvent{Id: 567, TenantId: "default", Change: "deleted"},
+			wantErr:   false,
+			err:       "",
 		},
 		{
 			name: "Should return an error when deleting by id",
@@ -384,6 +596,97 @@ func TestDeleteMovie(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
+			assertSentEvent(t, mockKafkaProducer, tc.wantEvent)
+
+			for _, call := range calls {
+				call.Unset()
+			}
+		})
+	}
+}
+
+func TestBatchMovies(t *testing.T) {
+	mockRepository := new(mockRepo)
+	mockKafkaProducer := new(mockKafkaProducer)
+
+	service := Service{Repository: mockRepository, KafkaProducer: mockKafkaProducer}
+	ops := []models.BatchOperation{
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}},
+		{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780553418026", Title: "The Martian", Director: "Ridley Scott"}},
+		{Op: models.BatchDelete, ID: 99},
+	}
+
+	testCases := []struct {
+		name       string
+		mockSetup  func() []*mock.Call
+		atomic     bool
+		wantEvents []int
+		wantErr    bool
+		err        string
+	}{
+		{
+			name: "Should send the events of the created movies in one batch",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("BatchMovies", ops, false).Return([]models.BatchResult{
+						{Index: 0, Op: models.BatchCreate, Status: models.BatchCreated, Movie: &models.Movie{ID: 1, Title: "Jaws"}},
+						{Index: 1, Op: models.BatchCreate, Status: models.BatchCreated, Movie: &models.Movie{ID: 2, Title: "The Martian"}},
+						{Index: 2, Op: models.BatchDelete, Status: models.BatchNotFound, Error: "no such movie"},
+					}, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvents", mock.Anything).Return(nil),
+				}
+			},
+			wantEvents: []int{2},
+		},
+		{
+			name: "Should send the events of the deleted movies",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("BatchMovies", ops, false).Return([]models.BatchResult{
+						{Index: 0, Op: models.BatchCreate, Status: models.BatchCreated, Movie: &models.Movie{ID: 1, Title: "Jaws"}},
+						{Index: 1, Op: models.BatchCreate, Status: models.BatchConflict, Error: "duplicate isbn"},
+						{Index: 2, Op: models.BatchDelete, Status: models.BatchDeleted, Movie: &models.Movie{ID: 99}},
+					}, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvents", mock.Anything).Return(nil),
+				}
+			},
+			wantEvents: []int{2},
+		},
+		{
+			name: "Should not send events when an atomic batch is aborted",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("BatchMovies", ops, true).Return([]models.BatchResult{
+						{Index: 0, Op: models.BatchCreate, Status: models.BatchAborted},
+						{Index: 1, Op: models.BatchCreate, Status: models.BatchAborted},
+						{Index: 2, Op: models.BatchDelete, Status: models.BatchNotFound, Error: "no such movie"},
+					}, repository.ErrBatchAborted),
+				}
+			},
+			atomic:  true,
+			wantErr: true,
+			err:     "batch aborted",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := tc.mockSetup()
+
+			resp, err := service.BatchMovies(ops, tc.atomic)
+			assert.Len(t, resp, len(ops))
+			if tc.wantErr {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var sent []int
+			for _, call := range mockKafkaProducer.Producer.Calls {
+				sent = append(sent, len(call.Arguments.Get(0).([]producer.Message)))
+			}
+			assert.Equal(t, tc.wantEvents, sent)
+			mockKafkaProducer.Producer.Calls = nil
 
 			for _, call := range calls {
 				call.Unset()
@@ -391,3 +694,247 @@ func TestDeleteMovie(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchMoviesWithInvalidIsbns(t *testing.T) {
+	mockRepository := new(mockRepo)
+	mockKafkaProducer := new(mockKafkaProducer)
+
+	service := Service{Repository: mockRepository, KafkaProducer: mockKafkaProducer}
+	ops := func() []models.BatchOperation {
+		return []models.BatchOperation{
+			{Op: models.BatchCreate, Movie: &models.Movie{Isbn: "9780553418027", Title: "The Martian", Director: "Ridley Scott"}},
+			{Op: models.BatchUpdate, ID: 1, Movie: &models.Movie{Isbn: "978-84-01-49004-0", Title: "Jaws", Director: "Steven Spielberg"}},
+		}
+	}
+
+	t.Run("Should run the operations with a valid isbn on their own", func(t *testing.T) {
+		call := mockRepository.On("BatchMovies", []models.BatchOperation{
+			{Op: models.BatchUpdate, ID: 1, Movie: &models.Movie{Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}},
+		}, false).Return([]models.BatchResult{
+			{Index: 0, Op: models.BatchUpdate, Status: models.BatchUpdated, Movie: &models.Movie{ID: 1, Isbn: "9788401490040"}},
+		}, nil)
+		defer call.Unset()
+		saved := mockRepository.On("GetMovieById", int64(1)).Return(&models.Movie{ID: 1, Isbn: "9788401490040"}, nil)
+		defer saved.Unset()
+		sent := mockKafkaProducer.Producer.On("SendMovieEvents", mock.Anything).Return(nil)
+		defer sent.Unset()
+
+		results, err := service.BatchMovies(ops(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.BatchResult{
+			{Index: 0, Op: models.BatchCreate, Status: models.BatchInvalid, Error: "invalid isbn 9780553418027"},
+			{Index: 1, Op: models.BatchUpdate, Status: models.BatchUpdated, Movie: &models.Movie{ID: 1, Isbn: "9788401490040"}},
+		}, results)
+	})
+
+	t.Run("Should abort an atomic batch without running it", func(t *testing.T) {
+		results, err := service.BatchMovies(ops(), true)
+		assert.ErrorIs(t, err, repository.ErrBatchAborted)
+		assert.Equal(t, []models.BatchResult{
+			{Index: 0, Op: models.BatchCreate, Status: models.BatchInvalid, Error: "invalid isbn 9780553418027"},
+			{Index: 1, Op: models.BatchUpdate, Status: models.BatchAborted},
+		}, results)
+		mockRepository.AssertNotCalled(t, "BatchMovies", mock.Anything, true)
+	})
+}
+
+func TestUpsertMovieByIsbn(t *testing.T) {
+	mockRepository := new(mockRepo)
+	mockKafkaProducer := new(mockKafkaProducer)
+
+	service := Service{Repository: mockRepository, KafkaProducer: mockKafkaProducer}
+	movie := &models.Movie{ID: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}
+
+	testCases := []struct {
+		name        string
+		mockSetup   func() []*mock.Call
+		wantCreated bool
+		wantEvents  int
+		wantErr     bool
+		err         string
+	}{
+		{
+			name: "Should send an event when the movie is created",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("UpsertMovieByIsbn", movie).Return(movie, true, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvent", mock.Anything).Return(nil),
+				}
+			},
+			wantCreated: true,
+			wantEvents:  1,
+		},
+		{
+			name: "Should send an event when the movie is replaced",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("UpsertMovieByIsbn", movie).Return(movie, false, nil),
+					mockRepository.On("GetMovieById", int64(1)).Return(movie, nil),
+					mockKafkaProducer.Producer.On("SendMovieEvent", mock.Anything).Return(nil),
+				}
+			},
+			wantEvents: 1,
+		},
+		{
+			name: "Should return an error when upserting the movie",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("UpsertMovieByIsbn", movie).Return(nil, false, errors.New("failed")),
+				}
+			},
+			wantErr: true,
+			err:     "failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := tc.mockSetup()
+
+			resp, created, err := service.UpsertMovieByIsbn(movie)
+			if tc.wantErr {
+				assert.Nil(t, resp)
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, movie, resp)
+			}
+			assert.Equal(t, tc.wantCreated, created)
+			assert.Len(t, mockKafkaProducer.Producer.Calls, tc.wantEvents)
+			mockKafkaProducer.Producer.Calls = nil
+
+			for _, call := range calls {
+				call.Unset()
+			}
+		})
+	}
+}
+
+func TestGetMovieByIsbn(t *testing.T) {
+	mockRepository := new(mockRepo)
+	service := Service{Repository: mockRepository}
+	movie := models.Movie{ID: 1, Isbn: "9780553418026", Title: "The Martian", Director: "Ridley Scott"}
+	notFound := fmt.Errorf("getMovieByIsbn: %w", repository.ErrMovieNotFound)
+
+	testCases := []struct {
+		name      string
+		isbn      string
+		mockSetup func() []*mock.Call
+		wantErr   bool
+		err       string
+	}{
+		{
+			name: "Should find a movie by a hyphenated isbn",
+			isbn: "978-0-553-41802-6",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("GetMovieByIsbn", "9780553418026").Return(&movie, nil),
+				}
+			},
+		},
+		{
+			name: "Should find a movie stored with its ISBN-10",
+			isbn: "0553418025",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("GetMovieByIsbn", "9780553418026").Return(nil, notFound),
+					mockRepository.On("GetMovieByIsbn", "0553418025").Return(&movie, nil),
+				}
+			},
+		},
+		{
+			name: "Should return not found when neither isbn is found",
+			isbn: "9780553418026",
+			mockSetup: func() []*mock.Call {
+				return []*mock.Call{
+					mockRepository.On("GetMovieByIsbn", mock.Anything).Return(nil, notFound),
+				}
+			},
+			wantErr: true,
+			err:     "getMovieByIsbn: no such movie",
+		},
+		{
+			name:      "Should reject an invalid isbn",
+			isbn:      "9780553418027",
+			mockSetup: func() []*mock.Call { return nil },
+			wantErr:   true,
+			err:       "invalid isbn 9780553418027",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := tc.mockSetup()
+
+			resp, err := service.GetMovieByIsbn(tc.isbn)
+			if tc.wantErr {
+				assert.Nil(t, resp)
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, &movie, resp)
+			}
+
+			for _, call := range calls {
+				call.Unset()
+			}
+		})
+	}
+}
+
+func TestTenantEvents(t *testing.T) {
+	mockRepository := new(mockRepo)
+	mockKafkaProducer := new(mockKafkaProducer)
+	broadcaster := changes.Broadcaster{}
+	service := Service{Tenant: "studio-a", Repository: mockRepository, KafkaProducer: mockKafkaProducer, Broadcaster: &broadcaster}
+
+	own, unsubscribe := broadcaster.Subscribe("studio-a")
+	defer unsubscribe()
+	other, unsubscribeOther := broadcaster.Subscribe("studio-b")
+	defer unsubscribeOther()
+
+	movie := models.Movie{ID: 123, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}
+	mockRepository.On("CreateMovie", mock.Anything).Return(&movie, nil)
+	mockKafkaProducer.Producer.On("SendMovieEvent", mock.MatchedBy(func(msg producer.Message) bool {
+		return string(msg.Key) == "studio-a/123" && msg.Headers[encoder.TenantHeader] == "studio-a"
+	})).Return(nil)
+
+	_, err := service.CreateMovie(&movie)
+	assert.NoError(t, err)
+	mockKafkaProducer.Producer.AssertExpectations(t)
+
+	change := <-own
+	assert.Equal(t, "studio-a", change.Tenant)
+	assert.Len(t, other, 0)
+}
+
+func TestSaveTranslation(t *testing.T) {
+	mockRepository := new(mockRepo)
+	mockKafkaProducer := new(mockKafkaProducer)
+	service := Service{Repository: mockRepository, KafkaProducer: mockKafkaProducer}
+
+	translated := models.Movie{ID: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg", Translations: []models.Translation{
+		{Language: "es", Title: "Tiburón"},
+		{Language: "pt-BR", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."},
+	}}
+
+	mockRepository.On("SaveTranslation", int64(1), &models.Translation{Language: "pt-BR", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."}).Return(true, nil)
+	mockRepository.On("GetMovieById", int64(1)).Return(&translated, nil)
+	mockKafkaProducer.Producer.On("SendMovieEvent", mock.MatchedBy(func(msg producer.Message) bool {
+		var event events.MovieEvent
+		if err := proto.Unmarshal(msg.Value, &event); err != nil {
+			return false
+		}
+		return len(event.Translations) == 2 && event.Translations["pt-BR"].Title == "Tubarão" && event.Translations["es"].Title == "Tiburón"
+	})).Return(nil)
+
+	created, err := service.SaveTranslation(1, &models.Translation{Language: "pt-br", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."})
+	assert.NoError(t, err)
+	assert.True(t, created)
+	mockRepository.AssertExpectations(t)
+	mockKafkaProducer.Producer.AssertExpectations(t)
+
+	_, err = service.SaveTranslation(1, &models.Translation{Language: "not a language", Title: "Tubarão"})
+	assert.ErrorIs(t, err, models.ErrInvalidLanguage)
+	mockRepository.AssertNumberOfCalls(t, "SaveTranslation", 1)
+}
@@ -0,0 +1,30 @@
+-- The movies tables of movies.ddl for sqlite, created when the database is opened.
+CREATE TABLE IF NOT EXISTS movies (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id       TEXT NOT NULL,
+    isbn            TEXT NOT NULL,
+    title           TEXT NOT NULL,
+    director        TEXT NOT NULL,
+    UNIQUE (tenant_id, isbn),
+    UNIQUE (tenant_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS external_ids (
+    tenant_id       TEXT NOT NULL,
+    movie_id        INTEGER NOT NULL,
+    source          TEXT NOT NULL,
+    external_id     TEXT NOT NULL,
+    PRIMARY KEY (movie_id, source),
+    UNIQUE (tenant_id, source, external_id),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS movie_translations (
+    tenant_id       TEXT NOT NULL,
+    movie_id        INTEGER NOT NULL,
+    language        TEXT NOT NULL,
+    title           TEXT NOT NULL,
+    synopsis        TEXT NOT NULL,
+    PRIMARY KEY (movie_id, language),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+);
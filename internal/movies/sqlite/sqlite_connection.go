@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed schema.sql
+var schema string
+
+// GetSQLiteDB opens the database of the file at path, creating the file and the movies tables when they don't exist.
+func GetSQLiteDB(path string) (*sql.DB, error) {
+	// foreign keys are off unless asked for, and transactions take the write lock when they begin,
+	// so two of them can't read the same row before updating it
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_txlock=immediate&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %v", path, err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create sqlite tables: %v", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,148 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultClaim is the claim of the bearer token holding the tenant
+const DefaultClaim = "tenant_id"
+
+var (
+	ErrMissingToken   = errors.New("a bearer token is required")
+	ErrInvalidToken   = errors.New("invalid bearer token")
+	ErrTenantMismatch = errors.New("X-Tenant-ID doesn't match the tenant of the token")
+)
+
+// Resolver finds the tenant of a request. When Secret is set the tenant comes from a claim
+// of the HS256 bearer token, which every request must have. Otherwise a gateway is trusted
+// to set the X-Tenant-ID header, and requests without it belong to the Default tenant,
+// or are rejected when there is none.
+type Resolver struct {
+	Secret  []byte
+	Claim   string
+	Default string
+	// Now is used to check the expiry of the tokens, time.Now when nil
+	Now func() time.Time
+}
+
+// Resolve returns the tenant given the Authorization and X-Tenant-ID headers of a request.
+func (r *Resolver) Resolve(authorization string, header string) (string, error) {
+	id := header
+	if len(r.Secret) > 0 {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok {
+			return "", ErrMissingToken
+		}
+
+		claim, err := r.verify(token)
+		if err != nil {
+			return "", err
+		}
+		if header != "" && header != claim {
+			return "", ErrTenantMismatch
+		}
+		id = claim
+	}
+
+	if id == "" {
+		id = r.Default
+	}
+	if id == "" {
+		return "", ErrMissingTenant
+	}
+	if err := Validate(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Middleware resolves the tenant of every request, which handlers read with FromContext.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := r.Resolve(req.Header.Get("Authorization"), req.Header.Get(Header))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(Status(err))
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), id)))
+	})
+}
+
+// Status is the http status of a resolution error
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrMissingToken), errors.Is(err, ErrInvalidToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrTenantMismatch):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// verify checks the signature and expiry of a jwt, returning its tenant claim
+func (r *Resolver) verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, r.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", ErrInvalidToken
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", ErrInvalidToken
+	}
+	if exp, ok := claims["exp"].(float64); ok && r.now().Unix() >= int64(exp) {
+		return "", ErrInvalidToken
+	}
+
+	claim := r.Claim
+	if claim == "" {
+		claim = DefaultClaim
+	}
+	id, _ := claims[claim].(string)
+	if id == "" {
+		return "", ErrInvalidToken
+	}
+	return id, nil
+}
+
+func (r *Resolver) now() time.Time {
+	if r.Now == nil {
+		return time.Now()
+	}
+	return r.Now()
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
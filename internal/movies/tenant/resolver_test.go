@@ -0,0 +1,134 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func sign(secret string, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ := json.Marshal(claims)
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestResolve(t *testing.T) {
+	valid := sign("secret", map[string]interface{}{"tenant_id": "studio-a", "exp": now.Add(time.Hour).Unix()})
+
+	testCases := []struct {
+		name          string
+		resolver      Resolver
+		authorization string
+		header        string
+		want          string
+		wantErr       error
+	}{
+		{
+			name:     "Should take the tenant from the header",
+			resolver: Resolver{Default: Default},
+			header:   "studio-a",
+			want:     "studio-a",
+		},
+		{
+			name:     "Should fall back to the default tenant",
+			resolver: Resolver{Default: Default},
+			want:     Default,
+		},
+		{
+			name:    "Should require a tenant without a default one",
+			wantErr: ErrMissingTenant,
+		},
+		{
+			name:     "Should reject invalid tenants",
+			resolver: Resolver{Default: Default},
+			header:   "../studio-a",
+			wantErr:  ErrInvalidTenant,
+		},
+		{
+			name:          "Should take the tenant from the token",
+			resolver:      Resolver{Secret: []byte("secret"), Default: Default},
+			authorization: "Bearer " + valid,
+			want:          "studio-a",
+		},
+		{
+			name:          "Should accept a header matching the token",
+			resolver:      Resolver{Secret: []byte("secret")},
+			authorization: "Bearer " + valid,
+			header:        "studio-a",
+			want:          "studio-a",
+		},
+		{
+			name:          "Should not let the header pick another tenant than the token",
+			resolver:      Resolver{Secret: []byte("secret")},
+			authorization: "Bearer " + valid,
+			header:        "studio-b",
+			wantErr:       ErrTenantMismatch,
+		},
+		{
+			name:     "Should require a token when tokens are verified",
+			resolver: Resolver{Secret: []byte("secret"), Default: Default},
+			header:   "studio-a",
+			wantErr:  ErrMissingToken,
+		},
+		{
+			name:          "Should reject tokens signed with another secret",
+			resolver:      Resolver{Secret: []byte("secret")},
+			authorization: "Bearer " + sign("other", map[string]interface{}{"tenant_id": "studio-a"}),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name:          "Should reject expired tokens",
+			resolver:      Resolver{Secret: []byte("secret")},
+			authorization: "Bearer " + sign("secret", map[string]interface{}{"tenant_id": "studio-a", "exp": now.Unix()}),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name:          "Should reject tokens without the claim",
+			resolver:      Resolver{Secret: []byte("secret"), Claim: "org"},
+			authorization: "Bearer " + valid,
+			wantErr:       ErrInvalidToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.resolver.Now = func() time.Time { return now }
+
+			id, err := tc.resolver.Resolve(tc.authorization, tc.header)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, id)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	resolver := Resolver{}
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromContext(r.Context())))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/movies", nil)
+	req.Header.Set(Header, "studio-a")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "studio-a", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "the request has no tenant"}`, rec.Body.String())
+}
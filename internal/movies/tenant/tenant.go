@@ -0,0 +1,42 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+const (
+	// Header names the tenant of a request when it isn't taken from a token
+	Header = "X-Tenant-ID"
+	// Default is the tenant of the movies created before catalogues were split by tenant
+	Default = "default"
+
+	maxLength = 64
+)
+
+var (
+	ErrMissingTenant = errors.New("the request has no tenant")
+	ErrInvalidTenant = errors.New("tenant must be 1 to 64 lowercase letters, digits, - or _")
+)
+
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func Validate(id string) error {
+	if len(id) > maxLength || !validTenant.MatchString(id) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant the middleware resolved, empty when there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
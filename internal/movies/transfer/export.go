@@ -0,0 +1,66 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// flushEvery is how many movies are written before flushing, so exports start streaming right away
+const flushEvery = 500
+
+type flusher interface {
+	Flush()
+}
+
+// Export streams every movie into the writer as it is read from the database.
+func Export(w io.Writer, format string, svc service.MoviesService) (int, error) {
+	count := 0
+	flush := func() {
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+	}
+
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"id", "isbn", "title", "director"})
+
+		err := svc.StreamMovies(func(m models.Movie) error {
+			count++
+			if err := writer.Write([]string{strconv.FormatInt(m.ID, 10), m.Isbn, m.Title, m.Director}); err != nil {
+				return err
+			}
+			if count%flushEvery == 0 {
+				writer.Flush()
+				flush()
+			}
+			return writer.Error()
+		})
+
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+		return count, err
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+
+		err := svc.StreamMovies(func(m models.Movie) error {
+			count++
+			if count%flushEvery == 0 {
+				flush()
+			}
+			return encoder.Encode(m)
+		})
+		return count, err
+	}
+
+	return 0, fmt.Errorf("unknown export format %s", format)
+}
@@ -0,0 +1,320 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+const (
+	// chunkSize is how many rows are written with a single batch
+	chunkSize = 500
+	// maxRowErrors caps the errors kept in the report, the failed count keeps going
+	maxRowErrors = 1000
+)
+
+type ImportOptions struct {
+	Format string
+	// DryRun validates the rows and reports what would happen without writing anything
+	DryRun bool
+	// Upsert updates the movie with the same isbn instead of creating a new one
+	Upsert bool
+	// Resume skips the rows already counted in a previous report and keeps adding to it
+	Resume *ImportReport
+}
+
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun  bool       `json:"dry_run"`
+	Rows    int        `json:"rows"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors"`
+}
+
+func (r *ImportReport) fail(row int, err string) {
+	r.Failed++
+	if len(r.Errors) < maxRowErrors {
+		r.Errors = append(r.Errors, RowError{Row: row, Error: err})
+	}
+}
+
+type row struct {
+	number int
+	movie  models.Movie
+}
+
+// rowReader returns io.EOF once there are no more rows,
+// a row with an error is reported and the import moves on to the next one.
+type rowReader func() (row, error)
+
+// Import streams the movies in the reader into the catalogue in chunks,
+// so files of any size can be imported without holding them in memory.
+// Progress, when not nil, is called after every written chunk with the report so far,
+// the import stops when it returns an error.
+func Import(r io.Reader, opts ImportOptions, svc service.MoviesService, progress func(report *ImportReport) error) (*ImportReport, error) {
+	next, err := getRowReader(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Errors: []RowError{}}
+	skip := 0
+	if opts.Resume != nil {
+		report = opts.Resume
+		skip = report.Rows
+	}
+	chunk := make([]row, 0, chunkSize)
+	isbns := map[string]bool{}
+
+	for read := 0; ; read++ {
+		rw, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *rowError
+		if err != nil && !errors.As(err, &parseErr) {
+			return report, err
+		}
+		if read < skip {
+			continue
+		}
+
+		if parseErr != nil {
+			report.Rows++
+			report.fail(parseErr.row, parseErr.err.Error())
+			continue
+		}
+
+		report.Rows++
+		if err := rw.movie.Validate(); err != nil {
+			report.fail(rw.number, err.Error())
+			continue
+		}
+		// the isbns are normalized before the chunk is looked up, so a movie is found by any form of its isbn
+		isbn, err := models.NormalizeIsbn(rw.movie.Isbn)
+		if err != nil {
+			report.fail(rw.number, fmt.Sprintf("%v %s", err, rw.movie.Isbn))
+			continue
+		}
+		rw.movie.Isbn = isbn
+
+		// a chunk is looked up before it is written, so a repeated isbn has to wait for the next one
+		if opts.Upsert && isbns[rw.movie.Isbn] {
+			if err := importChunk(chunk, opts, svc, report); err != nil {
+				return report, err
+			}
+			chunk, isbns = chunk[:0], map[string]bool{}
+		}
+
+		chunk = append(chunk, rw)
+		isbns[rw.movie.Isbn] = true
+
+		if len(chunk) == chunkSize {
+			if err := importChunk(chunk, opts, svc, report); err != nil {
+				return report, err
+			}
+			chunk, isbns = chunk[:0], map[string]bool{}
+
+			if progress != nil {
+				if err := progress(report); err != nil {
+					return report, err
+				}
+			}
+		}
+	}
+
+	if err := importChunk(chunk, opts, svc, report); err != nil {
+		return report, err
+	}
+	if progress != nil {
+		if err := progress(report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func importChunk(chunk []row, opts ImportOptions, svc service.MoviesService, report *ImportReport) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	existing := map[string]int64{}
+	if opts.Upsert {
+		isbns := make([]string, len(chunk))
+		for i, rw := range chunk {
+			isbns[i] = rw.movie.Isbn
+		}
+
+		movies, err := svc.GetMoviesByIsbn(isbns)
+		if err != nil {
+			return fmt.Errorf("error looking up movies by isbn %v", err)
+		}
+		for _, m := range movies {
+			existing[m.Isbn] = m.ID
+		}
+	}
+
+	ops := make([]models.BatchOperation, len(chunk))
+	for i := range chunk {
+		movie := chunk[i].movie
+		if id, ok := existing[movie.Isbn]; ok {
+			ops[i] = models.BatchOperation{Op: models.BatchUpdate, ID: id, Movie: &movie}
+		} else {
+			ops[i] = models.BatchOperation{Op: models.BatchCreate, Movie: &movie}
+		}
+	}
+
+	if opts.DryRun {
+		for _, op := range ops {
+			if op.Op == models.BatchUpdate {
+				report.Updated++
+			} else {
+				report.Created++
+			}
+		}
+		return nil
+	}
+
+	results, err := svc.BatchMovies(ops, false)
+	if err != nil {
+		return fmt.Errorf("error importing movies %v", err)
+	}
+
+	for i, result := range results {
+		switch result.Status {
+		case models.BatchCreated:
+			report.Created++
+		case models.BatchUpdated:
+			report.Updated++
+		default:
+			report.fail(chunk[i].number, result.Error)
+		}
+	}
+
+	return nil
+}
+
+type rowError struct {
+	row int
+	err error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.row, e.err)
+}
+
+func getRowReader(r io.Reader, format string) (rowReader, error) {
+	switch format {
+	case CSV:
+		return csvRowReader(r)
+	case NDJSON:
+		return ndjsonRowReader(r), nil
+	}
+	return nil, fmt.Errorf("unknown import format %s", format)
+}
+
+// csvRowReader expects a header with the isbn, title and director columns, in any order.
+// Rows are numbered by their line in the file.
+func csvRowReader(r io.Reader) (rowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return func() (row, error) { return row{}, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading csv header %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"isbn", "title", "director"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	return func() (row, error) {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return row{}, io.EOF
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return row{}, &rowError{row: parseErr.StartLine, err: parseErr.Err}
+			}
+			return row{}, err
+		}
+
+		// the position is only known for a record that was read
+		line, _ := reader.FieldPos(0)
+		return row{number: line, movie: models.Movie{
+			Isbn:     field(record, "isbn"),
+			Title:    field(record, "title"),
+			Director: field(record, "director"),
+		}}, nil
+	}, nil
+}
+
+// ndjsonRowReader reads one json movie per line, blank lines are skipped.
+func ndjsonRowReader(r io.Reader) rowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	return func() (row, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var movie models.Movie
+			if err := json.Unmarshal([]byte(text), &movie); err != nil {
+				return row{}, &rowError{row: line, err: fmt.Errorf("invalid json: %v", err)}
+			}
+			movie.ID = 0
+			return row{number: line, movie: movie}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return row{}, fmt.Errorf("error reading ndjson %v", err)
+		}
+		return row{}, io.EOF
+	}
+}
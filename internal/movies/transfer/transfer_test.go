@@ -0,0 +1,193 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeService keeps the movies in a slice, only the methods used by import and export are implemented
+type fakeService struct {
+	service.MoviesService
+	movies  []models.Movie
+	batches int
+}
+
+func (f *fakeService) GetMoviesByIsbn(isbns []string) ([]models.Movie, error) {
+	var found []models.Movie
+	for _, m := range f.movies {
+		for _, isbn := range isbns {
+			if m.Isbn == isbn {
+				found = append(found, m)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeService) BatchMovies(ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	f.batches++
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		movie := *op.Movie
+		if op.Op == models.BatchCreate {
+			movie.ID = int64(len(f.movies) + 1)
+			f.movies = append(f.movies, movie)
+			results[i] = models.BatchResult{Index: i, Op: op.Op, Status: models.BatchCreated, Movie: &movie}
+			continue
+		}
+
+		movie.ID = op.ID
+		f.movies[op.ID-1] = movie
+		results[i] = models.BatchResult{Index: i, Op: op.Op, Status: models.BatchUpdated, Movie: &movie}
+	}
+	return results, nil
+}
+
+func (f *fakeService) StreamMovies(fn func(movie models.Movie) error) error {
+	for _, m := range f.movies {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestImport(t *testing.T) {
+	existing := []models.Movie{{ID: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Spielberg"}}
+
+	testCases := []struct {
+		name       string
+		body       string
+		opts       ImportOptions
+		wantReport ImportReport
+		wantMovies int
+	}{
+		{
+			name: "Should import csv rows and report the invalid ones",
+			body: "title,isbn,director\n" +
+				"The Martian,9780553418026,Ridley Scott\n" +
+				",9780553418027,Nobody\n" +
+				"Alien,9780000000002,Ridley Scott\n",
+			opts:       ImportOptions{Format: CSV},
+			wantReport: ImportReport{Rows: 3, Created: 2, Failed: 1, Errors: []RowError{{Row: 3, Error: "title is required"}}},
+			wantMovies: 3,
+		},
+		{
+			name: "Should report malformed csv rows",
+			body: "isbn,title,director\n" +
+				"9780553418026,The Martian,Ridley Scott\n" +
+				"\"abc\n",
+			opts:       ImportOptions{Format: CSV},
+			wantReport: ImportReport{Rows: 2, Created: 1, Failed: 1, Errors: []RowError{{Row: 3, Error: `extraneous or missing " in quoted-field`}}},
+			wantMovies: 2,
+		},
+		{
+			name: "Should upsert ndjson rows by isbn",
+			body: `{"isbn": "9788401490040", "title": "Jaws", "director": "Steven Spielberg"}` + "\n\n" +
+				`{"isbn": "9780553418026", "title": "The Martian", "director": "Ridley Scott"}` + "\n" +
+				`not json` + "\n",
+			opts:       ImportOptions{Format: NDJSON, Upsert: true},
+			wantReport: ImportReport{Rows: 3, Created: 1, Updated: 1, Failed: 1, Errors: []RowError{{Row: 4, Error: "invalid json: invalid character 'o' in literal null (expecting 'u')"}}},
+			wantMovies: 2,
+		},
+		{
+			name: "Should upsert rows by any form of their isbn",
+			body: "isbn,title,director\n" +
+				"978-84-01-49004-0,Jaws,Steven Spielberg\n" +
+				"0-553-41802-5,The Martian,Ridley Scott\n" +
+				"9780553418027,Alien,Ridley Scott\n",
+			opts:       ImportOptions{Format: CSV, Upsert: true},
+			wantReport: ImportReport{Rows: 3, Created: 1, Updated: 1, Failed: 1, Errors: []RowError{{Row: 4, Error: "invalid isbn 9780553418027"}}},
+			wantMovies: 2,
+		},
+		{
+			name: "Should only report what would happen on a dry run",
+			body: "isbn,title,director\n" +
+				"9788401490040,Jaws,Steven Spielberg\n" +
+				"9780553418026,The Martian,Ridley Scott\n",
+			opts:       ImportOptions{Format: CSV, Upsert: true, DryRun: true},
+			wantReport: ImportReport{DryRun: true, Rows: 2, Created: 1, Updated: 1, Errors: []RowError{}},
+			wantMovies: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &fakeService{movies: append([]models.Movie{}, existing...)}
+
+			report, err := Import(strings.NewReader(tc.body), tc.opts, svc, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantReport, *report)
+			assert.Len(t, svc.movies, tc.wantMovies)
+		})
+	}
+}
+
+func TestImportInvalidHeader(t *testing.T) {
+	_, err := Import(strings.NewReader("isbn,name\n1,2\n"), ImportOptions{Format: CSV}, &fakeService{}, nil)
+	assert.EqualError(t, err, "csv header is missing the title column")
+}
+
+func TestImportInChunks(t *testing.T) {
+	var body strings.Builder
+	body.WriteString("isbn,title,director\n")
+	for i := 0; i < chunkSize*2+1; i++ {
+		body.WriteString("9780000000002,Title,Director\n")
+	}
+
+	svc := &fakeService{}
+	progress := 0
+	report, err := Import(strings.NewReader(body.String()), ImportOptions{Format: CSV}, svc, func(r *ImportReport) error { progress++; return nil })
+
+	assert.NoError(t, err)
+	assert.Equal(t, chunkSize*2+1, report.Created)
+	assert.Equal(t, 3, svc.batches)
+	assert.Equal(t, 3, progress)
+}
+
+func TestExport(t *testing.T) {
+	svc := &fakeService{movies: []models.Movie{
+		{ID: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"},
+		{ID: 2, Isbn: "9780553418026", Title: "The Martian, extended", Director: "Ridley Scott"},
+	}}
+
+	var csvOut bytes.Buffer
+	count, err := Export(&csvOut, CSV, svc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "id,isbn,title,director\n"+
+		"1,9788401490040,Jaws,Steven Spielberg\n"+
+		"2,9780553418026,\"The Martian, extended\",Ridley Scott\n", csvOut.String())
+
+	var ndjsonOut bytes.Buffer
+	_, err = Export(&ndjsonOut, NDJSON, svc)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":1,"isbn":"9788401490040","title":"Jaws","director":"Steven Spielberg"}`+"\n"+
+		`{"id":2,"isbn":"9780553418026","title":"The Martian, extended","director":"Ridley Scott"}`+"\n", ndjsonOut.String())
+
+	// what is exported can be imported back
+	report, err := Import(&csvOut, ImportOptions{Format: CSV, Upsert: true, DryRun: true}, svc, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Updated)
+}
+
+func TestImportResume(t *testing.T) {
+	body := "isbn,title,director\n" +
+		"9788401490040,Jaws,Steven Spielberg\n" +
+		"9780553418026,The Martian,Ridley Scott\n" +
+		"9780000000002,Alien,Ridley Scott\n"
+
+	// the first row was imported before the import got interrupted
+	svc := &fakeService{movies: []models.Movie{{ID: 1, Isbn: "9788401490040", Title: "Jaws", Director: "Steven Spielberg"}}}
+	previous := &ImportReport{Rows: 1, Created: 1, Errors: []RowError{}}
+
+	report, err := Import(strings.NewReader(body), ImportOptions{Format: CSV, Resume: previous}, svc, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportReport{Rows: 3, Created: 3, Errors: []RowError{}}, *report)
+	assert.Len(t, svc.movies, 3)
+}
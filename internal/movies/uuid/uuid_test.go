@@ -0,0 +1,20 @@
+package uuid
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	v4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	first, err := New()
+	assert.NoError(t, err)
+	assert.Regexp(t, v4, first)
+
+	second, err := New()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
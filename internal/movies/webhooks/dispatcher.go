@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/uuid"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type Payload struct {
+	ID    string       `json:"id"`
+	Type  string       `json:"type"`
+	Time  time.Time    `json:"time"`
+	Movie models.Movie `json:"movie"`
+}
+
+// Dispatcher posts movie changes to the subscribed webhooks.
+// Every attempt is recorded, failed deliveries are retried with exponential backoff
+// and a webhook is disabled after DisableAfter deliveries in a row have failed.
+type Dispatcher struct {
+	Repository     WebhooksRepository
+	Client         *http.Client
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	DisableAfter   int
+}
+
+func GetDispatcher(repository WebhooksRepository) *Dispatcher {
+	return &Dispatcher{
+		Repository:     repository,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		DisableAfter:   10,
+	}
+}
+
+// Run dispatches the changes of the broadcaster until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, broadcaster *changes.Broadcaster) {
+	for {
+		ch, unsubscribe := broadcaster.Subscribe("")
+
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			case change, ok := <-ch:
+				if !ok {
+					log.Println("Webhook dispatcher fell behind, some changes were not delivered")
+					open = false
+					continue
+				}
+				d.Dispatch(change)
+			}
+		}
+	}
+}
+
+// Dispatch starts delivering the change to every active webhook of its tenant subscribed to it.
+func (d *Dispatcher) Dispatch(change changes.Change) {
+	webhooks, err := d.Repository.GetWebhooks(change.Tenant)
+	if err != nil {
+		log.Println("Error fetching webhooks", err)
+		return
+	}
+
+	// the ids of the changes start over with the process, receivers dedupe on the id of the payload
+	id, err := uuid.New()
+	if err != nil {
+		log.Println("Error dispatching change", err)
+		return
+	}
+
+	payload := Payload{
+		ID:    id,
+		Type:  "movie." + string(change.Type),
+		Time:  change.Time,
+		Movie: change.Movie,
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.Active && webhook.Subscribes(string(change.Type)) {
+			go d.Deliver(webhook, payload)
+		}
+	}
+}
+
+// Deliver posts the payload to the webhook, retrying until it succeeds or attempts run out.
+func (d *Dispatcher) Deliver(webhook models.Webhook, payload Payload) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Error encoding webhook payload", err)
+		return false
+	}
+
+	backoff := d.InitialBackoff
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		delivery := d.post(webhook, payload, body)
+		delivery.Attempt = attempt
+		if err := d.Repository.CreateDelivery(&delivery); err != nil {
+			log.Println("Error recording webhook delivery", err)
+		}
+
+		if delivery.Success {
+			if webhook.FailureCount > 0 {
+				d.setStatus(webhook.ID, true, 0)
+			}
+			return true
+		}
+	}
+
+	// re-read the webhook, other deliveries may have failed concurrently
+	current, err := d.Repository.GetWebhookById(webhook.Tenant, webhook.ID)
+	if err != nil {
+		log.Println("Error fetching webhook", err)
+		return false
+	}
+
+	failures := current.FailureCount + 1
+	active := current.Active && failures < d.DisableAfter
+	if !active && current.Active {
+		log.Printf("Disabling webhook %d after %d failed deliveries\n", webhook.ID, failures)
+	}
+	d.setStatus(webhook.ID, active, failures)
+
+	return false
+}
+
+func (d *Dispatcher) post(webhook models.Webhook, payload Payload, body []byte) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{WebhookID: webhook.ID, EventID: payload.ID, EventType: payload.Type}
+	start := time.Now()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Type)
+	req.Header.Set(DeliveryHeader, payload.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	delivery.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return delivery
+}
+
+func (d *Dispatcher) setStatus(id int64, active bool, failureCount int) {
+	if err := d.Repository.SetWebhookStatus(id, active, failureCount); err != nil {
+		log.Println("Error updating webhook status", err)
+	}
+}
+
+// Sign returns the signature receivers should compare against the X-Webhook-Signature header:
+// the hex HMAC-SHA256 of "timestamp.body" with the webhook secret. Signing the timestamp
+// lets receivers reject replayed requests.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,185 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepository struct {
+	WebhooksRepository
+
+	mu         sync.Mutex
+	webhooks   map[int64]models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (f *fakeRepository) GetWebhooks(tenant string) ([]models.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, w := range f.webhooks {
+		if w.Tenant == tenant {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (f *fakeRepository) GetWebhookById(tenant string, id int64) (*models.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w, ok := f.webhooks[id]
+	if !ok || w.Tenant != tenant {
+		return nil, fmt.Errorf("getWebhookById %d: %w", id, ErrWebhookNotFound)
+	}
+	return &w, nil
+}
+
+func (f *fakeRepository) SetWebhookStatus(id int64, active bool, failureCount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := f.webhooks[id]
+	w.Active = active
+	w.FailureCount = failureCount
+	f.webhooks[id] = w
+	return nil
+}
+
+func (f *fakeRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deliveries = append(f.deliveries, *delivery)
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	payload := Payload{ID: "1", Type: "movie.created", Movie: models.Movie{ID: 1, Title: "Jaws"}}
+
+	testCases := []struct {
+		name         string
+		statuses     []int
+		failureCount int
+		wantSuccess  bool
+		wantAttempts int
+		wantActive   bool
+		wantFailures int
+	}{
+		{
+			name:         "Should deliver on the first attempt",
+			statuses:     []int{http.StatusOK},
+			wantSuccess:  true,
+			wantAttempts: 1,
+			wantActive:   true,
+		},
+		{
+			name:         "Should retry failed attempts and reset the failure count",
+			statuses:     []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent},
+			failureCount: 3,
+			wantSuccess:  true,
+			wantAttempts: 3,
+			wantActive:   true,
+		},
+		{
+			name:         "Should count a failure after exhausting the attempts",
+			statuses:     []int{http.StatusInternalServerError},
+			wantAttempts: 3,
+			wantActive:   true,
+			wantFailures: 1,
+		},
+		{
+			name:         "Should disable the webhook after too many failures",
+			statuses:     []int{http.StatusInternalServerError},
+			failureCount: 4,
+			wantAttempts: 3,
+			wantActive:   false,
+			wantFailures: 5,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, Sign("secret", r.Header.Get(TimestampHeader), body), r.Header.Get(SignatureHeader))
+				assert.Equal(t, "movie.created", r.Header.Get(EventHeader))
+
+				status := tc.statuses[len(tc.statuses)-1]
+				if requests < len(tc.statuses) {
+					status = tc.statuses[requests]
+				}
+				requests++
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			webhook := models.Webhook{ID: 1, URL: server.URL, Secret: "secret", Active: true, FailureCount: tc.failureCount}
+			repository := &fakeRepository{webhooks: map[int64]models.Webhook{1: webhook}}
+			dispatcher := Dispatcher{Repository: repository, Client: server.Client(), MaxAttempts: 3, DisableAfter: 5}
+
+			success := dispatcher.Deliver(webhook, payload)
+
+			assert.Equal(t, tc.wantSuccess, success)
+			assert.Len(t, repository.deliveries, tc.wantAttempts)
+			assert.Equal(t, tc.wantAttempts, repository.deliveries[len(repository.deliveries)-1].Attempt)
+			assert.Equal(t, tc.wantActive, repository.webhooks[1].Active)
+			assert.Equal(t, tc.wantFailures, repository.webhooks[1].FailureCount)
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var mu sync.Mutex
+	var deliveries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, payload.ID, r.Header.Get(DeliveryHeader))
+
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, payload.ID)
+	}))
+	defer server.Close()
+
+	webhook := models.Webhook{ID: 1, Tenant: "studio-a", URL: server.URL, Secret: "secret", Active: true}
+	repository := &fakeRepository{webhooks: map[int64]models.Webhook{1: webhook}}
+	dispatcher := Dispatcher{Repository: repository, Client: server.Client(), MaxAttempts: 1, DisableAfter: 5}
+
+	// the change of a process and the one of the next process, which has the same id
+	dispatcher.Dispatch(changes.Change{ID: 1, Type: changes.Created, Movie: models.Movie{ID: 1}, Tenant: "studio-a"})
+	dispatcher.Dispatch(changes.Change{ID: 1, Type: changes.Created, Movie: models.Movie{ID: 2}, Tenant: "studio-a"})
+	// and one of another tenant
+	dispatcher.Dispatch(changes.Change{ID: 2, Type: changes.Created, Movie: models.Movie{ID: 3}, Tenant: "studio-b"})
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(deliveries) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotEqual(t, deliveries[0], deliveries[1])
+	for _, id := range deliveries {
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	}
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163", Sign("secret", "1700000000", []byte(`{}`)))
+}
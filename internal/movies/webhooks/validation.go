@@ -0,0 +1,41 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var eventTypes = map[string]bool{
+	string(changes.Created): true,
+	string(changes.Updated): true,
+	string(changes.Deleted): true,
+}
+
+func Validate(webhook *models.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+
+	for _, t := range webhook.EventTypes {
+		if !eventTypes[t] {
+			return fmt.Errorf("unknown event type %s", t)
+		}
+	}
+
+	return nil
+}
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
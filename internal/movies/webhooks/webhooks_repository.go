@@ -0,0 +1,167 @@
+package webhooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+var ErrWebhookNotFound = errors.New("no such webhook")
+
+// WebhooksRepository keeps the webhooks of every tenant, the dispatcher delivering the changes of all of them.
+// Webhooks are looked up within a tenant, their deliveries by the id of a webhook found that way.
+type WebhooksRepository interface {
+	GetWebhooks(tenant string) ([]models.Webhook, error)
+	GetWebhookById(tenant string, id int64) (*models.Webhook, error)
+	CreateWebhook(tenant string, webhook *models.Webhook) (*models.Webhook, error)
+	UpdateWebhook(tenant string, id int64, webhook *models.Webhook) (*models.Webhook, error)
+	DeleteWebhook(tenant string, id int64) error
+	SetWebhookStatus(id int64, active bool, failureCount int) error
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	GetDeliveries(webhookId int64, limit int) ([]models.WebhookDelivery, error)
+}
+
+type Repository struct {
+	DB *sql.DB
+}
+
+const webhookColumns = "id, tenant_id, url, event_types, secret, active, failure_count, created_at"
+
+func (r *Repository) GetWebhooks(tenant string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+
+	rows, err := r.DB.Query("select "+webhookColumns+" from webhooks where tenant_id = ?", tenant)
+	if err != nil {
+		return nil, fmt.Errorf("getWebhooks %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("getWebhooks %v", err)
+		}
+		webhooks = append(webhooks, *w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getWebhooks %v", err)
+	}
+
+	return webhooks, nil
+}
+
+func (r *Repository) GetWebhookById(tenant string, id int64) (*models.Webhook, error) {
+	row := r.DB.QueryRow("select "+webhookColumns+" from webhooks where id = ? and tenant_id = ?", id, tenant)
+	w, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("getWebhookById %d: %w", id, ErrWebhookNotFound)
+		}
+		return nil, fmt.Errorf("getWebhookById %d: %v", id, err)
+	}
+	return w, nil
+}
+
+func (r *Repository) CreateWebhook(tenant string, webhook *models.Webhook) (*models.Webhook, error) {
+	result, err := r.DB.Exec("insert into webhooks (tenant_id, url, event_types, secret, active) values (?, ?, ?, ?, ?)",
+		tenant, webhook.URL, strings.Join(webhook.EventTypes, ","), webhook.Secret, webhook.Active)
+	if err != nil {
+		return nil, fmt.Errorf("add webhook: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get webhook last inserted id %v", err)
+	}
+
+	return r.GetWebhookById(tenant, id)
+}
+
+func (r *Repository) UpdateWebhook(tenant string, id int64, webhook *models.Webhook) (*models.Webhook, error) {
+	// re-enabling a webhook gives it a clean slate
+	_, err := r.DB.Exec("update webhooks set url = ?, event_types = ?, secret = ?, active = ?, failure_count = if(?, 0, failure_count) where id = ? and tenant_id = ?",
+		webhook.URL, strings.Join(webhook.EventTypes, ","), webhook.Secret, webhook.Active, webhook.Active, id, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("update webhook: %v", err)
+	}
+
+	return r.GetWebhookById(tenant, id)
+}
+
+func (r *Repository) DeleteWebhook(tenant string, id int64) error {
+	_, err := r.DB.Exec("delete from webhooks where id = ? and tenant_id = ?", id, tenant)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) SetWebhookStatus(id int64, active bool, failureCount int) error {
+	_, err := r.DB.Exec("update webhooks set active = ?, failure_count = ? where id = ?", active, failureCount, id)
+	if err != nil {
+		return fmt.Errorf("set webhook status: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) CreateDelivery(d *models.WebhookDelivery) error {
+	result, err := r.DB.Exec("insert into webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		d.WebhookID, d.EventID, d.EventType, d.Attempt, d.StatusCode, d.Error, d.Success, d.Duration)
+	if err != nil {
+		return fmt.Errorf("add webhook delivery: %v", err)
+	}
+
+	d.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get webhook delivery last inserted id %v", err)
+	}
+	return nil
+}
+
+// GetDeliveries returns the most recent delivery attempts first.
+func (r *Repository) GetDeliveries(webhookId int64, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	rows, err := r.DB.Query("select id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at from webhook_deliveries where webhook_id = ? order by id desc limit ?", webhookId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getDeliveries %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.Success, &d.Duration, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("getDeliveries %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getDeliveries %v", err)
+	}
+
+	return deliveries, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	// webhooks for every change have no event types, rather than null ones
+	w := models.Webhook{EventTypes: []string{}}
+	var eventTypes string
+
+	if err := row.Scan(&w.ID, &w.Tenant, &w.URL, &eventTypes, &w.Secret, &w.Active, &w.FailureCount, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if eventTypes != "" {
+		w.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return &w, nil
+}
@@ -1,25 +1,63 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/iamthiago/movies-crud/api"
+	"github.com/iamthiago/movies-crud/internal/movies/availability"
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/collections"
+	"github.com/iamthiago/movies-crud/internal/movies/config"
+	"github.com/iamthiago/movies-crud/internal/movies/consumer"
 	"github.com/iamthiago/movies-crud/internal/movies/controller"
+	"github.com/iamthiago/movies-crud/internal/movies/encoder"
+	"github.com/iamthiago/movies-crud/internal/movies/enrichment"
+	"github.com/iamthiago/movies-crud/internal/movies/idempotency"
+	"github.com/iamthiago/movies-crud/internal/movies/jobs"
+	"github.com/iamthiago/movies-crud/internal/movies/media"
 	"github.com/iamthiago/movies-crud/internal/movies/mysql"
+	"github.com/iamthiago/movies-crud/internal/movies/openapi"
+	"github.com/iamthiago/movies-crud/internal/movies/postgres"
 	"github.com/iamthiago/movies-crud/internal/movies/producer"
+	"github.com/iamthiago/movies-crud/internal/movies/projection"
+	"github.com/iamthiago/movies-crud/internal/movies/recommendations"
 	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/reviews"
+	"github.com/iamthiago/movies-crud/internal/movies/rpc"
+	"github.com/iamthiago/movies-crud/internal/movies/schemaregistry"
 	"github.com/iamthiago/movies-crud/internal/movies/service"
+	"github.com/iamthiago/movies-crud/internal/movies/sqlite"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/internal/movies/webhooks"
+	"github.com/iamthiago/movies-crud/pkg/models"
+	protofiles "github.com/iamthiago/movies-crud/proto"
 )
 
 func main() {
-	db, err := mysql.GetMySQLDB()
-	if err != nil {
-		log.Fatal(err)
-		panic(err)
+	if len(os.Args) > 1 && os.Args[1] == "consume" {
+		consume(os.Args[2:])
+		return
 	}
 
+	serve()
+}
+
+func serve() {
+	cfg := config.Load()
+
+	db, moviesRepository := storage(cfg)
+
 	topic := "movies"
 	kafkaProducer, err := producer.GetKafkaProducer(&topic)
 	if err != nil {
@@ -27,34 +65,662 @@ func main() {
 		panic(err)
 	}
 
-	defer db.Close()
+	reviewsTopic := "reviews"
+	reviewsProducer, err := producer.GetKafkaProducer(&reviewsTopic)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	availabilityTopic := "availability"
+	availabilityProducer, err := producer.GetKafkaProducer(&availabilityTopic)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if db != nil {
+		defer db.Close()
+	}
 	defer kafkaProducer.Producer.Close()
+	defer reviewsProducer.Producer.Close()
+	defer availabilityProducer.Producer.Close()
+
+	broadcaster := changes.Broadcaster{}
+
+	eventEncoder := topicEncoder(cfg, topic, "movie_event.proto")
+	reviewsEncoder := topicEncoder(cfg, reviewsTopic, "review_event.proto")
+	availabilityEncoder := topicEncoder(cfg, availabilityTopic, "availability_event.proto")
+
+	recommender := recommendations.GetRecommender(&recommendations.Repository{DB: db})
+
+	localMedia := media.LocalStore{Dir: cfg.MediaDir, BaseURL: cfg.MediaBaseURL}
+	tenants := catalogues{
+		db:              db,
+		repository:      moviesRepository,
+		kafkaProducer:   &kafkaProducer,
+		reviewsProducer: &reviewsProducer,
+		encoder:         eventEncoder,
+		reviewsEncoder:  reviewsEncoder,
+		broadcaster:     &broadcaster,
+		blobs:           blobStore(cfg, &localMedia),
+		cfg:             cfg,
+	}
+
+	// the features kept in mysql don't run in the background on the other storages
+	webhooksRepo := webhooks.Repository{DB: db}
+	if db != nil {
+		go webhooks.GetDispatcher(&webhooksRepo).Run(context.Background(), &broadcaster)
+	}
+
+	if err := os.MkdirAll(cfg.JobsDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	jobsRepo := jobs.Repository{DB: db}
+	jobManager := jobs.GetManager(&jobsRepo, cfg.JobsConcurrency)
+	jobManager.MaxAttempts = cfg.JobsMaxAttempts
+	jobManager.Handlers[jobs.ImportJob] = jobs.ImportHandler(tenants.movies, cfg.JobsDir)
+	jobManager.Handlers[jobs.ExportJob] = jobs.ExportHandler(tenants.movies, cfg.JobsDir)
+	jobManager.Handlers[jobs.ReindexJob] = jobs.ReindexHandler(tenants.movies)
+	if db != nil {
+		jobManager.Start(context.Background())
+		go jobs.SweepFiles(context.Background(), cfg.JobsDir, cfg.JobsRetention, time.Hour)
+	}
+
+	if db != nil && cfg.RefreshSimilarities {
+		tenants.recommender = recommender
+		go refreshSimilarities(context.Background(), recommender)
+		go recommender.Run(context.Background(), &broadcaster)
+	}
 
-	movieRepo := repository.Repository{DB: db}
-	movieService := service.Service{Repository: &movieRepo, KafkaProducer: &kafkaProducer}
+	metadataRepo := enrichment.Repository{DB: db}
+	var enricher *enrichment.Enricher
+	if provider := metadataProvider(cfg); provider != nil {
+		enricher = enrichment.GetEnricher(provider, &metadataRepo, cfg.MetadataCacheTTL)
+		if db != nil && cfg.EnrichOnCreate {
+			go enricher.Run(context.Background(), &broadcaster)
+		}
+	}
+
+	scheduler := availability.GetScheduler(&availability.ScheduleRepository{DB: db}, &availabilityProducer, availabilityEncoder)
+	scheduler.Interval = cfg.AvailabilityCheckInterval
+	if db != nil {
+		go scheduler.Run(context.Background())
+	}
+
+	idempotencyRepo := idempotency.Repository{DB: db}
+	idempotent := idempotency.GetMiddleware(&idempotencyRepo, cfg.IdempotencyTTL)
+	if db != nil {
+		go idempotent.PurgeExpired(context.Background(), time.Hour)
+	}
+
+	defaultLanguage, err := models.NormalizeLanguage(cfg.DefaultLanguage)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	r := mux.NewRouter()
+	resolver := tenant.Resolver{Secret: []byte(cfg.TenantJWTSecret), Claim: cfg.TenantClaim, Default: cfg.DefaultTenant}
+
+	spec, err := openapi.GetSpec(api.Spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server{
+		cfg:             cfg,
+		db:              db,
+		tenants:         &tenants,
+		resolver:        &resolver,
+		spec:            spec,
+		defaultLanguage: defaultLanguage,
+		localMedia:      &localMedia,
+		broadcaster:     &broadcaster,
+		idempotent:      idempotent,
+		jobManager:      jobManager,
+		jobsRepo:        &jobsRepo,
+		webhooksRepo:    &webhooksRepo,
+		recommender:     recommender,
+		metadataRepo:    &metadataRepo,
+		enricher:        enricher,
+	}
+
+	grpcServer := rpc.GetGRPCServer(&rpc.MoviesServer{Catalogue: tenants.movies, Broadcaster: &broadcaster}, &resolver)
+	listener, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		fmt.Printf("Starting grpc server at %s\n", cfg.GRPCAddr)
+		log.Fatal(grpcServer.Serve(listener))
+	}()
+
+	fmt.Printf("Starting server at port 8080\n")
+	log.Fatal(http.ListenAndServe(":8080", srv.router()))
+}
+
+// server routes the http requests to the controllers, with what they are served with
+type server struct {
+	cfg             config.Config
+	db              *sql.DB
+	tenants         *catalogues
+	resolver        *tenant.Resolver
+	spec            *openapi.Spec
+	defaultLanguage string
+	localMedia      *media.LocalStore
+	broadcaster     *changes.Broadcaster
+	idempotent      *idempotency.Middleware
+	jobManager      *jobs.Manager
+	jobsRepo        *jobs.Repository
+	webhooksRepo    *webhooks.Repository
+	recommender     *recommendations.Recommender
+	metadataRepo    *enrichment.Repository
+	enricher        *enrichment.Enricher
+}
+
+// router registers every route of the app, the routes of a tenant being checked against the OpenAPI description
+func (s *server) router() *mux.Router {
+	router := mux.NewRouter()
+
+	// media urls are downloaded by browsers, which don't send the tenant
+	router.PathPrefix("/media/").Handler(http.StripPrefix("/media", s.localMedia)).Methods("GET")
+
+	// the description of the routes is the same for every tenant
+	router.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetOpenAPI(w, r, s.spec)
+	}).Methods("GET")
+
+	router.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetDocs(w, r, api.Docs)
+	}).Methods("GET")
+
+	r := router.NewRoute().Subrouter()
+	r.Use(s.resolver.Middleware)
+	r.Use(s.spec.Middleware)
 
 	r.HandleFunc("/movies", func(w http.ResponseWriter, r *http.Request) {
-		controller.GetMovies(w, r, &movieService)
+		c := s.catalogueOf(r)
+		controller.GetMovies(w, r, c.movies, c.availability, s.defaultLanguage)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/export", func(w http.ResponseWriter, r *http.Request) {
+		controller.ExportMovies(w, r, s.catalogueOf(r).movies)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/export", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.SubmitExportJob(w, r, s.jobManager)
+	})).Methods("POST")
+
+	r.HandleFunc("/movies/import", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.SubmitImportJob(w, r, s.jobManager, s.cfg.JobsDir)
+	})).Methods("POST").Queries("async", "true")
+
+	r.HandleFunc("/movies/import", func(w http.ResponseWriter, r *http.Request) {
+		controller.ImportMovies(w, r, s.catalogueOf(r).movies)
+	}).Methods("POST")
+
+	r.HandleFunc("/movies/reindex", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.SubmitReindexJob(w, r, s.jobManager)
+	})).Methods("POST")
+
+	r.HandleFunc("/movies/stream", func(w http.ResponseWriter, r *http.Request) {
+		controller.StreamMovies(w, r, s.broadcaster)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/stream/ws", func(w http.ResponseWriter, r *http.Request) {
+		controller.WatchMovies(w, r, s.broadcaster)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/isbn/{isbn}", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetMovieByIsbn(w, r, s.catalogueOf(r).movies)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/by-external/{source}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetMovieByExternalId(w, r, s.catalogueOf(r).movies)
 	}).Methods("GET")
 
 	r.HandleFunc("/movies/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controller.GetMovie(w, r, &movieService)
+		controller.GetMovie(w, r, s.catalogueOf(r).movies, s.defaultLanguage)
 	}).Methods("GET")
 
-	r.HandleFunc("/movies", func(w http.ResponseWriter, r *http.Request) {
-		controller.CreateMovie(w, r, &movieService)
+	createMovie := func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateMovie(w, r, s.catalogueOf(r).movies)
+	}
+	if s.db != nil {
+		createMovie = s.idempotent.Handle(createMovie)
+	} else {
+		createMovie = withoutIdempotency(createMovie)
+	}
+	r.HandleFunc("/movies", createMovie).Methods("POST")
+
+	r.HandleFunc("/movies:batch", func(w http.ResponseWriter, r *http.Request) {
+		controller.BatchMovies(w, r, s.catalogueOf(r).movies, s.cfg.BatchMaxOperations)
 	}).Methods("POST")
 
 	r.HandleFunc("/movies/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controller.UpdateMovie(w, r, &movieService)
+		controller.UpdateMovie(w, r, s.catalogueOf(r).movies)
+	}).Methods("PUT")
+
+	r.HandleFunc("/movies/isbn/{isbn}", func(w http.ResponseWriter, r *http.Request) {
+		controller.UpsertMovieByIsbn(w, r, s.catalogueOf(r).movies)
+	}).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/poster", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		c := s.catalogueOf(r)
+		controller.UploadPoster(w, r, c.movies, c.posters, s.cfg.PosterMaxBytes)
+	})).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/poster", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeletePoster(w, r, s.catalogueOf(r).posters)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/movies/{id}/translations", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetTranslations(w, r, s.catalogueOf(r).movies)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/translations/{language}", func(w http.ResponseWriter, r *http.Request) {
+		controller.GetTranslation(w, r, s.catalogueOf(r).movies)
+	}).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/translations/{language}", func(w http.ResponseWriter, r *http.Request) {
+		controller.SaveTranslation(w, r, s.catalogueOf(r).movies)
 	}).Methods("PUT")
 
+	r.HandleFunc("/movies/{id}/translations/{language}", func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteTranslation(w, r, s.catalogueOf(r).movies)
+	}).Methods("DELETE")
+
+	r.HandleFunc("/movies/{id}/releases", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetReleases(w, r, s.catalogueOf(r).availability)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/releases", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateRelease(w, r, s.catalogueOf(r).availability)
+	})).Methods("POST")
+
+	r.HandleFunc("/movies/{id}/releases/{releaseId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.UpdateRelease(w, r, s.catalogueOf(r).availability)
+	})).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/releases/{releaseId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteRelease(w, r, s.catalogueOf(r).availability)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/movies/{id}/availability", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetWindows(w, r, s.catalogueOf(r).availability)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/availability", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateWindow(w, r, s.catalogueOf(r).availability)
+	})).Methods("POST")
+
+	r.HandleFunc("/movies/{id}/availability/{windowId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.UpdateWindow(w, r, s.catalogueOf(r).availability)
+	})).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/availability/{windowId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteWindow(w, r, s.catalogueOf(r).availability)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/movies/{id}/reviews", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetReviews(w, r, s.catalogueOf(r).reviews)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/reviews", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateReview(w, r, s.catalogueOf(r).reviews)
+	})).Methods("POST")
+
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetReview(w, r, s.catalogueOf(r).reviews)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.UpdateReview(w, r, s.catalogueOf(r).reviews)
+	})).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteReview(w, r, s.catalogueOf(r).reviews)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/movies/{id}/reviews/{reviewId}/status", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.ModerateReview(w, r, s.catalogueOf(r).reviews)
+	})).Methods("PUT")
+
+	r.HandleFunc("/movies/{id}/similar", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetSimilarMovies(w, r, s.catalogueOf(r).movies, s.recommender)
+	})).Methods("GET")
+
+	r.HandleFunc("/users/{id}/recommendations", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetRecommendations(w, r, s.recommender)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/metadata", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetMovieMetadata(w, r, s.metadataRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/movies/{id}/enrich", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.EnrichMovie(w, r, s.catalogueOf(r).movies, s.enricher)
+	})).Methods("POST")
+
 	r.HandleFunc("/movies/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controller.DeleteMovie(w, r, &movieService)
+		controller.DeleteMovie(w, r, s.catalogueOf(r).movies)
 	}).Methods("DELETE")
 
-	fmt.Printf("Starting server at port 8080\n")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	r.HandleFunc("/collections", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetCollections(w, r, s.catalogueOf(r).collections)
+	})).Methods("GET")
+
+	r.HandleFunc("/collections", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateCollection(w, r, s.catalogueOf(r).collections)
+	})).Methods("POST")
+
+	r.HandleFunc("/collections/shared/{slug}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetSharedCollection(w, r, s.catalogueOf(r).collections)
+	})).Methods("GET")
+
+	r.HandleFunc("/collections/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetCollection(w, r, s.catalogueOf(r).collections)
+	})).Methods("GET")
+
+	r.HandleFunc("/collections/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.UpdateCollection(w, r, s.catalogueOf(r).collections)
+	})).Methods("PUT")
+
+	r.HandleFunc("/collections/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteCollection(w, r, s.catalogueOf(r).collections)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/collections/{id}/items", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.AddCollectionItem(w, r, s.catalogueOf(r).collections)
+	})).Methods("POST")
+
+	r.HandleFunc("/collections/{id}/items", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.ReorderCollectionItems(w, r, s.catalogueOf(r).collections)
+	})).Methods("PUT")
+
+	r.HandleFunc("/collections/{id}/items/{movieId}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.RemoveCollectionItem(w, r, s.catalogueOf(r).collections)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/webhooks", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetWebhooks(w, r, s.webhooksRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/webhooks", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CreateWebhook(w, r, s.webhooksRepo)
+	})).Methods("POST")
+
+	r.HandleFunc("/webhooks/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetWebhook(w, r, s.webhooksRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/webhooks/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.UpdateWebhook(w, r, s.webhooksRepo)
+	})).Methods("PUT")
+
+	r.HandleFunc("/webhooks/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.DeleteWebhook(w, r, s.webhooksRepo)
+	})).Methods("DELETE")
+
+	r.HandleFunc("/webhooks/{id}/deliveries", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetWebhookDeliveries(w, r, s.webhooksRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/jobs", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetJobs(w, r, s.jobsRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/jobs/{id}", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetJob(w, r, s.jobsRepo)
+	})).Methods("GET")
+
+	r.HandleFunc("/jobs/{id}/cancel", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.CancelJob(w, r, s.jobManager)
+	})).Methods("POST")
+
+	r.HandleFunc("/jobs/{id}/result", s.mysqlOnly(func(w http.ResponseWriter, r *http.Request) {
+		controller.GetJobResult(w, r, s.jobsRepo, s.cfg.JobsDir)
+	})).Methods("GET")
+
+	return router
+}
+
+func (s *server) catalogueOf(r *http.Request) *catalogue {
+	return s.tenants.get(tenant.FromContext(r.Context()))
+}
+
+// mysqlOnly guards the routes of the features that keep their data in mysql,
+// they answer 501 on the other storages
+func (s *server) mysqlOnly(handler http.HandlerFunc) http.HandlerFunc {
+	if s.db == nil {
+		return controller.Unsupported
+	}
+	return handler
+}
+
+// withoutIdempotency answers 501 to the requests with an Idempotency-Key on the storages without idempotency keys,
+// as their retries would create the movie again
+func withoutIdempotency(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(idempotency.HeaderKey) != "" {
+			controller.Unsupported(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// catalogues builds the catalogue of a tenant from the connections shared by all of them.
+// db is nil when the movies aren't kept in mysql, the catalogues only have their movies then
+type catalogues struct {
+	db              *sql.DB
+	repository      func(tenantId string) repository.MoviesRepository
+	kafkaProducer   producer.KafkaProducer
+	reviewsProducer producer.KafkaProducer
+	encoder         encoder.EventEncoder
+	reviewsEncoder  encoder.EventEncoder
+	broadcaster     *changes.Broadcaster
+	blobs           media.BlobStore
+	cfg             config.Config
+	// recommender refreshes the similar movies of the movies whose reviews or collections change, when set
+	recommender *recommendations.Recommender
+}
+
+// catalogue serves the requests of one tenant, every repository of it is scoped to the tenant
+type catalogue struct {
+	movies       *service.Service
+	posters      *media.Posters
+	reviews      *reviews.Reviews
+	collections  *collections.Collections
+	availability availability.AvailabilityRepository
+}
+
+func (c *catalogues) get(tenantId string) *catalogue {
+	movies := &service.Service{
+		Tenant:        tenantId,
+		Repository:    c.repository(tenantId),
+		KafkaProducer: c.kafkaProducer,
+		Encoder:       c.encoder,
+		Broadcaster:   c.broadcaster,
+	}
+	if c.db == nil {
+		return &catalogue{movies: movies}
+	}
+
+	posters := media.Posters{Store: c.blobs, Repository: &media.Repository{DB: c.db, Tenant: tenantId}}
+	movieReviews := reviews.Reviews{
+		Tenant:        tenantId,
+		Repository:    &reviews.Repository{DB: c.db, Tenant: tenantId},
+		KafkaProducer: c.reviewsProducer,
+		Encoder:       c.reviewsEncoder,
+		Premoderation: c.cfg.ReviewsPremoderation,
+	}
+
+	movieCollections := collections.Collections{Repository: &collections.Repository{DB: c.db, Tenant: tenantId}}
+
+	movies.Decorators = []service.MovieDecorator{&posters, &movieReviews}
+	if c.recommender != nil {
+		changed := func(movieIds ...int64) {
+			c.recommender.Changed(tenantId, movieIds...)
+		}
+		movieReviews.Changed = changed
+		movieCollections.Changed = changed
+	}
+
+	return &catalogue{
+		movies:       movies,
+		posters:      &posters,
+		reviews:      &movieReviews,
+		collections:  &movieCollections,
+		availability: &availability.Repository{DB: c.db, Tenant: tenantId},
+	}
+}
+
+// movies returns the movies service of the tenant, for the gRPC server and the jobs
+func (c *catalogues) movies(tenantId string) service.MoviesService {
+	return c.get(tenantId).movies
+}
+
+// storage connects to where the movies are kept, returning the repository of a tenant's movies.
+// The mysql connection is only returned with the mysql storage, the other features need it.
+// topicEncoder returns the encoder of the events sent to a topic, in the configured format.
+// With a schema registry each topic registers the schema of its own events under its value subject.
+func topicEncoder(cfg config.Config, topic string, schemaFile string) encoder.EventEncoder {
+	var serializer encoder.Serializer
+	if cfg.SchemaRegistryURL != "" {
+		schema, err := protofiles.Files.ReadFile(schemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		serializer = &schemaregistry.ProtobufSerializer{
+			Client:  &schemaregistry.HTTPClient{URL: cfg.SchemaRegistryURL, Client: &http.Client{Timeout: cfg.SchemaRegistryTimeout}},
+			Subject: topic + "-value",
+			Schema:  string(schema),
+		}
+	}
+
+	eventEncoder, err := encoder.GetEventEncoder(cfg.EventFormat, serializer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return eventEncoder
+}
+
+func storage(cfg config.Config) (*sql.DB, func(tenantId string) repository.MoviesRepository) {
+	switch cfg.Storage {
+	case "mysql":
+		db, err := mysql.GetMySQLDB()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return db, func(tenantId string) repository.MoviesRepository {
+			return &repository.Repository{DB: db, Tenant: tenantId}
+		}
+	case "postgres":
+		db, err := postgres.GetPostgresDB(cfg.PostgresURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return nil, func(tenantId string) repository.MoviesRepository {
+			return &repository.Repository{DB: db, Tenant: tenantId, Dialect: repository.Postgres}
+		}
+	case "sqlite":
+		db, err := sqlite.GetSQLiteDB(cfg.SQLitePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return nil, func(tenantId string) repository.MoviesRepository {
+			return &repository.Repository{DB: db, Tenant: tenantId, Dialect: repository.SQLite}
+		}
+	case "memory":
+		db := &repository.MemoryDB{}
+		return nil, func(tenantId string) repository.MoviesRepository {
+			return &repository.MemoryRepository{DB: db, Tenant: tenantId}
+		}
+	}
+
+	log.Fatalf("unknown storage %s, expected mysql, postgres, sqlite or memory", cfg.Storage)
+	return nil, nil
+}
+
+// blobStore returns where the uploaded media is kept, the local store unless s3 is configured
+func blobStore(cfg config.Config, local *media.LocalStore) media.BlobStore {
+	if cfg.MediaStore != "s3" {
+		return local
+	}
+
+	return &media.S3Store{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    cfg.S3Bucket,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		PathStyle: cfg.S3PathStyle,
+		URLExpiry: cfg.MediaURLExpiry,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// metadataProvider returns the configured provider of movie metadata, nil when there is none
+func metadataProvider(cfg config.Config) enrichment.MetadataProvider {
+	switch {
+	case cfg.MetadataFile != "":
+		provider, err := enrichment.GetFileProvider(cfg.MetadataFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return provider
+	case cfg.MetadataURL != "":
+		return enrichment.GetHTTPProvider(cfg.MetadataURL, cfg.MetadataAPIKey, cfg.MetadataRequestsPerSecond)
+	}
+	return nil
+}
+
+// refreshSimilarities computes the similar movies of every movie in the movies topic,
+// with its own consumer group so it doesn't take events from other consumers
+func refreshSimilarities(ctx context.Context, recommender *recommendations.Recommender) {
+	topic := "movies"
+	similarityConsumer, err := consumer.GetKafkaConsumer("movies-similarities", &topic, recommender, nil)
+	if err != nil {
+		log.Println("Error starting the similarities consumer", err)
+		return
+	}
+	defer similarityConsumer.Close()
+
+	if err := similarityConsumer.Run(ctx); err != nil {
+		log.Println("Similarities consumer stopped", err)
+	}
+}
+
+// consume materializes the movies topic into a local json read model,
+// as a reference for teams that need to read the events.
+func consume(args []string) {
+	flags := flag.NewFlagSet("consume", flag.ExitOnError)
+	groupId := flags.String("group", "movies-projection", "kafka consumer group id")
+	path := flags.String("projection", "movies-projection.json", "path of the json read model")
+	deadLetterTopic := flags.String("dlq", "movies-dlq", "dead letter topic, empty to disable")
+	flags.Parse(args)
+
+	store, err := projection.GetJSONStore(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var dlq *string
+	if *deadLetterTopic != "" {
+		dlq = deadLetterTopic
+	}
+
+	topic := "movies"
+	movieConsumer, err := consumer.GetKafkaConsumer(*groupId, &topic, store, dlq)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer movieConsumer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Consuming topic %s into %s\n", topic, *path)
+	if err := movieConsumer.Run(ctx); err != nil {
+		log.Println(err)
+	}
 }
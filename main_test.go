@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+)
+
+// TestRoutesAreDescribed checks that the OpenAPI description has every route of the app, and nothing else
+func TestRoutesAreDescribed(t *testing.T) {
+	seen := map[string]bool{}
+	var routes []string
+	err := (&server{}).router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			// the subrouter of the tenants
+			return nil
+		}
+		// the files under the media prefix are described as a path parameter
+		if strings.HasSuffix(path, "/") {
+			path += "{key}"
+		}
+
+		methods, err := route.GetMethods()
+		require.NoError(t, err, path)
+		for _, method := range methods {
+			if operation := method + " " + path; !seen[operation] {
+				seen[operation] = true
+				routes = append(routes, operation)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(routes)
+	assert.Equal(t, routes, apitest.Spec.Operations())
+}
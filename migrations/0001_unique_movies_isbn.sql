@@ -0,0 +1,7 @@
+-- Adds a unique index on the isbn of the movies, so the same movie can't be inserted twice.
+-- The index can't be created while an isbn is used by more than one movie, those can be listed with
+--   select isbn, group_concat(id order by id) from movies group by isbn having count(*) > 1;
+-- and have to be merged or deleted before running it.
+use movies;
+
+ALTER TABLE movies ADD UNIQUE INDEX movies_isbn (isbn);
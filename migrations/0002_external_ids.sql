@@ -0,0 +1,11 @@
+-- Adds the ids of the movies in other catalogues, such as imdb, tmdb and eidr.
+use movies;
+
+CREATE TABLE external_ids (
+    movie_id        INT NOT NULL,
+    source          VARCHAR(16) NOT NULL,
+    external_id     VARCHAR(128) NOT NULL,
+    PRIMARY KEY (movie_id, source),
+    UNIQUE KEY external_ids_source (source, external_id),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,22 @@
+-- Adds the metadata filled in from external movie databases, along with where each field came from.
+use movies;
+
+CREATE TABLE movie_metadata (
+    movie_id            INT NOT NULL,
+    synopsis            TEXT NOT NULL,
+    year                INT NOT NULL,
+    runtime_minutes     INT NOT NULL,
+    poster_url          VARCHAR(2048) NOT NULL,
+    PRIMARY KEY (movie_id),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
+
+CREATE TABLE metadata_provenance (
+    movie_id            INT NOT NULL,
+    field               VARCHAR(32) NOT NULL,
+    source              VARCHAR(32) NOT NULL,
+    source_id           VARCHAR(128) NOT NULL,
+    fetched_at          TIMESTAMP NOT NULL,
+    PRIMARY KEY (movie_id, field),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,15 @@
+-- Adds the posters of the movies, their files are kept in the blob store.
+use movies;
+
+CREATE TABLE movie_posters (
+    movie_id            INT NOT NULL,
+    poster_key          VARCHAR(512) NOT NULL,
+    thumbnail_key       VARCHAR(512) NOT NULL,
+    content_type        VARCHAR(64) NOT NULL,
+    size                INT NOT NULL,
+    width               INT NOT NULL,
+    height              INT NOT NULL,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (movie_id),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,27 @@
+-- Adds the reviews of the movies and the rating aggregated from the approved ones.
+use movies;
+
+CREATE TABLE reviews (
+    id                  INT AUTO_INCREMENT NOT NULL,
+    movie_id            INT NOT NULL,
+    user_id             VARCHAR(64) NOT NULL,
+    score               TINYINT NOT NULL,
+    text                TEXT NOT NULL,
+    status              VARCHAR(16) NOT NULL,
+    created_at          TIMESTAMP NOT NULL,
+    updated_at          TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY reviews_movie_user (movie_id, user_id),
+    KEY reviews_movie_status (movie_id, status, id),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
+
+CREATE TABLE movie_ratings (
+    movie_id            INT NOT NULL,
+    review_count        INT NOT NULL,
+    average             DECIMAL(4,2) NOT NULL,
+    histogram           JSON NOT NULL,
+    PRIMARY KEY (movie_id),
+    KEY movie_ratings_average (average),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
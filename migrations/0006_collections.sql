@@ -0,0 +1,26 @@
+-- Adds the collections curated by users, their items go away with the movies they reference.
+use movies;
+
+CREATE TABLE collections (
+    id                  INT AUTO_INCREMENT NOT NULL,
+    owner_id            VARCHAR(64) NOT NULL,
+    name                VARCHAR(128) NOT NULL,
+    visibility          VARCHAR(16) NOT NULL,
+    slug                VARCHAR(32) NOT NULL,
+    created_at          TIMESTAMP NOT NULL,
+    updated_at          TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY collections_slug (slug),
+    KEY collections_owner (owner_id)
+) ENGINE=INNODB;
+
+CREATE TABLE collection_items (
+    collection_id       INT NOT NULL,
+    movie_id            INT NOT NULL,
+    position            INT NOT NULL,
+    added_at            TIMESTAMP NOT NULL,
+    PRIMARY KEY (collection_id, movie_id),
+    KEY collection_items_position (collection_id, position),
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,14 @@
+-- Adds the precomputed similarities between movies used for recommendations.
+use movies;
+
+CREATE TABLE movie_similarities (
+    movie_id            INT NOT NULL,
+    similar_movie_id    INT NOT NULL,
+    score               DOUBLE NOT NULL,
+    reasons             VARCHAR(64) NOT NULL,
+    computed_at         TIMESTAMP NOT NULL,
+    PRIMARY KEY (movie_id, similar_movie_id),
+    KEY movie_similarities_score (movie_id, score),
+    FOREIGN KEY (movie_id) REFERENCES movies(id) ON DELETE CASCADE,
+    FOREIGN KEY (similar_movie_id) REFERENCES movies(id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,30 @@
+-- Adds the webhooks called on movie changes and the log of their deliveries.
+-- Databases created from a movies.ddl that already had them are left as they are.
+use movies;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id              INT AUTO_INCREMENT NOT NULL,
+    url             VARCHAR(2048) NOT NULL,
+    event_types     VARCHAR(256) NOT NULL,
+    secret          VARCHAR(128) NOT NULL,
+    active          BOOLEAN NOT NULL DEFAULT TRUE,
+    failure_count   INT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=INNODB;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              INT AUTO_INCREMENT NOT NULL,
+    webhook_id      INT NOT NULL,
+    event_id        VARCHAR(64) NOT NULL,
+    event_type      VARCHAR(32) NOT NULL,
+    attempt         INT NOT NULL,
+    status_code     INT NOT NULL,
+    error           VARCHAR(1024) NOT NULL,
+    success         BOOLEAN NOT NULL,
+    duration_ms     INT NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY webhook_deliveries_webhook (webhook_id, id),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+) ENGINE=INNODB;
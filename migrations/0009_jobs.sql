@@ -0,0 +1,21 @@
+-- Adds the queue of the background jobs, such as imports, exports and reindexing.
+-- Databases created from a movies.ddl that already had it are left as they are.
+use movies;
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id                  INT AUTO_INCREMENT NOT NULL,
+    type                VARCHAR(32) NOT NULL,
+    status              VARCHAR(16) NOT NULL,
+    params              TEXT NOT NULL,
+    progress            TEXT NOT NULL,
+    result              TEXT NOT NULL,
+    error               VARCHAR(1024) NOT NULL,
+    cancel_requested    BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts            INT NOT NULL DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    started_at          TIMESTAMP NULL,
+    finished_at         TIMESTAMP NULL,
+    PRIMARY KEY (id),
+    KEY jobs_status (status, id)
+) ENGINE=INNODB;
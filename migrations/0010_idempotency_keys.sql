@@ -0,0 +1,17 @@
+-- Adds the responses kept for the requests sent with an Idempotency-Key header.
+-- Databases created from a movies.ddl that already had it are left as they are.
+use movies;
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key     VARCHAR(255) NOT NULL,
+    request_hash        CHAR(64) NOT NULL,
+    completed           BOOLEAN NOT NULL DEFAULT FALSE,
+    status              INT NOT NULL,
+    content_type        VARCHAR(128) NOT NULL,
+    body                MEDIUMTEXT NOT NULL,
+    locked_until        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (idempotency_key),
+    KEY idempotency_keys_expires (expires_at)
+) ENGINE=INNODB;
@@ -0,0 +1,93 @@
+-- Splits the catalogue by tenant. Every movie and everything attached to it gets the tenant it belongs to,
+-- the existing rows going to the default tenant. The foreign keys include the tenant, so a row can't
+-- reference the movie of another tenant. The foreign keys being replaced have the names mysql gave them,
+-- they can be checked with
+--   select table_name, constraint_name from information_schema.referential_constraints where constraint_schema = 'movies';
+use movies;
+
+ALTER TABLE movies
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    DROP INDEX movies_isbn,
+    ADD UNIQUE INDEX movies_isbn (tenant_id, isbn),
+    ADD UNIQUE INDEX movies_tenant (tenant_id, id);
+
+ALTER TABLE external_ids DROP FOREIGN KEY external_ids_ibfk_1;
+ALTER TABLE external_ids
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    DROP INDEX external_ids_source,
+    ADD UNIQUE INDEX external_ids_source (tenant_id, source, external_id),
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE movie_metadata DROP FOREIGN KEY movie_metadata_ibfk_1;
+ALTER TABLE movie_metadata
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE metadata_provenance DROP FOREIGN KEY metadata_provenance_ibfk_1;
+ALTER TABLE metadata_provenance
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE movie_posters DROP FOREIGN KEY movie_posters_ibfk_1;
+ALTER TABLE movie_posters
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE reviews DROP FOREIGN KEY reviews_ibfk_1;
+ALTER TABLE reviews
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX reviews_user (tenant_id, user_id),
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE movie_ratings DROP FOREIGN KEY movie_ratings_ibfk_1;
+ALTER TABLE movie_ratings
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE collections
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    DROP INDEX collections_slug,
+    ADD UNIQUE INDEX collections_slug (tenant_id, slug),
+    ADD UNIQUE INDEX collections_tenant (tenant_id, id),
+    DROP INDEX collections_owner,
+    ADD INDEX collections_owner (tenant_id, owner_id);
+
+ALTER TABLE collection_items DROP FOREIGN KEY collection_items_ibfk_1, DROP FOREIGN KEY collection_items_ibfk_2;
+ALTER TABLE collection_items
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, collection_id) REFERENCES collections(tenant_id, id) ON DELETE CASCADE,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE movie_similarities DROP FOREIGN KEY movie_similarities_ibfk_1, DROP FOREIGN KEY movie_similarities_ibfk_2;
+ALTER TABLE movie_similarities
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    ADD FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE,
+    ADD FOREIGN KEY (tenant_id, similar_movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE webhooks
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX webhooks_tenant (tenant_id);
+
+ALTER TABLE jobs
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD INDEX jobs_tenant (tenant_id, id);
+
+ALTER TABLE idempotency_keys
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (tenant_id, idempotency_key);
+
+-- the application always sets the tenant, the default was only there for the existing rows
+ALTER TABLE movies ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE external_ids ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE movie_metadata ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE metadata_provenance ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE movie_posters ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE reviews ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE movie_ratings ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE collections ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE collection_items ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE movie_similarities ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhooks ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE jobs ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE idempotency_keys ALTER COLUMN tenant_id DROP DEFAULT;
@@ -0,0 +1,13 @@
+-- Adds the titles and synopses of the movies in other languages, keyed by BCP 47 language tag.
+-- The table is utf8mb4 so titles in any script can be kept.
+use movies;
+
+CREATE TABLE movie_translations (
+    tenant_id       VARCHAR(64) NOT NULL,
+    movie_id        INT NOT NULL,
+    language        VARCHAR(35) NOT NULL,
+    title           VARCHAR(128) NOT NULL,
+    synopsis        TEXT NOT NULL,
+    PRIMARY KEY (movie_id, language),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,32 @@
+-- Adds the release dates of the movies per country and the windows in which they can be watched per region.
+-- The notified flags keep the scheduler from announcing a window more than once.
+use movies;
+
+CREATE TABLE releases (
+    id              INT NOT NULL AUTO_INCREMENT,
+    tenant_id       VARCHAR(64) NOT NULL,
+    movie_id        INT NOT NULL,
+    country         CHAR(2) NOT NULL,
+    release_date    DATE NOT NULL,
+    type            VARCHAR(16) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY releases_movie_country_type (movie_id, country, type),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+) ENGINE=INNODB;
+
+CREATE TABLE availability_windows (
+    id              INT NOT NULL AUTO_INCREMENT,
+    tenant_id       VARCHAR(64) NOT NULL,
+    movie_id        INT NOT NULL,
+    region          CHAR(2) NOT NULL,
+    platform        VARCHAR(128) NOT NULL,
+    starts_at       DATETIME NOT NULL,
+    ends_at         DATETIME NULL,
+    opened_notified BOOLEAN NOT NULL DEFAULT FALSE,
+    closed_notified BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    INDEX availability_windows_region (tenant_id, region, starts_at),
+    INDEX availability_windows_opening (opened_notified, starts_at),
+    INDEX availability_windows_closing (closed_notified, ends_at),
+    FOREIGN KEY (tenant_id, movie_id) REFERENCES movies(tenant_id, id) ON DELETE CASCADE
+) ENGINE=INNODB;
@@ -0,0 +1,20 @@
+-- Stores the isbn of every movie as an ISBN-13 without hyphens or spaces, as the application now does on every write,
+-- so a movie saved with an ISBN-10 or a hyphenated ISBN can be found, upserted and imported by any of its forms.
+-- The ISBN-10 are turned into the ISBN-13 starting with 978 and their check digit is computed again,
+-- 38 being the weighted sum of the digits of the 978 prefix.
+-- The update fails when a tenant has the same book under two forms, those can be listed with
+--   select tenant_id, right(left(digits, length(digits) - 1), 9) as book, group_concat(id order by id)
+--   from (select id, tenant_id, replace(replace(isbn, '-', ''), ' ', '') as digits from movies) m
+--   where length(digits) = 10 or digits like '978%' group by tenant_id, book having count(*) > 1;
+-- and have to be merged or deleted before running it. Isbns of other lengths are left as they are, they can be listed with
+--   select id, isbn from movies where length(isbn) <> 13;
+use movies;
+
+UPDATE movies SET isbn = UPPER(REPLACE(REPLACE(isbn, '-', ''), ' ', ''))
+WHERE isbn LIKE '%-%' OR isbn LIKE '% %' OR isbn LIKE '%x';
+
+UPDATE movies SET isbn = CONCAT('978', LEFT(isbn, 9), MOD(10 - MOD(38
+        + 3 * SUBSTRING(isbn, 1, 1) + SUBSTRING(isbn, 2, 1) + 3 * SUBSTRING(isbn, 3, 1)
+        + SUBSTRING(isbn, 4, 1) + 3 * SUBSTRING(isbn, 5, 1) + SUBSTRING(isbn, 6, 1)
+        + 3 * SUBSTRING(isbn, 7, 1) + SUBSTRING(isbn, 8, 1) + 3 * SUBSTRING(isbn, 9, 1), 10), 10))
+WHERE LENGTH(isbn) = 10 AND LEFT(isbn, 9) REGEXP '^[0-9]{9}$';
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var ErrInvalidRegion = errors.New("invalid region")
+
+const (
+	ReleaseTheatrical = "theatrical"
+	ReleaseDigital    = "digital"
+	ReleasePhysical   = "physical"
+)
+
+// DateLayout is the format of the dates of the releases and of the on query parameter
+const DateLayout = "2006-01-02"
+
+// Release is the date a movie comes out in a country, in theaters, digitally or on physical media
+type Release struct {
+	ID      int64  `json:"id"`
+	MovieID int64  `json:"movie_id"`
+	Country string `json:"country"`
+	Date    string `json:"date"`
+	Type    string `json:"type"`
+}
+
+// AvailabilityWindow is when a movie can be watched on a platform in a region, from Start until End.
+// Windows without End stay open.
+type AvailabilityWindow struct {
+	ID       int64      `json:"id"`
+	MovieID  int64      `json:"movie_id"`
+	Region   string     `json:"region"`
+	Platform string     `json:"platform"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	// Tenant the movie belongs to, set on the windows found by the scheduler
+	Tenant string `json:"-"`
+}
+
+func (r Release) Validate() error {
+	var errs []error
+	if _, err := NormalizeRegion(r.Country); err != nil {
+		errs = append(errs, fmt.Errorf("country: %w %s", err, r.Country))
+	}
+	if _, err := time.Parse(DateLayout, r.Date); err != nil {
+		errs = append(errs, fmt.Errorf("date must be formatted as %s", DateLayout))
+	}
+	if !IsReleaseType(r.Type) {
+		errs = append(errs, errors.New("type must be theatrical, digital or physical"))
+	}
+	return errors.Join(errs...)
+}
+
+func IsReleaseType(t string) bool {
+	return t == ReleaseTheatrical || t == ReleaseDigital || t == ReleasePhysical
+}
+
+func (w AvailabilityWindow) Validate() error {
+	var errs []error
+	if _, err := NormalizeRegion(w.Region); err != nil {
+		errs = append(errs, fmt.Errorf("region: %w %s", err, w.Region))
+	}
+	if w.Platform == "" {
+		errs = append(errs, errors.New("platform is required"))
+	} else if len(w.Platform) > maxFieldLength {
+		errs = append(errs, fmt.Errorf("platform is longer than %d characters", maxFieldLength))
+	}
+	if w.Start.IsZero() {
+		errs = append(errs, errors.New("start is required"))
+	}
+	if w.End != nil && !w.End.After(w.Start) {
+		errs = append(errs, errors.New("end must be after start"))
+	}
+	return errors.Join(errs...)
+}
+
+// IsOpen tells whether the movie can be watched at t
+func (w AvailabilityWindow) IsOpen(t time.Time) bool {
+	return !t.Before(w.Start) && (w.End == nil || t.Before(*w.End))
+}
+
+// NormalizeRegion returns the ISO 3166-1 alpha-2 code of a country in upper case, so br is BR.
+// It returns ErrInvalidRegion for anything else, such as unassigned codes or the UN M.49 areas like 419.
+func NormalizeRegion(code string) (string, error) {
+	if len(code) != 2 {
+		return "", ErrInvalidRegion
+	}
+
+	region, err := language.ParseRegion(code)
+	if err != nil || !region.IsCountry() {
+		return "", ErrInvalidRegion
+	}
+	return region.String(), nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRegion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Should keep a country", code: "BR", want: "BR"},
+		{name: "Should fix the case", code: "us", want: "US"},
+		{name: "Should reject an area", code: "419", wantErr: true},
+		{name: "Should reject an unknown region", code: "ZZ", wantErr: true},
+		{name: "Should reject a private use code", code: "XA", wantErr: true},
+		{name: "Should reject a language", code: "pt-BR", wantErr: true},
+		{name: "Should reject an empty code", code: "", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeRegion(tc.code)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRegion)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAvailabilityWindowIsOpen(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	window := AvailabilityWindow{Region: "BR", Platform: "Netflix", Start: start, End: &end}
+
+	assert.False(t, window.IsOpen(start.Add(-time.Second)))
+	assert.True(t, window.IsOpen(start))
+	assert.True(t, window.IsOpen(end.Add(-time.Second)))
+	assert.False(t, window.IsOpen(end))
+
+	window.End = nil
+	assert.True(t, window.IsOpen(end.AddDate(10, 0, 0)))
+}
+
+func TestReleaseValidate(t *testing.T) {
+	assert.NoError(t, Release{Country: "br", Date: "2026-10-18", Type: ReleaseTheatrical}.Validate())
+
+	err := Release{Country: "Brazil", Date: "18/10/2026", Type: "streaming"}.Validate()
+	assert.ErrorIs(t, err, ErrInvalidRegion)
+	assert.ErrorContains(t, err, "date must be formatted as 2006-01-02")
+	assert.ErrorContains(t, err, "type must be theatrical, digital or physical")
+}
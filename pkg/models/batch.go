@@ -0,0 +1,43 @@
+package models
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+const (
+	BatchCreated  = "created"
+	BatchUpdated  = "updated"
+	BatchDeleted  = "deleted"
+	BatchNotFound = "not_found"
+	BatchInvalid  = "invalid"
+	BatchConflict = "conflict"
+	BatchFailed   = "failed"
+	// BatchAborted is the status of operations rolled back because another one failed
+	BatchAborted = "aborted"
+)
+
+type BatchOperation struct {
+	Op    string `json:"op"`
+	ID    int64  `json:"id,omitempty"`
+	Movie *Movie `json:"movie,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic applies all operations or none of them, otherwise each one is applied on its own
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status string `json:"status"`
+	Movie  *Movie `json:"movie,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r BatchResult) Succeeded() bool {
+	return r.Status == BatchCreated || r.Status == BatchUpdated || r.Status == BatchDeleted
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// CollectionPrivate collections are only seen by their owner
+	CollectionPrivate = "private"
+	// CollectionPublic collections can be seen by anyone, and shared through their slug
+	CollectionPublic = "public"
+)
+
+// Collection is a list of movies curated by a user, such as a watchlist, its items are in the order chosen by the owner.
+type Collection struct {
+	ID         int64  `json:"id"`
+	OwnerID    string `json:"owner_id"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+	Slug       string `json:"slug"`
+	ItemCount  int    `json:"item_count"`
+	// Items are left out when listing the collections of a user
+	Items     []CollectionItem `json:"items,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type CollectionItem struct {
+	Movie   Movie     `json:"movie"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func (c Collection) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	} else if len(c.Name) > maxFieldLength {
+		errs = append(errs, fmt.Errorf("name is longer than %d characters", maxFieldLength))
+	}
+	if c.Visibility != CollectionPrivate && c.Visibility != CollectionPublic {
+		errs = append(errs, errors.New("visibility must be private or public"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidIsbn = errors.New("invalid isbn")
+
+// NormalizeIsbn turns an ISBN-10 or ISBN-13, with or without hyphens and spaces, into an ISBN-13.
+// It returns ErrInvalidIsbn when the check digit doesn't match.
+func NormalizeIsbn(isbn string) (string, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+
+	switch len(digits) {
+	case 10:
+		if !isDigits(digits[:9]) || (!isDigits(digits[9:]) && digits[9] != 'X') || isbn10CheckDigit(digits[:9]) != digits[9] {
+			return "", ErrInvalidIsbn
+		}
+		isbn13 := "978" + digits[:9]
+		return isbn13 + string(isbn13CheckDigit(isbn13)), nil
+	case 13:
+		if !isDigits(digits) || isbn13CheckDigit(digits[:12]) != digits[12] {
+			return "", ErrInvalidIsbn
+		}
+		return digits, nil
+	}
+
+	return "", ErrInvalidIsbn
+}
+
+// Isbn10 returns the ISBN-10 of an ISBN-13, only those starting with 978 have one.
+func Isbn10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	return isbn13[3:12] + string(isbn10CheckDigit(isbn13[3:12])), true
+}
+
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func isbn13CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeIsbn(t *testing.T) {
+	testCases := []struct {
+		name    string
+		isbn    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Should keep an ISBN-13", isbn: "9788401490040", want: "9788401490040"},
+		{name: "Should remove hyphens and spaces", isbn: "978-0-553-41802 6", want: "9780553418026"},
+		{name: "Should convert an ISBN-10", isbn: "0-553-41802-5", want: "9780553418026"},
+		{name: "Should convert an ISBN-10 ending in X", isbn: "080442957X", want: "9780804429573"},
+		{name: "Should reject a wrong check digit", isbn: "9780553418027", wantErr: true},
+		{name: "Should reject a wrong ISBN-10 check digit", isbn: "0553418020", wantErr: true},
+		{name: "Should reject letters", isbn: "97805534180AB", wantErr: true},
+		{name: "Should reject other lengths", isbn: "12345", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeIsbn(tc.isbn)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidIsbn)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestIsbn10(t *testing.T) {
+	isbn10, ok := Isbn10("9780553418026")
+	assert.True(t, ok)
+	assert.Equal(t, "0553418025", isbn10)
+
+	_, ok = Isbn10("9791032305690")
+	assert.False(t, ok)
+}
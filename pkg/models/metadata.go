@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	MetadataSynopsis  = "synopsis"
+	MetadataYear      = "year"
+	MetadataRuntime   = "runtime_minutes"
+	MetadataPosterURL = "poster_url"
+)
+
+// MovieMetadata is filled in from an external movie database, Provenance tells where each field came from.
+type MovieMetadata struct {
+	MovieID        int64                 `json:"movie_id"`
+	Synopsis       string                `json:"synopsis,omitempty"`
+	Year           int                   `json:"year,omitempty"`
+	RuntimeMinutes int                   `json:"runtime_minutes,omitempty"`
+	PosterURL      string                `json:"poster_url,omitempty"`
+	Provenance     map[string]Provenance `json:"provenance"`
+}
+
+type Provenance struct {
+	// Source is the provider the value came from
+	Source string `json:"source"`
+	// SourceID is the id of the movie in the provider
+	SourceID  string    `json:"source_id,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
@@ -5,6 +5,34 @@ type Movie struct {
 	Isbn     string `json:"isbn"`
 	Title    string `json:"title"`
 	Director string `json:"director"`
+	// ExternalIDs are the ids of the movie in other catalogues, keyed by source
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+	Poster      *Poster           `json:"poster,omitempty"`
+	Rating      *Rating           `json:"rating,omitempty"`
+	// Translations of the title and synopsis in other languages
+	Translations []Translation `json:"translations,omitempty"`
+	// Language and Synopsis are set on movies localized for a request
+	Language string `json:"language,omitempty"`
+	Synopsis string `json:"synopsis,omitempty"`
+}
+
+// Poster holds where the poster of a movie and its thumbnail can be downloaded from
+type Poster struct {
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+const (
+	SourceIMDb = "imdb"
+	SourceTMDB = "tmdb"
+	SourceEIDR = "eidr"
+)
+
+func IsExternalSource(source string) bool {
+	return source == SourceIMDb || source == SourceTMDB || source == SourceEIDR
 }
 
 func (m Movie) IsEmpty() bool {
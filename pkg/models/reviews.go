@@ -0,0 +1,73 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+const (
+	MinReviewScore = 1
+	MaxReviewScore = 10
+	// maxReviewLength matches the size of the text column in the reviews table
+	maxReviewLength = 5000
+)
+
+// Review is the score a user gives to a movie, only approved reviews count towards its rating.
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    string    `json:"user_id"`
+	Score     int       `json:"score"`
+	Text      string    `json:"text"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r Review) Validate() error {
+	var errs []error
+	if r.Score < MinReviewScore || r.Score > MaxReviewScore {
+		errs = append(errs, fmt.Errorf("score must be between %d and %d", MinReviewScore, MaxReviewScore))
+	}
+	if len(r.Text) > maxReviewLength {
+		errs = append(errs, fmt.Errorf("text is longer than %d characters", maxReviewLength))
+	}
+	return errors.Join(errs...)
+}
+
+func IsReviewStatus(status string) bool {
+	return status == ReviewPending || status == ReviewApproved || status == ReviewRejected
+}
+
+// Rating aggregates the approved reviews of a movie, Histogram counts the reviews of each score.
+type Rating struct {
+	Average   float64     `json:"average"`
+	Count     int         `json:"count"`
+	Histogram map[int]int `json:"histogram"`
+}
+
+// NewRating returns the rating of the given number of reviews per score, its average rounded to two decimals.
+func NewRating(histogram map[int]int) *Rating {
+	rating := &Rating{Histogram: map[int]int{}}
+
+	sum := 0
+	for score := MinReviewScore; score <= MaxReviewScore; score++ {
+		count := histogram[score]
+		rating.Histogram[score] = count
+		rating.Count += count
+		sum += score * count
+	}
+
+	if rating.Count > 0 {
+		rating.Average = math.Round(float64(sum)*100/float64(rating.Count)) / 100
+	}
+	return rating
+}
@@ -0,0 +1,22 @@
+package models
+
+const (
+	// SimilarDirector means both movies have the same director
+	SimilarDirector = "director"
+	// SimilarCollections means both movies are often in the same collections
+	SimilarCollections = "collections"
+	// SimilarReviews means the users who liked one movie also liked the other
+	SimilarReviews = "reviews"
+	// RecommendedSimilar movies are similar to the ones the user liked or collected
+	RecommendedSimilar = "similar"
+	// RecommendedTopRated movies are recommended to users with nothing to go by
+	RecommendedTopRated = "top_rated"
+)
+
+// SimilarMovie is a movie related to another one, or recommended to a user, with a score from 0 to 1
+// and the reasons it was picked.
+type SimilarMovie struct {
+	Movie   Movie    `json:"movie"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+var ErrInvalidLanguage = errors.New("invalid language tag")
+
+const (
+	// maxLanguageLength matches the size of the language column in the movie_translations table
+	maxLanguageLength = 35
+	// maxSynopsisLength matches the size of the synopsis column in the movie_translations table
+	maxSynopsisLength = 5000
+)
+
+// Translation is the title and synopsis of a movie in the language of a BCP 47 tag, such as pt-BR
+type Translation struct {
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Synopsis string `json:"synopsis,omitempty"`
+}
+
+func (t Translation) Validate() error {
+	var errs []error
+	if _, err := NormalizeLanguage(t.Language); err != nil {
+		errs = append(errs, fmt.Errorf("%w %s", err, t.Language))
+	}
+	if t.Title == "" {
+		errs = append(errs, errors.New("title is required"))
+	} else if len(t.Title) > maxFieldLength {
+		errs = append(errs, fmt.Errorf("title is longer than %d characters", maxFieldLength))
+	}
+	if len(t.Synopsis) > maxSynopsisLength {
+		errs = append(errs, fmt.Errorf("synopsis is longer than %d characters", maxSynopsisLength))
+	}
+	return errors.Join(errs...)
+}
+
+// NormalizeLanguage returns the canonical form of a BCP 47 language tag, so pt-br and pt_BR are both pt-BR.
+// It returns ErrInvalidLanguage when the tag is not well formed or names no language.
+func NormalizeLanguage(tag string) (string, error) {
+	if tag == "" || len(tag) > maxLanguageLength {
+		return "", ErrInvalidLanguage
+	}
+
+	parsed, err := language.Parse(tag)
+	if err != nil {
+		return "", ErrInvalidLanguage
+	}
+	if _, confidence := parsed.Base(); confidence != language.Exact {
+		return "", ErrInvalidLanguage
+	}
+	return parsed.String(), nil
+}
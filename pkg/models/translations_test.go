@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{name: "Should keep a language", tag: "fr", want: "fr"},
+		{name: "Should keep a language and region", tag: "pt-BR", want: "pt-BR"},
+		{name: "Should fix the case", tag: "PT-br", want: "pt-BR"},
+		{name: "Should accept underscores", tag: "pt_BR", want: "pt-BR"},
+		{name: "Should keep a script", tag: "zh-hant-tw", want: "zh-Hant-TW"},
+		{name: "Should reject an empty tag", tag: "", wantErr: true},
+		{name: "Should reject an undetermined language", tag: "und", wantErr: true},
+		{name: "Should reject a malformed tag", tag: "portuguese-brazil!", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeLanguage(tc.tag)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLanguage)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTranslationValidate(t *testing.T) {
+	assert.NoError(t, Translation{Language: "pt-BR", Title: "Tubarão"}.Validate())
+
+	err := Translation{Language: "xx-!", Synopsis: string(make([]byte, maxSynopsisLength+1))}.Validate()
+	assert.ErrorIs(t, err, ErrInvalidLanguage)
+	assert.ErrorContains(t, err, "title is required")
+	assert.ErrorContains(t, err, "synopsis is longer than 5000 characters")
+}
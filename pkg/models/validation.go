@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// maxFieldLength matches the size of the columns in the movies table
+const maxFieldLength = 128
+
+func (m Movie) Validate() error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"isbn", m.Isbn},
+		{"title", m.Title},
+		{"director", m.Director},
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", f.name))
+		} else if len(f.value) > maxFieldLength {
+			errs = append(errs, fmt.Errorf("%s is longer than %d characters", f.name, maxFieldLength))
+		}
+	}
+
+	sources := make([]string, 0, len(m.ExternalIDs))
+	for source := range m.ExternalIDs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		id := m.ExternalIDs[source]
+		if !IsExternalSource(source) {
+			errs = append(errs, fmt.Errorf("unknown external id source %s", source))
+		} else if id == "" || len(id) > maxFieldLength {
+			errs = append(errs, fmt.Errorf("%s id must have between 1 and %d characters", source, maxFieldLength))
+		}
+	}
+
+	languages := map[string]bool{}
+	for _, translation := range m.Translations {
+		if err := translation.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("translation %s: %w", translation.Language, err))
+			continue
+		}
+
+		language, _ := NormalizeLanguage(translation.Language)
+		if languages[language] {
+			errs = append(errs, fmt.Errorf("translation %s is repeated", language))
+		}
+		languages[language] = true
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,7 @@
+// Package proto embeds the .proto sources so they can be registered as schemas.
+package proto
+
+import "embed"
+
+//go:embed *.proto
+var Files embed.FS
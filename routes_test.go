@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iamthiago/movies-crud/internal/movies/apitest"
+	"github.com/iamthiago/movies-crud/internal/movies/changes"
+	"github.com/iamthiago/movies-crud/internal/movies/repository"
+	"github.com/iamthiago/movies-crud/internal/movies/tenant"
+	"github.com/iamthiago/movies-crud/pkg/models"
+)
+
+// seed adds Jaws, translated to portuguese and spanish, and Alien, with ids 1 and 2, to the default tenant
+func seed(t *testing.T, movies *repository.MemoryDB) {
+	catalogue := &repository.MemoryRepository{DB: movies, Tenant: "default"}
+	_, err := catalogue.CreateMovie(&models.Movie{
+		Isbn:        "9788401490040",
+		Title:       "Jaws",
+		Director:    "Steven Spielberg",
+		ExternalIDs: map[string]string{models.SourceIMDb: "tt0073195"},
+		Translations: []models.Translation{
+			{Language: "pt-BR", Title: "Tubarão", Synopsis: "Um tubarão aterroriza uma pequena cidade."},
+			{Language: "es", Title: "Tiburón"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = catalogue.CreateMovie(&models.Movie{Isbn: "9780000000002", Title: "Alien", Director: "Ridley Scott"})
+	require.NoError(t, err)
+}
+
+// TestRoutes sends every request through the router of main, with the tenant and OpenAPI middlewares,
+// to a memory catalogue holding seed, and compares the response with testdata/<name>.golden.
+// go test -update rewrites the golden files after a change of the api.
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		// failing keeps the movies in a database that is down
+		failing bool
+		status  int
+		// header is expected among the headers of the response
+		header map[string]string
+	}{
+		{name: "list_movies", method: "GET", path: "/movies", status: http.StatusOK,
+			header: map[string]string{"Content-Type": "application/json", "Content-Language": "en", "Vary": "Accept-Language"}},
+		{name: "list_movies_in_portuguese", method: "GET", path: "/movies", headers: map[string]string{"Accept-Language": "pt-BR,pt;q=0.9"},
+			status: http.StatusOK, header: map[string]string{"Content-Language": "pt-BR, en"}},
+		{name: "list_movies_available_without_windows", method: "GET", path: "/movies?available_in=BR", status: http.StatusNotImplemented},
+		{name: "list_movies_on_without_region", method: "GET", path: "/movies?on=2026-10-18", status: http.StatusBadRequest},
+		{name: "list_movies_failing", method: "GET", path: "/movies", failing: true, status: http.StatusInternalServerError},
+
+		{name: "get_movie", method: "GET", path: "/movies/1", status: http.StatusOK},
+		{name: "get_movie_in_spanish", method: "GET", path: "/movies/1", headers: map[string]string{"Accept-Language": "es-MX"},
+			status: http.StatusOK, header: map[string]string{"Content-Language": "es"}},
+		{name: "get_movie_not_found", method: "GET", path: "/movies/99", status: http.StatusNotFound},
+		{name: "get_movie_invalid_id", method: "GET", path: "/movies/jaws", status: http.StatusBadRequest},
+		{name: "get_movie_failing", method: "GET", path: "/movies/1", failing: true, status: http.StatusInternalServerError},
+
+		{name: "get_movie_by_isbn", method: "GET", path: "/movies/isbn/9788401490040", status: http.StatusOK},
+		{name: "get_movie_by_isbn_not_found", method: "GET", path: "/movies/isbn/9780000000019", status: http.StatusNotFound},
+		{name: "get_movie_by_isbn_invalid", method: "GET", path: "/movies/isbn/123", status: http.StatusBadRequest},
+
+		{name: "get_movie_by_external_id", method: "GET", path: "/movies/by-external/imdb/tt0073195", status: http.StatusOK},
+		{name: "get_movie_by_external_id_not_found", method: "GET", path: "/movies/by-external/imdb/tt0078748", status: http.StatusNotFound},
+		{name: "get_movie_by_external_id_unknown_source", method: "GET", path: "/movies/by-external/letterboxd/jaws", status: http.StatusBadRequest},
+
+		{name: "create_movie", method: "POST", path: "/movies", body: `{"isbn": "9780000000019", "title": "Heat", "director": "Michael Mann"}`,
+			status: http.StatusOK},
+		{name: "create_movie_duplicate_isbn", method: "POST", path: "/movies", body: `{"isbn": "9788401490040", "title": "Jaws 2"}`,
+			status: http.StatusConflict},
+		{name: "create_movie_duplicate_external_id", method: "POST", path: "/movies",
+			body: `{"isbn": "9780000000019", "title": "Heat", "external_ids": {"imdb": "tt0073195"}}`, status: http.StatusConflict},
+		{name: "create_movie_invalid_language", method: "POST", path: "/movies",
+			body: `{"isbn": "9780000000019", "title": "Heat", "translations": [{"language": "english!", "title": "Heat"}]}`, status: http.StatusBadRequest},
+		{name: "create_movie_invalid_isbn", method: "POST", path: "/movies", body: `{"isbn": "9780000000018", "title": "Heat"}`,
+			status: http.StatusBadRequest},
+		{name: "create_movie_not_described", method: "POST", path: "/movies", body: `{"isbn": 9780000000019, "title": "Heat"}`,
+			status: http.StatusBadRequest},
+		{name: "create_movie_failing", method: "POST", path: "/movies", body: `{"isbn": "9780000000019", "title": "Heat"}`,
+			failing: true, status: http.StatusInternalServerError},
+
+		{name: "update_movie", method: "PUT", path: "/movies/2", body: `{"isbn": "9780000000002", "title": "Aliens", "director": "James Cameron"}`,
+			status: http.StatusOK},
+		{name: "update_movie_not_found", method: "PUT", path: "/movies/99", body: `{"isbn": "9780000000019", "title": "Heat"}`,
+			status: http.StatusNotFound},
+		{name: "update_movie_duplicate_isbn", method: "PUT", path: "/movies/2", body: `{"isbn": "9788401490040", "title": "Alien"}`,
+			status: http.StatusConflict},
+		{name: "update_movie_invalid_id", method: "PUT", path: "/movies/alien", body: `{"isbn": "9780000000002", "title": "Alien"}`,
+			status: http.StatusBadRequest},
+		{name: "update_movie_failing", method: "PUT", path: "/movies/2", body: `{"isbn": "9780000000002", "title": "Alien"}`,
+			failing: true, status: http.StatusInternalServerError},
+
+		{name: "upsert_movie_created", method: "PUT", path: "/movies/isbn/9780000000019", body: `{"title": "Heat", "director": "Michael Mann"}`,
+			status: http.StatusCreated, header: map[string]string{"Location": "/movies/3"}},
+		{name: "upsert_movie_replaced", method: "PUT", path: "/movies/isbn/9780000000002", body: `{"title": "Aliens", "director": "James Cameron"}`,
+			status: http.StatusOK},
+		{name: "upsert_movie_hyphenated_isbn", method: "PUT", path: "/movies/isbn/978-0-00-000001-9", body: `{"isbn": "9780000000019", "title": "Heat", "director": "Michael Mann"}`,
+			status: http.StatusCreated, header: map[string]string{"Location": "/movies/3"}},
+		{name: "upsert_movie_invalid_isbn", method: "PUT", path: "/movies/isbn/123", body: `{"title": "Heat", "director": "Michael Mann"}`,
+			status: http.StatusBadRequest},
+		{name: "upsert_movie_isbn_mismatch", method: "PUT", path: "/movies/isbn/9780000000002", body: `{"isbn": "9788401490040", "title": "Jaws"}`,
+			status: http.StatusBadRequest},
+		{name: "upsert_movie_invalid_body", method: "PUT", path: "/movies/isbn/9780000000002", body: `{"title": `, status: http.StatusBadRequest},
+		{name: "upsert_movie_invalid_movie", method: "PUT", path: "/movies/isbn/9780000000002", body: `{"director": "Ridley Scott"}`,
+			status: http.StatusBadRequest},
+
+		{name: "delete_movie", method: "DELETE", path: "/movies/1", status: http.StatusOK},
+		{name: "delete_movie_invalid_id", method: "DELETE", path: "/movies/jaws", status: http.StatusBadRequest},
+		{name: "delete_movie_failing", method: "DELETE", path: "/movies/1", failing: true, status: http.StatusInternalServerError},
+
+		{name: "batch_movies", method: "POST", path: "/movies:batch", status: http.StatusOK,
+			body: `{"operations": [{"op": "create", "movie": {"isbn": "9780000000019", "title": "Heat"}}, {"op": "update", "id": 99, "movie": {"isbn": "9780000000026", "title": "Ran"}}, {"op": "delete", "id": 2}]}`},
+		{name: "batch_movies_atomic_aborted", method: "POST", path: "/movies:batch", status: http.StatusUnprocessableEntity,
+			body: `{"atomic": true, "operations": [{"op": "create", "movie": {"isbn": "9780000000019", "title": "Heat"}}, {"op": "create", "movie": {"isbn": "9788401490040", "title": "Jaws 2"}}]}`},
+		{name: "batch_movies_empty", method: "POST", path: "/movies:batch", body: `{"operations": []}`, status: http.StatusBadRequest},
+		{name: "batch_movies_too_many", method: "POST", path: "/movies:batch", status: http.StatusRequestEntityTooLarge,
+			body: `{"operations": [{"op": "delete", "id": 1}, {"op": "delete", "id": 2}, {"op": "delete", "id": 3}, {"op": "delete", "id": 4}]}`},
+		{name: "batch_movies_invalid_body", method: "POST", path: "/movies:batch", body: `[]`, status: http.StatusBadRequest},
+
+		{name: "export_movies_csv", method: "GET", path: "/movies/export", status: http.StatusOK,
+			header: map[string]string{"Content-Type": "text/csv", "Content-Disposition": "attachment; filename=movies.csv"}},
+		{name: "export_movies_ndjson", method: "GET", path: "/movies/export?format=ndjson", status: http.StatusOK,
+			header: map[string]string{"Content-Type": "application/x-ndjson"}},
+		{name: "export_movies_unknown_format", method: "GET", path: "/movies/export?format=xml", status: http.StatusBadRequest},
+
+		{name: "import_movies", method: "POST", path: "/movies/import", headers: map[string]string{"Content-Type": "application/x-ndjson"},
+			body:   "{\"isbn\": \"9780000000019\", \"title\": \"Heat\", \"director\": \"Michael Mann\"}\n{\"isbn\": \"9788401490040\", \"title\": \"Jaws\"}\n",
+			status: http.StatusOK},
+		{name: "import_movies_unknown_format", method: "POST", path: "/movies/import", body: "isbn,title\n", status: http.StatusBadRequest},
+
+		{name: "list_translations", method: "GET", path: "/movies/1/translations", status: http.StatusOK},
+		{name: "list_translations_none", method: "GET", path: "/movies/2/translations", status: http.StatusOK},
+		{name: "list_translations_movie_not_found", method: "GET", path: "/movies/99/translations", status: http.StatusNotFound},
+		{name: "get_translation", method: "GET", path: "/movies/1/translations/pt-br", status: http.StatusOK,
+			header: map[string]string{"Content-Language": "pt-BR"}},
+		{name: "get_translation_not_found", method: "GET", path: "/movies/1/translations/fr", status: http.StatusNotFound},
+		{name: "get_translation_invalid_language", method: "GET", path: "/movies/1/translations/english!", status: http.StatusBadRequest},
+		{name: "save_translation_created", method: "PUT", path: "/movies/2/translations/fr", body: `{"title": "Alien, le huitième passager"}`,
+			status: http.StatusCreated, header: map[string]string{"Location": "/movies/2/translations/fr"}},
+		{name: "save_translation_replaced", method: "PUT", path: "/movies/1/translations/es", body: `{"title": "Tiburón", "synopsis": "Un tiburón aterroriza un pueblo."}`,
+			status: http.StatusOK},
+		{name: "save_translation_movie_not_found", method: "PUT", path: "/movies/99/translations/fr", body: `{"title": "Les Dents de la mer"}`,
+			status: http.StatusNotFound},
+		{name: "save_translation_invalid_body", method: "PUT", path: "/movies/1/translations/fr", body: `"Les Dents de la mer"`, status: http.StatusBadRequest},
+		{name: "delete_translation", method: "DELETE", path: "/movies/1/translations/es", status: http.StatusNoContent},
+		{name: "delete_translation_not_found", method: "DELETE", path: "/movies/1/translations/fr", status: http.StatusNotFound},
+		{name: "translations_failing", method: "GET", path: "/movies/1/translations", failing: true, status: http.StatusInternalServerError},
+
+		{name: "list_movies_of_another_tenant", method: "GET", path: "/movies", headers: map[string]string{tenant.Header: "studio-b"},
+			status: http.StatusOK},
+		{name: "get_movie_of_another_tenant", method: "GET", path: "/movies/1", headers: map[string]string{tenant.Header: "studio-b"},
+			status: http.StatusNotFound},
+		{name: "invalid_tenant", method: "GET", path: "/movies", headers: map[string]string{tenant.Header: "Studio B!"},
+			status: http.StatusBadRequest},
+
+		{name: "method_not_allowed", method: "PATCH", path: "/movies/1", status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, "protobuf")
+			seed(t, s.movies)
+			if tc.failing {
+				s = newFailingServer(t)
+			}
+
+			rec := apitest.Send(t, s.router(), tc.method, tc.path, tc.body, tc.headers)
+
+			assert.Equal(t, tc.status, rec.Code)
+			for name, value := range tc.header {
+				assert.Equal(t, value, rec.Header().Get(name), name)
+			}
+			assertGolden(t, tc.name, rec.Body.Bytes())
+		})
+	}
+}
+
+// TestGetMovieNotFound is the request that used to panic, the service returning no movie with its error
+func TestGetMovieNotFound(t *testing.T) {
+	rec := apitest.Send(t, newTestServer(t, "protobuf").router(), "GET", "/movies/1", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error": "movie not found"}`, rec.Body.String())
+}
+
+func TestRoutesChangeTheCatalogue(t *testing.T) {
+	s := newTestServer(t, "protobuf")
+	seed(t, s.movies)
+	router := s.router()
+
+	rec := apitest.Send(t, router, "PUT", "/movies/2", `{"isbn": "9780000000002", "title": "Aliens", "director": "James Cameron"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = apitest.Send(t, router, "DELETE", "/movies/1", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	movies, err := (&repository.MemoryRepository{DB: s.movies, Tenant: "default"}).GetMovies()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Movie{{ID: 2, Isbn: "9780000000002", Title: "Aliens", Director: "James Cameron"}}, movies)
+
+	rec = apitest.Send(t, router, "GET", "/movies/1", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDocs(t *testing.T) {
+	router := newTestServer(t, "protobuf").router()
+
+	rec := apitest.Send(t, router, "GET", "/openapi.json", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/movies/{id}")
+
+	rec = apitest.Send(t, router, "GET", "/docs", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `spec-url="/openapi.json"`)
+}
+
+// TestMySQLOnlyRoutes checks that the routes of the features keeping their data in mysql answer 501 on memory storage.
+// Their repositories only have mysql queries, so the router can't serve them here: what they do is covered
+// by the tests of their packages, and of their controllers, with the repositories faked.
+func TestMySQLOnlyRoutes(t *testing.T) {
+	router := newTestServer(t, "protobuf").router()
+
+	requests := []struct {
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+	}{
+		{method: "POST", path: "/movies/export", body: `{"format": "csv"}`},
+		{method: "POST", path: "/movies/import?async=true", body: "isbn,title\n", headers: map[string]string{"Content-Type": "text/csv"}},
+		{method: "POST", path: "/movies/reindex"},
+
+		{method: "PUT", path: "/movies/1/poster", body: "\x89PNG", headers: map[string]string{"Content-Type": "image/png"}},
+		{method: "DELETE", path: "/movies/1/poster"},
+
+		{method: "GET", path: "/movies/1/releases"},
+		{method: "POST", path: "/movies/1/releases", body: `{"country": "BR", "type": "theatrical", "date": "2026-10-18"}`},
+		{method: "PUT", path: "/movies/1/releases/1", body: `{"country": "BR", "type": "theatrical", "date": "2026-10-18"}`},
+		{method: "DELETE", path: "/movies/1/releases/1"},
+		{method: "GET", path: "/movies/1/availability"},
+		{method: "POST", path: "/movies/1/availability", body: `{"region": "BR", "platform": "streamflix", "start": "2026-10-18T00:00:00Z"}`},
+		{method: "PUT", path: "/movies/1/availability/1", body: `{"region": "BR", "platform": "streamflix", "start": "2026-10-18T00:00:00Z"}`},
+		{method: "DELETE", path: "/movies/1/availability/1"},
+
+		{method: "GET", path: "/movies/1/reviews"},
+		{method: "POST", path: "/movies/1/reviews", body: `{"score": 9, "text": "Still scary"}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "GET", path: "/movies/1/reviews/1"},
+		{method: "PUT", path: "/movies/1/reviews/1", body: `{"score": 8, "text": "Still scary"}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "DELETE", path: "/movies/1/reviews/1", headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "PUT", path: "/movies/1/reviews/1/status", body: `{"status": "approved"}`,
+			headers: map[string]string{"X-User-ID": "bruno", "X-User-Roles": "moderator"}},
+
+		{method: "GET", path: "/movies/1/similar"},
+		{method: "GET", path: "/users/ana/recommendations"},
+		{method: "GET", path: "/movies/1/metadata"},
+		{method: "POST", path: "/movies/1/enrich"},
+
+		{method: "GET", path: "/collections", headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "POST", path: "/collections", body: `{"name": "Sharks"}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "GET", path: "/collections/shared/sharks"},
+		{method: "GET", path: "/collections/1", headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "PUT", path: "/collections/1", body: `{"name": "Sharks"}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "DELETE", path: "/collections/1", headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "POST", path: "/collections/1/items", body: `{"movie_id": 1}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "PUT", path: "/collections/1/items", body: `{"movie_ids": [1]}`, headers: map[string]string{"X-User-ID": "ana"}},
+		{method: "DELETE", path: "/collections/1/items/1", headers: map[string]string{"X-User-ID": "ana"}},
+
+		{method: "GET", path: "/webhooks"},
+		{method: "POST", path: "/webhooks", body: `{"url": "https://example.com/hook", "events": ["created"]}`},
+		{method: "GET", path: "/webhooks/1"},
+		{method: "PUT", path: "/webhooks/1", body: `{"url": "https://example.com/hook", "events": ["created"]}`},
+		{method: "DELETE", path: "/webhooks/1"},
+		{method: "GET", path: "/webhooks/1/deliveries"},
+
+		{method: "GET", path: "/jobs"},
+		{method: "GET", path: "/jobs/1"},
+		{method: "POST", path: "/jobs/1/cancel"},
+		{method: "GET", path: "/jobs/1/result"},
+
+		{method: "POST", path: "/movies", body: `{"isbn": "9780000000019", "title": "Heat"}`,
+			headers: map[string]string{"Idempotency-Key": "5d1c0f0e-8d1f-4b1a-9a53-2f4a1f0b6c11"}},
+	}
+
+	for _, req := range requests {
+		t.Run(req.method+" "+req.path, func(t *testing.T) {
+			rec := apitest.Send(t, router, req.method, req.path, req.body, req.headers)
+			assert.Equal(t, http.StatusNotImplemented, rec.Code, rec.Body.String())
+			assertGolden(t, "unsupported", rec.Body.Bytes())
+		})
+	}
+}
+
+// TestStreamRoutes follows the changes of a tenant while its movies are changed through the router
+func TestStreamRoutes(t *testing.T) {
+	s := newTestServer(t, "protobuf")
+	router := s.router()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	studioA := map[string]string{tenant.Header: "studio-a"}
+
+	req, err := http.NewRequest("GET", server.URL+"/movies/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set(tenant.Header, "studio-a")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the headers are sent once subscribed
+	apitest.Send(t, router, "POST", "/movies", `{"isbn": "9780000000002", "title": "Alien"}`, map[string]string{tenant.Header: "studio-b"})
+	apitest.Send(t, router, "POST", "/movies", `{"isbn": "9788401490040", "title": "Jaws"}`, studioA)
+
+	created := readChange(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, changes.Created, created.Type)
+	assert.Equal(t, "Jaws", created.Movie.Title)
+
+	t.Run("Should replay the changes over a websocket", func(t *testing.T) {
+		rec := apitest.Send(t, router, "PUT", fmt.Sprintf("/movies/%d", created.Movie.ID), `{"isbn": "9788401490040", "title": "Jaws 2"}`, studioA)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/movies/stream/ws?last_event_id=" + strconv.FormatUint(created.ID, 10)
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{tenant.Header: []string{"studio-a"}})
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+		var updated changes.Change
+		require.NoError(t, conn.ReadJSON(&updated))
+		assert.Equal(t, changes.Updated, updated.Type)
+		assert.Equal(t, "Jaws 2", updated.Movie.Title)
+	})
+}
+
+// readChange reads the data of the next event of the stream, skipping the comments
+func readChange(t *testing.T, reader *bufio.Reader) changes.Change {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		if data, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "data: "); ok {
+			var change changes.Change
+			require.NoError(t, json.Unmarshal([]byte(data), &change))
+			return change
+		}
+	}
+}
+
+// TestMediaRoute serves the uploaded files of every tenant, as browsers download them without the tenant.
+// The keys have slashes, which a path parameter of the OpenAPI description can't match, so the responses aren't checked against it.
+func TestMediaRoute(t *testing.T) {
+	s := newTestServer(t, "protobuf")
+	path := filepath.Join(s.cfg.MediaDir, "posters", "1", "jaws.png")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("\x89PNG"), 0o644))
+	router := s.router()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/media/posters/1/jaws.png", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "\x89PNG", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/media/posters/1/alien.png", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}